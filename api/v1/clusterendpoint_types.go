@@ -0,0 +1,60 @@
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ClusterEndpointSpec defines the desired state of ClusterEndpoint
+type ClusterEndpointSpec struct {
+	// The frpc of the cluster endpoint runs in the controller's cluster resource namespace,
+	// the token secret is resolved in the same namespace.
+	EndpointSpec `json:",inline"`
+
+	// NamespaceSelector selects the namespaces whose services may bind to the cluster endpoint.
+	// An empty selector selects all namespaces.
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterEndpoint is the Schema for the clusterendpoints API
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+// +kubebuilder:printcolumn:name="Config",type=string,JSONPath=`.status.conditions[?(@.type=="ConfigGenerated")].status`
+// +kubebuilder:printcolumn:name="Pod",type=string,JSONPath=`.status.conditions[?(@.type=="ClientPodReady")].status`
+// +kubebuilder:printcolumn:name="Server",type=string,JSONPath=`.status.conditions[?(@.type=="ServerReachable")].status`
+// +kubebuilder:printcolumn:name="Proxies",type=string,JSONPath=`.status.conditions[?(@.type=="ProxiesRegistered")].status`
+// +kubebuilder:printcolumn:name="Message",type=string,priority=1,JSONPath=`.status.conditions[?(@.status!="True")].message`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type ClusterEndpoint struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterEndpointSpec `json:"spec,omitempty"`
+	Status EndpointStatus      `json:"status,omitempty"`
+}
+
+// AllowsNamespace tells if services in the namespace may bind to the cluster endpoint.
+func (e *ClusterEndpoint) AllowsNamespace(namespace *corev1.Namespace) (bool, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&e.Spec.NamespaceSelector)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(namespace.Labels)), nil
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterEndpointList contains a list of ClusterEndpoint
+type ClusterEndpointList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterEndpoint `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterEndpoint{}, &ClusterEndpointList{})
+}
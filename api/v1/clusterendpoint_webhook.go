@@ -0,0 +1,61 @@
+package v1
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func (r *ClusterEndpoint) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-frp-go-build4-fun-v1-clusterendpoint,mutating=true,failurePolicy=fail,groups=frp.go.build4.fun,resources=clusterendpoints,verbs=create;update,versions=v1,name=mclusterendpoint.frp.go.build4.fun,admissionReviewVersions=v1,sideEffects=None
+
+var _ webhook.Defaulter = &ClusterEndpoint{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *ClusterEndpoint) Default() {
+	r.Spec.defaultSpec()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-frp-go-build4-fun-v1-clusterendpoint,mutating=false,failurePolicy=fail,groups=frp.go.build4.fun,resources=clusterendpoints,versions=v1,name=vclusterendpoint.frp.go.build4.fun,admissionReviewVersions=v1,sideEffects=None
+
+var _ webhook.Validator = &ClusterEndpoint{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterEndpoint) ValidateCreate() (admission.Warnings, error) {
+	return nil, r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterEndpoint) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	return nil, r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *ClusterEndpoint) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (r *ClusterEndpoint) validate() error {
+	specPath := field.NewPath("spec")
+	allErrs := r.Spec.validateSpec(specPath)
+
+	if _, err := metav1.LabelSelectorAsSelector(&r.Spec.NamespaceSelector); err != nil {
+		allErrs = append(allErrs, field.Invalid(
+			specPath.Child("namespaceSelector"), r.Spec.NamespaceSelector, err.Error(),
+		))
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("ClusterEndpoint").GroupKind(), r.Name, allErrs)
+}
@@ -0,0 +1,94 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionType defines the type of a condition.
+type ConditionType string
+
+const (
+	// ConditionConfigGenerated tells if the frpc config has been generated.
+	ConditionConfigGenerated ConditionType = "ConfigGenerated"
+	// ConditionClientPodReady tells if the frpc pods are running.
+	ConditionClientPodReady ConditionType = "ClientPodReady"
+	// ConditionServerReachable tells if the frpc has logged in to the frp server.
+	ConditionServerReachable ConditionType = "ServerReachable"
+	// ConditionProxiesRegistered tells if the proxies have been registered to the frp server.
+	ConditionProxiesRegistered ConditionType = "ProxiesRegistered"
+	// ConditionRemotePortsAllocated tells if the remote ports of the service have been allocated without conflicts.
+	ConditionRemotePortsAllocated ConditionType = "RemotePortsAllocated"
+	// ConditionServerPodReady tells if the frps pods are running.
+	ConditionServerPodReady ConditionType = "ServerPodReady"
+	// ConditionAddressAssigned tells if the frps service has been assigned with the public address.
+	ConditionAddressAssigned ConditionType = "AddressAssigned"
+	// ConditionPortAvailable tells if the port of the visitor can be bound by the frpc without conflicts.
+	ConditionPortAvailable ConditionType = "PortAvailable"
+	// ConditionDeletionBlocked tells if the deletion is blocked by the referencing resources.
+	ConditionDeletionBlocked ConditionType = "DeletionBlocked"
+)
+
+// Condition describes an aspect of the current state of a resource.
+// It follows the `metav1.Condition` convention.
+type Condition struct {
+	// Type of the condition.
+	Type ConditionType `json:"type"`
+
+	// +kubebuilder:validation:Enum=True;False;Unknown
+
+	// Status of the condition, one of True, False, Unknown.
+	Status metav1.ConditionStatus `json:"status"`
+
+	// ObservedGeneration tells the .metadata.generation that the condition was set based upon.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastTransitionTime tells the last time the condition transitioned from one status to another.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+
+	// Reason contains a programmatic identifier indicating the reason for the condition's last transition.
+	Reason string `json:"reason"`
+
+	// Message is a human readable message indicating details about the transition.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// FindCondition finds the condition with given type.
+// Returns nil if not found.
+func FindCondition(conditions []Condition, conditionType ConditionType) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or updates the condition in conditions.
+// LastTransitionTime is only updated when the status changed.
+func SetCondition(conditions *[]Condition, condition Condition) {
+	if condition.LastTransitionTime.IsZero() {
+		condition.LastTransitionTime = metav1.Now()
+	}
+
+	existed := FindCondition(*conditions, condition.Type)
+	if existed == nil {
+		*conditions = append(*conditions, condition)
+		return
+	}
+
+	if existed.Status != condition.Status {
+		existed.Status = condition.Status
+		existed.LastTransitionTime = condition.LastTransitionTime
+	}
+	existed.ObservedGeneration = condition.ObservedGeneration
+	existed.Reason = condition.Reason
+	existed.Message = condition.Message
+}
+
+// IsConditionTrue tells if the condition with given type is true.
+func IsConditionTrue(conditions []Condition, conditionType ConditionType) bool {
+	condition := FindCondition(conditions, conditionType)
+	return condition != nil && condition.Status == metav1.ConditionTrue
+}
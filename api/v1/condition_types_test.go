@@ -0,0 +1,60 @@
+package v1
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetCondition(t *testing.T) {
+	var conditions []Condition
+
+	t0 := metav1.NewTime(time.Unix(1000, 0))
+	SetCondition(&conditions, Condition{
+		Type:               ConditionConfigGenerated,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: 1,
+		LastTransitionTime: t0,
+		Reason:             "Failed",
+		Message:            "token not found",
+	})
+	if len(conditions) != 1 {
+		t.Fatalf("expected 1 condition, got %d", len(conditions))
+	}
+
+	t1 := metav1.NewTime(time.Unix(2000, 0))
+	SetCondition(&conditions, Condition{
+		Type:               ConditionConfigGenerated,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: 2,
+		LastTransitionTime: t1,
+		Reason:             "Failed",
+		Message:            "secret not found",
+	})
+	condition := FindCondition(conditions, ConditionConfigGenerated)
+	if !condition.LastTransitionTime.Equal(&t0) {
+		t.Errorf("transition time should not change without status change")
+	}
+	if condition.ObservedGeneration != 2 || condition.Message != "secret not found" {
+		t.Errorf("unexpected condition: %+v", condition)
+	}
+
+	SetCondition(&conditions, Condition{
+		Type:               ConditionConfigGenerated,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: 2,
+		LastTransitionTime: t1,
+		Reason:             "Generated",
+	})
+	condition = FindCondition(conditions, ConditionConfigGenerated)
+	if !condition.LastTransitionTime.Equal(&t1) {
+		t.Errorf("transition time should change with status change")
+	}
+	if !IsConditionTrue(conditions, ConditionConfigGenerated) {
+		t.Errorf("condition should be true")
+	}
+	if IsConditionTrue(conditions, ConditionServerReachable) {
+		t.Errorf("missing condition should not be true")
+	}
+}
@@ -0,0 +1,52 @@
+package v1
+
+import (
+	"testing"
+)
+
+func TestEndpointSpec_GetConfigFormat(t *testing.T) {
+	cases := []struct {
+		name     string
+		spec     EndpointSpec
+		expected ConfigFormat
+	}{
+		{
+			name:     "default",
+			spec:     EndpointSpec{},
+			expected: ConfigFormatINI,
+		},
+		{
+			name:     "legacy version",
+			spec:     EndpointSpec{FrpVersion: "0.51.3"},
+			expected: ConfigFormatINI,
+		},
+		{
+			name:     "v1 config version",
+			spec:     EndpointSpec{FrpVersion: "v0.52.0"},
+			expected: ConfigFormatTOML,
+		},
+		{
+			name:     "newer major version",
+			spec:     EndpointSpec{FrpVersion: "1.0.0"},
+			expected: ConfigFormatTOML,
+		},
+		{
+			name:     "invalid version",
+			spec:     EndpointSpec{FrpVersion: "latest"},
+			expected: ConfigFormatINI,
+		},
+		{
+			name:     "explicit format",
+			spec:     EndpointSpec{FrpVersion: "0.52.0", ConfigFormat: ConfigFormatYAML},
+			expected: ConfigFormatYAML,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if format := c.spec.GetConfigFormat(); format != c.expected {
+				t.Errorf("expected %s, got %s", c.expected, format)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package v1
+
+import (
+	"fmt"
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/b4fun/frpcontroller/pkg/portalloc"
+)
+
+func (r *Endpoint) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-frp-go-build4-fun-v1-endpoint,mutating=true,failurePolicy=fail,groups=frp.go.build4.fun,resources=endpoints,verbs=create;update,versions=v1,name=mendpoint.frp.go.build4.fun,admissionReviewVersions=v1,sideEffects=None
+
+var _ webhook.Defaulter = &Endpoint{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *Endpoint) Default() {
+	r.Spec.defaultSpec()
+}
+
+func (s *EndpointSpec) defaultSpec() {
+	if s.DeletionPolicy == "" {
+		s.DeletionPolicy = EndpointDeletionPolicyOrphan
+	}
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-frp-go-build4-fun-v1-endpoint,mutating=false,failurePolicy=fail,groups=frp.go.build4.fun,resources=endpoints,versions=v1,name=vendpoint.frp.go.build4.fun,admissionReviewVersions=v1,sideEffects=None
+
+var _ webhook.Validator = &Endpoint{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Endpoint) ValidateCreate() (admission.Warnings, error) {
+	return nil, r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *Endpoint) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	return nil, r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *Endpoint) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (r *Endpoint) validate() error {
+	allErrs := r.Spec.validateSpec(field.NewPath("spec"))
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Endpoint").GroupKind(), r.Name, allErrs)
+}
+
+func (s *EndpointSpec) validateSpec(specPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if s.Addr == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("addr"), "addr should not be empty"))
+	}
+	if !isValidPort(s.Port) {
+		allErrs = append(allErrs, field.Invalid(
+			specPath.Child("port"), s.Port, "port should be in range 1-65535",
+		))
+	}
+	if _, err := portalloc.ParseRanges(s.AllowedPorts); err != nil {
+		allErrs = append(allErrs, field.Invalid(
+			specPath.Child("allowedPorts"), s.AllowedPorts, err.Error(),
+		))
+	}
+	if tls := s.TLS; tls != nil {
+		tlsPath := specPath.Child("tls")
+		if ref := tls.TrustedCASecretRef; ref != nil {
+			allErrs = append(allErrs, validateSecretKeySelector(tlsPath.Child("trustedCASecretRef"), ref)...)
+		}
+		if ref := tls.ClientCertSecretRef; ref != nil && ref.Name == "" {
+			allErrs = append(allErrs, field.Required(
+				tlsPath.Child("clientCertSecretRef", "name"), "secret name should not be empty",
+			))
+		}
+		if !tls.Enabled && (tls.TrustedCASecretRef != nil || tls.ClientCertSecretRef != nil) {
+			allErrs = append(allErrs, field.Invalid(
+				tlsPath.Child("enabled"), tls.Enabled, "certificates are specified but TLS is disabled",
+			))
+		}
+	}
+	if transport := s.Transport; transport != nil {
+		allErrs = append(allErrs, s.validateTransport(specPath.Child("transport"))...)
+	}
+	if ref := s.TokenSecretRef; ref != nil {
+		allErrs = append(allErrs, validateSecretKeySelector(specPath.Child("tokenSecretRef"), ref)...)
+	}
+	if auth := s.Auth; auth != nil {
+		allErrs = append(allErrs, s.validateAuth(specPath.Child("auth"))...)
+	}
+
+	return allErrs
+}
+
+func validateSecretKeySelector(refPath *field.Path, ref *corev1.SecretKeySelector) field.ErrorList {
+	var allErrs field.ErrorList
+	if ref.Name == "" {
+		allErrs = append(allErrs, field.Required(refPath.Child("name"), "secret name should not be empty"))
+	}
+	if ref.Key == "" {
+		allErrs = append(allErrs, field.Required(refPath.Child("key"), "secret key should not be empty"))
+	}
+	return allErrs
+}
+
+func (s *EndpointSpec) validateAuth(authPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	auth := s.Auth
+
+	if s.Token != "" || s.TokenSecretRef != nil {
+		allErrs = append(allErrs, field.Forbidden(
+			authPath, "auth cannot be used with token or tokenSecretRef",
+		))
+	}
+
+	switch {
+	case auth.Token == nil && auth.OIDC == nil:
+		allErrs = append(allErrs, field.Required(authPath, "one of token and oidc should be specified"))
+	case auth.Token != nil && auth.OIDC != nil:
+		allErrs = append(allErrs, field.Forbidden(authPath.Child("oidc"), "token and oidc are exclusive"))
+	}
+
+	if token := auth.Token; token != nil {
+		allErrs = append(allErrs, validateSecretKeySelector(authPath.Child("token", "secretRef"), &token.SecretRef)...)
+	}
+	if oidc := auth.OIDC; oidc != nil {
+		oidcPath := authPath.Child("oidc")
+		if oidc.ClientID == "" {
+			allErrs = append(allErrs, field.Required(oidcPath.Child("clientID"), "client id should not be empty"))
+		}
+		allErrs = append(allErrs, validateSecretKeySelector(oidcPath.Child("clientSecretRef"), &oidc.ClientSecretRef)...)
+		tokenEndpointURL, err := url.Parse(oidc.TokenEndpointURL)
+		switch {
+		case oidc.TokenEndpointURL == "":
+			allErrs = append(allErrs, field.Required(
+				oidcPath.Child("tokenEndpointURL"), "token endpoint url should not be empty",
+			))
+		case err != nil:
+			allErrs = append(allErrs, field.Invalid(
+				oidcPath.Child("tokenEndpointURL"), oidc.TokenEndpointURL, err.Error(),
+			))
+		case tokenEndpointURL.Scheme != "http" && tokenEndpointURL.Scheme != "https",
+			tokenEndpointURL.Host == "":
+			allErrs = append(allErrs, field.Invalid(
+				oidcPath.Child("tokenEndpointURL"), oidc.TokenEndpointURL, "token endpoint url should be a http(s) url",
+			))
+		}
+	}
+
+	return allErrs
+}
+
+// validateTransportProtocolVersion lists the frp versions required by the transport protocols.
+var validateTransportProtocolVersion = map[TransportProtocol][3]int{
+	TransportProtocolQUIC: frpVersionQUIC,
+	TransportProtocolWSS:  frpVersionWSS,
+}
+
+func (s *EndpointSpec) validateTransport(transportPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	transport := s.Transport
+
+	switch transport.Protocol {
+	case "", TransportProtocolTCP, TransportProtocolKCP, TransportProtocolQUIC,
+		TransportProtocolWebsocket, TransportProtocolWSS:
+	default:
+		allErrs = append(allErrs, field.NotSupported(
+			transportPath.Child("protocol"), transport.Protocol, []string{
+				string(TransportProtocolTCP), string(TransportProtocolKCP), string(TransportProtocolQUIC),
+				string(TransportProtocolWebsocket), string(TransportProtocolWSS),
+			},
+		))
+	}
+	if version, exists := validateTransportProtocolVersion[transport.Protocol]; exists &&
+		s.FrpVersion != "" && !frpVersionAtLeast(s.FrpVersion, version) {
+		allErrs = append(allErrs, field.Invalid(
+			transportPath.Child("protocol"), transport.Protocol, fmt.Sprintf(
+				"protocol requires frp v%d.%d.%d+", version[0], version[1], version[2],
+			),
+		))
+	}
+
+	if transport.PoolCount < 0 || transport.PoolCount > 50 {
+		allErrs = append(allErrs, field.Invalid(
+			transportPath.Child("poolCount"), transport.PoolCount, "pool count should be in range 0-50",
+		))
+	}
+	if transport.HeartbeatIntervalSeconds < -1 {
+		allErrs = append(allErrs, field.Invalid(
+			transportPath.Child("heartbeatIntervalSeconds"), transport.HeartbeatIntervalSeconds,
+			"heartbeat interval should be positive, or -1 to disable heartbeats",
+		))
+	}
+	if transport.HeartbeatTimeoutSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(
+			transportPath.Child("heartbeatTimeoutSeconds"), transport.HeartbeatTimeoutSeconds,
+			"heartbeat timeout should not be negative",
+		))
+	}
+	if transport.HeartbeatIntervalSeconds > 0 && transport.HeartbeatTimeoutSeconds > 0 &&
+		transport.HeartbeatTimeoutSeconds <= transport.HeartbeatIntervalSeconds {
+		allErrs = append(allErrs, field.Invalid(
+			transportPath.Child("heartbeatTimeoutSeconds"), transport.HeartbeatTimeoutSeconds,
+			"heartbeat timeout should be greater than the heartbeat interval",
+		))
+	}
+	if transport.DialServerTimeoutSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(
+			transportPath.Child("dialServerTimeoutSeconds"), transport.DialServerTimeoutSeconds,
+			"dial server timeout should not be negative",
+		))
+	}
+
+	if transport.HTTPProxy != "" {
+		proxyURL, err := url.Parse(transport.HTTPProxy)
+		switch {
+		case err != nil:
+			allErrs = append(allErrs, field.Invalid(
+				transportPath.Child("httpProxy"), transport.HTTPProxy, err.Error(),
+			))
+		case proxyURL.Scheme != "http" && proxyURL.Scheme != "socks5" && proxyURL.Scheme != "ntlm":
+			allErrs = append(allErrs, field.Invalid(
+				transportPath.Child("httpProxy"), transport.HTTPProxy, "proxy scheme should be http, socks5 or ntlm",
+			))
+		case proxyURL.Host == "":
+			allErrs = append(allErrs, field.Invalid(
+				transportPath.Child("httpProxy"), transport.HTTPProxy, "proxy host should not be empty",
+			))
+		}
+		if transport.Protocol != "" && transport.Protocol != TransportProtocolTCP {
+			allErrs = append(allErrs, field.Invalid(
+				transportPath.Child("httpProxy"), transport.HTTPProxy, "proxy only works with tcp protocol",
+			))
+		}
+	}
+
+	return allErrs
+}
@@ -0,0 +1,189 @@
+package v1
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestEndpointSpec_ValidateTransport(t *testing.T) {
+	cases := []struct {
+		name    string
+		spec    EndpointSpec
+		invalid bool
+	}{
+		{
+			name: "defaults",
+			spec: EndpointSpec{Transport: &EndpointTransport{}},
+		},
+		{
+			name: "kcp with tuning",
+			spec: EndpointSpec{Transport: &EndpointTransport{
+				Protocol:                 TransportProtocolKCP,
+				PoolCount:                5,
+				HeartbeatIntervalSeconds: 10,
+				HeartbeatTimeoutSeconds:  30,
+				DialServerTimeoutSeconds: 10,
+			}},
+		},
+		{
+			name: "heartbeats disabled",
+			spec: EndpointSpec{Transport: &EndpointTransport{HeartbeatIntervalSeconds: -1}},
+		},
+		{
+			name:    "unknown protocol",
+			spec:    EndpointSpec{Transport: &EndpointTransport{Protocol: "udp"}},
+			invalid: true,
+		},
+		{
+			name: "quic with supported version",
+			spec: EndpointSpec{
+				FrpVersion: "0.46.0",
+				Transport:  &EndpointTransport{Protocol: TransportProtocolQUIC},
+			},
+		},
+		{
+			name: "wss with unsupported version",
+			spec: EndpointSpec{
+				FrpVersion: "0.49.0",
+				Transport:  &EndpointTransport{Protocol: TransportProtocolWSS},
+			},
+			invalid: true,
+		},
+		{
+			name: "heartbeat timeout not greater than interval",
+			spec: EndpointSpec{Transport: &EndpointTransport{
+				HeartbeatIntervalSeconds: 30,
+				HeartbeatTimeoutSeconds:  30,
+			}},
+			invalid: true,
+		},
+		{
+			name:    "pool count out of range",
+			spec:    EndpointSpec{Transport: &EndpointTransport{PoolCount: 100}},
+			invalid: true,
+		},
+		{
+			name: "socks5 proxy",
+			spec: EndpointSpec{Transport: &EndpointTransport{HTTPProxy: "socks5://192.168.1.128:1080"}},
+		},
+		{
+			name:    "unsupported proxy scheme",
+			spec:    EndpointSpec{Transport: &EndpointTransport{HTTPProxy: "ftp://192.168.1.128"}},
+			invalid: true,
+		},
+		{
+			name: "proxy with non-tcp protocol",
+			spec: EndpointSpec{Transport: &EndpointTransport{
+				Protocol:  TransportProtocolKCP,
+				HTTPProxy: "http://192.168.1.128:8080",
+			}},
+			invalid: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			errs := c.spec.validateTransport(field.NewPath("spec", "transport"))
+			if c.invalid && len(errs) == 0 {
+				t.Errorf("expected errors")
+			}
+			if !c.invalid && len(errs) > 0 {
+				t.Errorf("unexpected errors: %v", errs)
+			}
+		})
+	}
+}
+
+func TestEndpointSpec_ValidateAuth(t *testing.T) {
+	clientSecretRef := corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "oidc"},
+		Key:                  "client-secret",
+	}
+	cases := []struct {
+		name    string
+		spec    EndpointSpec
+		invalid bool
+	}{
+		{
+			name: "token",
+			spec: EndpointSpec{Auth: &EndpointAuth{Token: &TokenAuth{
+				SecretRef: corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "frps"},
+					Key:                  "token",
+				},
+			}}},
+		},
+		{
+			name: "oidc",
+			spec: EndpointSpec{Auth: &EndpointAuth{
+				OIDC: &OIDCAuth{
+					ClientID:         "frpc",
+					ClientSecretRef:  clientSecretRef,
+					TokenEndpointURL: "https://idp.example.com/oauth2/token",
+				},
+				AuthenticateHeartbeats: true,
+			}},
+		},
+		{
+			name:    "empty",
+			spec:    EndpointSpec{Auth: &EndpointAuth{}},
+			invalid: true,
+		},
+		{
+			name: "token and oidc",
+			spec: EndpointSpec{Auth: &EndpointAuth{
+				Token: &TokenAuth{SecretRef: clientSecretRef},
+				OIDC: &OIDCAuth{
+					ClientID:         "frpc",
+					ClientSecretRef:  clientSecretRef,
+					TokenEndpointURL: "https://idp.example.com/oauth2/token",
+				},
+			}},
+			invalid: true,
+		},
+		{
+			name: "with legacy token",
+			spec: EndpointSpec{
+				Token: "foobar",
+				Auth:  &EndpointAuth{Token: &TokenAuth{SecretRef: clientSecretRef}},
+			},
+			invalid: true,
+		},
+		{
+			name:    "token without secret key",
+			spec:    EndpointSpec{Auth: &EndpointAuth{Token: &TokenAuth{}}},
+			invalid: true,
+		},
+		{
+			name: "oidc without client id",
+			spec: EndpointSpec{Auth: &EndpointAuth{OIDC: &OIDCAuth{
+				ClientSecretRef:  clientSecretRef,
+				TokenEndpointURL: "https://idp.example.com/oauth2/token",
+			}}},
+			invalid: true,
+		},
+		{
+			name: "oidc with invalid token endpoint",
+			spec: EndpointSpec{Auth: &EndpointAuth{OIDC: &OIDCAuth{
+				ClientID:         "frpc",
+				ClientSecretRef:  clientSecretRef,
+				TokenEndpointURL: "idp.example.com",
+			}}},
+			invalid: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			errs := c.spec.validateAuth(field.NewPath("spec", "auth"))
+			if c.invalid && len(errs) == 0 {
+				t.Errorf("expected errors")
+			}
+			if !c.invalid && len(errs) > 0 {
+				t.Errorf("unexpected errors: %v", errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ServerEndpointDashboard describes the frps dashboard settings.
+type ServerEndpointDashboard struct {
+	// Port of the dashboard.
+	Port int32 `json:"port"`
+
+	// Reference to the basic auth secret (`username` / `password` keys) of the dashboard.
+	// Required unless the service type is ClusterIP.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+}
+
+// ServerEndpointClientEndpoint describes the Endpoint to create for connecting the frps.
+type ServerEndpointClientEndpoint struct {
+	// Name of the Endpoint, defaults to the name of the ServerEndpoint.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Addr overrides the address of the Endpoint,
+	// defaults to the cluster DNS name of the frps service.
+	// +optional
+	Addr string `json:"addr,omitempty"`
+}
+
+// ServerEndpointSpec defines the desired state of ServerEndpoint
+type ServerEndpointSpec struct {
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+
+	// BindPort specifies the port for frpc to connect (`bind_port`).
+	BindPort int32 `json:"bindPort"`
+
+	// TokenSecretRef references the secret key holding the token for authenticating frpc.
+	// Required unless the service type is ClusterIP.
+	// +optional
+	TokenSecretRef *corev1.SecretKeySelector `json:"tokenSecretRef,omitempty"`
+
+	// VhostHTTPPort specifies the port to serve the HTTP proxies (`vhost_http_port`).
+	// +optional
+	VhostHTTPPort int32 `json:"vhostHTTPPort,omitempty"`
+
+	// VhostHTTPSPort specifies the port to serve the HTTPS proxies (`vhost_https_port`).
+	// +optional
+	VhostHTTPSPort int32 `json:"vhostHTTPSPort,omitempty"`
+
+	// SubdomainHost specifies the domain for the HTTP/HTTPS proxies with subdomain (`subdomain_host`).
+	// +optional
+	SubdomainHost string `json:"subdomainHost,omitempty"`
+
+	// +kubebuilder:validation:Pattern="^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$"
+
+	// AllowedPorts specifies the remote port ranges allowed for the TCP/UDP proxies (`allow_ports`),
+	// e.g. `30000-30100,31000`. The ports are exposed with both TCP and UDP protocols by the frps service,
+	// at most 100 ports are allowed.
+	// +optional
+	AllowedPorts string `json:"allowedPorts,omitempty"`
+
+	// Dashboard enables the frps dashboard.
+	// +optional
+	Dashboard *ServerEndpointDashboard `json:"dashboard,omitempty"`
+
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+
+	// ServiceType specifies the type of the frps service, defaults to LoadBalancer.
+	// +optional
+	ServiceType corev1.ServiceType `json:"serviceType,omitempty"`
+
+	// Extra labels for the generated service.
+	// +optional
+	ServiceLabels map[string]string `json:"serviceLabels,omitempty"`
+
+	// Extra annotations for the generated service, e.g. for configuring the load balancer.
+	// +optional
+	ServiceAnnotations map[string]string `json:"serviceAnnotations,omitempty"`
+
+	// ClientEndpoint creates an Endpoint connecting to the frps if specified.
+	// +optional
+	ClientEndpoint *ServerEndpointClientEndpoint `json:"clientEndpoint,omitempty"`
+
+	// Image specifies the frps image, defaults to the image configured for the controller.
+	// The image should ship the frps binary at `/opt/frp/frps`.
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// ServerEndpointMaxAllowedPorts limits the allowed ports of a server endpoint,
+// as each of them is exposed as a TCP and a UDP service port. The bind, vhost and dashboard ports
+// are not counted.
+const ServerEndpointMaxAllowedPorts = 100
+
+type ServerEndpointState string
+
+const (
+	ServerEndpointReady    ServerEndpointState = "Ready"
+	ServerEndpointNotReady ServerEndpointState = "NotReady"
+)
+
+// ServerEndpointStatus defines the observed state of ServerEndpoint
+type ServerEndpointStatus struct {
+	// State tells if the frps is ready.
+	// +optional
+	State ServerEndpointState `json:"state,omitempty"`
+
+	// ObservedGeneration tells the latest generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions tell the latest observations of the server endpoint.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// ServiceName tells the name of the frps service.
+	// +optional
+	ServiceName string `json:"serviceName,omitempty"`
+
+	// Addr tells the public address of the frps, from the load balancer ingress
+	// or the cluster ip of the frps service.
+	// +optional
+	Addr string `json:"addr,omitempty"`
+
+	// EndpointName tells the name of the created Endpoint.
+	// +optional
+	EndpointName string `json:"endpointName,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ServerEndpoint is the Schema for the serverendpoints API
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+// +kubebuilder:printcolumn:name="Addr",type=string,JSONPath=`.status.addr`
+// +kubebuilder:printcolumn:name="Endpoint",type=string,JSONPath=`.status.endpointName`
+// +kubebuilder:printcolumn:name="Message",type=string,priority=1,JSONPath=`.status.conditions[?(@.status!="True")].message`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type ServerEndpoint struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ServerEndpointSpec   `json:"spec,omitempty"`
+	Status ServerEndpointStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ServerEndpointList contains a list of ServerEndpoint
+type ServerEndpointList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ServerEndpoint `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ServerEndpoint{}, &ServerEndpointList{})
+}
@@ -0,0 +1,140 @@
+package v1
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/b4fun/frpcontroller/pkg/portalloc"
+)
+
+func (r *ServerEndpoint) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-frp-go-build4-fun-v1-serverendpoint,mutating=true,failurePolicy=fail,groups=frp.go.build4.fun,resources=serverendpoints,verbs=create;update,versions=v1,name=mserverendpoint.frp.go.build4.fun,admissionReviewVersions=v1,sideEffects=None
+
+var _ webhook.Defaulter = &ServerEndpoint{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *ServerEndpoint) Default() {
+	if r.Spec.ServiceType == "" {
+		r.Spec.ServiceType = corev1.ServiceTypeLoadBalancer
+	}
+	if r.Spec.ClientEndpoint != nil && r.Spec.ClientEndpoint.Name == "" {
+		r.Spec.ClientEndpoint.Name = r.Name
+	}
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-frp-go-build4-fun-v1-serverendpoint,mutating=false,failurePolicy=fail,groups=frp.go.build4.fun,resources=serverendpoints,versions=v1,name=vserverendpoint.frp.go.build4.fun,admissionReviewVersions=v1,sideEffects=None
+
+var _ webhook.Validator = &ServerEndpoint{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *ServerEndpoint) ValidateCreate() (admission.Warnings, error) {
+	return nil, r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *ServerEndpoint) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	return nil, r.validate()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *ServerEndpoint) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (r *ServerEndpoint) validate() error {
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	ports := map[int32]string{}
+	checkPort := func(path *field.Path, port int32) {
+		if !isValidPort(port) {
+			allErrs = append(allErrs, field.Invalid(path, port, "port should be in range 1-65535"))
+			return
+		}
+		if usedBy, used := ports[port]; used {
+			allErrs = append(allErrs, field.Invalid(path, port, "port is already used by "+usedBy))
+			return
+		}
+		ports[port] = path.String()
+	}
+	checkPort(specPath.Child("bindPort"), r.Spec.BindPort)
+	if r.Spec.VhostHTTPPort != 0 {
+		checkPort(specPath.Child("vhostHTTPPort"), r.Spec.VhostHTTPPort)
+	}
+	if r.Spec.VhostHTTPSPort != 0 {
+		checkPort(specPath.Child("vhostHTTPSPort"), r.Spec.VhostHTTPSPort)
+	}
+	if r.Spec.Dashboard != nil {
+		checkPort(specPath.Child("dashboard", "port"), r.Spec.Dashboard.Port)
+	}
+
+	ranges, err := portalloc.ParseRanges(r.Spec.AllowedPorts)
+	if err != nil {
+		allErrs = append(allErrs, field.Invalid(
+			specPath.Child("allowedPorts"), r.Spec.AllowedPorts, err.Error(),
+		))
+	}
+	portsCount := 0
+	for _, portRange := range ranges {
+		portsCount += int(portRange.To-portRange.From) + 1
+		for port, usedBy := range ports {
+			if port >= portRange.From && port <= portRange.To {
+				allErrs = append(allErrs, field.Invalid(
+					specPath.Child("allowedPorts"), r.Spec.AllowedPorts, "port is already used by "+usedBy,
+				))
+			}
+		}
+	}
+	if portsCount > ServerEndpointMaxAllowedPorts {
+		allErrs = append(allErrs, field.Invalid(
+			specPath.Child("allowedPorts"), r.Spec.AllowedPorts,
+			fmt.Sprintf("at most %d ports are allowed, got %d", ServerEndpointMaxAllowedPorts, portsCount),
+		))
+	}
+
+	// NOTE: frps and the dashboard are reachable outside of the cluster unless the service is ClusterIP
+	if r.Spec.ServiceType != corev1.ServiceTypeClusterIP {
+		if r.Spec.TokenSecretRef == nil {
+			allErrs = append(allErrs, field.Required(
+				specPath.Child("tokenSecretRef"),
+				"token is required unless the service type is ClusterIP",
+			))
+		}
+		if r.Spec.Dashboard != nil && r.Spec.Dashboard.CredentialsSecretRef == nil {
+			allErrs = append(allErrs, field.Required(
+				specPath.Child("dashboard", "credentialsSecretRef"),
+				"dashboard credentials are required unless the service type is ClusterIP",
+			))
+		}
+	}
+
+	if ref := r.Spec.TokenSecretRef; ref != nil {
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(
+				specPath.Child("tokenSecretRef", "name"), "secret name should not be empty",
+			))
+		}
+		if ref.Key == "" {
+			allErrs = append(allErrs, field.Required(
+				specPath.Child("tokenSecretRef", "key"), "secret key should not be empty",
+			))
+		}
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("ServerEndpoint").GroupKind(), r.Name, allErrs)
+}
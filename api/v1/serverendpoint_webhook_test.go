@@ -0,0 +1,98 @@
+package v1
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServerEndpoint_Validate(t *testing.T) {
+	tokenSecretRef := &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "frps"},
+		Key:                  "token",
+	}
+
+	cases := []struct {
+		name          string
+		spec          ServerEndpointSpec
+		expectedError string
+	}{
+		{
+			name: "valid",
+			spec: ServerEndpointSpec{
+				BindPort:       7000,
+				TokenSecretRef: tokenSecretRef,
+				VhostHTTPPort:  80,
+				AllowedPorts:   "30000-30099",
+				Dashboard: &ServerEndpointDashboard{
+					Port:                 7500,
+					CredentialsSecretRef: &corev1.LocalObjectReference{Name: "dashboard"},
+				},
+			},
+		},
+		{
+			name: "cluster ip without credentials",
+			spec: ServerEndpointSpec{
+				BindPort:    7000,
+				Dashboard:   &ServerEndpointDashboard{Port: 7500},
+				ServiceType: corev1.ServiceTypeClusterIP,
+			},
+		},
+		{
+			name: "load balancer without token",
+			spec: ServerEndpointSpec{
+				BindPort: 7000,
+			},
+			expectedError: "spec.tokenSecretRef",
+		},
+		{
+			name: "load balancer dashboard without credentials",
+			spec: ServerEndpointSpec{
+				BindPort:       7000,
+				TokenSecretRef: tokenSecretRef,
+				Dashboard:      &ServerEndpointDashboard{Port: 7500},
+			},
+			expectedError: "spec.dashboard.credentialsSecretRef",
+		},
+		{
+			name: "too many allowed ports",
+			spec: ServerEndpointSpec{
+				BindPort:       7000,
+				TokenSecretRef: tokenSecretRef,
+				AllowedPorts:   "30000-30100",
+			},
+			expectedError: "at most 100 ports are allowed, got 101",
+		},
+		{
+			name: "allowed ports overlap bind port",
+			spec: ServerEndpointSpec{
+				BindPort:       30000,
+				TokenSecretRef: tokenSecretRef,
+				AllowedPorts:   "30000-30010",
+			},
+			expectedError: "spec.allowedPorts",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			serverEndpoint := &ServerEndpoint{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "frps"},
+				Spec:       c.spec,
+			}
+			serverEndpoint.Default()
+			_, err := serverEndpoint.ValidateCreate()
+			if c.expectedError == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.expectedError) {
+				t.Errorf("expected error with %q, got %v", c.expectedError, err)
+			}
+		})
+	}
+}
@@ -10,16 +10,46 @@ import (
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // ServicePortProtocol defines the protocol to use.
-// +kubebuilder:validation:Enum=TCP;UDP
+// +kubebuilder:validation:Enum=TCP;UDP;HTTP;HTTPS;STCP;SUDP;XTCP
 type ServicePortProtocol string
 
 func (s ServicePortProtocol) ToCorev1Protocol() corev1.Protocol {
-	return corev1.Protocol(s)
+	switch s {
+	case ServicePortUDP, ServicePortSUDP:
+		return corev1.ProtocolUDP
+	default:
+		return corev1.ProtocolTCP
+	}
+}
+
+// IsHTTP tells if the protocol is served by frp server's http/https virtual host.
+func (s ServicePortProtocol) IsHTTP() bool {
+	return s == ServicePortHTTP || s == ServicePortHTTPS
+}
+
+// HasRemotePort tells if the protocol listens on the remote port of the frp server.
+func (s ServicePortProtocol) HasRemotePort() bool {
+	return s == ServicePortTCP || s == ServicePortUDP
+}
+
+// IsSecret tells if the protocol is only accessible from the visitors with the secret key.
+func (s ServicePortProtocol) IsSecret() bool {
+	return s == ServicePortSTCP || s == ServicePortSUDP || s == ServicePortXTCP
+}
+
+// SupportsProxyProtocol tells if the protocol can send PROXY protocol headers to the local port.
+func (s ServicePortProtocol) SupportsProxyProtocol() bool {
+	return s != ServicePortUDP && s != ServicePortSUDP
 }
 
 const (
-	ServicePortTCP ServicePortProtocol = "TCP"
-	ServicePortUDP ServicePortProtocol = "UDP"
+	ServicePortTCP   ServicePortProtocol = "TCP"
+	ServicePortUDP   ServicePortProtocol = "UDP"
+	ServicePortHTTP  ServicePortProtocol = "HTTP"
+	ServicePortHTTPS ServicePortProtocol = "HTTPS"
+	ServicePortSTCP  ServicePortProtocol = "STCP"
+	ServicePortSUDP  ServicePortProtocol = "SUDP"
+	ServicePortXTCP  ServicePortProtocol = "XTCP"
 )
 
 type ServicePort struct {
@@ -32,16 +62,99 @@ type ServicePort struct {
 	// The name of this port to use in frp side.
 	Name string `json:"name"`
 
-	// The protocol to use.
-	Protocol ServicePortProtocol `json:"protocol"`
+	// The protocol to use, defaults to TCP.
+	// +optional
+	Protocol ServicePortProtocol `json:"protocol,omitempty"`
 
-	// The local port to expose (service.ports.TargetPort).
-	LocalPort int32 `json:"localPort"`
+	// The local port to expose (service.ports.TargetPort), defaults to the remote port.
+	// Required if the remote port is allocated by the endpoint.
+	// +optional
+	LocalPort int32 `json:"localPort,omitempty"`
 
 	// The remote port to use (service.ports.Port).
-	RemotePort int32 `json:"remotePort"`
+	// For TCP/UDP ports, it's allocated from the endpoint's allowed ports if not specified.
+	// For HTTP/HTTPS ports, it's only used as the generated service port,
+	// the frp server serves them with its vhost http/https port.
+	// For STCP/SUDP/XTCP ports, it's only used as the generated service port,
+	// the port is accessed through visitors.
+	// +optional
+	RemotePort int32 `json:"remotePort,omitempty"`
+
+	// The secret key to share with the visitors of the STCP/SUDP/XTCP port,
+	// required for STCP/SUDP/XTCP ports.
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+
+	// The domains to serve the HTTP/HTTPS port.
+	// +optional
+	CustomDomains []string `json:"customDomains,omitempty"`
+
+	// The subdomain (under frp server's subdomain host) to serve the HTTP/HTTPS port.
+	// +optional
+	Subdomain string `json:"subdomain,omitempty"`
+
+	// The url path prefixes to route for the HTTP port.
+	// +optional
+	Locations []string `json:"locations,omitempty"`
+
+	// The host header to rewrite to for the HTTP port.
+	// +optional
+	HostHeaderRewrite string `json:"hostHeaderRewrite,omitempty"`
+
+	// The basic auth secret (`kubernetes.io/basic-auth`) to protect the HTTP port,
+	// which should contain `username` and `password` keys.
+	// +optional
+	HTTPAuthSecretRef *corev1.LocalObjectReference `json:"httpAuthSecretRef,omitempty"`
+
+	// The headers to set on the requests for the HTTP port.
+	// +optional
+	RequestHeaders map[string]string `json:"requestHeaders,omitempty"`
+
+	// Encrypts the traffic between frpc and the frp server (`use_encryption`).
+	// +optional
+	UseEncryption bool `json:"useEncryption,omitempty"`
+
+	// Compresses the traffic between frpc and the frp server (`use_compression`).
+	// +optional
+	UseCompression bool `json:"useCompression,omitempty"`
+
+	// +kubebuilder:validation:Pattern="^[0-9]+(KB|MB)$"
+
+	// The bandwidth limit of the port, e.g. `10MB`, `512KB` (`bandwidth_limit`).
+	// +optional
+	BandwidthLimit string `json:"bandwidthLimit,omitempty"`
+
+	// Where the bandwidth limit is applied, defaults to client (`bandwidth_limit_mode`).
+	// +optional
+	BandwidthLimitMode BandwidthLimitMode `json:"bandwidthLimitMode,omitempty"`
+
+	// The PROXY protocol version to send the client address to the local port with
+	// (`proxy_protocol_version`), the workload should accept PROXY protocol headers.
+	// Not supported by UDP/SUDP ports.
+	// +optional
+	ProxyProtocolVersion ProxyProtocolVersion `json:"proxyProtocolVersion,omitempty"`
 }
 
+// ProxyProtocolVersion specifies the PROXY protocol version.
+// +kubebuilder:validation:Enum=v1;v2
+type ProxyProtocolVersion string
+
+const (
+	ProxyProtocolV1 ProxyProtocolVersion = "v1"
+	ProxyProtocolV2 ProxyProtocolVersion = "v2"
+)
+
+// BandwidthLimitMode specifies where the bandwidth limit is applied.
+// +kubebuilder:validation:Enum=client;server
+type BandwidthLimitMode string
+
+const (
+	// BandwidthLimitModeClient applies the bandwidth limit in frpc.
+	BandwidthLimitModeClient BandwidthLimitMode = "client"
+	// BandwidthLimitModeServer applies the bandwidth limit in the frp server.
+	BandwidthLimitModeServer BandwidthLimitMode = "server"
+)
+
 func (p ServicePort) ToCorev1ServicePort() corev1.ServicePort {
 	return corev1.ServicePort{
 		Protocol:   p.Protocol.ToCorev1Protocol(),
@@ -51,6 +164,29 @@ func (p ServicePort) ToCorev1ServicePort() corev1.ServicePort {
 	}
 }
 
+// EndpointKind defines the kind of the endpoint to bind.
+// +kubebuilder:validation:Enum=Endpoint;ClusterEndpoint
+type EndpointKind string
+
+const (
+	// EndpointKindEndpoint binds to an Endpoint in the service namespace.
+	EndpointKindEndpoint EndpointKind = "Endpoint"
+	// EndpointKindClusterEndpoint binds to a ClusterEndpoint.
+	EndpointKindClusterEndpoint EndpointKind = "ClusterEndpoint"
+)
+
+// EndpointReference references the endpoint to bind.
+type EndpointReference struct {
+	// Kind of the endpoint, defaults to Endpoint.
+	// +optional
+	Kind EndpointKind `json:"kind,omitempty"`
+
+	// +kubebuilder:validation:MinLength=1
+
+	// Name of the endpoint.
+	Name string `json:"name"`
+}
+
 // ServiceSpec defines the desired state of Service
 type ServiceSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -59,14 +195,19 @@ type ServiceSpec struct {
 	// +kubebuilder:validation:MinLength=1
 
 	// Name of the remote endpoint to use.
-	Endpoint string `json:"endpoint"`
+	// Either endpoint or endpointRef should be specified.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Reference to the remote endpoint to use, required for binding to a ClusterEndpoint.
+	// +optional
+	EndpointRef *EndpointReference `json:"endpointRef,omitempty"`
 
 	// List of ports that are exposed to the frp server.
-	// +patchMergeKey=port
+	// +patchMergeKey=name
 	// +patchStrategy=merge
 	// +listType=map
-	// +listMapKey=remotePort
-	// +listMapKey=protocol
+	// +listMapKey=name
 	Ports []ServicePort `json:"ports"`
 
 	// The selector for picking up pods to the service.
@@ -83,6 +224,42 @@ const (
 	ServiceStateInactive ServiceState = "inactive"
 )
 
+type ServicePortState string
+
+const (
+	ServicePortStateRunning ServicePortState = "Running"
+	ServicePortStatePending ServicePortState = "Pending"
+	ServicePortStateFailed  ServicePortState = "Failed"
+	ServicePortStateUnknown ServicePortState = "Unknown"
+)
+
+// ServicePortStatus defines the observed state of a service port.
+type ServicePortStatus struct {
+	// Name of the service port (ServicePort.Name).
+	Name string `json:"name"`
+
+	// ProxyName tells the name of the frp proxy, in `<service>_<port>` format,
+	// or `<namespace>_<service>_<port>` for the services bound to a cluster endpoint.
+	ProxyName string `json:"proxyName"`
+
+	// RemoteAddr tells the address of the proxy on the frp server.
+	// +optional
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+
+	// RemotePort tells the remote port of the proxy, allocated by the endpoint
+	// if not specified in the service port.
+	// +optional
+	RemotePort int32 `json:"remotePort,omitempty"`
+
+	// State tells the state of the proxy.
+	State ServicePortState `json:"state"`
+
+	// LastError tells the last error reported for the proxy.
+	// It's kept after the proxy recovered.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
 // ServiceStatus defines the observed state of Service
 type ServiceStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
@@ -91,12 +268,34 @@ type ServiceStatus struct {
 	// State tells the service state.
 	// +optional
 	State ServiceState `json:"state,omitempty"`
+
+	// ObservedGeneration tells the latest generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions tell the latest observations of the service.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// Ports tell the state of the service ports.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Ports []ServicePortStatus `json:"ports,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 
 // Service is the Schema for the services API
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Endpoint",type=string,JSONPath=`.spec.endpoint`
+// +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+// +kubebuilder:printcolumn:name="Server",type=string,JSONPath=`.status.conditions[?(@.type=="ServerReachable")].status`
+// +kubebuilder:printcolumn:name="Proxies",type=string,JSONPath=`.status.conditions[?(@.type=="ProxiesRegistered")].status`
+// +kubebuilder:printcolumn:name="Message",type=string,priority=1,JSONPath=`.status.conditions[?(@.status!="True")].message`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 type Service struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -105,6 +304,19 @@ type Service struct {
 	Status ServiceStatus `json:"status,omitempty"`
 }
 
+// GetEndpointRef returns the reference of the endpoint to bind.
+func (s *Service) GetEndpointRef() EndpointReference {
+	if s.Spec.EndpointRef == nil {
+		return EndpointReference{Kind: EndpointKindEndpoint, Name: s.Spec.Endpoint}
+	}
+
+	ref := *s.Spec.EndpointRef
+	if ref.Kind == "" {
+		ref.Kind = EndpointKindEndpoint
+	}
+	return ref
+}
+
 // +kubebuilder:object:root=true
 
 // ServiceList contains a list of Service
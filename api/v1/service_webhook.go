@@ -0,0 +1,308 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func (r *Service) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	mgr.GetWebhookServer().Register(
+		"/validate-frp-go-build4-fun-v1-service",
+		&webhook.Admission{Handler: &serviceValidator{
+			client:  mgr.GetClient(),
+			decoder: admission.NewDecoder(mgr.GetScheme()),
+		}},
+	)
+
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-frp-go-build4-fun-v1-service,mutating=true,failurePolicy=fail,groups=frp.go.build4.fun,resources=services,verbs=create;update,versions=v1,name=mservice.frp.go.build4.fun,admissionReviewVersions=v1,sideEffects=None
+
+var _ webhook.Defaulter = &Service{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *Service) Default() {
+	if r.Spec.EndpointRef != nil && r.Spec.EndpointRef.Kind == "" {
+		r.Spec.EndpointRef.Kind = EndpointKindEndpoint
+	}
+	for i := range r.Spec.Ports {
+		port := &r.Spec.Ports[i]
+		if port.Protocol == "" {
+			port.Protocol = ServicePortTCP
+		}
+		// NOTE: remote port 0 is allocated by the endpoint, local port can't follow it
+		if port.LocalPort == 0 && port.RemotePort > 0 {
+			port.LocalPort = port.RemotePort
+		}
+	}
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-frp-go-build4-fun-v1-service,mutating=false,failurePolicy=fail,groups=frp.go.build4.fun,resources=services,versions=v1,name=vservice.frp.go.build4.fun,admissionReviewVersions=v1,sideEffects=None
+
+// serviceValidator validates services on create and update. Unlike the other
+// types, it looks up the referenced endpoint and the services sharing it, so
+// it's registered as a handler holding a client instead of a webhook.Validator.
+type serviceValidator struct {
+	client  client.Reader
+	decoder *admission.Decoder
+}
+
+// Handle implements admission.Handler.
+func (v *serviceValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return admission.Allowed("")
+	}
+
+	var service Service
+	if err := v.decoder.Decode(req, &service); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := service.validate(ctx, v.client); err != nil {
+		return admission.Denied(err.Error())
+	}
+	return admission.Allowed("")
+}
+
+// validate validates the service spec. The referenced endpoint is checked
+// only when reader is not nil.
+func (r *Service) validate(ctx context.Context, reader client.Reader) error {
+	if r.DeletionTimestamp != nil {
+		// NOTE: allow removing the finalizers
+		return nil
+	}
+
+	var allErrs field.ErrorList
+	specPath := field.NewPath("spec")
+
+	switch {
+	case r.Spec.Endpoint == "" && r.Spec.EndpointRef == nil:
+		allErrs = append(allErrs, field.Required(specPath.Child("endpoint"), "either endpoint or endpointRef should be set"))
+	case r.Spec.Endpoint != "" && r.Spec.EndpointRef != nil:
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("endpointRef"), "endpoint and endpointRef are mutually exclusive"))
+	}
+	if len(r.Spec.Selector) == 0 {
+		allErrs = append(allErrs, field.Required(specPath.Child("selector"), "selector should not be empty"))
+	}
+	if len(r.Spec.Ports) == 0 {
+		allErrs = append(allErrs, field.Required(specPath.Child("ports"), "ports should not be empty"))
+	}
+
+	portNames := map[string]bool{}
+	remotePorts := map[string]bool{}
+	for i, port := range r.Spec.Ports {
+		portPath := specPath.Child("ports").Index(i)
+
+		if portNames[port.Name] {
+			allErrs = append(allErrs, field.Duplicate(portPath.Child("name"), port.Name))
+		}
+		portNames[port.Name] = true
+
+		if !isValidPort(port.LocalPort) {
+			allErrs = append(allErrs, field.Invalid(
+				portPath.Child("localPort"), port.LocalPort, "port should be in range 1-65535",
+			))
+		}
+		// NOTE: TCP/UDP remote port is allocated by the endpoint if not specified
+		if !isValidPort(port.RemotePort) && !(port.RemotePort == 0 && port.Protocol.HasRemotePort()) {
+			allErrs = append(allErrs, field.Invalid(
+				portPath.Child("remotePort"), port.RemotePort, "port should be in range 1-65535",
+			))
+		}
+
+		if port.Protocol.IsSecret() {
+			switch ref := port.SecretKeyRef; {
+			case ref == nil:
+				allErrs = append(allErrs, field.Required(
+					portPath.Child("secretKeyRef"),
+					fmt.Sprintf("secret key is required for %s ports", port.Protocol),
+				))
+			case ref.Name == "" || ref.Key == "":
+				allErrs = append(allErrs, field.Invalid(
+					portPath.Child("secretKeyRef"), ref, "secret name and key should not be empty",
+				))
+			}
+		}
+
+		if port.BandwidthLimit != "" && !isValidBandwidthLimit(port.BandwidthLimit) {
+			allErrs = append(allErrs, field.Invalid(
+				portPath.Child("bandwidthLimit"), port.BandwidthLimit,
+				"bandwidth limit should be a positive number with KB or MB unit, e.g. 512KB, 10MB",
+			))
+		}
+		switch port.BandwidthLimitMode {
+		case "":
+		case BandwidthLimitModeClient, BandwidthLimitModeServer:
+			if port.BandwidthLimit == "" {
+				allErrs = append(allErrs, field.Invalid(
+					portPath.Child("bandwidthLimitMode"), port.BandwidthLimitMode,
+					"bandwidth limit mode requires bandwidth limit",
+				))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(
+				portPath.Child("bandwidthLimitMode"), port.BandwidthLimitMode,
+				[]string{string(BandwidthLimitModeClient), string(BandwidthLimitModeServer)},
+			))
+		}
+
+		switch port.ProxyProtocolVersion {
+		case "":
+		case ProxyProtocolV1, ProxyProtocolV2:
+			if !port.Protocol.SupportsProxyProtocol() {
+				allErrs = append(allErrs, field.Invalid(
+					portPath.Child("proxyProtocolVersion"), port.ProxyProtocolVersion,
+					fmt.Sprintf("proxy protocol is not supported by %s ports", port.Protocol),
+				))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(
+				portPath.Child("proxyProtocolVersion"), port.ProxyProtocolVersion,
+				[]string{string(ProxyProtocolV1), string(ProxyProtocolV2)},
+			))
+		}
+
+		if !port.Protocol.HasRemotePort() || port.RemotePort == 0 {
+			continue
+		}
+		remotePortKey := fmt.Sprintf("%d/%s", port.RemotePort, port.Protocol)
+		if remotePorts[remotePortKey] {
+			allErrs = append(allErrs, field.Duplicate(portPath.Child("remotePort"), port.RemotePort))
+		}
+		remotePorts[remotePortKey] = true
+	}
+
+	if reader != nil && r.GetEndpointRef().Name != "" {
+		endpointErrs, err := r.validateEndpoint(ctx, reader, specPath)
+		if err != nil {
+			return err
+		}
+		allErrs = append(allErrs, endpointErrs...)
+	}
+
+	if len(allErrs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Service").GroupKind(), r.Name, allErrs)
+}
+
+// validateEndpoint validates the referenced endpoint exists, and the remote ports
+// are not used by other services on the same endpoint.
+func (r *Service) validateEndpoint(ctx context.Context, reader client.Reader, specPath *field.Path) (field.ErrorList, error) {
+	var allErrs field.ErrorList
+
+	endpointRef := r.GetEndpointRef()
+	endpointPath := specPath.Child("endpoint")
+	if r.Spec.EndpointRef != nil {
+		endpointPath = specPath.Child("endpointRef", "name")
+	}
+
+	var (
+		err                error
+		servicesListOption []client.ListOption
+	)
+	switch endpointRef.Kind {
+	case EndpointKindClusterEndpoint:
+		var endpoint ClusterEndpoint
+		err = reader.Get(ctx, client.ObjectKey{Name: endpointRef.Name}, &endpoint)
+		if err == nil {
+			var namespace corev1.Namespace
+			if err := reader.Get(ctx, client.ObjectKey{Name: r.Namespace}, &namespace); err != nil {
+				return nil, err
+			}
+			allowed, err := endpoint.AllowsNamespace(&namespace)
+			if err != nil {
+				return nil, err
+			}
+			if !allowed {
+				allErrs = append(allErrs, field.Forbidden(endpointPath, fmt.Sprintf(
+					"namespace %s is not allowed by cluster endpoint %s", r.Namespace, endpointRef.Name,
+				)))
+				return allErrs, nil
+			}
+		}
+	default:
+		var endpoint Endpoint
+		err = reader.Get(ctx, client.ObjectKey{Namespace: r.Namespace, Name: endpointRef.Name}, &endpoint)
+		servicesListOption = append(servicesListOption, client.InNamespace(r.Namespace))
+	}
+	switch {
+	case err == nil:
+	case apierrors.IsNotFound(err):
+		allErrs = append(allErrs, field.NotFound(endpointPath, endpointRef.Name))
+		return allErrs, nil
+	default:
+		return nil, err
+	}
+
+	var serviceList ServiceList
+	if err := reader.List(ctx, &serviceList, servicesListOption...); err != nil {
+		return nil, err
+	}
+	remotePortsUsed := map[string]string{}
+	for _, service := range serviceList.Items {
+		if service.Namespace == r.Namespace && service.Name == r.Name {
+			continue
+		}
+		if service.GetEndpointRef() != endpointRef {
+			continue
+		}
+		serviceName := service.Name
+		if endpointRef.Kind == EndpointKindClusterEndpoint {
+			serviceName = fmt.Sprintf("%s/%s", service.Namespace, service.Name)
+		}
+		for _, port := range service.Spec.Ports {
+			if !port.Protocol.HasRemotePort() || port.RemotePort == 0 {
+				continue
+			}
+			remotePortKey := fmt.Sprintf("%d/%s", port.RemotePort, port.Protocol)
+			remotePortsUsed[remotePortKey] = serviceName
+		}
+	}
+	for i, port := range r.Spec.Ports {
+		if !port.Protocol.HasRemotePort() || port.RemotePort == 0 {
+			continue
+		}
+		remotePortKey := fmt.Sprintf("%d/%s", port.RemotePort, port.Protocol)
+		if serviceName, used := remotePortsUsed[remotePortKey]; used {
+			allErrs = append(allErrs, field.Invalid(
+				specPath.Child("ports").Index(i).Child("remotePort"), port.RemotePort,
+				fmt.Sprintf(
+					"remote port %s is already used by service %s on endpoint %s",
+					remotePortKey, serviceName, endpointRef.Name,
+				),
+			))
+		}
+	}
+
+	return allErrs, nil
+}
+
+// isValidBandwidthLimit checks the bandwidth limit is in frp's format, e.g. 512KB, 10MB.
+func isValidBandwidthLimit(limit string) bool {
+	var value string
+	switch {
+	case strings.HasSuffix(limit, "KB"):
+		value = strings.TrimSuffix(limit, "KB")
+	case strings.HasSuffix(limit, "MB"):
+		value = strings.TrimSuffix(limit, "MB")
+	default:
+		return false
+	}
+	n, err := strconv.ParseUint(value, 10, 32)
+	return err == nil && n > 0
+}
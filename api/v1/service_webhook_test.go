@@ -0,0 +1,298 @@
+package v1
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newTestService(name string, ports ...ServicePort) *Service {
+	return &Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+		},
+		Spec: ServiceSpec{
+			Endpoint: "endpoint",
+			Ports:    ports,
+			Selector: map[string]string{"app": name},
+		},
+	}
+}
+
+func newTestClusterService(name string, ports ...ServicePort) *Service {
+	service := newTestService(name, ports...)
+	service.Spec.Endpoint = ""
+	service.Spec.EndpointRef = &EndpointReference{
+		Kind: EndpointKindClusterEndpoint,
+		Name: "cluster-endpoint",
+	}
+	return service
+}
+
+func TestService_Default(t *testing.T) {
+	service := newTestService("foo", ServicePort{Name: "ssh", RemotePort: 2222})
+	service.Default()
+
+	port := service.Spec.Ports[0]
+	if port.Protocol != ServicePortTCP {
+		t.Errorf("protocol should default to TCP, got %s", port.Protocol)
+	}
+	if port.LocalPort != 2222 {
+		t.Errorf("local port should default to remote port, got %d", port.LocalPort)
+	}
+
+	service = newTestService("foo", ServicePort{Name: "ssh", LocalPort: 22})
+	service.Default()
+	if err := service.validate(context.Background(), nil); err != nil {
+		t.Errorf("port with allocated remote port should be valid after defaulting: %v", err)
+	}
+
+	service = newTestService("foo", ServicePort{Name: "ssh"})
+	service.Default()
+	if err := service.validate(context.Background(), nil); err == nil || !strings.Contains(err.Error(), "spec.ports[0].localPort") {
+		t.Errorf("port with allocated remote port should require local port, got %v", err)
+	}
+}
+
+func TestService_Validate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatalf("add to scheme: %v", err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add to scheme: %v", err)
+	}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&Endpoint{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "endpoint"},
+			Spec:       EndpointSpec{Addr: "127.0.0.1", Port: 7000},
+		},
+		newTestService("existed", ServicePort{
+			Name: "ssh", Protocol: ServicePortTCP, LocalPort: 22, RemotePort: 2222,
+		}),
+		&ClusterEndpoint{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster-endpoint"},
+			Spec: ClusterEndpointSpec{
+				EndpointSpec: EndpointSpec{Addr: "127.0.0.1", Port: 7000},
+				NamespaceSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"team": "foo"},
+				},
+			},
+		},
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{"team": "foo"}},
+		},
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "bar"},
+		},
+		func() *Service {
+			s := newTestClusterService("existed", ServicePort{
+				Name: "ssh", Protocol: ServicePortTCP, LocalPort: 22, RemotePort: 3333,
+			})
+			s.Namespace = "team-foo"
+			return s
+		}(),
+	).Build()
+
+	cases := []struct {
+		name          string
+		service       *Service
+		expectedError string
+	}{
+		{
+			name: "valid",
+			service: newTestService("foo",
+				ServicePort{Name: "ssh", Protocol: ServicePortUDP, LocalPort: 22, RemotePort: 2222},
+				ServicePort{Name: "web", Protocol: ServicePortHTTP, LocalPort: 80, RemotePort: 80},
+			),
+		},
+		{
+			name: "update existed",
+			service: newTestService("existed",
+				ServicePort{Name: "ssh", Protocol: ServicePortTCP, LocalPort: 2222, RemotePort: 2222},
+			),
+		},
+		{
+			name: "allocated remote ports",
+			service: newTestService("foo",
+				ServicePort{Name: "ssh", Protocol: ServicePortTCP, LocalPort: 22},
+				ServicePort{Name: "dns", Protocol: ServicePortUDP, LocalPort: 53},
+			),
+		},
+		{
+			name: "allocated http port",
+			service: newTestService("foo",
+				ServicePort{Name: "web", Protocol: ServicePortHTTP, LocalPort: 80},
+			),
+			expectedError: "spec.ports[0].remotePort",
+		},
+		{
+			name: "invalid port",
+			service: newTestService("foo",
+				ServicePort{Name: "ssh", Protocol: ServicePortTCP, LocalPort: 0, RemotePort: 70000},
+			),
+			expectedError: "spec.ports[0].remotePort",
+		},
+		{
+			name: "duplicate port name",
+			service: newTestService("foo",
+				ServicePort{Name: "ssh", Protocol: ServicePortTCP, LocalPort: 22, RemotePort: 2200},
+				ServicePort{Name: "ssh", Protocol: ServicePortTCP, LocalPort: 22, RemotePort: 2201},
+			),
+			expectedError: "spec.ports[1].name",
+		},
+		{
+			name: "encryption and bandwidth limit",
+			service: newTestService("foo",
+				ServicePort{
+					Name: "db", Protocol: ServicePortTCP, LocalPort: 5432, RemotePort: 5432,
+					UseEncryption: true, UseCompression: true,
+					BandwidthLimit: "512KB", BandwidthLimitMode: BandwidthLimitModeServer,
+				},
+			),
+		},
+		{
+			name: "invalid bandwidth limit",
+			service: newTestService("foo",
+				ServicePort{
+					Name: "db", Protocol: ServicePortTCP, LocalPort: 5432, RemotePort: 5432,
+					BandwidthLimit: "10GB",
+				},
+			),
+			expectedError: "spec.ports[0].bandwidthLimit",
+		},
+		{
+			name: "bandwidth limit mode without limit",
+			service: newTestService("foo",
+				ServicePort{
+					Name: "db", Protocol: ServicePortTCP, LocalPort: 5432, RemotePort: 5432,
+					BandwidthLimitMode: BandwidthLimitModeClient,
+				},
+			),
+			expectedError: "spec.ports[0].bandwidthLimitMode",
+		},
+		{
+			name: "proxy protocol",
+			service: newTestService("foo",
+				ServicePort{
+					Name: "web", Protocol: ServicePortHTTPS, LocalPort: 443, RemotePort: 443,
+					ProxyProtocolVersion: ProxyProtocolV2,
+				},
+			),
+		},
+		{
+			name: "proxy protocol on udp port",
+			service: newTestService("foo",
+				ServicePort{
+					Name: "dns", Protocol: ServicePortUDP, LocalPort: 53, RemotePort: 53,
+					ProxyProtocolVersion: ProxyProtocolV1,
+				},
+			),
+			expectedError: "spec.ports[0].proxyProtocolVersion",
+		},
+		{
+			name: "secret port",
+			service: newTestService("foo",
+				ServicePort{
+					Name: "db", Protocol: ServicePortSTCP, LocalPort: 5432, RemotePort: 5432,
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "db-sk"},
+						Key:                  "sk",
+					},
+				},
+			),
+		},
+		{
+			name: "secret port without secret key",
+			service: newTestService("foo",
+				ServicePort{Name: "db", Protocol: ServicePortXTCP, LocalPort: 5432, RemotePort: 5432},
+			),
+			expectedError: "spec.ports[0].secretKeyRef",
+		},
+		{
+			name: "empty selector",
+			service: func() *Service {
+				s := newTestService("foo",
+					ServicePort{Name: "ssh", Protocol: ServicePortTCP, LocalPort: 22, RemotePort: 2200},
+				)
+				s.Spec.Selector = nil
+				return s
+			}(),
+			expectedError: "spec.selector",
+		},
+		{
+			name: "missing endpoint",
+			service: func() *Service {
+				s := newTestService("foo",
+					ServicePort{Name: "ssh", Protocol: ServicePortTCP, LocalPort: 22, RemotePort: 2200},
+				)
+				s.Spec.Endpoint = "missing"
+				return s
+			}(),
+			expectedError: "spec.endpoint",
+		},
+		{
+			name: "cluster endpoint",
+			service: newTestClusterService("foo",
+				ServicePort{Name: "ssh", Protocol: ServicePortTCP, LocalPort: 22, RemotePort: 2222},
+			),
+		},
+		{
+			name: "cluster endpoint remote port collision",
+			service: newTestClusterService("foo",
+				ServicePort{Name: "ssh", Protocol: ServicePortTCP, LocalPort: 22, RemotePort: 3333},
+			),
+			expectedError: "already used by service team-foo/existed",
+		},
+		{
+			name: "cluster endpoint namespace not allowed",
+			service: func() *Service {
+				s := newTestClusterService("foo",
+					ServicePort{Name: "ssh", Protocol: ServicePortTCP, LocalPort: 22, RemotePort: 2200},
+				)
+				s.Namespace = "bar"
+				return s
+			}(),
+			expectedError: "namespace bar is not allowed",
+		},
+		{
+			name: "both endpoint and endpointRef",
+			service: func() *Service {
+				s := newTestClusterService("foo",
+					ServicePort{Name: "ssh", Protocol: ServicePortTCP, LocalPort: 22, RemotePort: 2200},
+				)
+				s.Spec.Endpoint = "endpoint"
+				return s
+			}(),
+			expectedError: "spec.endpointRef",
+		},
+		{
+			name: "remote port collision",
+			service: newTestService("foo",
+				ServicePort{Name: "ssh", Protocol: ServicePortTCP, LocalPort: 22, RemotePort: 2222},
+			),
+			expectedError: "already used by service existed",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.service.validate(context.Background(), reader)
+			if c.expectedError == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.expectedError) {
+				t.Errorf("expected error with %q, got %v", c.expectedError, err)
+			}
+		})
+	}
+}
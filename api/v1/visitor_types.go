@@ -0,0 +1,101 @@
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
+// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+
+// VisitorProtocol defines the protocol of the proxy to visit.
+// +kubebuilder:validation:Enum=STCP;SUDP;XTCP
+type VisitorProtocol string
+
+func (s VisitorProtocol) ToCorev1Protocol() corev1.Protocol {
+	return ServicePortProtocol(s).ToCorev1Protocol()
+}
+
+const (
+	VisitorSTCP VisitorProtocol = "STCP"
+	VisitorSUDP VisitorProtocol = "SUDP"
+	VisitorXTCP VisitorProtocol = "XTCP"
+)
+
+// VisitorSpec defines the desired state of Visitor
+type VisitorSpec struct {
+	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
+	// Important: Run "make" to regenerate code after modifying this file
+
+	// +kubebuilder:validation:MinLength=1
+
+	// Name of the remote endpoint to use.
+	Endpoint string `json:"endpoint"`
+
+	// The protocol of the proxy to visit.
+	Protocol VisitorProtocol `json:"protocol"`
+
+	// +kubebuilder:validation:MinLength=1
+
+	// The name of the proxy to visit.
+	// Proxies exposed by frpcontroller are named as `<service>_<port>`.
+	ServerName string `json:"serverName"`
+
+	// The secret key shared with the proxy to visit.
+	SecretKeyRef corev1.SecretKeySelector `json:"secretKeyRef"`
+
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+
+	// The port to expose the visited proxy with (service.ports.Port).
+	Port int32 `json:"port"`
+
+	// Extra labels for the generated service.
+	ServiceLabels map[string]string `json:"serviceLabels,omitempty"`
+}
+
+// VisitorStatus defines the observed state of Visitor
+type VisitorStatus struct {
+	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
+	// Important: Run "make" to regenerate code after modifying this file
+
+	// ServiceName tells the name of the generated service.
+	// +optional
+	ServiceName string `json:"serviceName,omitempty"`
+
+	// Conditions tell the latest observations of the visitor.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// Visitor is the Schema for the visitors API
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Endpoint",type=string,JSONPath=`.spec.endpoint`
+// +kubebuilder:printcolumn:name="Port",type=integer,JSONPath=`.spec.port`
+// +kubebuilder:printcolumn:name="Available",type=string,JSONPath=`.status.conditions[?(@.type=="PortAvailable")].status`
+// +kubebuilder:printcolumn:name="Message",type=string,priority=1,JSONPath=`.status.conditions[?(@.status!="True")].message`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+type Visitor struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VisitorSpec   `json:"spec,omitempty"`
+	Status VisitorStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VisitorList contains a list of Visitor
+type VisitorList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Visitor `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Visitor{}, &VisitorList{})
+}
@@ -0,0 +1,5 @@
+package v1
+
+func isValidPort(port int32) bool {
+	return port > 0 && port <= 65535
+}
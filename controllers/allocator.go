@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+	"github.com/b4fun/frpcontroller/pkg/portalloc"
+)
+
+// allocateRemotePorts allocates remote ports for the TCP/UDP ports of the services bound
+// to the endpoint. Ports without remote port are allocated from the endpoint's allowed ports,
+// previous allocations are kept if possible. The earlier created services take precedence,
+// explicit remote ports conflicting with them are reported with error.
+func allocateRemotePorts(endpoint *frpv1.Endpoint, services []frpv1.Service) []frpv1.PortAllocation {
+	ranges, rangesErr := portalloc.ParseRanges(endpoint.Spec.AllowedPorts)
+	allocators := map[frpv1.ServicePortProtocol]*portalloc.Allocator{}
+	allocatorFor := func(protocol frpv1.ServicePortProtocol) *portalloc.Allocator {
+		if _, exists := allocators[protocol]; !exists {
+			allocators[protocol] = portalloc.NewAllocator(ranges)
+		}
+		return allocators[protocol]
+	}
+
+	var sortedServices []frpv1.Service
+	for _, service := range services {
+		if service.DeletionTimestamp != nil {
+			continue
+		}
+		// NOTE: the defaulting webhook might be disabled
+		service.Default()
+		sortedServices = append(sortedServices, service)
+	}
+	sort.SliceStable(sortedServices, func(i, j int) bool {
+		ti, tj := sortedServices[i].CreationTimestamp, sortedServices[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		if sortedServices[i].Namespace != sortedServices[j].Namespace {
+			return sortedServices[i].Namespace < sortedServices[j].Namespace
+		}
+		return sortedServices[i].Name < sortedServices[j].Name
+	})
+
+	previousAllocations := map[string]int32{}
+	serviceKeys := map[string]bool{}
+	for _, service := range sortedServices {
+		serviceKeys[service.Namespace+"/"+service.Name] = true
+		for _, portStatus := range service.Status.Ports {
+			if portStatus.RemotePort > 0 {
+				key := portAllocationKey(service.Namespace, service.Name, portStatus.Name)
+				previousAllocations[key] = portStatus.RemotePort
+			}
+		}
+	}
+	for _, allocation := range endpoint.Status.Allocations {
+		if allocation.Error == "" && allocation.RemotePort > 0 {
+			serviceName := allocation.Service
+			// NOTE: migrate the allocations of the core services named with the legacy prefix,
+			//       unless they belong to an frpv1 service named as such
+			if strings.HasPrefix(serviceName, legacyCoreServiceNamePrefix) &&
+				!serviceKeys[allocation.Namespace+"/"+serviceName] {
+				serviceName = coreServiceNamePrefix + strings.TrimPrefix(serviceName, legacyCoreServiceNamePrefix)
+			}
+			key := portAllocationKey(allocation.Namespace, serviceName, allocation.Port)
+			previousAllocations[key] = allocation.RemotePort
+		}
+	}
+
+	allocations := map[string]*frpv1.PortAllocation{}
+	usedBy := map[string]string{}
+	use := func(service *frpv1.Service, port frpv1.ServicePort, remotePort int32) bool {
+		if !allocatorFor(port.Protocol).Use(remotePort) {
+			return false
+		}
+		usedBy[fmt.Sprintf("%d/%s", remotePort, port.Protocol)] = serviceDisplayName(service)
+		allocations[portAllocationKey(service.Namespace, service.Name, port.Name)] = &frpv1.PortAllocation{
+			Namespace:  service.Namespace,
+			Service:    service.Name,
+			Port:       port.Name,
+			RemotePort: remotePort,
+		}
+		return true
+	}
+
+	// NOTE: explicit remote ports and previous allocations are claimed in the creation order
+	// of the services, so a later service can't take the port an earlier one is using.
+	for i := range sortedServices {
+		service := &sortedServices[i]
+		for _, port := range service.Spec.Ports {
+			if !port.Protocol.HasRemotePort() {
+				continue
+			}
+
+			if port.RemotePort == 0 {
+				remotePort, exists := previousAllocations[portAllocationKey(service.Namespace, service.Name, port.Name)]
+				if exists && allocatorFor(port.Protocol).Contains(remotePort) {
+					use(service, port, remotePort)
+				}
+				continue
+			}
+
+			if use(service, port, port.RemotePort) {
+				continue
+			}
+			allocations[portAllocationKey(service.Namespace, service.Name, port.Name)] = &frpv1.PortAllocation{
+				Namespace: service.Namespace,
+				Service:   service.Name,
+				Port:      port.Name,
+				Error: fmt.Sprintf(
+					"remote port %d/%s is already used by service %s",
+					port.RemotePort, port.Protocol,
+					usedBy[fmt.Sprintf("%d/%s", port.RemotePort, port.Protocol)],
+				),
+			}
+		}
+	}
+
+	// new allocations
+	for i := range sortedServices {
+		service := &sortedServices[i]
+		for _, port := range service.Spec.Ports {
+			if !port.Protocol.HasRemotePort() || port.RemotePort != 0 {
+				continue
+			}
+			key := portAllocationKey(service.Namespace, service.Name, port.Name)
+			if _, allocated := allocations[key]; allocated {
+				continue
+			}
+
+			allocation := &frpv1.PortAllocation{
+				Namespace: service.Namespace,
+				Service:   service.Name,
+				Port:      port.Name,
+			}
+			switch {
+			case rangesErr != nil:
+				allocation.Error = fmt.Sprintf(
+					"invalid allowed ports of endpoint %s: %s", endpoint.Name, rangesErr,
+				)
+			case len(ranges) == 0:
+				allocation.Error = fmt.Sprintf("endpoint %s has no allowed ports", endpoint.Name)
+			default:
+				remotePort, ok := allocatorFor(port.Protocol).Allocate()
+				if ok {
+					allocation.RemotePort = remotePort
+				} else {
+					allocation.Error = fmt.Sprintf("allowed ports of endpoint %s are exhausted", endpoint.Name)
+				}
+			}
+			allocations[key] = allocation
+		}
+	}
+
+	var result []frpv1.PortAllocation
+	for _, allocation := range allocations {
+		result = append(result, *allocation)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		if result[i].Service != result[j].Service {
+			return result[i].Service < result[j].Service
+		}
+		return result[i].Port < result[j].Port
+	})
+
+	return result
+}
+
+// findPortAllocation finds the allocation of the service port.
+func findPortAllocation(
+	allocations []frpv1.PortAllocation,
+	service *frpv1.Service,
+	portName string,
+) *frpv1.PortAllocation {
+	for i := range allocations {
+		allocation := &allocations[i]
+		if allocation.Namespace == service.Namespace &&
+			allocation.Service == service.Name &&
+			allocation.Port == portName {
+			return allocation
+		}
+	}
+	return nil
+}
+
+func portAllocationKey(namespace string, serviceName string, portName string) string {
+	return fmt.Sprintf("%s/%s/%s", namespace, serviceName, portName)
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+func newAllocatorTestService(name string, createdAt int, ports ...frpv1.ServicePort) frpv1.Service {
+	return frpv1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(time.Unix(int64(createdAt), 0)),
+		},
+		Spec: frpv1.ServiceSpec{
+			Endpoint: "endpoint",
+			Ports:    ports,
+		},
+	}
+}
+
+func TestAllocateRemotePorts(t *testing.T) {
+	tcpPort := func(name string, remotePort int32) frpv1.ServicePort {
+		return frpv1.ServicePort{Name: name, Protocol: frpv1.ServicePortTCP, LocalPort: 22, RemotePort: remotePort}
+	}
+	allocated := func(service string, port string, remotePort int32) frpv1.PortAllocation {
+		return frpv1.PortAllocation{Namespace: "default", Service: service, Port: port, RemotePort: remotePort}
+	}
+	failed := func(service string, port string, err string) frpv1.PortAllocation {
+		return frpv1.PortAllocation{Namespace: "default", Service: service, Port: port, Error: err}
+	}
+
+	cases := []struct {
+		name                string
+		allowedPorts        string
+		previousAllocations []frpv1.PortAllocation
+		services            []frpv1.Service
+		expected            []frpv1.PortAllocation
+	}{
+		{
+			name:         "allocate from allowed ports",
+			allowedPorts: "30000-30001",
+			services: []frpv1.Service{
+				newAllocatorTestService("foo", 1, tcpPort("ssh", 0), tcpPort("web", 0)),
+				newAllocatorTestService("bar", 2, tcpPort("ssh", 0)),
+			},
+			expected: []frpv1.PortAllocation{
+				failed("bar", "ssh", "allowed ports of endpoint endpoint are exhausted"),
+				allocated("foo", "ssh", 30000),
+				allocated("foo", "web", 30001),
+			},
+		},
+		{
+			name:         "keep previous allocations",
+			allowedPorts: "30000-30001",
+			previousAllocations: []frpv1.PortAllocation{
+				allocated("bar", "ssh", 30000),
+			},
+			services: []frpv1.Service{
+				newAllocatorTestService("foo", 1, tcpPort("ssh", 0)),
+				newAllocatorTestService("bar", 2, tcpPort("ssh", 0)),
+			},
+			expected: []frpv1.PortAllocation{
+				allocated("bar", "ssh", 30000),
+				allocated("foo", "ssh", 30001),
+			},
+		},
+		{
+			name:         "explicit remote port",
+			allowedPorts: "30000-30001",
+			services: []frpv1.Service{
+				newAllocatorTestService("foo", 1, tcpPort("ssh", 30000)),
+				newAllocatorTestService("bar", 2, tcpPort("ssh", 0)),
+			},
+			expected: []frpv1.PortAllocation{
+				allocated("bar", "ssh", 30001),
+				allocated("foo", "ssh", 30000),
+			},
+		},
+		{
+			name:         "explicit remote port conflicts with earlier allocation",
+			allowedPorts: "30000-30001",
+			previousAllocations: []frpv1.PortAllocation{
+				allocated("foo", "ssh", 30000),
+			},
+			services: []frpv1.Service{
+				newAllocatorTestService("foo", 1, tcpPort("ssh", 0)),
+				newAllocatorTestService("bar", 2, tcpPort("ssh", 30000)),
+			},
+			expected: []frpv1.PortAllocation{
+				failed("bar", "ssh", "remote port 30000/TCP is already used by service foo"),
+				allocated("foo", "ssh", 30000),
+			},
+		},
+		{
+			name:         "explicit remote port conflicts with earlier service",
+			allowedPorts: "30000-30001",
+			services: []frpv1.Service{
+				newAllocatorTestService("foo", 1, tcpPort("ssh", 2222)),
+				newAllocatorTestService("bar", 2, tcpPort("ssh", 2222)),
+			},
+			expected: []frpv1.PortAllocation{
+				failed("bar", "ssh", "remote port 2222/TCP is already used by service foo"),
+				allocated("foo", "ssh", 2222),
+			},
+		},
+		{
+			name:         "reallocate previous allocation taken by earlier service",
+			allowedPorts: "30000-30001",
+			previousAllocations: []frpv1.PortAllocation{
+				allocated("bar", "ssh", 30000),
+			},
+			services: []frpv1.Service{
+				newAllocatorTestService("foo", 1, tcpPort("ssh", 30000)),
+				newAllocatorTestService("bar", 2, tcpPort("ssh", 0)),
+			},
+			expected: []frpv1.PortAllocation{
+				allocated("bar", "ssh", 30001),
+				allocated("foo", "ssh", 30000),
+			},
+		},
+		{
+			name:         "migrate core service allocations with legacy prefix",
+			allowedPorts: "30000-30001",
+			previousAllocations: []frpv1.PortAllocation{
+				allocated(legacyCoreServiceNamePrefix+"web", "http", 30001),
+			},
+			services: []frpv1.Service{
+				newAllocatorTestService(coreServiceNamePrefix+"web", 1, tcpPort("http", 0)),
+			},
+			expected: []frpv1.PortAllocation{
+				allocated(coreServiceNamePrefix+"web", "http", 30001),
+			},
+		},
+		{
+			name:         "keep service named with legacy core service prefix",
+			allowedPorts: "30000-30001",
+			previousAllocations: []frpv1.PortAllocation{
+				allocated(legacyCoreServiceNamePrefix+"web", "http", 30001),
+			},
+			services: []frpv1.Service{
+				newAllocatorTestService(coreServiceNamePrefix+"web", 1, tcpPort("http", 0)),
+				newAllocatorTestService(legacyCoreServiceNamePrefix+"web", 2, tcpPort("http", 0)),
+			},
+			expected: []frpv1.PortAllocation{
+				allocated(legacyCoreServiceNamePrefix+"web", "http", 30001),
+				allocated(coreServiceNamePrefix+"web", "http", 30000),
+			},
+		},
+		{
+			name: "no allowed ports",
+			services: []frpv1.Service{
+				newAllocatorTestService("foo", 1, tcpPort("ssh", 0)),
+			},
+			expected: []frpv1.PortAllocation{
+				failed("foo", "ssh", "endpoint endpoint has no allowed ports"),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			endpoint := &frpv1.Endpoint{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "endpoint"},
+				Spec:       frpv1.EndpointSpec{AllowedPorts: c.allowedPorts},
+				Status:     frpv1.EndpointStatus{Allocations: c.previousAllocations},
+			}
+			allocations := allocateRemotePorts(endpoint, c.services)
+			if !reflect.DeepEqual(allocations, c.expected) {
+				t.Errorf("unexpected allocations:\n%+v\nexpected:\n%+v", allocations, c.expected)
+			}
+		})
+	}
+}
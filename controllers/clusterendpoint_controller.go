@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+const (
+	clusterEndpointOwnerKey = ".metadata.controller.clusterEndpoint"
+)
+
+// ClusterEndpointReconciler reconciles a ClusterEndpoint object.
+// The frpc of the cluster endpoint is managed in the same way as Endpoint.
+type ClusterEndpointReconciler struct {
+	EndpointReconciler
+
+	// Namespace specifies the namespace to run the frpc of the cluster endpoints.
+	Namespace string
+}
+
+// +kubebuilder:rbac:groups=frp.go.build4.fun,resources=clusterendpoints,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=frp.go.build4.fun,resources=clusterendpoints/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+func (r *ClusterEndpointReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Log.WithValues("clusterendpoint", req.Name)
+
+	var endpoint frpv1.ClusterEndpoint
+	err := r.Get(ctx, req.NamespacedName, &endpoint)
+	switch {
+	case err == nil && endpoint.DeletionTimestamp != nil:
+		return r.handleDeleted(ctx, logger, newClusterEndpointView(&endpoint, r.Namespace))
+	case err == nil:
+		return r.handleCreateOrUpdate(ctx, logger, newClusterEndpointView(&endpoint, r.Namespace))
+	case apierrors.IsNotFound(err):
+		// NOTE: the endpoint has been cleaned up before removing the finalizer
+		return ctrl.Result{}, nil
+	default:
+		logger.Error(err, "get cluster endpoint failed")
+		return ctrl.Result{}, err
+	}
+}
+
+// clusterEndpointAllowsNamespace tells if services in the namespace may bind to the cluster endpoint.
+func clusterEndpointAllowsNamespace(
+	ctx context.Context,
+	reader client.Reader,
+	endpoint *frpv1.ClusterEndpoint,
+	namespace string,
+) (bool, error) {
+	var ns corev1.Namespace
+	if err := reader.Get(ctx, client.ObjectKey{Name: namespace}, &ns); err != nil {
+		return false, err
+	}
+	return endpoint.AllowsNamespace(&ns)
+}
+
+// SetupWithManager sets up the controller with the manager.
+// NOTE: the service secrets index is registered by the EndpointReconciler.
+func (r *ClusterEndpointReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	var err error
+	err = mgr.GetFieldIndexer().IndexField(
+		context.Background(), &corev1.Secret{}, clusterEndpointOwnerKey,
+		func(rawObj client.Object) []string {
+			secret := rawObj.(*corev1.Secret)
+			owner := metav1.GetControllerOf(secret)
+			if owner == nil {
+				return nil
+			}
+			if owner.APIVersion != apiGVStr || owner.Kind != KindClusterEndpoint {
+				return nil
+			}
+			return []string{owner.Name}
+		},
+	)
+	if err != nil {
+		return err
+	}
+	err = mgr.GetFieldIndexer().IndexField(
+		context.Background(), &appsv1.Deployment{}, clusterEndpointOwnerKey,
+		func(rawObj client.Object) []string {
+			deployment := rawObj.(*appsv1.Deployment)
+			owner := metav1.GetControllerOf(deployment)
+			if owner == nil {
+				return nil
+			}
+			if owner.APIVersion != apiGVStr || owner.Kind != KindClusterEndpoint {
+				return nil
+			}
+			return []string{owner.Name}
+		},
+	)
+	if err != nil {
+		return err
+	}
+	err = mgr.GetFieldIndexer().IndexField(
+		context.Background(), &frpv1.ClusterEndpoint{}, endpointSecretRefKey,
+		func(rawObj client.Object) []string {
+			endpoint := rawObj.(*frpv1.ClusterEndpoint)
+			return endpointReferencedSecrets(&endpoint.Spec.EndpointSpec)
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&frpv1.ClusterEndpoint{}).
+		Owns(&corev1.Secret{}).
+		Owns(&appsv1.Deployment{}).
+		Watches(
+			&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.mapSecretToClusterEndpoints),
+		).
+		Watches(
+			&corev1.Pod{},
+			handler.EnqueueRequestsFromMapFunc(r.mapToClusterEndpoint),
+		).
+		Watches(
+			&frpv1.Service{},
+			handler.EnqueueRequestsFromMapFunc(r.mapToClusterEndpoint),
+		).
+		Watches(
+			&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.mapNamespaceToClusterEndpoints),
+		).
+		Complete(r)
+}
+
+// mapSecretToClusterEndpoints maps a secret to the cluster endpoints referencing it,
+// either directly or through the bound services.
+func (r *ClusterEndpointReconciler) mapSecretToClusterEndpoints(ctx context.Context, obj client.Object) []reconcile.Request {
+	var requests []reconcile.Request
+
+	if obj.GetNamespace() == r.Namespace {
+		var endpointList frpv1.ClusterEndpointList
+		err := r.List(
+			context.Background(), &endpointList,
+			client.MatchingFields{endpointSecretRefKey: obj.GetName()},
+		)
+		if err != nil {
+			r.Log.Error(err, "list cluster endpoints failed", "secret", obj.GetName())
+			return nil
+		}
+		for _, endpoint := range endpointList.Items {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: client.ObjectKey{Name: endpoint.Name},
+			})
+		}
+	}
+
+	var serviceList frpv1.ServiceList
+	err := r.List(
+		context.Background(), &serviceList,
+		client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{serviceSecretRefKey: obj.GetName()},
+	)
+	if err != nil {
+		r.Log.Error(err, "list services failed", "secret", obj.GetName())
+		return nil
+	}
+	for _, service := range serviceList.Items {
+		requests = append(requests, r.mapToClusterEndpoint(ctx, &service)...)
+	}
+
+	return requests
+}
+
+// mapToClusterEndpoint maps an object to the cluster endpoint it bounds to by the cluster endpoint label.
+func (r *ClusterEndpointReconciler) mapToClusterEndpoint(ctx context.Context, obj client.Object) []reconcile.Request {
+	endpointName, exists := obj.GetLabels()[labelKeyClusterEndpointName]
+	if !exists || endpointName == "" {
+		return nil
+	}
+
+	return []reconcile.Request{
+		{
+			NamespacedName: client.ObjectKey{Name: endpointName},
+		},
+	}
+}
+
+// mapNamespaceToClusterEndpoints maps a namespace to all cluster endpoints,
+// as the namespace labels might change the selected namespaces.
+func (r *ClusterEndpointReconciler) mapNamespaceToClusterEndpoints(ctx context.Context, obj client.Object) []reconcile.Request {
+	var endpointList frpv1.ClusterEndpointList
+	if err := r.List(context.Background(), &endpointList); err != nil {
+		r.Log.Error(err, "list cluster endpoints failed", "namespace", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, endpoint := range endpointList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{Name: endpoint.Name},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	g "github.com/onsi/ginkgo"
+	m "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+var _ = g.Describe("ClusterEndpointController", func() {
+	const (
+		resourcePollingTimeout  = "1m"
+		resourcePollingInterval = "2s"
+
+		// NOTE: the frpc of the cluster endpoints runs in the namespace set in suite_test.go
+		clusterResourceNamespace = "default"
+	)
+
+	var (
+		frpsDeploy       *frpsDeployStatus
+		testNamespace    string
+		serviceNamespace string
+		teamLabel        map[string]string
+		clusterEndpoint  *frpv1.ClusterEndpoint
+	)
+
+	g.BeforeEach(func(done g.Done) {
+		ctx := context.Background()
+		var err error
+
+		g.By("create test namespaces")
+		testNamespace, err = createNamespace(ctx, k8sClient, "frp-test-")
+		m.Expect(err).NotTo(m.HaveOccurred(), "create namespace")
+		log.Log.Info(fmt.Sprintf("created namespace: %s", testNamespace))
+		serviceNamespace, err = createNamespace(ctx, k8sClient, "frp-test-service-")
+		m.Expect(err).NotTo(m.HaveOccurred(), "create namespace")
+		log.Log.Info(fmt.Sprintf("created namespace: %s", serviceNamespace))
+		// NOTE: label value is unique per test so other test namespaces are never selected
+		teamLabel = map[string]string{"frp-test-team": serviceNamespace}
+
+		g.By("deploying frps server")
+		frps := frpsSettings{
+			Port:  3333,
+			Token: "supersecret",
+		}
+		frpsDeploy, err = frps.DeployToCluster(ctx, k8sClient, testNamespace)
+		m.Expect(err).NotTo(m.HaveOccurred(), "deploy frps")
+		log.Log.Info(fmt.Sprintf("deployed frps: %s", frpsDeploy))
+
+		g.By("creating cluster endpoint")
+		clusterEndpoint = &frpv1.ClusterEndpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "frpc-cluster-endpoint-",
+			},
+			Spec: frpv1.ClusterEndpointSpec{
+				EndpointSpec: frpv1.EndpointSpec{
+					Addr:  frpsDeploy.Endpoint,
+					Port:  frpsDeploy.Port,
+					Token: frpsDeploy.Token,
+				},
+				NamespaceSelector: metav1.LabelSelector{MatchLabels: teamLabel},
+			},
+		}
+		err = k8sClient.Create(ctx, clusterEndpoint)
+		m.Expect(err).NotTo(m.HaveOccurred(), "create cluster endpoint")
+
+		close(done)
+	}, 300)
+
+	g.AfterEach(func(done g.Done) {
+		ctx := context.Background()
+
+		err := k8sClient.Delete(ctx, clusterEndpoint)
+		m.Expect(client.IgnoreNotFound(err)).NotTo(m.HaveOccurred(), "delete cluster endpoint")
+		err = deleteNamespace(ctx, k8sClient, serviceNamespace)
+		m.Expect(err).NotTo(m.HaveOccurred(), "delete namespace")
+		err = deleteNamespace(ctx, k8sClient, testNamespace)
+		m.Expect(err).NotTo(m.HaveOccurred(), "delete namespace")
+
+		close(done)
+	}, 300)
+
+	getClusterEndpointConfig := func() (string, error) {
+		var secretList corev1.SecretList
+		err := k8sClient.List(
+			context.Background(), &secretList,
+			client.InNamespace(clusterResourceNamespace),
+		)
+		if err != nil {
+			return "", err
+		}
+		for _, secret := range secretList.Items {
+			for _, owner := range secret.OwnerReferences {
+				if owner.Kind == KindClusterEndpoint && owner.Name == clusterEndpoint.Name {
+					return string(secret.Data[frpcFileName]), nil
+				}
+			}
+		}
+		return "", errors.New("cluster endpoint secret not found")
+	}
+
+	labelServiceNamespace := func(labels map[string]string) {
+		ctx := context.Background()
+		var namespace corev1.Namespace
+		err := k8sClient.Get(ctx, client.ObjectKey{Name: serviceNamespace}, &namespace)
+		m.Expect(err).NotTo(m.HaveOccurred(), "get namespace")
+		namespace.Labels = labels
+		err = k8sClient.Update(ctx, &namespace)
+		m.Expect(err).NotTo(m.HaveOccurred(), "update namespace labels")
+	}
+
+	createClusterService := func() *frpv1.Service {
+		service := &frpv1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:    serviceNamespace,
+				GenerateName: "frpc-service-",
+			},
+			Spec: frpv1.ServiceSpec{
+				EndpointRef: &frpv1.EndpointReference{
+					Kind: frpv1.EndpointKindClusterEndpoint,
+					Name: clusterEndpoint.Name,
+				},
+				Ports: []frpv1.ServicePort{
+					{
+						Name:       "test-port",
+						Protocol:   frpv1.ServicePortTCP,
+						LocalPort:  3333,
+						RemotePort: 3334,
+					},
+				},
+				Selector: map[string]string{
+					"foo": "bar",
+				},
+			},
+		}
+		err := k8sClient.Create(context.Background(), service)
+		m.Expect(err).NotTo(m.HaveOccurred(), "create service")
+		return service
+	}
+
+	expectServiceBound := func(service *frpv1.Service) {
+		proxyName := serviceProxyName(service, "test-port")
+		m.Expect(proxyName).To(m.HavePrefix(fmt.Sprintf("%s_", serviceNamespace)), "proxy name should be namespaced")
+
+		m.Eventually(func() error {
+			config, err := getClusterEndpointConfig()
+			if err != nil {
+				return err
+			}
+			if !strings.Contains(config, proxyName) {
+				return fmt.Errorf("proxy %s not found in config", proxyName)
+			}
+			return nil
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+	}
+
+	expectServiceNotAllowed := func(service *frpv1.Service) {
+		proxyName := serviceProxyName(service, "test-port")
+
+		m.Eventually(func() error {
+			var serviceLatest frpv1.Service
+			err := k8sClient.Get(
+				context.Background(),
+				client.ObjectKey{Namespace: service.Namespace, Name: service.Name},
+				&serviceLatest,
+			)
+			if err != nil {
+				return err
+			}
+			condition := frpv1.FindCondition(serviceLatest.Status.Conditions, frpv1.ConditionRemotePortsAllocated)
+			if condition == nil || condition.Reason != reasonNamespaceNotAllowed {
+				return fmt.Errorf("service is not reported as not allowed: %+v", serviceLatest.Status.Conditions)
+			}
+
+			config, err := getClusterEndpointConfig()
+			if err != nil {
+				return err
+			}
+			if strings.Contains(config, proxyName) {
+				return fmt.Errorf("proxy %s should not be in config", proxyName)
+			}
+			return nil
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+	}
+
+	g.It("should bind services from allowed namespaces", func() {
+		labelServiceNamespace(teamLabel)
+
+		service := createClusterService()
+		expectServiceBound(service)
+	})
+
+	g.It("should report services from disallowed namespaces", func() {
+		service := createClusterService()
+		expectServiceNotAllowed(service)
+	})
+
+	g.It("should follow namespace label changes", func() {
+		service := createClusterService()
+		expectServiceNotAllowed(service)
+
+		g.By("selecting the service namespace")
+		labelServiceNamespace(teamLabel)
+		expectServiceBound(service)
+
+		g.By("unselecting the service namespace")
+		labelServiceNamespace(nil)
+		expectServiceNotAllowed(service)
+	})
+})
+
+func TestServiceProxyName(t *testing.T) {
+	newService := func(namespace string, name string, endpointKind frpv1.EndpointKind) *frpv1.Service {
+		return &frpv1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec: frpv1.ServiceSpec{
+				EndpointRef: &frpv1.EndpointReference{Kind: endpointKind, Name: "endpoint"},
+			},
+		}
+	}
+
+	cases := []struct {
+		service  *frpv1.Service
+		portName string
+		expected string
+	}{
+		{
+			service:  newService("team", "ssh", frpv1.EndpointKindEndpoint),
+			portName: "ssh",
+			expected: "ssh_ssh",
+		},
+		{
+			service:  newService("team", "ssh", frpv1.EndpointKindClusterEndpoint),
+			portName: "ssh",
+			expected: "team_ssh_ssh",
+		},
+		{
+			// NOTE: named as `team.ssh.v2_ssh` previously, conflicting with the next one
+			service:  newService("team", "ssh.v2", frpv1.EndpointKindClusterEndpoint),
+			portName: "ssh",
+			expected: "team_ssh.v2_ssh",
+		},
+		{
+			service:  newService("team", "team.ssh.v2", frpv1.EndpointKindEndpoint),
+			portName: "ssh",
+			expected: "team.ssh.v2_ssh",
+		},
+		{
+			service:  newService("team-ssh", "v2", frpv1.EndpointKindClusterEndpoint),
+			portName: "ssh",
+			expected: "team-ssh_v2_ssh",
+		},
+	}
+
+	proxyNames := map[string]bool{}
+	for _, c := range cases {
+		proxyName := serviceProxyName(c.service, c.portName)
+		if proxyName != c.expected {
+			t.Errorf("%s/%s: expected %q, got %q", c.service.Namespace, c.service.Name, c.expected, proxyName)
+		}
+		if proxyNames[proxyName] {
+			t.Errorf("%s/%s: proxy name %q conflicts", c.service.Namespace, c.service.Name, proxyName)
+		}
+		proxyNames[proxyName] = true
+	}
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+// condition reasons
+const (
+	reasonConfigGenerated      = "Generated"
+	reasonConfigGenerateFailed = "GenerateFailed"
+	reasonSpecInvalid          = "InvalidSpec"
+	reasonPodRunning           = "PodRunning"
+	reasonPodNotRunning        = "PodNotRunning"
+	reasonLoggedIn             = "LoggedIn"
+	reasonNotLoggedIn          = "NotLoggedIn"
+	reasonLoginFailed          = "LoginFailed"
+	reasonProxiesApplied       = "Applied"
+	reasonProxiesReloadFailed  = "ReloadFailed"
+	reasonProxiesRunning       = "Running"
+	reasonProxiesPending       = "Pending"
+	reasonProxiesFailed        = "ProxyFailed"
+	reasonClientPodNotReady    = "ClientPodNotReady"
+	reasonEndpointNotFound     = "EndpointNotFound"
+	reasonNamespaceNotAllowed  = "NamespaceNotAllowed"
+	reasonServicesReferenced   = "ServicesReferenced"
+	reasonRemotePortsAllocated = "Allocated"
+	reasonRemotePortConflict   = "PortConflict"
+	reasonPortAvailable        = "Available"
+	reasonAddressAssigned      = "Assigned"
+	reasonAddressPending       = "Pending"
+)
+
+// event reasons
+const (
+	reasonProxyProtocolNotDeclared = "ProxyProtocolNotDeclared"
+	reasonInvalidCoreService       = "InvalidCoreService"
+	reasonLoadBalancerPortMismatch = "LoadBalancerPortMismatch"
+)
+
+// endpointConditionTypes lists the conditions reported by the endpoint.
+var endpointConditionTypes = []frpv1.ConditionType{
+	frpv1.ConditionConfigGenerated,
+	frpv1.ConditionClientPodReady,
+	frpv1.ConditionServerReachable,
+	frpv1.ConditionProxiesRegistered,
+}
+
+func setCondition(
+	conditions *[]frpv1.Condition,
+	generation int64,
+	conditionType frpv1.ConditionType,
+	status metav1.ConditionStatus,
+	reason string,
+	message string,
+) {
+	frpv1.SetCondition(conditions, frpv1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
@@ -7,15 +7,53 @@ var (
 )
 
 const (
-	KindEndpoint = "Endpoint"
-	KindService  = "Service"
+	KindEndpoint        = "Endpoint"
+	KindClusterEndpoint = "ClusterEndpoint"
+	KindServerEndpoint  = "ServerEndpoint"
+	KindService         = "Service"
+	KindVisitor         = "Visitor"
 
 	frpsFileName = "frps.ini"
 	frpcFileName = "frpc.ini"
 
-	annotationKeyEndpointPodConfigVersion = "frp.go.build4.fun/config-version"
-	annotationKeyServiceClusterIP         = "frp.go.build4.fun/cluster-ip"
-	labelKeyEndpointName                  = "frp.go.build4.fun/endpoint"
+	// frpcConfigBaseName is the frpc config file name without the format extension.
+	frpcConfigBaseName = "frpc"
+
+	annotationKeyEndpointPodConfigHash         = "frp.go.build4.fun/config-hash"
+	annotationKeyEndpointPodRestartConfigHash  = "frp.go.build4.fun/restart-config-hash"
+	annotationKeyEndpointPodAppliedConfigHash  = "frp.go.build4.fun/applied-config-hash"
+	annotationKeyEndpointDeploymentSpecHash    = "frp.go.build4.fun/spec-hash"
+	annotationKeyEndpointPodTLSHash            = "frp.go.build4.fun/tls-hash"
+	annotationKeyServiceClusterIP              = "frp.go.build4.fun/cluster-ip"
+	annotationKeyCoreService                   = "frp.go.build4.fun/core-service"
+	annotationKeyCoreServiceEndpoint           = "frp.go.build4.fun/endpoint"
+	annotationKeyCoreServiceRemotePorts        = "frp.go.build4.fun/remote-ports"
+	annotationKeyLoadBalancerClass             = "frp.go.build4.fun/load-balancer-class"
+	annotationKeyIngressClass                  = "kubernetes.io/ingress.class"
+	annotationKeyIngressBackendProtocol        = "frp.go.build4.fun/backend-protocol"
+	annotationKeyServiceProxyProtocol          = "frp.go.build4.fun/proxy-protocol"
+	annotationKeyServiceProxyProtocolSupported = "frp.go.build4.fun/proxy-protocol-supported"
+	labelKeyEndpointName                       = "frp.go.build4.fun/endpoint"
+	labelKeyClusterEndpointName                = "frp.go.build4.fun/cluster-endpoint"
+	labelKeyServerEndpointName                 = "frp.go.build4.fun/server-endpoint"
+
+	finalizerEndpoint = "frp.go.build4.fun/endpoint"
+	finalizerService  = "frp.go.build4.fun/service"
+
+	frpcAdminPort        = 7400
+	frpcAdminUser        = "admin"
+	frpcAdminPasswordKey = "admin-password"
+	frpcGroupKeyKey      = "group-key"
+
+	frpcTLSTrustedCAFile  = "/tls/ca/ca.crt"
+	frpcTLSClientCertFile = "/tls/client/tls.crt"
+	frpcTLSClientKeyFile  = "/tls/client/tls.key"
 
 	frpDockerImage = "vimagick/frp@sha256:215dee12e6cb41ccfb65be9a3a796e8e27ed9159cc5d5a54f536c28d07879e34"
 )
+
+// DefaultFrpcImage is the frpc image used when neither the endpoint nor the controller specifies one.
+const DefaultFrpcImage = frpDockerImage
+
+// DefaultFrpsImage is the frps image used when neither the server endpoint nor the controller specifies one.
+const DefaultFrpsImage = frpDockerImage
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+// coreServiceNamePrefix prefixes the name of the services converted from core services,
+// so their proxies and port allocations never conflict with the frpv1 services.
+// NOTE: frpv1 service names might contain `.` but never `_`.
+const coreServiceNamePrefix = "corev1_"
+
+// legacyCoreServiceNamePrefix is the previous prefix of the converted services,
+// their port allocations are migrated to the current prefix.
+const legacyCoreServiceNamePrefix = "corev1."
+
+// parseCoreServiceRemotePorts parses the remote ports annotation of a core service,
+// in `<port name>[=<remote port>][,...]` format. Ports without remote port are
+// allocated from the endpoint's allowed ports.
+func parseCoreServiceRemotePorts(value string) (map[string]int32, error) {
+	remotePorts := map[string]int32{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		portName := strings.TrimSpace(parts[0])
+		if portName == "" {
+			return nil, fmt.Errorf("invalid remote port %q: empty port name", entry)
+		}
+		if _, exists := remotePorts[portName]; exists {
+			return nil, fmt.Errorf("duplicated remote port %q", portName)
+		}
+		remotePorts[portName] = 0
+		if len(parts) == 1 {
+			continue
+		}
+
+		remotePort, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 32)
+		if err != nil || remotePort < 1 || remotePort > 65535 {
+			return nil, fmt.Errorf("invalid remote port %q: port should be in range 1-65535", entry)
+		}
+		remotePorts[portName] = int32(remotePort)
+	}
+	if len(remotePorts) == 0 {
+		return nil, fmt.Errorf("no remote ports specified")
+	}
+
+	return remotePorts, nil
+}
+
+// coreServiceEndpointName returns the name of the endpoint the core service binds to,
+// either by the endpoint annotation or as a load balancer implemented by frp.
+func coreServiceEndpointName(kservice *corev1.Service, loadBalancer LoadBalancerOptions) string {
+	if endpointName := kservice.Annotations[annotationKeyCoreServiceEndpoint]; endpointName != "" {
+		return endpointName
+	}
+	if loadBalancer.Matches(kservice) {
+		return loadBalancer.Endpoint
+	}
+	return ""
+}
+
+// coreServiceToService converts an annotated core service to the frpv1 service,
+// which exposes the core service ports through its cluster ip.
+func coreServiceToService(kservice *corev1.Service, loadBalancer LoadBalancerOptions) (*frpv1.Service, error) {
+	if kservice.Spec.ClusterIP == "" || kservice.Spec.ClusterIP == corev1.ClusterIPNone {
+		return nil, fmt.Errorf("service %s has no cluster ip", kservice.Name)
+	}
+
+	var remotePorts map[string]int32
+	if value, exists := kservice.Annotations[annotationKeyCoreServiceRemotePorts]; exists || !loadBalancer.Matches(kservice) {
+		var err error
+		remotePorts, err = parseCoreServiceRemotePorts(value)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// NOTE: load balancer exposes all ports with the same remote port
+		remotePorts = map[string]int32{}
+		for _, port := range kservice.Spec.Ports {
+			remotePorts[port.Name] = port.Port
+		}
+	}
+
+	service := &frpv1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              coreServiceNamePrefix + kservice.Name,
+			Namespace:         kservice.Namespace,
+			CreationTimestamp: kservice.CreationTimestamp,
+			DeletionTimestamp: kservice.DeletionTimestamp,
+			Annotations: map[string]string{
+				annotationKeyServiceClusterIP: kservice.Spec.ClusterIP,
+				annotationKeyCoreService:      kservice.Name,
+			},
+		},
+		Spec: frpv1.ServiceSpec{
+			Endpoint: coreServiceEndpointName(kservice, loadBalancer),
+		},
+	}
+	portsFound := map[string]bool{}
+	for _, port := range kservice.Spec.Ports {
+		remotePort, exists := remotePorts[port.Name]
+		if !exists {
+			continue
+		}
+		portsFound[port.Name] = true
+
+		var protocol frpv1.ServicePortProtocol
+		switch port.Protocol {
+		case corev1.ProtocolTCP, "":
+			protocol = frpv1.ServicePortTCP
+		case corev1.ProtocolUDP:
+			protocol = frpv1.ServicePortUDP
+		default:
+			return nil, fmt.Errorf("port %s: protocol %s is not supported", port.Name, port.Protocol)
+		}
+		service.Spec.Ports = append(service.Spec.Ports, frpv1.ServicePort{
+			Name:       port.Name,
+			Protocol:   protocol,
+			LocalPort:  port.Port,
+			RemotePort: remotePort,
+		})
+	}
+	for portName := range remotePorts {
+		if !portsFound[portName] {
+			return nil, fmt.Errorf("port %s not found in service %s", portName, kservice.Name)
+		}
+	}
+
+	return service, nil
+}
+
+// isCoreService tells if the service is converted from a core service.
+func isCoreService(service *frpv1.Service) bool {
+	_, exists := service.Annotations[annotationKeyCoreService]
+	return exists
+}
+
+// listEndpointCoreServices lists the annotated core services bound to the endpoint,
+// and converts them to frpv1 services. Invalid core services are reported with
+// warning events and skipped.
+func (r *EndpointReconciler) listEndpointCoreServices(
+	ctx context.Context,
+	endpoint *endpointView,
+) ([]frpv1.Service, error) {
+	if endpoint.Kind != KindEndpoint {
+		// NOTE: core services can only bind to the endpoint in the same namespace
+		return nil, nil
+	}
+
+	var kserviceList corev1.ServiceList
+	err := r.List(
+		ctx, &kserviceList,
+		client.InNamespace(endpoint.Namespace),
+		client.MatchingFields{coreServiceEndpointKey: endpoint.Name},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var services []frpv1.Service
+	for i := range kserviceList.Items {
+		kservice := &kserviceList.Items[i]
+		service, err := coreServiceToService(kservice, r.LoadBalancer)
+		if err != nil {
+			r.Log.Error(
+				err, "invalid core service",
+				"endpoint", endpoint.Name, "service", kservice.Name,
+			)
+			r.recordInvalidCoreService(kservice, err)
+			continue
+		}
+		r.coreServiceWarnings.Delete(kservice.UID)
+		services = append(services, *service)
+	}
+	return services, nil
+}
+
+// recordInvalidCoreService records a warning event on the invalid core service,
+// unless the same warning has been recorded.
+func (r *EndpointReconciler) recordInvalidCoreService(kservice *corev1.Service, err error) {
+	if r.Recorder == nil {
+		return
+	}
+
+	message := err.Error()
+	if previous, recorded := r.coreServiceWarnings.Load(kservice.UID); recorded && previous == message {
+		return
+	}
+	r.coreServiceWarnings.Store(kservice.UID, message)
+	r.Recorder.Event(kservice, corev1.EventTypeWarning, reasonInvalidCoreService, message)
+}
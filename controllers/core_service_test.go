@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+func TestParseCoreServiceRemotePorts(t *testing.T) {
+	cases := []struct {
+		name          string
+		value         string
+		expected      map[string]int32
+		expectedError string
+	}{
+		{
+			name:     "explicit and allocated",
+			value:    "http=8080, dns",
+			expected: map[string]int32{"http": 8080, "dns": 0},
+		},
+		{
+			name:          "empty",
+			value:         " , ",
+			expectedError: "no remote ports specified",
+		},
+		{
+			name:          "empty port name",
+			value:         "=8080",
+			expectedError: "empty port name",
+		},
+		{
+			name:          "duplicated port",
+			value:         "http=8080,http=8081",
+			expectedError: "duplicated remote port",
+		},
+		{
+			name:          "invalid port",
+			value:         "http=foo",
+			expectedError: "port should be in range 1-65535",
+		},
+		{
+			name:          "port out of range",
+			value:         "http=70000",
+			expectedError: "port should be in range 1-65535",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			remotePorts, err := parseCoreServiceRemotePorts(c.value)
+			if c.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), c.expectedError) {
+					t.Errorf("expected error with %q, got %v", c.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(remotePorts, c.expected) {
+				t.Errorf("unexpected remote ports: %v", remotePorts)
+			}
+		})
+	}
+}
+
+func TestCoreServiceToService(t *testing.T) {
+	loadBalancer := LoadBalancerOptions{Class: "frp", Endpoint: "lb-endpoint"}
+
+	newCoreService := func(annotations map[string]string, mutate func(*corev1.Service)) *corev1.Service {
+		kservice := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        "web",
+				Annotations: annotations,
+			},
+			Spec: corev1.ServiceSpec{
+				Type:      corev1.ServiceTypeClusterIP,
+				ClusterIP: "10.0.0.1",
+				Ports: []corev1.ServicePort{
+					{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80},
+					{Name: "dns", Protocol: corev1.ProtocolUDP, Port: 53},
+				},
+			},
+		}
+		if mutate != nil {
+			mutate(kservice)
+		}
+		return kservice
+	}
+
+	cases := []struct {
+		name             string
+		kservice         *corev1.Service
+		expectedEndpoint string
+		expectedPorts    []frpv1.ServicePort
+		expectedError    string
+	}{
+		{
+			name: "annotated",
+			kservice: newCoreService(map[string]string{
+				annotationKeyCoreServiceEndpoint:    "endpoint",
+				annotationKeyCoreServiceRemotePorts: "http=8080,dns",
+			}, nil),
+			expectedEndpoint: "endpoint",
+			expectedPorts: []frpv1.ServicePort{
+				{Name: "http", Protocol: frpv1.ServicePortTCP, LocalPort: 80, RemotePort: 8080},
+				{Name: "dns", Protocol: frpv1.ServicePortUDP, LocalPort: 53},
+			},
+		},
+		{
+			name: "selected ports",
+			kservice: newCoreService(map[string]string{
+				annotationKeyCoreServiceEndpoint:    "endpoint",
+				annotationKeyCoreServiceRemotePorts: "dns=5353",
+			}, nil),
+			expectedEndpoint: "endpoint",
+			expectedPorts: []frpv1.ServicePort{
+				{Name: "dns", Protocol: frpv1.ServicePortUDP, LocalPort: 53, RemotePort: 5353},
+			},
+		},
+		{
+			name: "load balancer",
+			kservice: newCoreService(map[string]string{
+				annotationKeyLoadBalancerClass: "frp",
+			}, func(kservice *corev1.Service) {
+				kservice.Spec.Type = corev1.ServiceTypeLoadBalancer
+			}),
+			expectedEndpoint: "lb-endpoint",
+			expectedPorts: []frpv1.ServicePort{
+				{Name: "http", Protocol: frpv1.ServicePortTCP, LocalPort: 80, RemotePort: 80},
+				{Name: "dns", Protocol: frpv1.ServicePortUDP, LocalPort: 53, RemotePort: 53},
+			},
+		},
+		{
+			name: "missing remote ports",
+			kservice: newCoreService(map[string]string{
+				annotationKeyCoreServiceEndpoint: "endpoint",
+			}, nil),
+			expectedError: "no remote ports specified",
+		},
+		{
+			name: "unknown port",
+			kservice: newCoreService(map[string]string{
+				annotationKeyCoreServiceEndpoint:    "endpoint",
+				annotationKeyCoreServiceRemotePorts: "https=8443",
+			}, nil),
+			expectedError: "port https not found in service web",
+		},
+		{
+			name: "headless",
+			kservice: newCoreService(map[string]string{
+				annotationKeyCoreServiceEndpoint:    "endpoint",
+				annotationKeyCoreServiceRemotePorts: "http",
+			}, func(kservice *corev1.Service) {
+				kservice.Spec.ClusterIP = corev1.ClusterIPNone
+			}),
+			expectedError: "service web has no cluster ip",
+		},
+		{
+			name: "unsupported protocol",
+			kservice: newCoreService(map[string]string{
+				annotationKeyCoreServiceEndpoint:    "endpoint",
+				annotationKeyCoreServiceRemotePorts: "sctp",
+			}, func(kservice *corev1.Service) {
+				kservice.Spec.Ports = append(kservice.Spec.Ports, corev1.ServicePort{
+					Name: "sctp", Protocol: corev1.ProtocolSCTP, Port: 9999,
+				})
+			}),
+			expectedError: "protocol SCTP is not supported",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			service, err := coreServiceToService(c.kservice, loadBalancer)
+			if c.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), c.expectedError) {
+					t.Errorf("expected error with %q, got %v", c.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if service.Name != coreServiceNamePrefix+c.kservice.Name || service.Namespace != c.kservice.Namespace {
+				t.Errorf("unexpected service name: %s/%s", service.Namespace, service.Name)
+			}
+			if !isCoreService(service) {
+				t.Errorf("service should be marked as core service")
+			}
+			if service.Annotations[annotationKeyServiceClusterIP] != c.kservice.Spec.ClusterIP {
+				t.Errorf("unexpected cluster ip: %s", service.Annotations[annotationKeyServiceClusterIP])
+			}
+			if service.Spec.Endpoint != c.expectedEndpoint {
+				t.Errorf("unexpected endpoint: %s", service.Spec.Endpoint)
+			}
+			if !reflect.DeepEqual(service.Spec.Ports, c.expectedPorts) {
+				t.Errorf("unexpected ports:\n%+v\nexpected:\n%+v", service.Spec.Ports, c.expectedPorts)
+			}
+		})
+	}
+}
+
+func TestCoreServiceToService_NameCollision(t *testing.T) {
+	kservice := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "web",
+			Annotations: map[string]string{annotationKeyCoreServiceRemotePorts: "http"},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: "10.0.0.1",
+			Ports:     []corev1.ServicePort{{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80}},
+		},
+	}
+	converted, err := coreServiceToService(kservice, LoadBalancerOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// NOTE: frpv1 service names might look like the converted name with `.`, or be the bare prefix
+	for _, name := range []string{"corev1.web", "corev1", "corev1.web.http"} {
+		service := &frpv1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+		if service.Name == converted.Name {
+			t.Errorf("service %s collides with the converted core service", name)
+		}
+		for _, portName := range []string{"http", "web-http"} {
+			if serviceProxyName(service, portName) == serviceProxyName(converted, "http") {
+				t.Errorf("proxy name of service %s port %s collides with the converted core service", name, portName)
+			}
+		}
+	}
+}
+
+func TestEndpointReconciler_RecordInvalidCoreService(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &EndpointReconciler{Recorder: recorder}
+	kservice := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "web-uid"},
+	}
+
+	r.recordInvalidCoreService(kservice, errors.New("port https not found in service web"))
+	r.recordInvalidCoreService(kservice, errors.New("port https not found in service web"))
+	r.recordInvalidCoreService(kservice, errors.New("service web has no cluster ip"))
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	expected := []string{
+		"Warning InvalidCoreService port https not found in service web",
+		"Warning InvalidCoreService service web has no cluster ip",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
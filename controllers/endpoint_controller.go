@@ -2,25 +2,72 @@ package controllers
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
+	"github.com/b4fun/frpcontroller/pkg/frpcadmin"
 	"github.com/b4fun/frpcontroller/pkg/frpconfig"
+	"github.com/b4fun/frpcontroller/pkg/oidc"
 
 	frpv1 "github.com/b4fun/frpcontroller/api/v1"
 )
 
 const (
-	endpointOwnerKey = ".metadata.controller"
+	endpointOwnerKey       = ".metadata.controller"
+	endpointSecretRefKey   = ".spec.secretRefs"
+	coreServiceEndpointKey = ".metadata.annotations.endpoint"
+
+	// frpcMinReadySeconds specifies the seconds for a new frpc pod to wait
+	// before it's treated as available.
+	frpcMinReadySeconds = 10
+
+	// frpcPodNameEnv specifies the env of the frpc container holding the pod name.
+	frpcPodNameEnv = "FRPC_POD_NAME"
+
+	// frpcProxyNamePodSeparator separates the proxy name and the frpc pod name,
+	// which cannot be contained in the resource names.
+	frpcProxyNamePodSeparator = "@"
+
+	// frpcAdminTimeout specifies the timeout for calling frpc admin api.
+	frpcAdminTimeout = 10 * time.Second
+
+	// frpcStatusPollInterval specifies the interval for polling frpc status.
+	frpcStatusPollInterval = 30 * time.Second
+
+	// frpcContainerName specifies the name of the frpc container.
+	frpcContainerName = "frpc"
+
+	// frpcLogTailLines specifies the lines of frpc logs to parse the status from.
+	frpcLogTailLines = 200
+
+	// oidcTokenTimeout specifies the timeout for requesting the OIDC token endpoint.
+	oidcTokenTimeout = 10 * time.Second
 )
 
 // EndpointReconciler reconciles a Endpoint object
@@ -28,22 +75,50 @@ type EndpointReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// Clientset is used for reading frpc logs, optional.
+	Clientset kubernetes.Interface
+	// LoadBalancer configures the LoadBalancer services implemented by frp, optional.
+	LoadBalancer LoadBalancerOptions
+	// Ingress configures the ingresses implemented by frp, optional.
+	Ingress IngressOptions
+	// Gateway configures the Gateway API implemented by frp, optional.
+	Gateway GatewayOptions
+	// DefaultImage specifies the frpc image for the endpoints without image, optional.
+	DefaultImage string
+	// Recorder records the warning events of the invalid core services, events are skipped if not set.
+	Recorder record.EventRecorder
+
+	// coreServiceWarnings remembers the last warning recorded for each invalid core service,
+	// so the warning is recorded once instead of on every reconcile.
+	coreServiceWarnings sync.Map
+	// oidcTokenChecks caches the oidcTokenCheck of each endpoint failed to login,
+	// so the OIDC provider is requested once per spec instead of on every reconcile.
+	oidcTokenChecks sync.Map
+}
+
+// oidcTokenCheck is the result of requesting the OIDC token with the endpoint spec.
+type oidcTokenCheck struct {
+	Generation       int64
+	ClientSecretHash string
+	Err              error
 }
 
 // +kubebuilder:rbac:groups=frp.go.build4.fun,resources=endpoints,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=frp.go.build4.fun,resources=endpoints/status,verbs=get;update;patch
 
-func (r *EndpointReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	ctx := context.Background()
+func (r *EndpointReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := r.Log.WithValues("endpoint", req.NamespacedName)
 
 	var endpoint frpv1.Endpoint
 	err := r.Get(ctx, req.NamespacedName, &endpoint)
 	switch {
+	case err == nil && endpoint.DeletionTimestamp != nil:
+		return r.handleDeleted(ctx, logger, newEndpointView(&endpoint))
 	case err == nil:
-		return r.handleCreateOrUpdate(ctx, logger, &endpoint)
+		return r.handleCreateOrUpdate(ctx, logger, newEndpointView(&endpoint))
 	case apierrors.IsNotFound(err):
-		return r.handleDeleted(ctx, logger, &endpoint)
+		// NOTE: the endpoint has been cleaned up before removing the finalizer
+		return ctrl.Result{}, nil
 	default:
 		logger.Error(err, "get endpoint failed")
 		return ctrl.Result{}, err
@@ -53,81 +128,235 @@ func (r *EndpointReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 func (r *EndpointReconciler) handleCreateOrUpdate(
 	ctx context.Context,
 	logger logr.Logger,
-	endpoint *frpv1.Endpoint,
+	endpoint *endpointView,
 ) (ctrl.Result, error) {
-	frpcConfig, err := r.ensureEndpointConfigMap(ctx, logger, endpoint)
+	if !hasFinalizer(endpoint.Object, finalizerEndpoint) {
+		controllerutil.AddFinalizer(endpoint.Object, finalizerEndpoint)
+		if err := r.Update(ctx, endpoint.Object); err != nil {
+			logger.Error(err, "add finalizer failed")
+			return ctrl.Result{}, err
+		}
+	}
+
+	endpointStatus := endpoint.Status.DeepCopy()
+
+	frpcConfig, err := r.ensureEndpointConfigSecret(ctx, logger, endpoint)
 	if err != nil {
-		return ctrl.Result{}, nil
+		setCondition(
+			&endpoint.Status.Conditions, endpoint.Generation,
+			frpv1.ConditionConfigGenerated, metav1.ConditionFalse,
+			reasonConfigGenerateFailed, err.Error(),
+		)
+		if statusErr := r.updateEndpointStatus(ctx, logger, endpoint, endpointStatus); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
+		return ctrl.Result{}, err
+	}
+	setCondition(
+		&endpoint.Status.Conditions, endpoint.Generation,
+		frpv1.ConditionConfigGenerated, metav1.ConditionTrue,
+		reasonConfigGenerated, fmt.Sprintf("frpc config is stored in secret %s", frpcConfig.Name),
+	)
+
+	frpcDeployment, err := r.ensureEndpointDeployment(ctx, logger, endpoint, frpcConfig)
+	if err != nil {
+		return ctrl.Result{}, err
 	}
 
-	frpcPod, err := r.ensureEndpointPod(ctx, logger, endpoint, frpcConfig)
+	var podList corev1.PodList
+	err = r.List(
+		ctx, &podList,
+		client.InNamespace(endpoint.Namespace),
+		client.MatchingLabels{endpoint.LabelKey: endpoint.Name},
+	)
 	if err != nil {
+		logger.Error(err, "list endpoint pods failed")
+		return ctrl.Result{}, err
+	}
+
+	setEndpointPodConditions(endpoint.Endpoint, frpcDeployment, podList.Items)
+
+	if err := r.reloadEndpointPods(ctx, logger, endpoint, frpcConfig, frpcDeployment, podList.Items); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	r.observeEndpointPods(ctx, logger, endpoint, frpcConfig, frpcDeployment, podList.Items)
+
+	endpoint.Status.State = frpv1.EndpointDisconnected
+	if frpv1.IsConditionTrue(endpoint.Status.Conditions, frpv1.ConditionServerReachable) {
+		endpoint.Status.State = frpv1.EndpointConnected
+	}
+	if err := r.updateEndpointStatus(ctx, logger, endpoint, endpointStatus); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// NOTE: changes from the owned resources and the bound services will trigger
+	//       the reconcile, requeue here is for polling the frpc status until
+	//       the proxies are running.
+	if frpv1.IsConditionTrue(endpoint.Status.Conditions, frpv1.ConditionServerReachable) &&
+		frpv1.IsConditionTrue(endpoint.Status.Conditions, frpv1.ConditionProxiesRegistered) {
 		return ctrl.Result{}, nil
 	}
+	return ctrl.Result{RequeueAfter: frpcStatusPollInterval}, nil
+}
 
-	if frpcPod.Status.Phase == corev1.PodRunning {
-		endpoint.Status = frpv1.EndpointStatus{
-			State: frpv1.EndpointConnected,
-		}
-		if err := r.Status().Update(ctx, endpoint); err != nil {
-			return ctrl.Result{}, err
-		}
-	} else {
-		endpoint.Status = frpv1.EndpointStatus{
-			State: frpv1.EndpointDisconnected,
-		}
-		if err := r.Status().Update(ctx, endpoint); err != nil {
-			return ctrl.Result{}, err
-		}
+// syncEndpointConfig regenerates the frpc config and reloads the frpc pods of the endpoint,
+// used for unregistering the proxies of the deleting services.
+func (r *EndpointReconciler) syncEndpointConfig(
+	ctx context.Context,
+	logger logr.Logger,
+	endpoint *endpointView,
+) error {
+	frpcConfig, err := r.ensureEndpointConfigSecret(ctx, logger, endpoint)
+	if err != nil {
+		return err
+	}
+
+	var deploymentList appsv1.DeploymentList
+	err = r.List(
+		ctx, &deploymentList,
+		client.InNamespace(endpoint.Namespace),
+		client.MatchingFields{endpoint.OwnerKey: endpoint.Name},
+	)
+	if err != nil {
+		logger.Error(err, "list endpoint deployments failed")
+		return err
+	}
+	if len(deploymentList.Items) == 0 {
+		// NOTE: no frpc running
+		return nil
 	}
 
-	return ctrl.Result{
-		// update 10s later
-		// TODO: can we trigger update in service side?
-		RequeueAfter: time.Duration(10 * time.Second),
-	}, nil
+	var podList corev1.PodList
+	err = r.List(
+		ctx, &podList,
+		client.InNamespace(endpoint.Namespace),
+		client.MatchingLabels{endpoint.LabelKey: endpoint.Name},
+	)
+	if err != nil {
+		logger.Error(err, "list endpoint pods failed")
+		return err
+	}
+
+	return r.reloadEndpointPods(ctx, logger, endpoint, frpcConfig, &deploymentList.Items[0], podList.Items)
+}
+
+// updateEndpointStatus updates the endpoint status if it differs from the previous one.
+func (r *EndpointReconciler) updateEndpointStatus(
+	ctx context.Context,
+	logger logr.Logger,
+	endpoint *endpointView,
+	previousStatus *frpv1.EndpointStatus,
+) error {
+	endpoint.Status.ObservedGeneration = endpoint.Generation
+	if apiequality.Semantic.DeepEqual(previousStatus, &endpoint.Status) {
+		return nil
+	}
+
+	endpoint.syncStatus()
+	if err := r.Status().Update(ctx, endpoint.Object); err != nil {
+		logger.Error(err, "update endpoint status failed")
+		return err
+	}
+	logger.Info(fmt.Sprintf("updated endpoint status to: %s", endpoint.Status.State))
+
+	return nil
 }
 
 func (r *EndpointReconciler) handleDeleted(
 	ctx context.Context,
 	logger logr.Logger,
-	endpoint *frpv1.Endpoint,
+	endpoint *endpointView,
 ) (ctrl.Result, error) {
+	if !hasFinalizer(endpoint.Object, finalizerEndpoint) {
+		return ctrl.Result{}, nil
+	}
+
+	if endpoint.Spec.DeletionPolicy == frpv1.EndpointDeletionPolicyBlock {
+		services, err := r.listEndpointServices(ctx, endpoint)
+		if err != nil {
+			logger.Error(err, "list services failed")
+			return ctrl.Result{}, err
+		}
+
+		if len(services) > 0 {
+			var serviceNames []string
+			for i := range services {
+				serviceNames = append(serviceNames, serviceDisplayName(&services[i]))
+			}
+			logger.Info(fmt.Sprintf(
+				"endpoint deletion is blocked by services: %s",
+				strings.Join(serviceNames, ", "),
+			))
+
+			endpointStatus := endpoint.Status.DeepCopy()
+			setCondition(
+				&endpoint.Status.Conditions, endpoint.Generation,
+				frpv1.ConditionDeletionBlocked, metav1.ConditionTrue,
+				reasonServicesReferenced, fmt.Sprintf(
+					"endpoint is referenced by services: %s",
+					strings.Join(serviceNames, ", "),
+				),
+			)
+			if err := r.updateEndpointStatus(ctx, logger, endpoint, endpointStatus); err != nil {
+				return ctrl.Result{}, err
+			}
+
+			// NOTE: keep serving the remaining services until they are deleted
+			return r.handleCreateOrUpdate(ctx, logger, endpoint)
+		}
+	}
+
+	// NOTE: the referencing services will be marked as orphaned by the service controller,
+	//       owned resources are cleaned up by the garbage collector.
+	controllerutil.RemoveFinalizer(endpoint.Object, finalizerEndpoint)
+	if err := r.Update(ctx, endpoint.Object); err != nil {
+		logger.Error(err, "remove finalizer failed")
+		return ctrl.Result{}, err
+	}
+	logger.Info("removed endpoint finalizer")
+	r.oidcTokenChecks.Delete(endpoint.UID)
+
 	return ctrl.Result{}, nil
 }
 
-func (r *EndpointReconciler) ensureEndpointConfigMap(
+func (r *EndpointReconciler) ensureEndpointConfigSecret(
 	ctx context.Context,
 	logger logr.Logger,
-	endpoint *frpv1.Endpoint,
-) (*corev1.ConfigMap, error) {
+	endpoint *endpointView,
+) (*corev1.Secret, error) {
+	if err := r.cleanupLegacyEndpointConfigMaps(ctx, logger, endpoint); err != nil {
+		return nil, err
+	}
+
 	var (
-		frpcConfigList    corev1.ConfigMapList
-		frpcConfig        *corev1.ConfigMap
+		frpcConfigList    corev1.SecretList
+		frpcConfig        *corev1.Secret
 		frpcConfigExisted bool
 	)
 	err := r.List(
 		ctx, &frpcConfigList,
 		client.InNamespace(endpoint.Namespace),
-		client.MatchingFields{endpointOwnerKey: endpoint.Name},
+		client.MatchingFields{endpoint.OwnerKey: endpoint.Name},
 	)
 	if err != nil {
-		logger.Error(err, "list endpoint config maps failed")
+		logger.Error(err, "list endpoint secrets failed")
 		return nil, err
 	}
 	if len(frpcConfigList.Items) == 0 {
-		logger.Info("no endpoint config map found, will create")
+		logger.Info("no endpoint secret found, will create")
 		frpcConfigExisted = false
-		frpcConfig = &corev1.ConfigMap{
+		frpcConfig = &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
 				Labels:       map[string]string{},
 				Annotations:  map[string]string{},
 				GenerateName: fmt.Sprintf("%s-frpc-", endpoint.Name),
 				Namespace:    endpoint.Namespace,
 			},
-			Data: map[string]string{},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{},
 		}
-		err := ctrl.SetControllerReference(endpoint, frpcConfig, r.Scheme)
+		err := ctrl.SetControllerReference(endpoint.Object, frpcConfig, r.Scheme)
 		if err != nil {
 			logger.Error(err, "set controller reference failed")
 			return nil, err
@@ -136,51 +365,143 @@ func (r *EndpointReconciler) ensureEndpointConfigMap(
 		frpcConfigExisted = true
 		frpcConfig = &frpcConfigList.Items[0]
 		logger.Info(fmt.Sprintf(
-			"found %d config maps, using %s",
+			"found %d secrets, using %s",
 			len(frpcConfigList.Items),
 			frpcConfig.Name),
 		)
 	}
 
-	var serviceList frpv1.ServiceList
-	err = r.List(
-		ctx, &serviceList,
-		client.InNamespace(endpoint.Namespace),
-		client.MatchingLabels{
-			labelKeyEndpointName: endpoint.Name,
-		},
-	)
+	services, err := r.listEndpointServices(ctx, endpoint)
 	if err != nil {
 		logger.Error(err, "list services failed")
 		return nil, err
 	}
+	coreServices, err := r.listEndpointCoreServices(ctx, endpoint)
+	if err != nil {
+		logger.Error(err, "list core services failed")
+		return nil, err
+	}
+	services = append(services, coreServices...)
+
+	adminPassword := string(frpcConfig.Data[frpcAdminPasswordKey])
+	if adminPassword == "" {
+		adminPassword, err = generateFrpcSecret()
+		if err != nil {
+			logger.Error(err, "generate frpc admin password failed")
+			return nil, err
+		}
+	}
+	groupKey := string(frpcConfig.Data[frpcGroupKeyKey])
+	if groupKey == "" {
+		groupKey, err = generateFrpcSecret()
+		if err != nil {
+			logger.Error(err, "generate frpc group key failed")
+			return nil, err
+		}
+	}
+
+	var visitorList frpv1.VisitorList
+	if endpoint.Kind == KindEndpoint {
+		// NOTE: visitors can only bind to the endpoint in the same namespace
+		err = r.List(
+			ctx, &visitorList,
+			client.InNamespace(endpoint.Namespace),
+			client.MatchingLabels{
+				labelKeyEndpointName: endpoint.Name,
+			},
+		)
+		if err != nil {
+			logger.Error(err, "list visitors failed")
+			return nil, err
+		}
+	}
+
+	token, err := r.resolveEndpointToken(ctx, endpoint)
+	if err != nil {
+		logger.Error(err, "resolve endpoint token failed")
+		return nil, err
+	}
+	oidcClientSecret, err := r.resolveEndpointOIDCClientSecret(ctx, endpoint)
+	if err != nil {
+		logger.Error(err, "resolve endpoint oidc client secret failed")
+		return nil, err
+	}
 
-	frpcConfigContent, err := r.generateFrpcConfig(ctx, endpoint, &serviceList)
+	endpoint.Status.Allocations = allocateRemotePorts(endpoint.Endpoint, services)
+
+	config, err := r.generateFrpcConfig(
+		ctx, endpoint, services, &visitorList,
+		endpoint.Status.Allocations, token, oidcClientSecret, adminPassword,
+	)
+	if err != nil {
+		logger.Error(err, "generate frpc config failed")
+		return nil, err
+	}
+	if err := r.generateIngressApps(ctx, logger, endpoint, config); err != nil {
+		logger.Error(err, "generate ingress proxies failed")
+		return nil, err
+	}
+	if err := r.generateGatewayApps(ctx, logger, endpoint, config); err != nil {
+		logger.Error(err, "generate gateway proxies failed")
+		return nil, err
+	}
+	groupFrpcApps(config, groupKey)
+	configFormat := endpointConfigFormat(endpoint)
+	frpcConfigContent, err := config.Generate(configFormat)
+	if err != nil {
+		logger.Error(err, "generate frpc config failed")
+		return nil, err
+	}
+	// NOTE: frpc can reload proxies without restarting, but changes in the
+	//       common section require a restart
+	frpcCommonConfigContent, err := (&frpconfig.FrpcConfig{Common: config.Common}).Generate(configFormat)
 	if err != nil {
 		logger.Error(err, "generate frpc config failed")
 		return nil, err
 	}
 
 	if frpcConfig.Data == nil {
-		frpcConfig.Data = map[string]string{}
+		frpcConfig.Data = map[string][]byte{}
+	}
+	for _, format := range []frpconfig.Format{
+		frpconfig.FormatINI, frpconfig.FormatTOML, frpconfig.FormatYAML, frpconfig.FormatJSON,
+	} {
+		// NOTE: remove the config of the previous format
+		delete(frpcConfig.Data, format.FileName(frpcConfigBaseName))
+	}
+	frpcConfig.Data[configFormat.FileName(frpcConfigBaseName)] = []byte(frpcConfigContent)
+	frpcConfig.Data[frpcAdminPasswordKey] = []byte(adminPassword)
+	frpcConfig.Data[frpcGroupKeyKey] = []byte(groupKey)
+	if frpcConfig.Annotations == nil {
+		frpcConfig.Annotations = map[string]string{}
+	}
+	frpcConfig.Annotations[annotationKeyEndpointPodConfigHash] = frpcConfigHash(frpcCommonConfigContent)
+	tlsHash, err := r.resolveEndpointTLSHash(ctx, endpoint)
+	if err != nil {
+		logger.Error(err, "resolve endpoint tls certificates failed")
+		return nil, err
+	}
+	if tlsHash != "" {
+		frpcConfig.Annotations[annotationKeyEndpointPodTLSHash] = tlsHash
+	} else {
+		delete(frpcConfig.Annotations, annotationKeyEndpointPodTLSHash)
 	}
-	frpcConfig.Data[frpcFileName] = frpcConfigContent
 
 	if frpcConfigExisted {
 		if err := r.Update(ctx, frpcConfig); err != nil {
-			logger.Error(err, "update config map failed")
+			logger.Error(err, "update secret failed")
 			return nil, err
 		}
-		logger.Info(fmt.Sprintf("updated config map: %s (%s)",
+		logger.Info(fmt.Sprintf("updated secret: %s (%s)",
 			frpcConfig.Name,
 			frpcConfig.ResourceVersion,
 		))
 	} else {
 		if err := r.Create(ctx, frpcConfig); err != nil {
-			logger.Error(err, "create config map failed")
+			logger.Error(err, "create secret failed")
 			return nil, err
 		}
-		logger.Info(fmt.Sprintf("created config map: %s (%s)",
+		logger.Info(fmt.Sprintf("created secret: %s (%s)",
 			frpcConfig.Name,
 			frpcConfig.ResourceVersion,
 		))
@@ -191,19 +512,73 @@ func (r *EndpointReconciler) ensureEndpointConfigMap(
 
 func (r *EndpointReconciler) generateFrpcConfig(
 	ctx context.Context,
-	endpoint *frpv1.Endpoint,
-	services *frpv1.ServiceList,
-) (string, error) {
+	endpoint *endpointView,
+	services []frpv1.Service,
+	visitors *frpv1.VisitorList,
+	allocations []frpv1.PortAllocation,
+	token string,
+	oidcClientSecret string,
+	adminPassword string,
+) (*frpconfig.FrpcConfig, error) {
 	config := &frpconfig.FrpcConfig{
 		Common: &frpconfig.ConfigCommon{
 			ServerAddr: endpoint.Spec.Addr,
 			ServerPort: int(endpoint.Spec.Port),
-			Token:      endpoint.Spec.Token,
+			Token:      token,
+			AdminAddr:  "0.0.0.0",
+			AdminPort:  frpcAdminPort,
+			AdminUser:  frpcAdminUser,
+			AdminPwd:   adminPassword,
 		},
-		Apps: map[string]*frpconfig.ConfigApp{},
+		Apps:     map[string]*frpconfig.ConfigApp{},
+		Visitors: map[string]*frpconfig.ConfigVisitor{},
+	}
+
+	if tls := endpoint.Spec.TLS; tls != nil {
+		enabled := tls.Enabled
+		config.Common.TLSEnable = &enabled
+		config.Common.TLSServerName = tls.ServerName
+		if tls.TrustedCASecretRef != nil {
+			config.Common.TLSTrustedCaFile = frpcTLSTrustedCAFile
+		}
+		if tls.ClientCertSecretRef != nil {
+			config.Common.TLSCertFile = frpcTLSClientCertFile
+			config.Common.TLSKeyFile = frpcTLSClientKeyFile
+		}
+	}
+
+	if auth := endpoint.Spec.Auth; auth != nil {
+		config.Common.AuthenticationMethod = frpconfig.AuthenticationMethodToken
+		config.Common.AuthenticateHeartbeats = auth.AuthenticateHeartbeats
+		config.Common.AuthenticateNewWorkConns = auth.AuthenticateNewWorkConns
+		if oidc := auth.OIDC; oidc != nil {
+			config.Common.AuthenticationMethod = frpconfig.AuthenticationMethodOIDC
+			config.Common.Token = ""
+			config.Common.OIDCClientID = oidc.ClientID
+			config.Common.OIDCClientSecret = oidcClientSecret
+			config.Common.OIDCAudience = oidc.Audience
+			config.Common.OIDCScope = oidc.Scope
+			config.Common.OIDCTokenEndpointURL = oidc.TokenEndpointURL
+		}
+	}
+
+	if transport := endpoint.Spec.Transport; transport != nil {
+		config.Common.Protocol = string(transport.Protocol)
+		config.Common.TCPMux = transport.TCPMux
+		config.Common.PoolCount = int(transport.PoolCount)
+		config.Common.HeartbeatInterval = int(transport.HeartbeatIntervalSeconds)
+		config.Common.HeartbeatTimeout = int(transport.HeartbeatTimeoutSeconds)
+		config.Common.DialServerTimeout = int(transport.DialServerTimeoutSeconds)
+		config.Common.HTTPProxy = transport.HTTPProxy
 	}
 
-	for _, service := range services.Items {
+	for _, service := range services {
+		if service.DeletionTimestamp != nil {
+			// NOTE: unregister the proxies of the deleting service
+			continue
+		}
+		// NOTE: the defaulting webhook might be disabled
+		service.Default()
 		if service.Annotations == nil {
 			continue
 		}
@@ -213,132 +588,1141 @@ func (r *EndpointReconciler) generateFrpcConfig(
 		}
 
 		for _, port := range service.Spec.Ports {
-			appName := fmt.Sprintf("%s_%s", service.Name, port.Name)
-			config.Apps[appName] = &frpconfig.ConfigApp{
-				Type:       strings.ToLower(string(port.Protocol)),
-				RemotePort: int(port.RemotePort),
-				// NOTE: the service is exposed with remote port
-				LocalPort: int(port.RemotePort),
-				LocalAddr: localAddr,
+			if port.Protocol.IsSecret() && port.SecretKeyRef == nil {
+				// NOTE: secret proxies without secret key are accessible by anyone,
+				//       which are rejected by the validating webhook
+				continue
+			}
+
+			remotePort := port.RemotePort
+			if port.Protocol.HasRemotePort() {
+				allocation := findPortAllocation(allocations, &service, port.Name)
+				if allocation == nil || allocation.Error != "" {
+					// NOTE: the conflicting port is reported in the service status
+					continue
+				}
+				remotePort = allocation.RemotePort
+			}
+
+			// NOTE: the generated service is exposed with remote port,
+			//       while the core service is exposed with its own port
+			localPort := remotePort
+			if isCoreService(&service) {
+				localPort = port.LocalPort
+			}
+
+			appName := serviceProxyName(&service, port.Name)
+			app, err := r.generateServicePortApp(ctx, &service, port, remotePort, localAddr, localPort)
+			if err != nil {
+				return nil, err
 			}
+			config.Apps[appName] = app
 		}
 	}
 
-	return config.GenerateIni()
+	for _, visitor := range visitors.Items {
+		if visitor.DeletionTimestamp != nil || visitorPortConflict(&visitor, visitors.Items) != "" {
+			// NOTE: the conflicting port is reported in the visitor status
+			continue
+		}
+		sk, err := getSecretKeyValue(ctx, r.Client, visitor.Namespace, &visitor.Spec.SecretKeyRef)
+		if err != nil {
+			return nil, err
+		}
+
+		// NOTE: visitor section names never conflict with the app section names,
+		//       as resource names cannot contain `_`
+		visitorName := fmt.Sprintf("%s.visitor", visitor.Name)
+		config.Visitors[visitorName] = &frpconfig.ConfigVisitor{
+			Type:       strings.ToLower(string(visitor.Spec.Protocol)),
+			Role:       frpconfig.RoleVisitor,
+			ServerName: visitor.Spec.ServerName,
+			SK:         sk,
+			BindAddr:   "0.0.0.0",
+			BindPort:   int(visitor.Spec.Port),
+		}
+	}
+
+	return config, nil
 }
 
-func (r *EndpointReconciler) ensureEndpointPod(
+func (r *EndpointReconciler) generateServicePortApp(
 	ctx context.Context,
-	logger logr.Logger,
-	endpoint *frpv1.Endpoint,
-	frpcConfig *corev1.ConfigMap,
-) (*corev1.Pod, error) {
-	var (
-		podList corev1.PodList
-		pod     *corev1.Pod
-	)
-	err := r.List(
-		ctx, &podList,
-		client.InNamespace(endpoint.Namespace),
-		client.MatchingFields{endpointOwnerKey: endpoint.Name},
-	)
-	if err != nil {
-		logger.Error(err, "list endpoint pods failed")
-		return nil, err
+	service *frpv1.Service,
+	port frpv1.ServicePort,
+	remotePort int32,
+	localAddr string,
+	localPort int32,
+) (*frpconfig.ConfigApp, error) {
+	app := &frpconfig.ConfigApp{
+		Type:      strings.ToLower(string(port.Protocol)),
+		LocalPort: int(localPort),
+		LocalAddr: localAddr,
+
+		UseEncryption:      port.UseEncryption,
+		UseCompression:     port.UseCompression,
+		BandwidthLimit:     port.BandwidthLimit,
+		BandwidthLimitMode: string(port.BandwidthLimitMode),
+	}
+	if port.Protocol.SupportsProxyProtocol() {
+		app.ProxyProtocolVersion = string(port.ProxyProtocolVersion)
 	}
 
-	for _, p := range podList.Items {
-		if len(p.Annotations) > 0 {
-			configVersion, exists := p.Annotations[annotationKeyEndpointPodConfigVersion]
-			if exists && configVersion == frpcConfig.ResourceVersion {
-				pod = &p
-				logger.Info(fmt.Sprintf("found pod with updated config: %s", p.Name))
-				break
+	if port.Protocol.IsSecret() {
+		if port.SecretKeyRef != nil {
+			var err error
+			app.SK, err = getSecretKeyValue(ctx, r.Client, service.Namespace, port.SecretKeyRef)
+			if err != nil {
+				return nil, err
 			}
 		}
+		return app, nil
 	}
-	for _, p := range podList.Items {
-		if pod != nil && p.Name == pod.Name {
-			// retain
-			continue
+
+	if !port.Protocol.IsHTTP() {
+		app.RemotePort = int(remotePort)
+		return app, nil
+	}
+
+	app.CustomDomains = port.CustomDomains
+	app.SubDomain = port.Subdomain
+	if port.Protocol == frpv1.ServicePortHTTP {
+		// NOTE: https proxies are routed by sni, the following settings
+		//       are for http proxies only
+		app.Locations = port.Locations
+		app.HostHeaderRewrite = port.HostHeaderRewrite
+		app.Headers = port.RequestHeaders
+
+		if port.HTTPAuthSecretRef != nil {
+			var err error
+			app.HTTPUser, err = getSecretKeyValue(ctx, r.Client, service.Namespace, &corev1.SecretKeySelector{
+				LocalObjectReference: *port.HTTPAuthSecretRef,
+				Key:                  corev1.BasicAuthUsernameKey,
+			})
+			if err != nil {
+				return nil, err
+			}
+			app.HTTPPwd, err = getSecretKeyValue(ctx, r.Client, service.Namespace, &corev1.SecretKeySelector{
+				LocalObjectReference: *port.HTTPAuthSecretRef,
+				Key:                  corev1.BasicAuthPasswordKey,
+			})
+			if err != nil {
+				return nil, err
+			}
 		}
-		err = r.Delete(ctx, &p)
+	}
+
+	return app, nil
+}
+
+// groupFrpcApps registers the tcp / http proxies in load balancing groups named by the proxy names,
+// and suffixes the proxy names with the frpc pod name (rendered by frpc from the env).
+// frps rejects the proxies with the same name or remote port, so the proxies are registered
+// by the old and new frpc pods at the same time during the rollout with the groups.
+func groupFrpcApps(config *frpconfig.FrpcConfig, groupKey string) {
+	var appNames []string
+	for appName, app := range config.Apps {
+		// NOTE: frps supports load balancing for tcp / http proxies only
+		if app.Type == "tcp" || app.Type == "http" {
+			appNames = append(appNames, appName)
+		}
+	}
+	for _, appName := range appNames {
+		app := config.Apps[appName]
+		delete(config.Apps, appName)
+		app.Group = appName
+		app.GroupKey = groupKey
+		podAppName := fmt.Sprintf("%s%s{{ .Envs.%s }}", appName, frpcProxyNamePodSeparator, frpcPodNameEnv)
+		config.Apps[podAppName] = app
+	}
+}
+
+// trimProxyNamePod trims the frpc pod name suffix of the load balanced proxy names.
+func trimProxyNamePod(proxyName string) string {
+	name, _, _ := strings.Cut(proxyName, frpcProxyNamePodSeparator)
+	return name
+}
+
+// endpointConfigFormat returns the format of the frpc config.
+func endpointConfigFormat(endpoint *endpointView) frpconfig.Format {
+	return frpconfig.Format(strings.ToLower(string(endpoint.Spec.GetConfigFormat())))
+}
+
+// endpointImage returns the frpc image of the endpoint.
+func (r *EndpointReconciler) endpointImage(endpoint *endpointView) string {
+	if endpoint.Spec.Image != "" {
+		return endpoint.Spec.Image
+	}
+	if r.DefaultImage != "" {
+		return r.DefaultImage
+	}
+	return frpDockerImage
+}
+
+// resolveEndpointTLSHash resolves the hash of the tls certificates of the endpoint,
+// returns empty if no certificates specified.
+func (r *EndpointReconciler) resolveEndpointTLSHash(
+	ctx context.Context,
+	endpoint *endpointView,
+) (string, error) {
+	tls := endpoint.Spec.TLS
+	if tls == nil || !tls.Enabled {
+		return "", nil
+	}
+
+	var selectors []*corev1.SecretKeySelector
+	if tls.TrustedCASecretRef != nil {
+		selectors = append(selectors, tls.TrustedCASecretRef)
+	}
+	if tls.ClientCertSecretRef != nil {
+		selectors = append(selectors,
+			&corev1.SecretKeySelector{LocalObjectReference: *tls.ClientCertSecretRef, Key: corev1.TLSCertKey},
+			&corev1.SecretKeySelector{LocalObjectReference: *tls.ClientCertSecretRef, Key: corev1.TLSPrivateKeyKey},
+		)
+	}
+	if len(selectors) == 0 {
+		return "", nil
+	}
+
+	var content strings.Builder
+	for _, selector := range selectors {
+		value, err := getSecretKeyValue(ctx, r.Client, endpoint.Namespace, selector)
 		if err != nil {
-			logger.Error(err, fmt.Sprintf("delete pod %s failed", p.Name))
-			return nil, err
+			return "", err
 		}
-		logger.Info(fmt.Sprintf("deleted pod %s", p.Name))
+		content.WriteString(value)
 	}
+	return frpcConfigHash(content.String()), nil
+}
 
-	if pod != nil {
-		return pod, nil
+// applyEndpointTLSVolumes mounts the tls certificates into the frpc container.
+func applyEndpointTLSVolumes(template *corev1.PodTemplateSpec, tls *frpv1.EndpointTLS) {
+	if tls == nil || !tls.Enabled {
+		return
 	}
 
 	const (
-		frpcVolumeName    = "frpc-config"
-		frpcContainerName = "frpc"
+		frpcTLSCAVolumeName     = "frpc-tls-ca"
+		frpcTLSClientVolumeName = "frpc-tls-client"
 	)
 
-	pod = &corev1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Labels: map[string]string{},
-			Annotations: map[string]string{
-				annotationKeyEndpointPodConfigVersion: frpcConfig.ResourceVersion,
-			},
-			GenerateName: fmt.Sprintf("%s-frpc-", endpoint.Name),
-			Namespace:    endpoint.Namespace,
-		},
-		Spec: corev1.PodSpec{
-			Volumes: []corev1.Volume{
-				{
-					Name: frpcVolumeName,
-					VolumeSource: corev1.VolumeSource{
-						ConfigMap: &corev1.ConfigMapVolumeSource{
-							LocalObjectReference: corev1.LocalObjectReference{
-								Name: frpcConfig.Name,
-							},
+	var volumeMounts []corev1.VolumeMount
+	if tls.TrustedCASecretRef != nil {
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name: frpcTLSCAVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: tls.TrustedCASecretRef.Name,
+					Items: []corev1.KeyToPath{
+						{
+							Key:  tls.TrustedCASecretRef.Key,
+							Path: path.Base(frpcTLSTrustedCAFile),
 						},
 					},
 				},
 			},
-			Containers: []corev1.Container{
-				{
-					Name:    frpcContainerName,
-					Image:   frpDockerImage,
-					Command: []string{"/opt/frp/frpc"},
-					Args:    []string{"-c", "/data/frpc.ini"},
-					VolumeMounts: []corev1.VolumeMount{
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      frpcTLSCAVolumeName,
+			ReadOnly:  true,
+			MountPath: path.Dir(frpcTLSTrustedCAFile),
+		})
+	}
+	if tls.ClientCertSecretRef != nil {
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name: frpcTLSClientVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: tls.ClientCertSecretRef.Name,
+					Items: []corev1.KeyToPath{
 						{
-							Name:      frpcVolumeName,
-							ReadOnly:  true,
-							MountPath: "/data/frpc.ini",
-							SubPath:   "frpc.ini",
+							Key:  corev1.TLSCertKey,
+							Path: path.Base(frpcTLSClientCertFile),
+						},
+						{
+							Key:  corev1.TLSPrivateKeyKey,
+							Path: path.Base(frpcTLSClientKeyFile),
 						},
 					},
 				},
 			},
-		},
+		})
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      frpcTLSClientVolumeName,
+			ReadOnly:  true,
+			MountPath: path.Dir(frpcTLSClientCertFile),
+		})
 	}
-	err = ctrl.SetControllerReference(endpoint, pod, r.Scheme)
+
+	for i := range template.Spec.Containers {
+		container := &template.Spec.Containers[i]
+		if container.Name == frpcContainerName {
+			container.VolumeMounts = append(container.VolumeMounts, volumeMounts...)
+		}
+	}
+}
+
+// endpointReferencedSecrets lists the names of the secrets referenced by the endpoint.
+func endpointReferencedSecrets(spec *frpv1.EndpointSpec) []string {
+	var secretNames []string
+	if spec.TokenSecretRef != nil {
+		secretNames = append(secretNames, spec.TokenSecretRef.Name)
+	}
+	if auth := spec.Auth; auth != nil {
+		if auth.Token != nil {
+			secretNames = append(secretNames, auth.Token.SecretRef.Name)
+		}
+		if auth.OIDC != nil {
+			secretNames = append(secretNames, auth.OIDC.ClientSecretRef.Name)
+		}
+	}
+	if tls := spec.TLS; tls != nil {
+		if tls.TrustedCASecretRef != nil {
+			secretNames = append(secretNames, tls.TrustedCASecretRef.Name)
+		}
+		if tls.ClientCertSecretRef != nil {
+			secretNames = append(secretNames, tls.ClientCertSecretRef.Name)
+		}
+	}
+	return secretNames
+}
+
+// resolveEndpointToken resolves the token to connect the endpoint.
+func (r *EndpointReconciler) resolveEndpointToken(
+	ctx context.Context,
+	endpoint *endpointView,
+) (string, error) {
+	if auth := endpoint.Spec.Auth; auth != nil {
+		if auth.Token == nil {
+			return "", nil
+		}
+		return getSecretKeyValue(ctx, r.Client, endpoint.Namespace, &auth.Token.SecretRef)
+	}
+	if endpoint.Spec.TokenSecretRef == nil {
+		return endpoint.Spec.Token, nil
+	}
+
+	return getSecretKeyValue(ctx, r.Client, endpoint.Namespace, endpoint.Spec.TokenSecretRef)
+}
+
+// resolveEndpointOIDCClientSecret resolves the OIDC client secret to connect the endpoint.
+func (r *EndpointReconciler) resolveEndpointOIDCClientSecret(
+	ctx context.Context,
+	endpoint *endpointView,
+) (string, error) {
+	if endpoint.Spec.Auth == nil || endpoint.Spec.Auth.OIDC == nil {
+		return "", nil
+	}
+
+	return getSecretKeyValue(ctx, r.Client, endpoint.Namespace, &endpoint.Spec.Auth.OIDC.ClientSecretRef)
+}
+
+// checkEndpointOIDCToken requests a token with the OIDC settings of the endpoint,
+// for telling whether a failed login is caused by the OIDC provider.
+// The result is cached until the endpoint spec or the client secret changes, or the endpoint logged in.
+func (r *EndpointReconciler) checkEndpointOIDCToken(
+	ctx context.Context,
+	endpoint *endpointView,
+) error {
+	oidcAuth := endpoint.Spec.Auth.OIDC
+	clientSecret, err := r.resolveEndpointOIDCClientSecret(ctx, endpoint)
 	if err != nil {
-		logger.Error(err, "set controller reference failed")
+		return err
+	}
+	clientSecretHash := frpcConfigHash(clientSecret)
+	if cached, ok := r.oidcTokenChecks.Load(endpoint.UID); ok {
+		check := cached.(oidcTokenCheck)
+		if check.Generation == endpoint.Generation && check.ClientSecretHash == clientSecretHash {
+			return check.Err
+		}
+	}
+
+	tokenCtx, cancel := context.WithTimeout(ctx, oidcTokenTimeout)
+	defer cancel()
+	_, err = (&oidc.Client{
+		TokenEndpointURL: oidcAuth.TokenEndpointURL,
+		ClientID:         oidcAuth.ClientID,
+		ClientSecret:     clientSecret,
+		Audience:         oidcAuth.Audience,
+		Scope:            oidcAuth.Scope,
+	}).Token(tokenCtx)
+	r.oidcTokenChecks.Store(endpoint.UID, oidcTokenCheck{
+		Generation:       endpoint.Generation,
+		ClientSecretHash: clientSecretHash,
+		Err:              err,
+	})
+	return err
+}
+
+func (r *EndpointReconciler) ensureEndpointDeployment(
+	ctx context.Context,
+	logger logr.Logger,
+	endpoint *endpointView,
+	frpcConfig *corev1.Secret,
+) (*appsv1.Deployment, error) {
+	if err := r.cleanupLegacyEndpointPods(ctx, logger, endpoint); err != nil {
 		return nil, err
 	}
-	err = r.Create(ctx, pod)
+
+	var (
+		deploymentList    appsv1.DeploymentList
+		deployment        *appsv1.Deployment
+		deploymentExisted bool
+	)
+	err := r.List(
+		ctx, &deploymentList,
+		client.InNamespace(endpoint.Namespace),
+		client.MatchingFields{endpoint.OwnerKey: endpoint.Name},
+	)
+	if err != nil {
+		logger.Error(err, "list endpoint deployments failed")
+		return nil, err
+	}
+	if len(deploymentList.Items) == 0 {
+		logger.Info("no endpoint deployment found, will create")
+		deploymentExisted = false
+		deployment = &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{
+					endpoint.LabelKey: endpoint.Name,
+				},
+				GenerateName: fmt.Sprintf("%s-frpc-", endpoint.Name),
+				Namespace:    endpoint.Namespace,
+			},
+			Spec: appsv1.DeploymentSpec{
+				// NOTE: selector is immutable, so we only set it on creation
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						endpoint.LabelKey: endpoint.Name,
+					},
+				},
+			},
+		}
+		err := ctrl.SetControllerReference(endpoint.Object, deployment, r.Scheme)
+		if err != nil {
+			logger.Error(err, "set controller reference failed")
+			return nil, err
+		}
+	} else {
+		deploymentExisted = true
+		deployment = &deploymentList.Items[0]
+		logger.Info(fmt.Sprintf(
+			"found %d deployments, using %s",
+			len(deploymentList.Items),
+			deployment.Name),
+		)
+	}
+
+	var (
+		replicas       = int32(1)
+		maxSurge       = intstr.FromInt(1)
+		maxUnavailable = intstr.FromInt(0)
+	)
+	deployment.Spec.Replicas = &replicas
+	deployment.Spec.MinReadySeconds = frpcMinReadySeconds
+	deployment.Spec.Strategy = appsv1.DeploymentStrategy{
+		// NOTE: start the new client before stopping the old one,
+		//       so the existing tunnels are kept during the rollout.
+		//       The tcp / http proxies are registered by both clients in load balancing
+		//       groups (see groupFrpcApps), other proxies are taken over by the new client
+		//       once the old one disconnected.
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxSurge:       &maxSurge,
+			MaxUnavailable: &maxUnavailable,
+		},
+	}
+	podTemplate := r.buildEndpointPodTemplate(endpoint, frpcConfig)
+	if v, exists := deployment.Spec.Template.Annotations[annotationKeyEndpointPodRestartConfigHash]; exists {
+		// retain the restart triggered by failed reload
+		podTemplate.Annotations[annotationKeyEndpointPodRestartConfigHash] = v
+	}
+	deployment.Spec.Template = podTemplate
+
+	specHash, err := endpointDeploymentSpecHash(&deployment.Spec)
+	if err != nil {
+		logger.Error(err, "hash deployment spec failed")
+		return nil, err
+	}
+	if deploymentExisted && deployment.Annotations[annotationKeyEndpointDeploymentSpecHash] == specHash {
+		return deployment, nil
+	}
+	if deployment.Annotations == nil {
+		deployment.Annotations = map[string]string{}
+	}
+	deployment.Annotations[annotationKeyEndpointDeploymentSpecHash] = specHash
+
+	if deploymentExisted {
+		if err := r.Update(ctx, deployment); err != nil {
+			logger.Error(err, "update deployment failed")
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("updated deployment: %s", deployment.Name))
+	} else {
+		if err := r.Create(ctx, deployment); err != nil {
+			logger.Error(err, "create deployment failed")
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("created deployment: %s", deployment.Name))
+	}
+
+	return deployment, nil
+}
+
+// endpointDeploymentSpecHash hashes the deployment spec fields managed by the controller,
+// the defaults filled by the api server are excluded so unchanged specs are not updated.
+func endpointDeploymentSpecHash(spec *appsv1.DeploymentSpec) (string, error) {
+	content, err := json.Marshal(struct {
+		Replicas        *int32                    `json:"replicas"`
+		MinReadySeconds int32                     `json:"minReadySeconds"`
+		Strategy        appsv1.DeploymentStrategy `json:"strategy"`
+		Template        corev1.PodTemplateSpec    `json:"template"`
+	}{
+		Replicas:        spec.Replicas,
+		MinReadySeconds: spec.MinReadySeconds,
+		Strategy:        spec.Strategy,
+		Template:        spec.Template,
+	})
+	if err != nil {
+		return "", err
+	}
+	return frpcConfigHash(string(content)), nil
+}
+
+func (r *EndpointReconciler) buildEndpointPodTemplate(
+	endpoint *endpointView,
+	frpcConfig *corev1.Secret,
+) corev1.PodTemplateSpec {
+	const (
+		frpcConfigVolumeName = "frpc-config"
+		frpcDataVolumeName   = "frpc-data"
+		frpcInitName         = "frpc-init"
+	)
+
+	frpcConfigFileName := endpointConfigFormat(endpoint).FileName(frpcConfigBaseName)
+	frpcImage := r.endpointImage(endpoint)
+
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				endpoint.LabelKey: endpoint.Name,
+			},
+			Annotations: map[string]string{
+				annotationKeyEndpointPodConfigHash: frpcConfig.Annotations[annotationKeyEndpointPodConfigHash],
+			},
+		},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				{
+					Name: frpcConfigVolumeName,
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName: frpcConfig.Name,
+							Items: []corev1.KeyToPath{
+								{
+									Key:  frpcConfigFileName,
+									Path: frpcConfigFileName,
+								},
+							},
+						},
+					},
+				},
+				{
+					// NOTE: frpc writes the config pushed from the admin api back to
+					//       the config file, so it has to be writable
+					Name: frpcDataVolumeName,
+					VolumeSource: corev1.VolumeSource{
+						EmptyDir: &corev1.EmptyDirVolumeSource{},
+					},
+				},
+			},
+			InitContainers: []corev1.Container{
+				{
+					Name:    frpcInitName,
+					Image:   frpcImage,
+					Command: []string{"cp", "/config/" + frpcConfigFileName, "/data/" + frpcConfigFileName},
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      frpcConfigVolumeName,
+							ReadOnly:  true,
+							MountPath: "/config",
+						},
+						{
+							Name:      frpcDataVolumeName,
+							MountPath: "/data",
+						},
+					},
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:    frpcContainerName,
+					Image:   frpcImage,
+					Command: []string{"/opt/frp/frpc"},
+					Args:    []string{"-c", "/data/" + frpcConfigFileName},
+					Env: []corev1.EnvVar{
+						{
+							// NOTE: rendered into the names of the load balanced proxies by frpc
+							Name: frpcPodNameEnv,
+							ValueFrom: &corev1.EnvVarSource{
+								FieldRef: &corev1.ObjectFieldSelector{
+									FieldPath: "metadata.name",
+								},
+							},
+						},
+					},
+					Ports: []corev1.ContainerPort{
+						{
+							Name:          "admin",
+							ContainerPort: frpcAdminPort,
+							Protocol:      corev1.ProtocolTCP,
+						},
+					},
+					// NOTE: frpc starts the admin api after logged in to the server
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							TCPSocket: &corev1.TCPSocketAction{
+								Port: intstr.FromInt(frpcAdminPort),
+							},
+						},
+						PeriodSeconds: 5,
+					},
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      frpcDataVolumeName,
+							MountPath: "/data",
+						},
+					},
+				},
+			},
+		},
+	}
+	applyEndpointTLSVolumes(&template, endpoint.Spec.TLS)
+	if tlsHash := frpcConfig.Annotations[annotationKeyEndpointPodTLSHash]; tlsHash != "" {
+		// NOTE: frpc loads the certificates on start, rolls the pods on rotation
+		template.Annotations[annotationKeyEndpointPodTLSHash] = tlsHash
+	}
+	applyClientPodTemplate(&template, endpoint.Spec.ClientTemplate)
+
+	return template
+}
+
+// applyClientPodTemplate merges the client template over the generated frpc pod template.
+// The labels and annotations managed by the controller are kept.
+func applyClientPodTemplate(template *corev1.PodTemplateSpec, clientTemplate *frpv1.ClientPodTemplate) {
+	if clientTemplate == nil {
+		return
+	}
+
+	for k, v := range clientTemplate.Metadata.Labels {
+		if _, exists := template.Labels[k]; !exists {
+			template.Labels[k] = v
+		}
+	}
+	for k, v := range clientTemplate.Metadata.Annotations {
+		if _, exists := template.Annotations[k]; !exists {
+			template.Annotations[k] = v
+		}
+	}
+
+	spec := clientTemplate.Spec
+	template.Spec.NodeSelector = spec.NodeSelector
+	template.Spec.Tolerations = spec.Tolerations
+	template.Spec.Affinity = spec.Affinity
+	template.Spec.SecurityContext = spec.SecurityContext
+	template.Spec.ImagePullSecrets = spec.ImagePullSecrets
+	template.Spec.ServiceAccountName = spec.ServiceAccountName
+	template.Spec.PriorityClassName = spec.PriorityClassName
+
+	for i := range template.Spec.Containers {
+		container := &template.Spec.Containers[i]
+		if container.Name != frpcContainerName {
+			continue
+		}
+		if len(spec.Command) > 0 {
+			container.Command = spec.Command
+		}
+		container.Resources = spec.Resources
+		container.SecurityContext = spec.ContainerSecurityContext
+	}
+	for i := range template.Spec.InitContainers {
+		template.Spec.InitContainers[i].SecurityContext = spec.ContainerSecurityContext
+	}
+}
+
+// reloadEndpointPods pushes the latest frpc config to the running frpc pods
+// through the admin api. The pods will be restarted if the reload failed.
+func (r *EndpointReconciler) reloadEndpointPods(
+	ctx context.Context,
+	logger logr.Logger,
+	endpoint *endpointView,
+	frpcConfig *corev1.Secret,
+	deployment *appsv1.Deployment,
+	pods []corev1.Pod,
+) error {
+	configContent := string(frpcConfig.Data[endpointConfigFormat(endpoint).FileName(frpcConfigBaseName)])
+	configHash := frpcConfigHash(configContent)
+
+	var (
+		reloadErr   error
+		podsApplied int
+	)
+	for i := range pods {
+		pod := &pods[i]
+		if pod.DeletionTimestamp != nil || !isPodReady(pod) {
+			// NOTE: pending pods will be reloaded after ready
+			continue
+		}
+		if !isPodFromTemplate(pod, &deployment.Spec.Template) {
+			// NOTE: pods from previous revision will be replaced by the rollout
+			continue
+		}
+		if pod.Annotations[annotationKeyEndpointPodAppliedConfigHash] == configHash ||
+			pod.Annotations[annotationKeyEndpointPodRestartConfigHash] == configHash {
+			podsApplied++
+			continue
+		}
+
+		adminClient := newFrpcAdminClient(pod, frpcConfig)
+		reloadCtx, cancel := context.WithTimeout(ctx, frpcAdminTimeout)
+		err := adminClient.PutConfig(reloadCtx, configContent)
+		if err == nil {
+			err = adminClient.Reload(reloadCtx)
+		}
+		cancel()
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("reload pod %s failed", pod.Name))
+			reloadErr = err
+			continue
+		}
+
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[annotationKeyEndpointPodAppliedConfigHash] = configHash
+		if err := r.Update(ctx, pod); err != nil {
+			logger.Error(err, fmt.Sprintf("update pod %s failed", pod.Name))
+			return err
+		}
+		logger.Info(fmt.Sprintf("reloaded pod %s with config %s", pod.Name, configHash))
+		podsApplied++
+	}
+
+	switch {
+	case reloadErr != nil:
+		setCondition(
+			&endpoint.Status.Conditions, endpoint.Generation,
+			frpv1.ConditionProxiesRegistered, metav1.ConditionFalse,
+			reasonProxiesReloadFailed,
+			fmt.Sprintf("reload frpc failed, restarting pods: %s", reloadErr),
+		)
+	case podsApplied > 0:
+		setCondition(
+			&endpoint.Status.Conditions, endpoint.Generation,
+			frpv1.ConditionProxiesRegistered, metav1.ConditionTrue,
+			reasonProxiesApplied,
+			fmt.Sprintf("latest proxies are applied to %d frpc pod(s)", podsApplied),
+		)
+	default:
+		setCondition(
+			&endpoint.Status.Conditions, endpoint.Generation,
+			frpv1.ConditionProxiesRegistered, metav1.ConditionUnknown,
+			reasonClientPodNotReady, "no ready frpc pod",
+		)
+	}
+
+	if reloadErr == nil {
+		return nil
+	}
+
+	// fallback to restart the pods
+	deployment.Spec.Template.Annotations[annotationKeyEndpointPodRestartConfigHash] = configHash
+	specHash, err := endpointDeploymentSpecHash(&deployment.Spec)
+	if err != nil {
+		logger.Error(err, "hash deployment spec failed")
+		return err
+	}
+	if deployment.Annotations == nil {
+		deployment.Annotations = map[string]string{}
+	}
+	deployment.Annotations[annotationKeyEndpointDeploymentSpecHash] = specHash
+	if err := r.Update(ctx, deployment); err != nil {
+		logger.Error(err, "update deployment failed")
+		return err
+	}
+	logger.Info(fmt.Sprintf("restarting deployment %s with config %s", deployment.Name, configHash))
+
+	return nil
+}
+
+// observeEndpointPods observes the login and proxies status from the frpc pod.
+// The status is queried from the frpc admin api, or parsed from the frpc logs
+// if the admin api is not available.
+func (r *EndpointReconciler) observeEndpointPods(
+	ctx context.Context,
+	logger logr.Logger,
+	endpoint *endpointView,
+	frpcConfig *corev1.Secret,
+	deployment *appsv1.Deployment,
+	pods []corev1.Pod,
+) {
+	var pod *corev1.Pod
+	for i := range pods {
+		if pods[i].DeletionTimestamp != nil || pods[i].Status.Phase != corev1.PodRunning {
+			continue
+		}
+		if pod == nil || isPodFromTemplate(&pods[i], &deployment.Spec.Template) {
+			pod = &pods[i]
+		}
+	}
+	if pod == nil {
+		// NOTE: ServerReachable condition is set from the pods
+		endpoint.Status.Proxies = nil
+		return
+	}
+
+	var (
+		proxies []frpcadmin.ProxyStatus
+		err     error
+	)
+	if isPodReady(pod) {
+		statusCtx, cancel := context.WithTimeout(ctx, frpcAdminTimeout)
+		proxies, err = newFrpcAdminClient(pod, frpcConfig).Status(statusCtx)
+		cancel()
+		if err == nil {
+			setCondition(
+				&endpoint.Status.Conditions, endpoint.Generation,
+				frpv1.ConditionServerReachable, metav1.ConditionTrue,
+				reasonLoggedIn, fmt.Sprintf(
+					"frpc logged in to %s:%d", endpoint.Spec.Addr, endpoint.Spec.Port,
+				),
+			)
+			r.oidcTokenChecks.Delete(endpoint.UID)
+		} else {
+			logger.Error(err, fmt.Sprintf("query pod %s status failed, fallback to logs", pod.Name))
+		}
+	}
+	if !isPodReady(pod) || err != nil {
+		if r.Clientset == nil {
+			return
+		}
+		logStatus, err := r.readFrpcLogStatus(ctx, pod)
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("read pod %s logs failed", pod.Name))
+			return
+		}
+		if logStatus.LoggedIn {
+			setCondition(
+				&endpoint.Status.Conditions, endpoint.Generation,
+				frpv1.ConditionServerReachable, metav1.ConditionTrue,
+				reasonLoggedIn, fmt.Sprintf(
+					"frpc logged in to %s:%d", endpoint.Spec.Addr, endpoint.Spec.Port,
+				),
+			)
+			r.oidcTokenChecks.Delete(endpoint.UID)
+		} else {
+			message := fmt.Sprintf(
+				"frpc login to %s:%d failed: %s",
+				endpoint.Spec.Addr, endpoint.Spec.Port, logStatus.LoginError,
+			)
+			if auth := endpoint.Spec.Auth; auth != nil && auth.OIDC != nil {
+				if err := r.checkEndpointOIDCToken(ctx, endpoint); err != nil {
+					message = fmt.Sprintf("%s; oidc token request failed: %s", message, err)
+				}
+			}
+			setCondition(
+				&endpoint.Status.Conditions, endpoint.Generation,
+				frpv1.ConditionServerReachable, metav1.ConditionFalse,
+				reasonLoginFailed, message,
+			)
+		}
+		proxies = logStatus.Proxies
+	}
+
+	endpoint.Status.Proxies = nil
+	var (
+		proxiesPending []string
+		proxiesFailed  []string
+	)
+	for _, proxy := range proxies {
+		proxy.Name = trimProxyNamePod(proxy.Name)
+		endpoint.Status.Proxies = append(endpoint.Status.Proxies, frpv1.ProxyStatus{
+			Name:       proxy.Name,
+			Status:     proxy.Status,
+			RemoteAddr: proxy.RemoteAddr,
+			Error:      proxy.Err,
+		})
+		switch {
+		case proxy.Status == frpcadmin.ProxyStatusRunning:
+		case proxy.IsPending():
+			proxiesPending = append(proxiesPending, proxy.Name)
+		default:
+			proxiesFailed = append(proxiesFailed, describeProxyStatus(proxy))
+		}
+	}
+
+	if condition := frpv1.FindCondition(
+		endpoint.Status.Conditions, frpv1.ConditionProxiesRegistered,
+	); condition != nil && condition.Reason == reasonProxiesReloadFailed {
+		// NOTE: keep the reload error, the pods are restarting with the latest config
+		return
+	}
+	switch {
+	case !frpv1.IsConditionTrue(endpoint.Status.Conditions, frpv1.ConditionServerReachable):
+		setCondition(
+			&endpoint.Status.Conditions, endpoint.Generation,
+			frpv1.ConditionProxiesRegistered, metav1.ConditionFalse,
+			reasonNotLoggedIn, "frpc has not logged in to the server",
+		)
+	case len(proxiesFailed) > 0:
+		setCondition(
+			&endpoint.Status.Conditions, endpoint.Generation,
+			frpv1.ConditionProxiesRegistered, metav1.ConditionFalse,
+			reasonProxiesFailed, strings.Join(proxiesFailed, "; "),
+		)
+	case len(proxiesPending) > 0:
+		setCondition(
+			&endpoint.Status.Conditions, endpoint.Generation,
+			frpv1.ConditionProxiesRegistered, metav1.ConditionUnknown,
+			reasonProxiesPending, fmt.Sprintf("proxies starting: %s", strings.Join(proxiesPending, ", ")),
+		)
+	default:
+		setCondition(
+			&endpoint.Status.Conditions, endpoint.Generation,
+			frpv1.ConditionProxiesRegistered, metav1.ConditionTrue,
+			reasonProxiesRunning, fmt.Sprintf("%d proxies running", len(proxies)),
+		)
+	}
+}
+
+// readFrpcLogStatus parses the frpc status from the pod logs.
+func (r *EndpointReconciler) readFrpcLogStatus(ctx context.Context, pod *corev1.Pod) (*frpcadmin.LogStatus, error) {
+	tailLines := int64(frpcLogTailLines)
+	logs, err := r.Clientset.CoreV1().
+		Pods(pod.Namespace).
+		GetLogs(pod.Name, &corev1.PodLogOptions{
+			Container: frpcContainerName,
+			TailLines: &tailLines,
+		}).
+		Stream(ctx)
 	if err != nil {
-		logger.Error(err, fmt.Sprintf("create pod %s failed", pod.Name))
 		return nil, err
 	}
-	logger.Info(fmt.Sprintf("created pod: %s", pod.Name))
+	defer logs.Close()
+
+	return frpcadmin.ParseLog(logs)
+}
+
+func newFrpcAdminClient(pod *corev1.Pod, frpcConfig *corev1.Secret) *frpcadmin.Client {
+	return &frpcadmin.Client{
+		Addr:     fmt.Sprintf("%s:%d", pod.Status.PodIP, frpcAdminPort),
+		User:     frpcAdminUser,
+		Password: string(frpcConfig.Data[frpcAdminPasswordKey]),
+	}
+}
 
-	return pod, nil
+func describeProxyStatus(proxy frpcadmin.ProxyStatus) string {
+	if proxy.Err == "" {
+		return fmt.Sprintf("%s: %s", proxy.Name, proxy.Status)
+	}
+	return fmt.Sprintf("%s: %s: %s", proxy.Name, proxy.Status, proxy.Err)
+}
+
+// setEndpointPodConditions sets the ClientPodReady and ServerReachable conditions
+// from the frpc deployment and pods.
+func setEndpointPodConditions(
+	endpoint *frpv1.Endpoint,
+	deployment *appsv1.Deployment,
+	pods []corev1.Pod,
+) {
+	var (
+		podsRunning    int
+		podsNotRunning []string
+	)
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodRunning {
+			podsRunning++
+			continue
+		}
+		podsNotRunning = append(podsNotRunning, describePodNotRunning(&pod))
+	}
+
+	if podsRunning > 0 {
+		setCondition(
+			&endpoint.Status.Conditions, endpoint.Generation,
+			frpv1.ConditionClientPodReady, metav1.ConditionTrue,
+			reasonPodRunning, fmt.Sprintf("%d frpc pod(s) running", podsRunning),
+		)
+	} else {
+		message := "no frpc pod found"
+		if len(podsNotRunning) > 0 {
+			message = strings.Join(podsNotRunning, "; ")
+		}
+		setCondition(
+			&endpoint.Status.Conditions, endpoint.Generation,
+			frpv1.ConditionClientPodReady, metav1.ConditionFalse,
+			reasonPodNotRunning, message,
+		)
+	}
+
+	// NOTE: the frpc admin port (readiness probe) is listened only after logged in
+	switch {
+	case deployment.Status.AvailableReplicas > 0:
+		setCondition(
+			&endpoint.Status.Conditions, endpoint.Generation,
+			frpv1.ConditionServerReachable, metav1.ConditionTrue,
+			reasonLoggedIn, fmt.Sprintf(
+				"frpc logged in to %s:%d", endpoint.Spec.Addr, endpoint.Spec.Port,
+			),
+		)
+	case podsRunning > 0:
+		setCondition(
+			&endpoint.Status.Conditions, endpoint.Generation,
+			frpv1.ConditionServerReachable, metav1.ConditionFalse,
+			reasonNotLoggedIn, fmt.Sprintf(
+				"frpc has not logged in to %s:%d, check the server address and token",
+				endpoint.Spec.Addr, endpoint.Spec.Port,
+			),
+		)
+	default:
+		setCondition(
+			&endpoint.Status.Conditions, endpoint.Generation,
+			frpv1.ConditionServerReachable, metav1.ConditionUnknown,
+			reasonClientPodNotReady, "no running frpc pod",
+		)
+	}
+}
+
+// describePodNotRunning tells why the pod is not running.
+func describePodNotRunning(pod *corev1.Pod) string {
+	containerStatuses := append(
+		append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...),
+		pod.Status.ContainerStatuses...,
+	)
+	for _, containerStatus := range containerStatuses {
+		if waiting := containerStatus.State.Waiting; waiting != nil && waiting.Reason != "" {
+			return fmt.Sprintf(
+				"pod %s container %s: %s %s",
+				pod.Name, containerStatus.Name, waiting.Reason, waiting.Message,
+			)
+		}
+	}
+	return fmt.Sprintf("pod %s is %s", pod.Name, pod.Status.Phase)
+}
+
+// cleanupLegacyEndpointConfigMaps deletes the frpc config maps created by previous versions,
+// which are now stored in the endpoint secret.
+func (r *EndpointReconciler) cleanupLegacyEndpointConfigMaps(
+	ctx context.Context,
+	logger logr.Logger,
+	endpoint *endpointView,
+) error {
+	if endpoint.Kind != KindEndpoint {
+		// NOTE: cluster endpoints are introduced after the legacy resources
+		return nil
+	}
+
+	var configMapList corev1.ConfigMapList
+	err := r.List(
+		ctx, &configMapList,
+		client.InNamespace(endpoint.Namespace),
+		client.MatchingFields{endpoint.OwnerKey: endpoint.Name},
+	)
+	if err != nil {
+		logger.Error(err, "list endpoint config maps failed")
+		return err
+	}
+
+	for _, c := range configMapList.Items {
+		err = r.Delete(ctx, &c)
+		if err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, fmt.Sprintf("delete legacy config map %s failed", c.Name))
+			return err
+		}
+		logger.Info(fmt.Sprintf("deleted legacy config map %s", c.Name))
+	}
+
+	return nil
+}
+
+// cleanupLegacyEndpointPods deletes the bare frpc pods created by previous versions,
+// which are now managed by the endpoint deployment.
+func (r *EndpointReconciler) cleanupLegacyEndpointPods(
+	ctx context.Context,
+	logger logr.Logger,
+	endpoint *endpointView,
+) error {
+	if endpoint.Kind != KindEndpoint {
+		// NOTE: cluster endpoints are introduced after the legacy resources
+		return nil
+	}
+
+	var podList corev1.PodList
+	err := r.List(
+		ctx, &podList,
+		client.InNamespace(endpoint.Namespace),
+		client.MatchingFields{endpoint.OwnerKey: endpoint.Name},
+	)
+	if err != nil {
+		logger.Error(err, "list endpoint pods failed")
+		return err
+	}
+
+	for _, p := range podList.Items {
+		err = r.Delete(ctx, &p)
+		if err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, fmt.Sprintf("delete legacy pod %s failed", p.Name))
+			return err
+		}
+		logger.Info(fmt.Sprintf("deleted legacy pod %s", p.Name))
+	}
+
+	return nil
+}
+
+// frpcConfigHash calculates the hash of the frpc config content.
+func frpcConfigHash(content string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
+
+// generateFrpcSecret generates a random secret for the frpc admin api password and the proxy group key.
+func generateFrpcSecret() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func isPodFromTemplate(pod *corev1.Pod, template *corev1.PodTemplateSpec) bool {
+	for _, key := range []string{
+		annotationKeyEndpointPodConfigHash,
+		annotationKeyEndpointPodRestartConfigHash,
+	} {
+		if pod.Annotations[key] != template.Annotations[key] {
+			return false
+		}
+	}
+	return true
 }
 
 func (r *EndpointReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	var err error
 	err = mgr.GetFieldIndexer().IndexField(
-		&corev1.ConfigMap{}, endpointOwnerKey,
-		func(rawObj runtime.Object) []string {
+		context.Background(), &corev1.ConfigMap{}, endpointOwnerKey,
+		func(rawObj client.Object) []string {
 			config := rawObj.(*corev1.ConfigMap)
 			owner := metav1.GetControllerOf(config)
 			if owner == nil {
@@ -354,8 +1738,8 @@ func (r *EndpointReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 	err = mgr.GetFieldIndexer().IndexField(
-		&corev1.Pod{}, endpointOwnerKey,
-		func(rawObj runtime.Object) []string {
+		context.Background(), &corev1.Pod{}, endpointOwnerKey,
+		func(rawObj client.Object) []string {
 			pod := rawObj.(*corev1.Pod)
 			owner := metav1.GetControllerOf(pod)
 			if owner == nil {
@@ -371,7 +1755,294 @@ func (r *EndpointReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
-	return ctrl.NewControllerManagedBy(mgr).
+	err = mgr.GetFieldIndexer().IndexField(
+		context.Background(), &corev1.Secret{}, endpointOwnerKey,
+		func(rawObj client.Object) []string {
+			secret := rawObj.(*corev1.Secret)
+			owner := metav1.GetControllerOf(secret)
+			if owner == nil {
+				return nil
+			}
+			if owner.APIVersion != apiGVStr || owner.Kind != KindEndpoint {
+				return nil
+			}
+			return []string{owner.Name}
+		},
+	)
+	if err != nil {
+		return err
+	}
+	err = mgr.GetFieldIndexer().IndexField(
+		context.Background(), &frpv1.Endpoint{}, endpointSecretRefKey,
+		func(rawObj client.Object) []string {
+			endpoint := rawObj.(*frpv1.Endpoint)
+			return endpointReferencedSecrets(&endpoint.Spec)
+		},
+	)
+	if err != nil {
+		return err
+	}
+	err = mgr.GetFieldIndexer().IndexField(
+		context.Background(), &frpv1.Service{}, serviceSecretRefKey,
+		func(rawObj client.Object) []string {
+			service := rawObj.(*frpv1.Service)
+			return serviceReferencedSecrets(service)
+		},
+	)
+	if err != nil {
+		return err
+	}
+	err = mgr.GetFieldIndexer().IndexField(
+		context.Background(), &frpv1.Visitor{}, visitorSecretRefKey,
+		func(rawObj client.Object) []string {
+			visitor := rawObj.(*frpv1.Visitor)
+			return []string{visitor.Spec.SecretKeyRef.Name}
+		},
+	)
+	if err != nil {
+		return err
+	}
+	err = mgr.GetFieldIndexer().IndexField(
+		context.Background(), &appsv1.Deployment{}, endpointOwnerKey,
+		func(rawObj client.Object) []string {
+			deployment := rawObj.(*appsv1.Deployment)
+			owner := metav1.GetControllerOf(deployment)
+			if owner == nil {
+				return nil
+			}
+			if owner.APIVersion != apiGVStr || owner.Kind != KindEndpoint {
+				return nil
+			}
+			return []string{owner.Name}
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	err = mgr.GetFieldIndexer().IndexField(
+		context.Background(), &corev1.Service{}, coreServiceEndpointKey,
+		func(rawObj client.Object) []string {
+			kservice := rawObj.(*corev1.Service)
+			endpointName := coreServiceEndpointName(kservice, r.LoadBalancer)
+			if endpointName == "" {
+				return nil
+			}
+			return []string{endpointName}
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&frpv1.Endpoint{}).
-		Complete(r)
+		Owns(&corev1.Secret{}).
+		Owns(&appsv1.Deployment{}).
+		Watches(
+			&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.mapSecretToEndpoints),
+		).
+		Watches(
+			&corev1.Pod{},
+			handler.EnqueueRequestsFromMapFunc(r.mapToEndpoint),
+		).
+		Watches(
+			&frpv1.Service{},
+			handler.EnqueueRequestsFromMapFunc(r.mapToEndpoint),
+		).
+		Watches(
+			&frpv1.Visitor{},
+			handler.EnqueueRequestsFromMapFunc(r.mapToEndpoint),
+		).
+		Watches(
+			&corev1.Service{},
+			handler.EnqueueRequestsFromMapFunc(r.mapCoreServiceToEndpoint),
+		)
+	if r.Ingress.Class != "" {
+		// NOTE: ingresses are watched only when implemented, saving the cache of the unrelated ingresses
+		builder = builder.
+			Watches(
+				&networkingv1.Ingress{},
+				handler.EnqueueRequestsFromMapFunc(r.mapIngressToEndpoint),
+			).
+			Watches(
+				&networkingv1.IngressClass{},
+				handler.EnqueueRequestsFromMapFunc(r.mapIngressClassToEndpoints),
+			)
+	}
+	if r.Gateway.Enabled {
+		builder = builder.
+			Watches(
+				&gatewayv1.Gateway{},
+				handler.EnqueueRequestsFromMapFunc(r.mapGatewayToEndpoint),
+			).
+			Watches(
+				&gatewayv1.GatewayClass{},
+				handler.EnqueueRequestsFromMapFunc(r.mapGatewayClassToEndpoints),
+			).
+			Watches(
+				&gatewayv1.HTTPRoute{},
+				handler.EnqueueRequestsFromMapFunc(r.mapRouteToEndpoints),
+			).
+			Watches(
+				&gatewayv1alpha2.TCPRoute{},
+				handler.EnqueueRequestsFromMapFunc(r.mapRouteToEndpoints),
+			).
+			Watches(
+				&gatewayv1alpha2.UDPRoute{},
+				handler.EnqueueRequestsFromMapFunc(r.mapRouteToEndpoints),
+			)
+	}
+
+	return builder.Complete(r)
+}
+
+// mapSecretToEndpoints maps a secret to the endpoints referencing it,
+// either directly or through the bound services and visitors.
+func (r *EndpointReconciler) mapSecretToEndpoints(ctx context.Context, obj client.Object) []reconcile.Request {
+	var endpointList frpv1.EndpointList
+	err := r.List(
+		context.Background(), &endpointList,
+		client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{endpointSecretRefKey: obj.GetName()},
+	)
+	if err != nil {
+		r.Log.Error(err, "list endpoints failed", "secret", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, endpoint := range endpointList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{
+				Namespace: endpoint.Namespace,
+				Name:      endpoint.Name,
+			},
+		})
+	}
+
+	var serviceList frpv1.ServiceList
+	err = r.List(
+		context.Background(), &serviceList,
+		client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{serviceSecretRefKey: obj.GetName()},
+	)
+	if err != nil {
+		r.Log.Error(err, "list services failed", "secret", obj.GetName())
+		return nil
+	}
+	for _, service := range serviceList.Items {
+		requests = append(requests, r.mapToEndpoint(ctx, &service)...)
+	}
+
+	var visitorList frpv1.VisitorList
+	err = r.List(
+		context.Background(), &visitorList,
+		client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{visitorSecretRefKey: obj.GetName()},
+	)
+	if err != nil {
+		r.Log.Error(err, "list visitors failed", "secret", obj.GetName())
+		return nil
+	}
+	for _, visitor := range visitorList.Items {
+		requests = append(requests, r.mapToEndpoint(ctx, &visitor)...)
+	}
+
+	return requests
+}
+
+// mapToEndpoint maps an object to the endpoint it bounds to by the endpoint label.
+func (r *EndpointReconciler) mapToEndpoint(ctx context.Context, obj client.Object) []reconcile.Request {
+	endpointName, exists := obj.GetLabels()[labelKeyEndpointName]
+	if !exists || endpointName == "" {
+		return nil
+	}
+
+	return []reconcile.Request{
+		{
+			NamespacedName: client.ObjectKey{
+				Namespace: obj.GetNamespace(),
+				Name:      endpointName,
+			},
+		},
+	}
+}
+
+// mapCoreServiceToEndpoint maps a core service to the endpoint it bounds to by the endpoint annotation,
+// or the endpoint implementing the load balancer.
+func (r *EndpointReconciler) mapCoreServiceToEndpoint(ctx context.Context, obj client.Object) []reconcile.Request {
+	kservice, ok := obj.(*corev1.Service)
+	if !ok {
+		return nil
+	}
+	endpointName := coreServiceEndpointName(kservice, r.LoadBalancer)
+	if endpointName == "" {
+		return nil
+	}
+
+	return []reconcile.Request{
+		{
+			NamespacedName: client.ObjectKey{
+				Namespace: obj.GetNamespace(),
+				Name:      endpointName,
+			},
+		},
+	}
+}
+
+// mapIngressToEndpoint maps an ingress implemented by frp to the endpoint exposing it.
+func (r *EndpointReconciler) mapIngressToEndpoint(ctx context.Context, obj client.Object) []reconcile.Request {
+	ingress, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return nil
+	}
+	matched, err := r.Ingress.Matches(ctx, r.Client, ingress)
+	if err != nil {
+		r.Log.Error(err, "get ingress class failed", "ingress", obj.GetName())
+		return nil
+	}
+	if !matched {
+		return nil
+	}
+	endpointName := r.Ingress.EndpointName(ingress)
+	if endpointName == "" {
+		return nil
+	}
+
+	return []reconcile.Request{
+		{
+			NamespacedName: client.ObjectKey{
+				Namespace: obj.GetNamespace(),
+				Name:      endpointName,
+			},
+		},
+	}
+}
+
+// mapIngressClassToEndpoints maps the implemented ingress class to the endpoints exposing ingresses,
+// as the class controller or the default class annotation might change the matched ingresses.
+func (r *EndpointReconciler) mapIngressClassToEndpoints(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetName() != r.Ingress.Class {
+		return nil
+	}
+
+	var ingressList networkingv1.IngressList
+	if err := r.List(ctx, &ingressList); err != nil {
+		r.Log.Error(err, "list ingresses failed", "ingressclass", obj.GetName())
+		return nil
+	}
+
+	endpoints := map[client.ObjectKey]bool{}
+	var requests []reconcile.Request
+	for _, ingress := range ingressList.Items {
+		key := client.ObjectKey{Namespace: ingress.Namespace, Name: r.Ingress.EndpointName(&ingress)}
+		if key.Name == "" || endpoints[key] {
+			continue
+		}
+		endpoints[key] = true
+		requests = append(requests, reconcile.Request{NamespacedName: key})
+	}
+	return requests
 }
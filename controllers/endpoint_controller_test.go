@@ -2,15 +2,35 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	g "github.com/onsi/ginkgo"
 	m "github.com/onsi/gomega"
+	"gopkg.in/ini.v1"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/b4fun/frpcontroller/pkg/frpconfig"
+	"github.com/b4fun/frpcontroller/pkg/oidc"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
 )
 
 var _ = g.Describe("EndpointController", func() {
@@ -57,25 +77,25 @@ var _ = g.Describe("EndpointController", func() {
 		close(done)
 	}, 300)
 
-	getEndpointConfigMap := func(namespace string, endpointName string) *corev1.ConfigMap {
-		configMapRetrieved := &corev1.ConfigMap{}
+	getEndpointConfigSecret := func(namespace string, endpointName string) *corev1.Secret {
+		secretRetrieved := &corev1.Secret{}
 		m.Eventually(func() error {
 			var (
-				configMapList corev1.ConfigMapList
-				err           error
+				secretList corev1.SecretList
+				err        error
 			)
 			ctx := context.Background()
 			err = k8sClient.List(
-				ctx, &configMapList,
+				ctx, &secretList,
 				client.InNamespace(namespace),
 			)
 			if err != nil {
 				return err
 			}
 			foundAlready := false
-			for _, configMap := range configMapList.Items {
+			for _, secret := range secretList.Items {
 				isOwnByEndpoint := false
-				for _, owner := range configMap.OwnerReferences {
+				for _, owner := range secret.OwnerReferences {
 					if owner.Name == endpointName {
 						isOwnByEndpoint = true
 						break
@@ -86,20 +106,20 @@ var _ = g.Describe("EndpointController", func() {
 				}
 				if isOwnByEndpoint && foundAlready {
 					return fmt.Errorf(
-						"found multiple config maps owned by the endpoint: %s %s",
-						configMapRetrieved.Name, configMap.Name,
+						"found multiple secrets owned by the endpoint: %s %s",
+						secretRetrieved.Name, secret.Name,
 					)
 				}
 				foundAlready = true
-				*configMapRetrieved = configMap
+				*secretRetrieved = secret
 			}
 			if foundAlready {
 				return nil
 			}
-			return errors.New("endpoint config map not found")
+			return errors.New("endpoint secret not found")
 		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
 
-		return configMapRetrieved
+		return secretRetrieved
 	}
 
 	getEndpointPod := func(namespace string, endpointName string) *corev1.Pod {
@@ -113,27 +133,18 @@ var _ = g.Describe("EndpointController", func() {
 			err = k8sClient.List(
 				ctx, &podList,
 				client.InNamespace(namespace),
+				client.MatchingLabels{labelKeyEndpointName: endpointName},
 			)
 			if err != nil {
 				return err
 			}
 			foundAlready := false
 			for _, pod := range podList.Items {
-				isOwnByEndpoint := false
 				if pod.Status.Phase != corev1.PodRunning {
 					// skip non-running pods
 					continue
 				}
-				for _, owner := range pod.OwnerReferences {
-					if owner.Name == endpointName {
-						isOwnByEndpoint = true
-						break
-					}
-				}
-				if !isOwnByEndpoint {
-					continue
-				}
-				if isOwnByEndpoint && foundAlready {
+				if foundAlready {
 					return fmt.Errorf(
 						"found multiple pods owned by the endpoint: %s %s",
 						podRetrieved.Name, pod.Name,
@@ -161,18 +172,18 @@ var _ = g.Describe("EndpointController", func() {
 		m.Expect(endpointCreated.Namespace).To(m.Equal(testNamespace))
 
 		var (
-			configMapCreated *corev1.ConfigMap
-			podCreated       *corev1.Pod
+			secretCreated *corev1.Secret
+			podCreated    *corev1.Pod
 		)
 
-		g.By("inspecting created config map", func() {
-			g.By("getting created config map")
-			configMapCreated = getEndpointConfigMap(endpointCreated.Namespace, endpointCreated.Name)
-			log.Log.Info(fmt.Sprintf("retrieved config map: %s", configMapCreated.Name))
+		g.By("inspecting created secret", func() {
+			g.By("getting created secret")
+			secretCreated = getEndpointConfigSecret(endpointCreated.Namespace, endpointCreated.Name)
+			log.Log.Info(fmt.Sprintf("retrieved secret: %s", secretCreated.Name))
 
-			g.By("inspecting config map properties")
-			m.Expect(configMapCreated.Namespace).To(m.Equal(testNamespace))
-			m.Expect(configMapCreated.Data).NotTo(m.BeEmpty())
+			g.By("inspecting secret properties")
+			m.Expect(secretCreated.Namespace).To(m.Equal(testNamespace))
+			m.Expect(secretCreated.Data).NotTo(m.BeEmpty())
 		})
 
 		g.By("inspecting created pod", func() {
@@ -185,8 +196,8 @@ var _ = g.Describe("EndpointController", func() {
 			m.Expect(podCreated.Status.Phase).To(m.Equal(corev1.PodRunning))
 			m.Expect(podCreated.Annotations).To(
 				m.HaveKeyWithValue(
-					annotationKeyEndpointPodConfigVersion,
-					configMapCreated.ResourceVersion,
+					annotationKeyEndpointPodConfigHash,
+					secretCreated.Annotations[annotationKeyEndpointPodConfigHash],
 				),
 				"pod should use latest endpoint",
 			)
@@ -222,19 +233,19 @@ var _ = g.Describe("EndpointController", func() {
 		log.Log.Info(fmt.Sprintf("endpoint updated: %s", endpointCreated.Name))
 
 		var (
-			configMapCreated *corev1.ConfigMap
-			podCreated       *corev1.Pod
+			secretCreated *corev1.Secret
+			podCreated    *corev1.Pod
 		)
 
-		g.By("inspecting created config map", func() {
-			g.By("getting created config map")
-			configMapCreated = getEndpointConfigMap(endpointUpdated.Namespace, endpointUpdated.Name)
-			log.Log.Info(fmt.Sprintf("retrieved config map: %s", configMapCreated.Name))
+		g.By("inspecting created secret", func() {
+			g.By("getting created secret")
+			secretCreated = getEndpointConfigSecret(endpointUpdated.Namespace, endpointUpdated.Name)
+			log.Log.Info(fmt.Sprintf("retrieved secret: %s", secretCreated.Name))
 
-			g.By("inspecting config map settings")
-			m.Expect(configMapCreated.Data).NotTo(m.BeEmpty())
-			m.Expect(configMapCreated.Data).To(m.HaveKey(frpcFileName))
-			frpcFileContent := configMapCreated.Data[frpcFileName]
+			g.By("inspecting secret settings")
+			m.Expect(secretCreated.Data).NotTo(m.BeEmpty())
+			m.Expect(secretCreated.Data).To(m.HaveKey(frpcFileName))
+			frpcFileContent := string(secretCreated.Data[frpcFileName])
 			m.Expect(frpcFileContent).To(m.ContainSubstring(newFrps.Token))
 		})
 
@@ -243,13 +254,13 @@ var _ = g.Describe("EndpointController", func() {
 			m.Eventually(func() error {
 				pod := getEndpointPod(endpointCreated.Namespace, endpointCreated.Name)
 
-				if v, ok := pod.Annotations[annotationKeyEndpointPodConfigVersion]; ok {
-					if v == configMapCreated.ResourceVersion {
+				if v, ok := pod.Annotations[annotationKeyEndpointPodConfigHash]; ok {
+					if v == secretCreated.Annotations[annotationKeyEndpointPodConfigHash] {
 						podCreated = pod
 						return nil
 					}
 				}
-				return errors.New("endpoint pod with latest config map is not ready")
+				return errors.New("endpoint pod with latest secret is not ready")
 
 			}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
 			log.Log.Info(fmt.Sprintf("retrieved pod: %s", podCreated.Name))
@@ -259,14 +270,88 @@ var _ = g.Describe("EndpointController", func() {
 			m.Expect(podCreated.Status.Phase).To(m.Equal(corev1.PodRunning))
 			m.Expect(podCreated.Annotations).To(
 				m.HaveKeyWithValue(
-					annotationKeyEndpointPodConfigVersion,
-					configMapCreated.ResourceVersion,
+					annotationKeyEndpointPodConfigHash,
+					secretCreated.Annotations[annotationKeyEndpointPodConfigHash],
 				),
 				"pod should use latest endpoint",
 			)
 		})
 	})
 
+	g.It("should read token from secret", func() {
+		ctx := context.Background()
+
+		g.By("creating token secret")
+		tokenSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: "frps-token-",
+				Namespace:    testNamespace,
+			},
+			Data: map[string][]byte{
+				"token": []byte(frpsDeploy.Token),
+			},
+		}
+		err := k8sClient.Create(ctx, tokenSecret)
+		m.Expect(err).NotTo(m.HaveOccurred())
+
+		endpointToCreate := &frpv1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:    testNamespace,
+				GenerateName: "frpc-endpoint-",
+			},
+			Spec: frpv1.EndpointSpec{
+				Addr: frpsDeploy.Endpoint,
+				Port: frpsDeploy.Port,
+				TokenSecretRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: tokenSecret.Name,
+					},
+					Key: "token",
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, endpointToCreate)
+		m.Expect(err).NotTo(m.HaveOccurred())
+
+		_, err = waitEndpointReady(
+			ctx, k8sClient, endpointToCreate.Namespace, endpointToCreate.Name,
+			resourceRetryOptions,
+		)
+		m.Expect(err).NotTo(m.HaveOccurred())
+
+		secretBeforeRotation := getEndpointConfigSecret(endpointToCreate.Namespace, endpointToCreate.Name)
+		configHashBeforeRotation := secretBeforeRotation.Annotations[annotationKeyEndpointPodConfigHash]
+		m.Expect(configHashBeforeRotation).NotTo(m.BeEmpty())
+
+		g.By("rotating the token secret only")
+		const rotatedToken = "rotated"
+		tokenSecret.Data["token"] = []byte(rotatedToken)
+		err = k8sClient.Update(ctx, tokenSecret)
+		m.Expect(err).NotTo(m.HaveOccurred())
+
+		var configHashAfterRotation string
+		m.Eventually(func() error {
+			secret := getEndpointConfigSecret(endpointToCreate.Namespace, endpointToCreate.Name)
+			if !strings.Contains(string(secret.Data[frpcFileName]), rotatedToken) {
+				return errors.New("endpoint secret is not updated with rotated token")
+			}
+			configHashAfterRotation = secret.Annotations[annotationKeyEndpointPodConfigHash]
+			if configHashAfterRotation == configHashBeforeRotation {
+				return errors.New("config hash is not updated with rotated token")
+			}
+			return nil
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+
+		g.By("rolling the frpc pod with the new config hash")
+		m.Eventually(func() error {
+			pod := getEndpointPod(endpointToCreate.Namespace, endpointToCreate.Name)
+			if pod.Annotations[annotationKeyEndpointPodConfigHash] != configHashAfterRotation {
+				return errors.New("endpoint pod with rotated token is not running")
+			}
+			return nil
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+	})
+
 	g.It("should delete endpoint", func() {
 		ctx := context.Background()
 
@@ -275,5 +360,741 @@ var _ = g.Describe("EndpointController", func() {
 
 		err = k8sClient.Delete(ctx, endpointCreated)
 		m.Expect(err).NotTo(m.HaveOccurred(), "delete endpoint")
+
+		m.Eventually(func() error {
+			var endpoint frpv1.Endpoint
+			err := k8sClient.Get(ctx, client.ObjectKey{
+				Namespace: endpointCreated.Namespace,
+				Name:      endpointCreated.Name,
+			}, &endpoint)
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return errors.New("endpoint is not deleted yet")
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+	})
+
+	g.It("should block endpoint deletion when referenced by services", func() {
+		ctx := context.Background()
+
+		endpointCreated := &frpv1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:    testNamespace,
+				GenerateName: "frpc-endpoint-",
+			},
+			Spec: frpv1.EndpointSpec{
+				Addr:           frpsDeploy.Endpoint,
+				Port:           frpsDeploy.Port,
+				Token:          frpsDeploy.Token,
+				DeletionPolicy: frpv1.EndpointDeletionPolicyBlock,
+			},
+		}
+		err := k8sClient.Create(ctx, endpointCreated)
+		m.Expect(err).NotTo(m.HaveOccurred())
+		_, err = waitEndpointReady(
+			ctx, k8sClient, endpointCreated.Namespace, endpointCreated.Name,
+			resourceRetryOptions,
+		)
+		m.Expect(err).NotTo(m.HaveOccurred())
+
+		serviceCreated := &frpv1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:    testNamespace,
+				GenerateName: "frpc-service-",
+			},
+			Spec: frpv1.ServiceSpec{
+				Endpoint: endpointCreated.Name,
+				Ports: []frpv1.ServicePort{
+					{
+						Name:       "test-port",
+						Protocol:   frpv1.ServicePortTCP,
+						LocalPort:  3333,
+						RemotePort: 3333,
+					},
+				},
+				Selector: map[string]string{
+					"foo": "bar",
+				},
+			},
+		}
+		err = k8sClient.Create(ctx, serviceCreated)
+		m.Expect(err).NotTo(m.HaveOccurred(), "create service")
+
+		endpointName := client.ObjectKey{
+			Namespace: endpointCreated.Namespace,
+			Name:      endpointCreated.Name,
+		}
+
+		g.By("deleting the endpoint")
+		err = k8sClient.Delete(ctx, endpointCreated)
+		m.Expect(err).NotTo(m.HaveOccurred(), "delete endpoint")
+		m.Eventually(func() error {
+			var endpoint frpv1.Endpoint
+			if err := k8sClient.Get(ctx, endpointName, &endpoint); err != nil {
+				return err
+			}
+			if !frpv1.IsConditionTrue(endpoint.Status.Conditions, frpv1.ConditionDeletionBlocked) {
+				return errors.New("endpoint deletion is not blocked yet")
+			}
+			return nil
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+
+		g.By("deleting the service")
+		err = k8sClient.Delete(ctx, serviceCreated)
+		m.Expect(err).NotTo(m.HaveOccurred(), "delete service")
+		m.Eventually(func() error {
+			var endpoint frpv1.Endpoint
+			err := k8sClient.Get(ctx, endpointName, &endpoint)
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return errors.New("endpoint is not deleted yet")
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+	})
+})
+
+var _ = g.Describe("EndpointController watches", func() {
+	// NOTE: the changes should be observed before the endpoint polls the frpc status
+	const (
+		resourcePollingTimeout  = frpcStatusPollInterval / 3
+		resourcePollingInterval = time.Second
+	)
+
+	var testNamespace string
+
+	g.BeforeEach(func(done g.Done) {
+		var err error
+		testNamespace, err = createNamespace(context.Background(), k8sClient, "frp-test-")
+		m.Expect(err).NotTo(m.HaveOccurred(), "create namespace")
+
+		close(done)
+	}, 60)
+
+	g.AfterEach(func(done g.Done) {
+		err := deleteNamespace(context.Background(), k8sClient, testNamespace)
+		m.Expect(err).NotTo(m.HaveOccurred(), "delete namespace")
+
+		close(done)
+	}, 60)
+
+	// NOTE: no frps is deployed, the endpoint stays disconnected while the config is rendered
+	createTestEndpoint := func(ctx context.Context, tokenSecret *corev1.Secret) *frpv1.Endpoint {
+		m.Expect(k8sClient.Create(ctx, tokenSecret)).To(m.Succeed())
+		endpoint := &frpv1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "endpoint"},
+			Spec: frpv1.EndpointSpec{
+				Addr: "127.0.0.1",
+				Port: 7000,
+				TokenSecretRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: tokenSecret.Name},
+					Key:                  "token",
+				},
+			},
+		}
+		m.Expect(k8sClient.Create(ctx, endpoint)).To(m.Succeed())
+		return endpoint
+	}
+
+	getEndpointConfig := func() string {
+		var secretList corev1.SecretList
+		err := k8sClient.List(
+			context.Background(), &secretList,
+			client.InNamespace(testNamespace),
+		)
+		m.Expect(err).NotTo(m.HaveOccurred())
+		for _, secret := range secretList.Items {
+			owner := metav1.GetControllerOf(&secret)
+			if owner != nil && owner.Kind == KindEndpoint && owner.Name == "endpoint" {
+				return string(secret.Data[frpcFileName])
+			}
+		}
+		return ""
+	}
+
+	g.It("should render the config after the token secret changed", func() {
+		ctx := context.Background()
+		tokenSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "token"},
+			StringData: map[string]string{"token": "supersecret"},
+		}
+		createTestEndpoint(ctx, tokenSecret)
+		m.Eventually(getEndpointConfig, resourcePollingTimeout, resourcePollingInterval).
+			Should(m.MatchRegexp(`token\s+= supersecret`))
+
+		g.By("rotating the token")
+		tokenSecret.StringData = map[string]string{"token": "rotated"}
+		m.Expect(k8sClient.Update(ctx, tokenSecret)).To(m.Succeed())
+		m.Eventually(getEndpointConfig, resourcePollingTimeout, resourcePollingInterval).
+			Should(m.MatchRegexp(`token\s+= rotated`))
+	})
+
+	g.It("should render the config after the service port changed", func() {
+		ctx := context.Background()
+		createTestEndpoint(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "token"},
+			StringData: map[string]string{"token": "supersecret"},
+		})
+
+		service := &frpv1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "ssh"},
+			Spec: frpv1.ServiceSpec{
+				Endpoint: "endpoint",
+				Selector: map[string]string{"app": "ssh"},
+				Ports: []frpv1.ServicePort{
+					{Name: "ssh", Protocol: frpv1.ServicePortTCP, LocalPort: 22, RemotePort: 2222},
+				},
+			},
+		}
+		m.Expect(k8sClient.Create(ctx, service)).To(m.Succeed())
+		m.Eventually(getEndpointConfig, resourcePollingTimeout, resourcePollingInterval).
+			Should(m.MatchRegexp(`remote_port\s+= 2222`))
+
+		g.By("changing the remote port")
+		m.Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: testNamespace, Name: "ssh"}, service)).To(m.Succeed())
+		service.Spec.Ports[0].RemotePort = 2223
+		m.Expect(k8sClient.Update(ctx, service)).To(m.Succeed())
+		m.Eventually(getEndpointConfig, resourcePollingTimeout, resourcePollingInterval).
+			Should(m.MatchRegexp(`remote_port\s+= 2223`))
+
+		g.By("registering the tcp proxy per frpc pod in a load balancing group")
+		config := getEndpointConfig()
+		m.Expect(config).To(m.MatchRegexp(`\[\S*ssh@\{\{ \.Envs\.FRPC_POD_NAME \}\}\]`))
+		m.Expect(config).To(m.MatchRegexp(`group\s+= \S*ssh\n`))
+		m.Expect(config).To(m.MatchRegexp(`group_key\s+= \S+`))
+	})
+
+	g.It("should roll out the frpc deployment surge-first", func() {
+		ctx := context.Background()
+		createTestEndpoint(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "token"},
+			StringData: map[string]string{"token": "supersecret"},
+		})
+
+		var deployment appsv1.Deployment
+		m.Eventually(func() error {
+			var deploymentList appsv1.DeploymentList
+			err := k8sClient.List(ctx, &deploymentList, client.InNamespace(testNamespace))
+			if err != nil {
+				return err
+			}
+			if len(deploymentList.Items) == 0 {
+				return errors.New("frpc deployment is not created yet")
+			}
+			deployment = deploymentList.Items[0]
+			return nil
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+
+		m.Expect(deployment.Spec.MinReadySeconds).To(m.Equal(int32(frpcMinReadySeconds)))
+		m.Expect(deployment.Spec.Strategy.Type).To(m.Equal(appsv1.RollingUpdateDeploymentStrategyType))
+		m.Expect(deployment.Spec.Strategy.RollingUpdate.MaxSurge.IntValue()).To(m.Equal(1))
+		m.Expect(deployment.Spec.Strategy.RollingUpdate.MaxUnavailable.IntValue()).To(m.Equal(0))
+		m.Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(m.ContainElement(m.HaveField(
+			"ValueFrom.FieldRef.FieldPath", "metadata.name",
+		)))
 	})
 })
+
+func TestApplyClientPodTemplate(t *testing.T) {
+	r := &EndpointReconciler{}
+	frpcConfig := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "frpc-config",
+			Annotations: map[string]string{annotationKeyEndpointPodConfigHash: "hash"},
+		},
+	}
+	newEndpoint := func(clientTemplate *frpv1.ClientPodTemplate) *endpointView {
+		return newEndpointView(&frpv1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "endpoint"},
+			Spec: frpv1.EndpointSpec{
+				Addr:           "127.0.0.1",
+				Port:           7000,
+				ClientTemplate: clientTemplate,
+			},
+		})
+	}
+	findContainer := func(containers []corev1.Container, name string) *corev1.Container {
+		for i := range containers {
+			if containers[i].Name == name {
+				return &containers[i]
+			}
+		}
+		t.Fatalf("container %s not found", name)
+		return nil
+	}
+
+	t.Run("no template", func(t *testing.T) {
+		template := r.buildEndpointPodTemplate(newEndpoint(nil), frpcConfig)
+		container := findContainer(template.Spec.Containers, frpcContainerName)
+		if !reflect.DeepEqual(container.Command, []string{"/opt/frp/frpc"}) {
+			t.Errorf("unexpected command: %v", container.Command)
+		}
+		if template.Spec.NodeSelector != nil || template.Spec.ServiceAccountName != "" {
+			t.Errorf("unexpected pod spec: %+v", template.Spec)
+		}
+	})
+
+	t.Run("merged", func(t *testing.T) {
+		runAsNonRoot := true
+		resources := corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+		}
+		containerSecurityContext := &corev1.SecurityContext{RunAsNonRoot: &runAsNonRoot}
+		tolerations := []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}}
+		endpoint := newEndpoint(&frpv1.ClientPodTemplate{
+			Metadata: frpv1.ClientPodTemplateMeta{
+				Labels: map[string]string{
+					"team":               "foo",
+					labelKeyEndpointName: "other",
+				},
+				Annotations: map[string]string{
+					"example.com/scrape":               "true",
+					annotationKeyEndpointPodConfigHash: "other",
+				},
+			},
+			Spec: frpv1.ClientPodSpec{
+				Command:                  []string{"/usr/bin/frpc"},
+				Resources:                resources,
+				ContainerSecurityContext: containerSecurityContext,
+				NodeSelector:             map[string]string{"kubernetes.io/os": "linux"},
+				Tolerations:              tolerations,
+				ImagePullSecrets:         []corev1.LocalObjectReference{{Name: "registry"}},
+				ServiceAccountName:       "frpc",
+				PriorityClassName:        "high",
+			},
+		})
+		template := r.buildEndpointPodTemplate(endpoint, frpcConfig)
+
+		expectedLabels := map[string]string{"team": "foo", labelKeyEndpointName: "endpoint"}
+		if !reflect.DeepEqual(template.Labels, expectedLabels) {
+			t.Errorf("unexpected labels: %v", template.Labels)
+		}
+		if template.Annotations["example.com/scrape"] != "true" ||
+			template.Annotations[annotationKeyEndpointPodConfigHash] != "hash" {
+			t.Errorf("unexpected annotations: %v", template.Annotations)
+		}
+
+		if !reflect.DeepEqual(template.Spec.NodeSelector, map[string]string{"kubernetes.io/os": "linux"}) ||
+			!reflect.DeepEqual(template.Spec.Tolerations, tolerations) ||
+			!reflect.DeepEqual(template.Spec.ImagePullSecrets, []corev1.LocalObjectReference{{Name: "registry"}}) ||
+			template.Spec.ServiceAccountName != "frpc" ||
+			template.Spec.PriorityClassName != "high" {
+			t.Errorf("unexpected pod spec: %+v", template.Spec)
+		}
+
+		container := findContainer(template.Spec.Containers, frpcContainerName)
+		if !reflect.DeepEqual(container.Command, []string{"/usr/bin/frpc"}) {
+			t.Errorf("unexpected command: %v", container.Command)
+		}
+		if !reflect.DeepEqual(container.Args, []string{"-c", "/data/frpc.ini"}) {
+			t.Errorf("config file flags should be kept: %v", container.Args)
+		}
+		if !reflect.DeepEqual(container.Resources, resources) {
+			t.Errorf("unexpected resources: %+v", container.Resources)
+		}
+		for _, c := range append(template.Spec.InitContainers, *container) {
+			if !reflect.DeepEqual(c.SecurityContext, containerSecurityContext) {
+				t.Errorf("unexpected security context of container %s: %+v", c.Name, c.SecurityContext)
+			}
+		}
+	})
+}
+
+// newTestOIDCTokenEndpoint starts an OIDC token endpoint stand-in accepting the given client credentials,
+// the returned counter tells the number of token requests received.
+func newTestOIDCTokenEndpoint(clientID string, clientSecret string) (*httptest.Server, *int) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		user, password, ok := r.BasicAuth()
+		if !ok || user != clientID || password != clientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+		})
+	}))
+	return server, &requests
+}
+
+func newTestOIDCEndpoint(tokenEndpointURL string) (*frpv1.Endpoint, *corev1.Secret) {
+	clientSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "oidc"},
+		Data:       map[string][]byte{"client-secret": []byte("secret")},
+	}
+	endpoint := &frpv1.Endpoint{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "endpoint",
+			UID:        types.UID("endpoint-uid"),
+			Generation: 1,
+		},
+		Spec: frpv1.EndpointSpec{
+			Addr: "127.0.0.1",
+			Port: 7000,
+			Auth: &frpv1.EndpointAuth{
+				OIDC: &frpv1.OIDCAuth{
+					ClientID: "frpc",
+					ClientSecretRef: corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: clientSecret.Name},
+						Key:                  "client-secret",
+					},
+					Audience:         "frps",
+					TokenEndpointURL: tokenEndpointURL,
+				},
+			},
+		},
+	}
+	return endpoint, clientSecret
+}
+
+func TestEndpointReconciler_GenerateFrpcConfig_OIDC(t *testing.T) {
+	server, _ := newTestOIDCTokenEndpoint("frpc", "secret")
+	defer server.Close()
+	endpoint, clientSecret := newTestOIDCEndpoint(server.URL + "/oauth2/token")
+	r := &EndpointReconciler{
+		Client: fake.NewClientBuilder().WithScheme(newIngressTestScheme(t)).WithObjects(clientSecret).Build(),
+	}
+
+	ctx := context.Background()
+	endpointView := newEndpointView(endpoint)
+	oidcClientSecret, err := r.resolveEndpointOIDCClientSecret(ctx, endpointView)
+	if err != nil {
+		t.Fatalf("resolve client secret: %v", err)
+	}
+	config, err := r.generateFrpcConfig(
+		ctx, endpointView, nil, &frpv1.VisitorList{}, nil, "", oidcClientSecret, "admin",
+	)
+	if err != nil {
+		t.Fatalf("generate config: %v", err)
+	}
+
+	// NOTE: frpc requests the token with the rendered settings on login, the same as oidc.Client
+	cases := []struct {
+		name   string
+		format frpconfig.Format
+		parse  func(content string) (*oidc.Client, error)
+	}{
+		{
+			name:   "ini",
+			format: frpconfig.FormatINI,
+			parse: func(content string) (*oidc.Client, error) {
+				cfg, err := ini.Load([]byte(content))
+				if err != nil {
+					return nil, err
+				}
+				common := cfg.Section("common")
+				if method := common.Key("authentication_method").String(); method != "oidc" {
+					return nil, fmt.Errorf("unexpected authentication method: %s", method)
+				}
+				return &oidc.Client{
+					TokenEndpointURL: common.Key("oidc_token_endpoint_url").String(),
+					ClientID:         common.Key("oidc_client_id").String(),
+					ClientSecret:     common.Key("oidc_client_secret").String(),
+					Audience:         common.Key("oidc_audience").String(),
+					Scope:            common.Key("oidc_scope").String(),
+				}, nil
+			},
+		},
+		{
+			name:   "toml",
+			format: frpconfig.FormatTOML,
+			parse: func(content string) (*oidc.Client, error) {
+				var cfg struct {
+					Auth struct {
+						Method string
+						OIDC   struct {
+							ClientID         string `toml:"clientID"`
+							ClientSecret     string `toml:"clientSecret"`
+							Audience         string `toml:"audience"`
+							Scope            string `toml:"scope"`
+							TokenEndpointURL string `toml:"tokenEndpointURL"`
+						} `toml:"oidc"`
+					} `toml:"auth"`
+				}
+				if _, err := toml.Decode(content, &cfg); err != nil {
+					return nil, err
+				}
+				if cfg.Auth.Method != "oidc" {
+					return nil, fmt.Errorf("unexpected authentication method: %s", cfg.Auth.Method)
+				}
+				return &oidc.Client{
+					TokenEndpointURL: cfg.Auth.OIDC.TokenEndpointURL,
+					ClientID:         cfg.Auth.OIDC.ClientID,
+					ClientSecret:     cfg.Auth.OIDC.ClientSecret,
+					Audience:         cfg.Auth.OIDC.Audience,
+					Scope:            cfg.Auth.OIDC.Scope,
+				}, nil
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			content, err := config.Generate(c.format)
+			if err != nil {
+				t.Fatalf("render config: %v", err)
+			}
+			oidcClient, err := c.parse(content)
+			if err != nil {
+				t.Fatalf("parse config: %v\n%s", err, content)
+			}
+			if _, err := oidcClient.Token(ctx); err != nil {
+				t.Errorf("request token with the rendered config: %v\n%s", err, content)
+			}
+		})
+	}
+}
+
+func TestEndpointReconciler_CheckEndpointOIDCToken(t *testing.T) {
+	server, requests := newTestOIDCTokenEndpoint("frpc", "secret")
+	defer server.Close()
+	endpoint, clientSecret := newTestOIDCEndpoint(server.URL + "/oauth2/token")
+	r := &EndpointReconciler{
+		Client: fake.NewClientBuilder().WithScheme(newIngressTestScheme(t)).WithObjects(clientSecret).Build(),
+	}
+	ctx := context.Background()
+
+	expectCheck := func(expectedError bool, expectedRequests int) {
+		t.Helper()
+		err := r.checkEndpointOIDCToken(ctx, newEndpointView(endpoint))
+		if (err != nil) != expectedError {
+			t.Errorf("unexpected check result: %v", err)
+		}
+		if *requests != expectedRequests {
+			t.Errorf("expected %d token requests, got %d", expectedRequests, *requests)
+		}
+	}
+
+	// the result is cached for the same spec
+	expectCheck(false, 1)
+	expectCheck(false, 1)
+
+	// spec changed
+	endpoint.Spec.Auth.OIDC.ClientID = "other"
+	endpoint.Generation++
+	expectCheck(true, 2)
+	expectCheck(true, 2)
+
+	// client secret changed
+	clientSecret.Data["client-secret"] = []byte("rotated")
+	if err := r.Update(ctx, clientSecret); err != nil {
+		t.Fatalf("update client secret: %v", err)
+	}
+	expectCheck(true, 3)
+
+	// cache dropped after logged in
+	r.oidcTokenChecks.Delete(endpoint.UID)
+	expectCheck(true, 4)
+}
+
+func TestEndpointReconciler_MapToEndpoint(t *testing.T) {
+	r := &EndpointReconciler{}
+
+	cases := []struct {
+		name     string
+		obj      client.Object
+		expected []reconcile.Request
+	}{
+		{
+			name: "labeled",
+			obj: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default", Name: "frpc",
+				Labels: map[string]string{labelKeyEndpointName: "endpoint"},
+			}},
+			expected: []reconcile.Request{
+				{NamespacedName: types.NamespacedName{Namespace: "default", Name: "endpoint"}},
+			},
+		},
+		{
+			name: "empty label",
+			obj: &frpv1.Service{ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default", Name: "ssh",
+				Labels: map[string]string{labelKeyEndpointName: ""},
+			}},
+		},
+		{
+			name: "not labeled",
+			obj: &frpv1.Visitor{ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default", Name: "ssh",
+				Labels: map[string]string{labelKeyClusterEndpointName: "endpoint"},
+			}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			requests := r.mapToEndpoint(context.Background(), c.obj)
+			if !reflect.DeepEqual(requests, c.expected) {
+				t.Errorf("unexpected requests: %+v", requests)
+			}
+		})
+	}
+}
+
+func TestEndpointReconciler_MapSecretToEndpoints(t *testing.T) {
+	newSecretRef := func(name string) *corev1.SecretKeySelector {
+		return &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: name},
+			Key:                  "key",
+		}
+	}
+	newEndpoint := func(namespace string, name string, tokenSecret string) *frpv1.Endpoint {
+		return &frpv1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       frpv1.EndpointSpec{TokenSecretRef: newSecretRef(tokenSecret)},
+		}
+	}
+	newService := func(name string, endpointName string, secretName string) *frpv1.Service {
+		return &frpv1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default", Name: name,
+				Labels: map[string]string{labelKeyEndpointName: endpointName},
+			},
+			Spec: frpv1.ServiceSpec{
+				Ports: []frpv1.ServicePort{
+					{Name: "ssh", Protocol: frpv1.ServicePortSTCP, LocalPort: 22, SecretKeyRef: newSecretRef(secretName)},
+				},
+			},
+		}
+	}
+	newVisitor := func(name string, endpointName string, secretName string) *frpv1.Visitor {
+		return &frpv1.Visitor{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default", Name: name,
+				Labels: map[string]string{labelKeyEndpointName: endpointName},
+			},
+			Spec: frpv1.VisitorSpec{SecretKeyRef: *newSecretRef(secretName)},
+		}
+	}
+
+	r := &EndpointReconciler{
+		Log: log.Log,
+		Client: fake.NewClientBuilder().
+			WithScheme(newIngressTestScheme(t)).
+			WithObjects(
+				newEndpoint("default", "token-endpoint", "token"),
+				newEndpoint("default", "other-endpoint", "other-token"),
+				newEndpoint("other", "token-endpoint", "token"),
+				newService("stcp", "service-endpoint", "sk"),
+				newService("other-stcp", "other-endpoint", "other-sk"),
+				newVisitor("stcp-visitor", "visitor-endpoint", "sk"),
+			).
+			WithIndex(&frpv1.Endpoint{}, endpointSecretRefKey, func(obj client.Object) []string {
+				return endpointReferencedSecrets(&obj.(*frpv1.Endpoint).Spec)
+			}).
+			WithIndex(&frpv1.Service{}, serviceSecretRefKey, func(obj client.Object) []string {
+				return serviceReferencedSecrets(obj.(*frpv1.Service))
+			}).
+			WithIndex(&frpv1.Visitor{}, visitorSecretRefKey, func(obj client.Object) []string {
+				return []string{obj.(*frpv1.Visitor).Spec.SecretKeyRef.Name}
+			}).
+			Build(),
+	}
+	newRequest := func(name string) reconcile.Request {
+		return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}}
+	}
+
+	cases := []struct {
+		name     string
+		secret   string
+		expected []reconcile.Request
+	}{
+		{
+			name:     "endpoint token",
+			secret:   "token",
+			expected: []reconcile.Request{newRequest("token-endpoint")},
+		},
+		{
+			name:     "service and visitor secret key",
+			secret:   "sk",
+			expected: []reconcile.Request{newRequest("service-endpoint"), newRequest("visitor-endpoint")},
+		},
+		{
+			name:   "not referenced",
+			secret: "unknown",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: c.secret}}
+			requests := r.mapSecretToEndpoints(context.Background(), secret)
+			if !reflect.DeepEqual(requests, c.expected) {
+				t.Errorf("unexpected requests: %+v", requests)
+			}
+		})
+	}
+}
+
+func TestGroupFrpcApps(t *testing.T) {
+	config := &frpconfig.FrpcConfig{
+		Apps: map[string]*frpconfig.ConfigApp{
+			"ssh_22":  {Type: "tcp"},
+			"web_80":  {Type: "http"},
+			"web_443": {Type: "https"},
+			"dns_53":  {Type: "udp"},
+			"db_5432": {Type: "stcp"},
+		},
+	}
+	groupFrpcApps(config, "key")
+
+	cases := []struct {
+		appName       string
+		expectedGroup string
+	}{
+		{appName: "ssh_22@{{ .Envs.FRPC_POD_NAME }}", expectedGroup: "ssh_22"},
+		{appName: "web_80@{{ .Envs.FRPC_POD_NAME }}", expectedGroup: "web_80"},
+		{appName: "web_443"},
+		{appName: "dns_53"},
+		{appName: "db_5432"},
+	}
+	if len(config.Apps) != len(cases) {
+		t.Errorf("expected %d apps, got %d", len(cases), len(config.Apps))
+	}
+	for _, c := range cases {
+		app, exists := config.Apps[c.appName]
+		if !exists {
+			t.Errorf("app %s not found", c.appName)
+			continue
+		}
+		if app.Group != c.expectedGroup {
+			t.Errorf("app %s: expected group %q, got %q", c.appName, c.expectedGroup, app.Group)
+		}
+		expectedGroupKey := ""
+		if c.expectedGroup != "" {
+			expectedGroupKey = "key"
+		}
+		if app.GroupKey != expectedGroupKey {
+			t.Errorf("app %s: expected group key %q, got %q", c.appName, expectedGroupKey, app.GroupKey)
+		}
+	}
+}
+
+func TestTrimProxyNamePod(t *testing.T) {
+	cases := []struct {
+		proxyName string
+		expected  string
+	}{
+		{proxyName: "ssh_22@endpoint-frpc-abcde-6d4b8f7c9d-x2k8q", expected: "ssh_22"},
+		{proxyName: "web_443", expected: "web_443"},
+	}
+	for _, c := range cases {
+		if actual := trimProxyNamePod(c.proxyName); actual != c.expected {
+			t.Errorf("%s: expected %q, got %q", c.proxyName, c.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+// endpointObject is the resource served by a frpc deployment, either Endpoint or ClusterEndpoint.
+type endpointObject interface {
+	runtime.Object
+	metav1.Object
+}
+
+// endpointView is the namespaced view of an Endpoint or ClusterEndpoint for managing the frpc.
+// The frpc resources are created in the view's namespace and owned by the underlying object.
+type endpointView struct {
+	*frpv1.Endpoint
+
+	// Kind tells the kind of the underlying object.
+	Kind string
+	// Object is the underlying object, finalizers and status are updated through it.
+	Object endpointObject
+	// LabelKey is the label key for binding the services and the frpc pods.
+	LabelKey string
+	// OwnerKey is the index key of the owned resources.
+	OwnerKey string
+}
+
+func newEndpointView(endpoint *frpv1.Endpoint) *endpointView {
+	return &endpointView{
+		Endpoint: endpoint,
+		Kind:     KindEndpoint,
+		Object:   endpoint,
+		LabelKey: labelKeyEndpointName,
+		OwnerKey: endpointOwnerKey,
+	}
+}
+
+// newClusterEndpointView creates the view of the cluster endpoint, which runs the frpc in the namespace.
+func newClusterEndpointView(endpoint *frpv1.ClusterEndpoint, namespace string) *endpointView {
+	view := &frpv1.Endpoint{
+		ObjectMeta: *endpoint.ObjectMeta.DeepCopy(),
+		Spec:       *endpoint.Spec.EndpointSpec.DeepCopy(),
+		Status:     *endpoint.Status.DeepCopy(),
+	}
+	view.Namespace = namespace
+
+	return &endpointView{
+		Endpoint: view,
+		Kind:     KindClusterEndpoint,
+		Object:   endpoint,
+		LabelKey: labelKeyClusterEndpointName,
+		OwnerKey: clusterEndpointOwnerKey,
+	}
+}
+
+// syncStatus copies the status of the view to the underlying object.
+func (e *endpointView) syncStatus() {
+	if clusterEndpoint, ok := e.Object.(*frpv1.ClusterEndpoint); ok {
+		clusterEndpoint.Status = *e.Status.DeepCopy()
+	}
+}
+
+// listEndpointServices lists the services bound to the endpoint. For cluster endpoints,
+// services from the namespaces not selected by the namespace selector are skipped.
+func (r *EndpointReconciler) listEndpointServices(
+	ctx context.Context,
+	endpoint *endpointView,
+) ([]frpv1.Service, error) {
+	var serviceList frpv1.ServiceList
+	listOptions := []client.ListOption{
+		client.MatchingLabels{endpoint.LabelKey: endpoint.Name},
+	}
+	if endpoint.Kind == KindEndpoint {
+		listOptions = append(listOptions, client.InNamespace(endpoint.Namespace))
+	}
+	if err := r.List(ctx, &serviceList, listOptions...); err != nil {
+		return nil, err
+	}
+
+	clusterEndpoint, ok := endpoint.Object.(*frpv1.ClusterEndpoint)
+	if !ok {
+		return serviceList.Items, nil
+	}
+
+	var services []frpv1.Service
+	namespacesAllowed := map[string]bool{}
+	for _, service := range serviceList.Items {
+		allowed, checked := namespacesAllowed[service.Namespace]
+		if !checked {
+			var err error
+			allowed, err = clusterEndpointAllowsNamespace(ctx, r.Client, clusterEndpoint, service.Namespace)
+			if err != nil {
+				return nil, err
+			}
+			namespacesAllowed[service.Namespace] = allowed
+		}
+		if allowed {
+			services = append(services, service)
+		}
+	}
+	return services, nil
+}
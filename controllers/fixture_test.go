@@ -72,9 +72,10 @@ func deleteNamespace(
 }
 
 type frpsDeployStatus struct {
-	Endpoint string
-	Port     int32
-	Token    string
+	ServerEndpoint string
+	Endpoint       string
+	Port           int32
+	Token          string
 }
 
 func (s frpsDeployStatus) String() string {
@@ -86,98 +87,57 @@ type frpsSettings struct {
 	Token string
 }
 
-func (s *frpsSettings) buildFrpsConfig(namespace string) *corev1.ConfigMap {
-	return &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: "frps-config-",
-			Namespace:    namespace,
-		},
-		Data: map[string]string{
-			"frps.ini": fmt.Sprintf(`
-[common]
-bind_port = %d
-token = %s
-log_level=info
-`, s.Port, s.Token),
-		},
-	}
-}
-
-func (s *frpsSettings) buildFrpsPod(
+func (s *frpsSettings) buildServerEndpoint(
 	namespace string,
-	configMap *corev1.ConfigMap,
-) *corev1.Pod {
-	const (
-		configVolume = "config-volume"
-	)
-
-	return &corev1.Pod{
+	tokenSecret *corev1.Secret,
+) *frpv1.ServerEndpoint {
+	return &frpv1.ServerEndpoint{
 		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: "frps-pod-",
+			GenerateName: "frps-",
 			Namespace:    namespace,
 		},
-		Spec: corev1.PodSpec{
-			Containers: []corev1.Container{
-				{
-					Name:    "frps",
-					Image:   frpDockerImage,
-					Command: []string{"/opt/frp/frps"},
-					Args:    []string{"-c", "/data/frps.ini"},
-					Ports: []corev1.ContainerPort{
-						{ContainerPort: s.Port},
-					},
-					VolumeMounts: []corev1.VolumeMount{
-						{
-							Name:      configVolume,
-							MountPath: "/data",
-						},
-					},
-				},
-			},
-			Volumes: []corev1.Volume{
-				{
-					Name: configVolume,
-					VolumeSource: corev1.VolumeSource{
-						ConfigMap: &corev1.ConfigMapVolumeSource{
-							LocalObjectReference: corev1.LocalObjectReference{
-								Name: configMap.Name,
-							},
-							Items: []corev1.KeyToPath{
-								{
-									Key:  "frps.ini",
-									Path: "frps.ini",
-								},
-							},
-						},
-					},
-				},
+		Spec: frpv1.ServerEndpointSpec{
+			BindPort: s.Port,
+			TokenSecretRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: tokenSecret.Name},
+				Key:                  "token",
 			},
+			ServiceType: corev1.ServiceTypeClusterIP,
 		},
 	}
 }
 
+// DeployToCluster deploys the frps with a ServerEndpoint, and waits for it to be ready.
 func (s *frpsSettings) DeployToCluster(
 	ctx context.Context,
 	k8sClient client.Client,
 	namespace string,
 ) (*frpsDeployStatus, error) {
-	configMap := s.buildFrpsConfig(namespace)
-	err := k8sClient.Create(ctx, configMap)
+	tokenSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "frps-token-",
+			Namespace:    namespace,
+		},
+		StringData: map[string]string{
+			"token": s.Token,
+		},
+	}
+	err := k8sClient.Create(ctx, tokenSecret)
 	if err != nil {
 		return nil, err
 	}
-	log.Log.Info(fmt.Sprintf("created config map: %s", configMap.Name))
+	log.Log.Info(fmt.Sprintf("created token secret: %s", tokenSecret.Name))
 
-	pod := s.buildFrpsPod(namespace, configMap)
-	err = k8sClient.Create(ctx, pod)
+	serverEndpoint := s.buildServerEndpoint(namespace, tokenSecret)
+	err = k8sClient.Create(ctx, serverEndpoint)
 	if err != nil {
 		return nil, err
 	}
-	log.Log.Info(fmt.Sprintf("created pod: %s", pod.Name))
+	log.Log.Info(fmt.Sprintf("created server endpoint: %s", serverEndpoint.Name))
 
-	podName := client.ObjectKey{
-		Namespace: pod.Namespace,
-		Name:      pod.Name,
+	serverEndpointName := client.ObjectKey{
+		Namespace: serverEndpoint.Namespace,
+		Name:      serverEndpoint.Name,
 	}
 
 	deployStatus := &frpsDeployStatus{}
@@ -187,23 +147,24 @@ func (s *frpsSettings) DeployToCluster(
 	}
 	retryErr := retryOpt.Retry(func() error {
 		var (
-			podLatest corev1.Pod
-			err       error
+			serverEndpointLatest frpv1.ServerEndpoint
+			err                  error
 		)
-		err = k8sClient.Get(ctx, podName, &podLatest)
+		err = k8sClient.Get(ctx, serverEndpointName, &serverEndpointLatest)
 		if err != nil {
 			return err
 		}
-		log.Log.Info(fmt.Sprintf("pod status: %s", podLatest.Status.Phase))
-		if podLatest.Status.Phase == corev1.PodRunning {
-			deployStatus.Endpoint = podLatest.Status.PodIP
+		log.Log.Info(fmt.Sprintf("server endpoint status: %s", serverEndpointLatest.Status.State))
+		if serverEndpointLatest.Status.State == frpv1.ServerEndpointReady {
+			deployStatus.ServerEndpoint = serverEndpointLatest.Name
+			deployStatus.Endpoint = serverEndpointLatest.Status.Addr
 			deployStatus.Port = s.Port
 			deployStatus.Token = s.Token
 			return nil
 		}
 
-		log.Log.Info("pod is not ready, retry...")
-		return errors.New("pod is not ready")
+		log.Log.Info("server endpoint is not ready, retry...")
+		return errors.New("server endpoint is not ready")
 	})
 	if retryErr != nil {
 		return nil, retryErr
@@ -0,0 +1,1357 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/b4fun/frpcontroller/pkg/frpcadmin"
+	"github.com/b4fun/frpcontroller/pkg/frpconfig"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+const (
+	// GatewayControllerName is the controller name of the gateway classes implemented by frp.
+	GatewayControllerName = "frp.go.build4.fun/gateway-controller"
+
+	kindGateway   = "Gateway"
+	kindHTTPRoute = "HTTPRoute"
+	kindTCPRoute  = "TCPRoute"
+	kindUDPRoute  = "UDPRoute"
+)
+
+// gatewayListenerRouteKinds maps the supported listener protocols to the route kinds attached to them.
+var gatewayListenerRouteKinds = map[gatewayv1.ProtocolType]string{
+	gatewayv1.HTTPProtocolType: kindHTTPRoute,
+	gatewayv1.TCPProtocolType:  kindTCPRoute,
+	gatewayv1.UDPProtocolType:  kindUDPRoute,
+}
+
+// gatewayRouteProxyTypes maps the route kinds to the frp proxy types.
+var gatewayRouteProxyTypes = map[string]string{
+	kindHTTPRoute: "http",
+	kindTCPRoute:  "tcp",
+	kindUDPRoute:  "udp",
+}
+
+// GatewayOptions configures the Gateway API implemented by frp.
+type GatewayOptions struct {
+	// Enabled implements the gateway classes with GatewayControllerName as the controller.
+	// The Gateway API CRDs should be installed, including the experimental TCPRoute and UDPRoute.
+	Enabled bool
+}
+
+// gatewayEndpointName returns the name of the endpoint exposing the gateway,
+// set by the `frp.go.build4.fun/endpoint` annotation, defaults to the gateway name.
+func gatewayEndpointName(gateway *gatewayv1.Gateway) string {
+	if endpointName := gateway.Annotations[annotationKeyCoreServiceEndpoint]; endpointName != "" {
+		return endpointName
+	}
+	return gateway.Name
+}
+
+// isGatewayClassImplemented tells if the gateway class is implemented by frp.
+func isGatewayClassImplemented(ctx context.Context, reader client.Reader, className gatewayv1.ObjectName) (bool, error) {
+	var gatewayClass gatewayv1.GatewayClass
+	err := reader.Get(ctx, client.ObjectKey{Name: string(className)}, &gatewayClass)
+	switch {
+	case err == nil:
+	case apierrors.IsNotFound(err):
+		return false, nil
+	default:
+		return false, err
+	}
+	return gatewayClass.Spec.ControllerName == GatewayControllerName, nil
+}
+
+// gatewayRoute is the common view of the HTTPRoute, TCPRoute and UDPRoute attached to the gateways.
+type gatewayRoute struct {
+	// Kind tells the kind of the route.
+	Kind string
+	// Object is the underlying route, the status is updated through it.
+	Object client.Object
+	// ParentRefs lists the gateways the route attaches to.
+	ParentRefs []gatewayv1.ParentReference
+	// Hostnames lists the hostnames of the HTTPRoute.
+	Hostnames []gatewayv1.Hostname
+	// Status points to the status of the underlying route.
+	Status *gatewayv1.RouteStatus
+	// Rules lists the rules of the route, the matches and filters are only set for the HTTPRoute.
+	Rules []gatewayRouteRule
+}
+
+// gatewayRouteRule is the common view of the route rules.
+type gatewayRouteRule struct {
+	Matches     []gatewayv1.HTTPRouteMatch
+	HasFilters  bool
+	BackendRefs []gatewayv1.BackendRef
+}
+
+// listGatewayRoutes lists the HTTPRoutes, TCPRoutes and UDPRoutes in all namespaces,
+// sorted by the creation time so the earlier routes take precedence.
+func listGatewayRoutes(ctx context.Context, reader client.Reader) ([]*gatewayRoute, error) {
+	var routes []*gatewayRoute
+
+	var httpRouteList gatewayv1.HTTPRouteList
+	if err := reader.List(ctx, &httpRouteList); err != nil {
+		return nil, err
+	}
+	for i := range httpRouteList.Items {
+		httpRoute := &httpRouteList.Items[i]
+		route := &gatewayRoute{
+			Kind:       kindHTTPRoute,
+			Object:     httpRoute,
+			ParentRefs: httpRoute.Spec.ParentRefs,
+			Hostnames:  httpRoute.Spec.Hostnames,
+			Status:     &httpRoute.Status.RouteStatus,
+		}
+		for _, rule := range httpRoute.Spec.Rules {
+			routeRule := gatewayRouteRule{
+				Matches:    rule.Matches,
+				HasFilters: len(rule.Filters) > 0,
+			}
+			for _, backendRef := range rule.BackendRefs {
+				routeRule.BackendRefs = append(routeRule.BackendRefs, backendRef.BackendRef)
+				routeRule.HasFilters = routeRule.HasFilters || len(backendRef.Filters) > 0
+			}
+			route.Rules = append(route.Rules, routeRule)
+		}
+		routes = append(routes, route)
+	}
+
+	var tcpRouteList gatewayv1alpha2.TCPRouteList
+	if err := reader.List(ctx, &tcpRouteList); err != nil {
+		return nil, err
+	}
+	for i := range tcpRouteList.Items {
+		tcpRoute := &tcpRouteList.Items[i]
+		route := &gatewayRoute{
+			Kind:       kindTCPRoute,
+			Object:     tcpRoute,
+			ParentRefs: tcpRoute.Spec.ParentRefs,
+			Status:     &tcpRoute.Status.RouteStatus,
+		}
+		for _, rule := range tcpRoute.Spec.Rules {
+			route.Rules = append(route.Rules, gatewayRouteRule{BackendRefs: rule.BackendRefs})
+		}
+		routes = append(routes, route)
+	}
+
+	var udpRouteList gatewayv1alpha2.UDPRouteList
+	if err := reader.List(ctx, &udpRouteList); err != nil {
+		return nil, err
+	}
+	for i := range udpRouteList.Items {
+		udpRoute := &udpRouteList.Items[i]
+		route := &gatewayRoute{
+			Kind:       kindUDPRoute,
+			Object:     udpRoute,
+			ParentRefs: udpRoute.Spec.ParentRefs,
+			Status:     &udpRoute.Status.RouteStatus,
+		}
+		for _, rule := range udpRoute.Spec.Rules {
+			route.Rules = append(route.Rules, gatewayRouteRule{BackendRefs: rule.BackendRefs})
+		}
+		routes = append(routes, route)
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		ti, tj := routes[i].Object.GetCreationTimestamp(), routes[j].Object.GetCreationTimestamp()
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		if routes[i].Object.GetNamespace() != routes[j].Object.GetNamespace() {
+			return routes[i].Object.GetNamespace() < routes[j].Object.GetNamespace()
+		}
+		if routes[i].Object.GetName() != routes[j].Object.GetName() {
+			return routes[i].Object.GetName() < routes[j].Object.GetName()
+		}
+		return routes[i].Kind < routes[j].Kind
+	})
+	return routes, nil
+}
+
+// parentRefMatchesGateway tells if the parent reference of the route refers to the gateway.
+func parentRefMatchesGateway(route *gatewayRoute, parentRef gatewayv1.ParentReference, gateway client.Object) bool {
+	if parentRef.Group != nil && *parentRef.Group != gatewayv1.GroupName {
+		return false
+	}
+	if parentRef.Kind != nil && *parentRef.Kind != kindGateway {
+		return false
+	}
+	namespace := route.Object.GetNamespace()
+	if parentRef.Namespace != nil {
+		namespace = string(*parentRef.Namespace)
+	}
+	return namespace == gateway.GetNamespace() && string(parentRef.Name) == gateway.GetName()
+}
+
+// gatewayProxy is an frp proxy generated for the route attached to the gateway listener.
+type gatewayProxy struct {
+	Name string
+	App  *frpconfig.ConfigApp
+}
+
+// gatewayRouteParent tells how the route is attached to the gateway by the parent reference.
+type gatewayRouteParent struct {
+	Route     *gatewayRoute
+	ParentRef gatewayv1.ParentReference
+
+	// Accepted tells if the route is accepted by the gateway, the reason and message
+	// are reported with the Accepted condition.
+	Accepted        bool
+	AcceptedReason  gatewayv1.RouteConditionReason
+	AcceptedMessage string
+
+	// RefsResolved tells if the backends of the route are resolved, the reason and message
+	// are reported with the ResolvedRefs condition.
+	RefsResolved bool
+	RefsReason   gatewayv1.RouteConditionReason
+	RefsMessage  string
+
+	// Proxies lists the frp proxies generated for the route.
+	Proxies []gatewayProxy
+}
+
+// gatewayListener is the resolved view of a gateway listener.
+type gatewayListener struct {
+	Listener gatewayv1.Listener
+
+	// RouteKind tells the kind of the routes attached to the listener, empty if the protocol is not supported.
+	RouteKind string
+	// SupportedKinds lists the route kinds allowed by the listener and supported.
+	SupportedKinds []gatewayv1.RouteGroupKind
+	// InvalidKinds tells if the listener allows route kinds not supported.
+	InvalidKinds bool
+	// AttachedRoutes tells the number of routes attached to the listener.
+	AttachedRoutes int32
+	// Proxies lists the names of the frp proxies generated for the listener.
+	Proxies []string
+
+	// usedBy tells the route claiming the remote port of a TCP/UDP listener.
+	usedBy string
+}
+
+// gatewayView is the resolved view of a gateway implemented by frp.
+type gatewayView struct {
+	Gateway   *gatewayv1.Gateway
+	Listeners []*gatewayListener
+	Parents   []*gatewayRouteParent
+
+	// Invalid tells why the gateway cannot be implemented, the routes are not attached if set.
+	Invalid string
+}
+
+// resolveGateway resolves the listeners of the gateway and the routes attached to them,
+// along with the frp proxies of the routes.
+func resolveGateway(
+	ctx context.Context,
+	reader client.Reader,
+	gateway *gatewayv1.Gateway,
+	routes []*gatewayRoute,
+) (*gatewayView, error) {
+	view := &gatewayView{Gateway: gateway}
+	if len(gateway.Spec.Addresses) > 0 {
+		view.Invalid = "addresses are not supported, the gateway is exposed at the endpoint's address"
+	}
+
+	for _, listener := range gateway.Spec.Listeners {
+		gatewayListener := &gatewayListener{Listener: listener}
+		routeKind, supported := gatewayListenerRouteKinds[listener.Protocol]
+		if supported {
+			var allowedKinds []gatewayv1.RouteGroupKind
+			if listener.AllowedRoutes != nil {
+				allowedKinds = listener.AllowedRoutes.Kinds
+			}
+			if len(allowedKinds) == 0 {
+				gatewayListener.RouteKind = routeKind
+			}
+			for _, kind := range allowedKinds {
+				if (kind.Group == nil || *kind.Group == gatewayv1.GroupName) && string(kind.Kind) == routeKind {
+					gatewayListener.RouteKind = routeKind
+				} else {
+					gatewayListener.InvalidKinds = true
+				}
+			}
+		}
+		if gatewayListener.RouteKind != "" {
+			group := gatewayv1.Group(gatewayv1.GroupName)
+			gatewayListener.SupportedKinds = []gatewayv1.RouteGroupKind{
+				{Group: &group, Kind: gatewayv1.Kind(gatewayListener.RouteKind)},
+			}
+		}
+		view.Listeners = append(view.Listeners, gatewayListener)
+	}
+
+	for _, route := range routes {
+		for _, parentRef := range route.ParentRefs {
+			if !parentRefMatchesGateway(route, parentRef, gateway) {
+				continue
+			}
+			parent, err := resolveGatewayRouteParent(ctx, reader, view, route, parentRef)
+			if err != nil {
+				return nil, err
+			}
+			view.Parents = append(view.Parents, parent)
+		}
+	}
+
+	return view, nil
+}
+
+// resolveGatewayRouteParent attaches the route to the listeners selected by the parent reference,
+// and generates the frp proxies for the attached listeners.
+func resolveGatewayRouteParent(
+	ctx context.Context,
+	reader client.Reader,
+	view *gatewayView,
+	route *gatewayRoute,
+	parentRef gatewayv1.ParentReference,
+) (*gatewayRouteParent, error) {
+	parent := &gatewayRouteParent{
+		Route:        route,
+		ParentRef:    parentRef,
+		RefsResolved: true,
+		RefsReason:   gatewayv1.RouteReasonResolvedRefs,
+		RefsMessage:  "backends resolved",
+	}
+	routeKey := fmt.Sprintf("%s %s/%s", route.Kind, route.Object.GetNamespace(), route.Object.GetName())
+	if view.Invalid != "" {
+		parent.AcceptedReason = gatewayv1.RouteReasonNotAllowedByListeners
+		parent.AcceptedMessage = fmt.Sprintf("gateway is not accepted: %s", view.Invalid)
+		return parent, nil
+	}
+
+	parent.AcceptedReason = gatewayv1.RouteReasonNoMatchingParent
+	parent.AcceptedMessage = "no listener matches the parent reference"
+	var (
+		attached    []*gatewayListener
+		unsupported []string
+		refErrors   []string
+	)
+	for _, listener := range view.Listeners {
+		if parentRef.SectionName != nil && *parentRef.SectionName != listener.Listener.Name {
+			continue
+		}
+		if parentRef.Port != nil && *parentRef.Port != listener.Listener.Port {
+			continue
+		}
+		if listener.RouteKind != route.Kind {
+			parent.AcceptedReason = gatewayv1.RouteReasonNotAllowedByListeners
+			parent.AcceptedMessage = fmt.Sprintf("listener %s does not allow %s", listener.Listener.Name, route.Kind)
+			continue
+		}
+		allowed, err := gatewayListenerAllowsNamespace(ctx, reader, view.Gateway, &listener.Listener, route.Object.GetNamespace())
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			parent.AcceptedReason = gatewayv1.RouteReasonNotAllowedByListeners
+			parent.AcceptedMessage = fmt.Sprintf(
+				"listener %s does not allow routes from namespace %s",
+				listener.Listener.Name, route.Object.GetNamespace(),
+			)
+			continue
+		}
+		hostnames, matched := intersectGatewayHostnames(listener.Listener.Hostname, route.Hostnames)
+		if !matched {
+			parent.AcceptedReason = gatewayv1.RouteReasonNoMatchingListenerHostname
+			parent.AcceptedMessage = fmt.Sprintf("no hostname matches listener %s", listener.Listener.Name)
+			continue
+		}
+
+		listener.AttachedRoutes++
+		attached = append(attached, listener)
+		if route.Kind != kindHTTPRoute {
+			// NOTE: the remote port of the TCP/UDP listener serves one route only, the earlier route wins
+			if listener.usedBy != "" && listener.usedBy != routeKey {
+				unsupported = append(unsupported, fmt.Sprintf(
+					"listener %s is used by %s", listener.Listener.Name, listener.usedBy,
+				))
+				continue
+			}
+			listener.usedBy = routeKey
+		} else if len(hostnames) == 0 {
+			unsupported = append(unsupported, fmt.Sprintf(
+				"listener %s: hostnames are required by the frp http proxies", listener.Listener.Name,
+			))
+			continue
+		}
+
+		for i, rule := range route.Rules {
+			if rule.HasFilters {
+				unsupported = append(unsupported, fmt.Sprintf("rule %d: filters are not supported", i))
+				continue
+			}
+			if len(rule.BackendRefs) != 1 {
+				unsupported = append(unsupported, fmt.Sprintf("rule %d: exactly one backend is required", i))
+				continue
+			}
+			locations, err := gatewayRouteRuleLocations(rule)
+			if err != nil {
+				unsupported = append(unsupported, fmt.Sprintf("rule %d: %s", i, err))
+				continue
+			}
+			localAddr, localPort, err := resolveGatewayBackend(ctx, reader, route.Object.GetNamespace(), rule.BackendRefs[0])
+			var refErr *gatewayRefError
+			switch {
+			case errors.As(err, &refErr):
+				if parent.RefsResolved {
+					parent.RefsResolved = false
+					parent.RefsReason = refErr.Reason
+				}
+				refErrors = append(refErrors, fmt.Sprintf("rule %d: %s", i, refErr.Message))
+				continue
+			case err != nil:
+				return nil, err
+			}
+
+			for j, location := range locations {
+				app := &frpconfig.ConfigApp{
+					Type:      gatewayRouteProxyTypes[route.Kind],
+					LocalAddr: localAddr,
+					LocalPort: int(localPort),
+				}
+				// NOTE: the parts are joined with `_`, which resource and listener names cannot contain,
+				// so the names never conflict with the services and the ingresses
+				proxyName := fmt.Sprintf(
+					"gateway_%s_%s_%s_%s",
+					view.Gateway.Name, listener.Listener.Name, route.Object.GetNamespace(), route.Object.GetName(),
+				)
+				if route.Kind == kindHTTPRoute {
+					app.CustomDomains = hostnames
+					if location != "" {
+						app.Locations = []string{location}
+					}
+					proxyName = fmt.Sprintf("%s_%d-%d", proxyName, i, j)
+				} else {
+					app.RemotePort = int(listener.Listener.Port)
+				}
+				parent.Proxies = append(parent.Proxies, gatewayProxy{Name: proxyName, App: app})
+				listener.Proxies = append(listener.Proxies, proxyName)
+			}
+		}
+	}
+
+	if !parent.RefsResolved {
+		parent.RefsMessage = strings.Join(refErrors, "; ")
+	}
+	switch {
+	case len(attached) == 0:
+	case len(parent.Proxies) == 0 && len(unsupported) > 0:
+		parent.AcceptedReason = gatewayv1.RouteReasonUnsupportedValue
+		parent.AcceptedMessage = strings.Join(unsupported, "; ")
+	default:
+		parent.Accepted = true
+		parent.AcceptedReason = gatewayv1.RouteReasonAccepted
+		parent.AcceptedMessage = "route is accepted"
+		if len(unsupported) > 0 {
+			parent.AcceptedMessage = fmt.Sprintf("route is accepted, ignored: %s", strings.Join(unsupported, "; "))
+		}
+	}
+	return parent, nil
+}
+
+// gatewayRouteRuleLocations returns the frp http locations of the rule matches, frp http proxies
+// route by the path prefix only. An empty location is returned for the TCP/UDP route rules.
+func gatewayRouteRuleLocations(rule gatewayRouteRule) ([]string, error) {
+	if len(rule.Matches) == 0 {
+		return []string{""}, nil
+	}
+
+	var locations []string
+	for _, match := range rule.Matches {
+		if len(match.Headers) > 0 || len(match.QueryParams) > 0 || match.Method != nil {
+			return nil, fmt.Errorf("only path matches are supported")
+		}
+		if match.Path == nil {
+			locations = append(locations, "")
+			continue
+		}
+		if match.Path.Type != nil && *match.Path.Type != gatewayv1.PathMatchPathPrefix {
+			return nil, fmt.Errorf("path match type %s is not supported", *match.Path.Type)
+		}
+		location := ""
+		if match.Path.Value != nil {
+			location = *match.Path.Value
+		}
+		locations = append(locations, location)
+	}
+	return locations, nil
+}
+
+// gatewayListenerAllowsNamespace tells if the listener allows the routes from the namespace.
+func gatewayListenerAllowsNamespace(
+	ctx context.Context,
+	reader client.Reader,
+	gateway *gatewayv1.Gateway,
+	listener *gatewayv1.Listener,
+	namespace string,
+) (bool, error) {
+	from := gatewayv1.NamespacesFromSame
+	if listener.AllowedRoutes != nil && listener.AllowedRoutes.Namespaces != nil &&
+		listener.AllowedRoutes.Namespaces.From != nil {
+		from = *listener.AllowedRoutes.Namespaces.From
+	}
+
+	switch from {
+	case gatewayv1.NamespacesFromAll:
+		return true, nil
+	case gatewayv1.NamespacesFromSelector:
+		if listener.AllowedRoutes.Namespaces.Selector == nil {
+			return false, nil
+		}
+		selector, err := metav1.LabelSelectorAsSelector(listener.AllowedRoutes.Namespaces.Selector)
+		if err != nil {
+			return false, nil
+		}
+		var routeNamespace corev1.Namespace
+		if err := reader.Get(ctx, client.ObjectKey{Name: namespace}, &routeNamespace); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		return selector.Matches(labels.Set(routeNamespace.Labels)), nil
+	default:
+		return namespace == gateway.Namespace, nil
+	}
+}
+
+// intersectGatewayHostnames returns the hostnames of the route matching the listener hostname,
+// following the Gateway API semantics: `*.example.com` matches `foo.example.com` and `*.foo.example.com`.
+// Returns false if the route specifies hostnames but none of them matches.
+func intersectGatewayHostnames(listenerHostname *gatewayv1.Hostname, routeHostnames []gatewayv1.Hostname) ([]string, bool) {
+	var hostnames []string
+	if listenerHostname == nil || *listenerHostname == "" {
+		for _, hostname := range routeHostnames {
+			hostnames = append(hostnames, string(hostname))
+		}
+		return hostnames, true
+	}
+	if len(routeHostnames) == 0 {
+		return []string{string(*listenerHostname)}, true
+	}
+
+	for _, hostname := range routeHostnames {
+		a, b := string(*listenerHostname), string(hostname)
+		switch {
+		case a == b || wildcardHostnameMatches(a, b):
+			hostnames = append(hostnames, b)
+		case wildcardHostnameMatches(b, a):
+			hostnames = append(hostnames, a)
+		}
+	}
+	return hostnames, len(hostnames) > 0
+}
+
+// wildcardHostnameMatches tells if the wildcard hostname matches the other hostname.
+func wildcardHostnameMatches(wildcard string, hostname string) bool {
+	if !strings.HasPrefix(wildcard, "*.") {
+		return false
+	}
+	suffix := wildcard[1:]
+	return len(hostname) > len(suffix) && strings.HasSuffix(hostname, suffix)
+}
+
+// gatewayRefError tells why the backend of the route cannot be resolved.
+type gatewayRefError struct {
+	Reason  gatewayv1.RouteConditionReason
+	Message string
+}
+
+func (e *gatewayRefError) Error() string {
+	return e.Message
+}
+
+// resolveGatewayBackend resolves the cluster ip and the port of the route backend service.
+// Unresolved backends are reported with gatewayRefError.
+func resolveGatewayBackend(
+	ctx context.Context,
+	reader client.Reader,
+	namespace string,
+	backendRef gatewayv1.BackendRef,
+) (string, int32, error) {
+	ref := backendRef.BackendObjectReference
+	if (ref.Group != nil && *ref.Group != "") || (ref.Kind != nil && *ref.Kind != KindService) {
+		return "", 0, &gatewayRefError{
+			Reason:  gatewayv1.RouteReasonInvalidKind,
+			Message: fmt.Sprintf("backend %s: only core services are supported", ref.Name),
+		}
+	}
+	if ref.Namespace != nil && string(*ref.Namespace) != namespace {
+		return "", 0, &gatewayRefError{
+			Reason:  gatewayv1.RouteReasonRefNotPermitted,
+			Message: fmt.Sprintf("backend %s: backends in other namespaces are not supported", ref.Name),
+		}
+	}
+	if ref.Port == nil {
+		return "", 0, &gatewayRefError{
+			Reason:  gatewayv1.RouteReasonBackendNotFound,
+			Message: fmt.Sprintf("backend %s: port is required", ref.Name),
+		}
+	}
+
+	var kservice corev1.Service
+	err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: string(ref.Name)}, &kservice)
+	switch {
+	case err == nil:
+	case apierrors.IsNotFound(err):
+		return "", 0, &gatewayRefError{
+			Reason:  gatewayv1.RouteReasonBackendNotFound,
+			Message: fmt.Sprintf("backend service %s not found", ref.Name),
+		}
+	default:
+		return "", 0, err
+	}
+	if kservice.Spec.ClusterIP == "" || kservice.Spec.ClusterIP == corev1.ClusterIPNone {
+		return "", 0, &gatewayRefError{
+			Reason:  gatewayv1.RouteReasonBackendNotFound,
+			Message: fmt.Sprintf("backend service %s has no cluster ip", ref.Name),
+		}
+	}
+	return kservice.Spec.ClusterIP, int32(*ref.Port), nil
+}
+
+// listEndpointGateways lists the gateways implemented by frp and exposed by the endpoint.
+func listEndpointGateways(
+	ctx context.Context,
+	reader client.Reader,
+	namespace string,
+	endpointName string,
+) ([]gatewayv1.Gateway, error) {
+	var gatewayList gatewayv1.GatewayList
+	if err := reader.List(ctx, &gatewayList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	var gateways []gatewayv1.Gateway
+	for _, gateway := range gatewayList.Items {
+		if gateway.DeletionTimestamp != nil || gatewayEndpointName(&gateway) != endpointName {
+			continue
+		}
+		implemented, err := isGatewayClassImplemented(ctx, reader, gateway.Spec.GatewayClassName)
+		if err != nil {
+			return nil, err
+		}
+		if implemented {
+			gateways = append(gateways, gateway)
+		}
+	}
+	return gateways, nil
+}
+
+// generateGatewayApps generates the frp proxies for the routes attached to the gateways exposed by the endpoint.
+func (r *EndpointReconciler) generateGatewayApps(
+	ctx context.Context,
+	logger logr.Logger,
+	endpoint *endpointView,
+	config *frpconfig.FrpcConfig,
+) error {
+	if !r.Gateway.Enabled || endpoint.Kind != KindEndpoint {
+		// NOTE: gateways can only bind to the endpoint in the same namespace
+		return nil
+	}
+
+	gateways, err := listEndpointGateways(ctx, r.Client, endpoint.Namespace, endpoint.Name)
+	if err != nil || len(gateways) == 0 {
+		return err
+	}
+	routes, err := listGatewayRoutes(ctx, r.Client)
+	if err != nil {
+		return err
+	}
+	for i := range gateways {
+		view, err := resolveGateway(ctx, r.Client, &gateways[i], routes)
+		if err != nil {
+			return err
+		}
+		for _, parent := range view.Parents {
+			if !parent.Accepted {
+				logger.Info(fmt.Sprintf(
+					"gateway %s: %s %s/%s is not accepted: %s",
+					gateways[i].Name, parent.Route.Kind,
+					parent.Route.Object.GetNamespace(), parent.Route.Object.GetName(), parent.AcceptedMessage,
+				))
+			}
+			for _, proxy := range parent.Proxies {
+				config.Apps[proxy.Name] = proxy.App
+			}
+		}
+	}
+
+	return nil
+}
+
+// GatewayReconciler reports the status of the gateways implemented by frp and the routes attached to them.
+type GatewayReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways;httproutes;tcproutes;udproutes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways/status;httproutes/status;tcproutes/status;udproutes/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
+func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Log.WithValues("gateway", req.NamespacedName)
+
+	var gateway gatewayv1.Gateway
+	err := r.Get(ctx, req.NamespacedName, &gateway)
+	switch {
+	case err == nil && gateway.DeletionTimestamp != nil:
+		return r.handleDeleted(ctx, logger, &gateway)
+	case err == nil:
+		return r.handleCreateOrUpdate(ctx, logger, &gateway)
+	case apierrors.IsNotFound(err):
+		gateway.Namespace, gateway.Name = req.Namespace, req.Name
+		return r.handleDeleted(ctx, logger, &gateway)
+	default:
+		logger.Error(err, "get gateway failed")
+		return ctrl.Result{}, err
+	}
+}
+
+func (r *GatewayReconciler) handleCreateOrUpdate(
+	ctx context.Context,
+	logger logr.Logger,
+	gateway *gatewayv1.Gateway,
+) (ctrl.Result, error) {
+	implemented, err := isGatewayClassImplemented(ctx, r.Client, gateway.Spec.GatewayClassName)
+	if err != nil {
+		logger.Error(err, "get gateway class failed")
+		return ctrl.Result{}, err
+	}
+	if !implemented {
+		// NOTE: the gateway might be implemented by frp before, e.g. the class is changed
+		return r.handleDeleted(ctx, logger, gateway)
+	}
+
+	routes, err := listGatewayRoutes(ctx, r.Client)
+	if err != nil {
+		logger.Error(err, "list routes failed")
+		return ctrl.Result{}, err
+	}
+	view, err := resolveGateway(ctx, r.Client, gateway, routes)
+	if err != nil {
+		logger.Error(err, "resolve gateway failed")
+		return ctrl.Result{}, err
+	}
+
+	endpointName := gatewayEndpointName(gateway)
+	var endpoint *frpv1.Endpoint
+	var endpointObj frpv1.Endpoint
+	err = r.Get(ctx, client.ObjectKey{Namespace: gateway.Namespace, Name: endpointName}, &endpointObj)
+	switch {
+	case err == nil:
+		endpoint = &endpointObj
+	case apierrors.IsNotFound(err):
+		logger.Info(fmt.Sprintf("endpoint %s not found", endpointName))
+	default:
+		logger.Error(err, "get endpoint failed")
+		return ctrl.Result{}, err
+	}
+
+	previousStatus := gateway.Status.DeepCopy()
+	setGatewayStatus(view, endpointName, endpoint)
+	if !apiequality.Semantic.DeepEqual(previousStatus, &gateway.Status) {
+		if err := r.Status().Update(ctx, gateway); err != nil {
+			logger.Error(err, "update gateway status failed")
+			return ctrl.Result{}, err
+		}
+		logger.Info("updated gateway status")
+	}
+
+	if err := r.updateRouteParents(ctx, logger, gateway, routes, view, endpoint); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// handleDeleted removes the status of the routes reported for the gateway no longer implemented by frp.
+func (r *GatewayReconciler) handleDeleted(
+	ctx context.Context,
+	logger logr.Logger,
+	gateway *gatewayv1.Gateway,
+) (ctrl.Result, error) {
+	routes, err := listGatewayRoutes(ctx, r.Client)
+	if err != nil {
+		logger.Error(err, "list routes failed")
+		return ctrl.Result{}, err
+	}
+	if err := r.updateRouteParents(ctx, logger, gateway, routes, nil, nil); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// setGatewayStatus sets the status of the gateway and its listeners from the resolved view,
+// the gateway is programmed once the endpoint is connected.
+func setGatewayStatus(view *gatewayView, endpointName string, endpoint *frpv1.Endpoint) {
+	gateway := view.Gateway
+	endpointConnected := endpoint != nil && endpoint.Status.State == frpv1.EndpointConnected
+	proxies := map[string]frpv1.ProxyStatus{}
+	if endpoint != nil {
+		for _, proxy := range endpoint.Status.Proxies {
+			proxies[proxy.Name] = proxy
+		}
+	}
+
+	listenersAccepted := 0
+	previousListeners := map[gatewayv1.SectionName]gatewayv1.ListenerStatus{}
+	for _, listenerStatus := range gateway.Status.Listeners {
+		previousListeners[listenerStatus.Name] = listenerStatus
+	}
+	gateway.Status.Listeners = nil
+	for _, listener := range view.Listeners {
+		listenerStatus := previousListeners[listener.Listener.Name]
+		listenerStatus.Name = listener.Listener.Name
+		listenerStatus.SupportedKinds = listener.SupportedKinds
+		if listenerStatus.SupportedKinds == nil {
+			listenerStatus.SupportedKinds = []gatewayv1.RouteGroupKind{}
+		}
+		listenerStatus.AttachedRoutes = listener.AttachedRoutes
+		setListenerCondition := func(
+			conditionType gatewayv1.ListenerConditionType,
+			status metav1.ConditionStatus,
+			reason gatewayv1.ListenerConditionReason,
+			message string,
+		) {
+			meta.SetStatusCondition(&listenerStatus.Conditions, metav1.Condition{
+				Type:               string(conditionType),
+				Status:             status,
+				ObservedGeneration: gateway.Generation,
+				Reason:             string(reason),
+				Message:            message,
+			})
+		}
+
+		_, protocolSupported := gatewayListenerRouteKinds[listener.Listener.Protocol]
+		accepted := protocolSupported && view.Invalid == ""
+		switch {
+		case !protocolSupported:
+			setListenerCondition(
+				gatewayv1.ListenerConditionAccepted, metav1.ConditionFalse,
+				gatewayv1.ListenerReasonUnsupportedProtocol,
+				fmt.Sprintf("protocol %s is not supported, supported protocols: HTTP, TCP, UDP", listener.Listener.Protocol),
+			)
+		case view.Invalid != "":
+			setListenerCondition(
+				gatewayv1.ListenerConditionAccepted, metav1.ConditionFalse,
+				gatewayv1.ListenerReasonInvalid, view.Invalid,
+			)
+		default:
+			listenersAccepted++
+			setListenerCondition(
+				gatewayv1.ListenerConditionAccepted, metav1.ConditionTrue,
+				gatewayv1.ListenerReasonAccepted, "listener is accepted",
+			)
+		}
+		if listener.InvalidKinds {
+			setListenerCondition(
+				gatewayv1.ListenerConditionResolvedRefs, metav1.ConditionFalse,
+				gatewayv1.ListenerReasonInvalidRouteKinds,
+				fmt.Sprintf("only %s is supported by the %s listener", gatewayListenerRouteKinds[listener.Listener.Protocol],
+					listener.Listener.Protocol),
+			)
+		} else {
+			setListenerCondition(
+				gatewayv1.ListenerConditionResolvedRefs, metav1.ConditionTrue,
+				gatewayv1.ListenerReasonResolvedRefs, "references resolved",
+			)
+		}
+
+		pending, failed := describeGatewayProxies(listener.Proxies, proxies)
+		switch {
+		case !accepted:
+			setListenerCondition(
+				gatewayv1.ListenerConditionProgrammed, metav1.ConditionFalse,
+				gatewayv1.ListenerReasonInvalid, "listener is not accepted",
+			)
+		case !endpointConnected:
+			setListenerCondition(
+				gatewayv1.ListenerConditionProgrammed, metav1.ConditionFalse,
+				gatewayv1.ListenerReasonPending, fmt.Sprintf("endpoint %s is not connected", endpointName),
+			)
+		case len(failed) > 0:
+			setListenerCondition(
+				gatewayv1.ListenerConditionProgrammed, metav1.ConditionFalse,
+				gatewayv1.ListenerReasonInvalid, strings.Join(failed, "; "),
+			)
+		case len(pending) > 0:
+			setListenerCondition(
+				gatewayv1.ListenerConditionProgrammed, metav1.ConditionFalse,
+				gatewayv1.ListenerReasonPending, fmt.Sprintf("proxies starting: %s", strings.Join(pending, ", ")),
+			)
+		default:
+			setListenerCondition(
+				gatewayv1.ListenerConditionProgrammed, metav1.ConditionTrue,
+				gatewayv1.ListenerReasonProgrammed, fmt.Sprintf("%d proxies running", len(listener.Proxies)),
+			)
+		}
+		gateway.Status.Listeners = append(gateway.Status.Listeners, listenerStatus)
+	}
+
+	setGatewayCondition := func(
+		conditionType gatewayv1.GatewayConditionType,
+		status metav1.ConditionStatus,
+		reason gatewayv1.GatewayConditionReason,
+		message string,
+	) {
+		meta.SetStatusCondition(&gateway.Status.Conditions, metav1.Condition{
+			Type:               string(conditionType),
+			Status:             status,
+			ObservedGeneration: gateway.Generation,
+			Reason:             string(reason),
+			Message:            message,
+		})
+	}
+	accepted := false
+	switch {
+	case view.Invalid != "":
+		setGatewayCondition(
+			gatewayv1.GatewayConditionAccepted, metav1.ConditionFalse,
+			gatewayv1.GatewayReasonUnsupportedAddress, view.Invalid,
+		)
+	case listenersAccepted == 0:
+		setGatewayCondition(
+			gatewayv1.GatewayConditionAccepted, metav1.ConditionFalse,
+			gatewayv1.GatewayReasonListenersNotValid, "no listener is accepted",
+		)
+	default:
+		accepted = true
+		setGatewayCondition(
+			gatewayv1.GatewayConditionAccepted, metav1.ConditionTrue,
+			gatewayv1.GatewayReasonAccepted, fmt.Sprintf("gateway is exposed by endpoint %s", endpointName),
+		)
+	}
+
+	gateway.Status.Addresses = nil
+	switch {
+	case !accepted:
+		setGatewayCondition(
+			gatewayv1.GatewayConditionProgrammed, metav1.ConditionFalse,
+			gatewayv1.GatewayReasonInvalid, "gateway is not accepted",
+		)
+	case endpoint == nil:
+		setGatewayCondition(
+			gatewayv1.GatewayConditionProgrammed, metav1.ConditionFalse,
+			gatewayv1.GatewayReasonNoResources, fmt.Sprintf("endpoint %s not found", endpointName),
+		)
+	case !endpointConnected:
+		setGatewayCondition(
+			gatewayv1.GatewayConditionProgrammed, metav1.ConditionFalse,
+			gatewayv1.GatewayReasonPending, fmt.Sprintf("endpoint %s is not connected", endpointName),
+		)
+	default:
+		for _, item := range endpointLoadBalancerIngress(endpoint) {
+			addressType := gatewayv1.IPAddressType
+			value := item.IP
+			if item.Hostname != "" {
+				addressType = gatewayv1.HostnameAddressType
+				value = item.Hostname
+			}
+			gateway.Status.Addresses = append(gateway.Status.Addresses, gatewayv1.GatewayStatusAddress{
+				Type:  &addressType,
+				Value: value,
+			})
+		}
+		setGatewayCondition(
+			gatewayv1.GatewayConditionProgrammed, metav1.ConditionTrue,
+			gatewayv1.GatewayReasonProgrammed, fmt.Sprintf("endpoint %s is connected", endpointName),
+		)
+	}
+}
+
+// describeGatewayProxies describes the proxies not running yet from the proxies reported by the endpoint.
+func describeGatewayProxies(names []string, proxies map[string]frpv1.ProxyStatus) ([]string, []string) {
+	var pending, failed []string
+	for _, name := range names {
+		proxy, exists := proxies[name]
+		switch {
+		case !exists || frpcadmin.IsProxyStatusPending(proxy.Status):
+			pending = append(pending, name)
+		case proxy.Status == frpcadmin.ProxyStatusRunning:
+		case proxy.Error != "":
+			failed = append(failed, fmt.Sprintf("%s: %s", name, proxy.Error))
+		default:
+			failed = append(failed, fmt.Sprintf("%s: %s", name, proxy.Status))
+		}
+	}
+	return pending, failed
+}
+
+// updateRouteParents updates the parent status reported by frp for the gateway in the routes.
+// The parent status of the routes no longer attached to the gateway is removed, the status
+// reported by other controllers is kept.
+func (r *GatewayReconciler) updateRouteParents(
+	ctx context.Context,
+	logger logr.Logger,
+	gateway *gatewayv1.Gateway,
+	routes []*gatewayRoute,
+	view *gatewayView,
+	endpoint *frpv1.Endpoint,
+) error {
+	routeParents := map[*gatewayRoute][]*gatewayRouteParent{}
+	if view != nil {
+		for _, parent := range view.Parents {
+			routeParents[parent.Route] = append(routeParents[parent.Route], parent)
+		}
+	}
+	proxies := map[string]frpv1.ProxyStatus{}
+	endpointConnected := endpoint != nil && endpoint.Status.State == frpv1.EndpointConnected
+	if endpoint != nil {
+		for _, proxy := range endpoint.Status.Proxies {
+			proxies[proxy.Name] = proxy
+		}
+	}
+
+	for _, route := range routes {
+		previousParents := map[string]gatewayv1.RouteParentStatus{}
+		var parentsStatus []gatewayv1.RouteParentStatus
+		for _, parentStatus := range route.Status.Parents {
+			if parentStatus.ControllerName == GatewayControllerName &&
+				parentRefMatchesGateway(route, parentStatus.ParentRef, gateway) {
+				previousParents[describeParentRef(parentStatus.ParentRef)] = parentStatus
+				continue
+			}
+			parentsStatus = append(parentsStatus, parentStatus)
+		}
+		for _, parent := range routeParents[route] {
+			parentStatus := previousParents[describeParentRef(parent.ParentRef)]
+			parentStatus.ParentRef = parent.ParentRef
+			parentStatus.ControllerName = GatewayControllerName
+			setRouteParentConditions(&parentStatus, route.Object.GetGeneration(), parent, proxies, endpointConnected)
+			parentsStatus = append(parentsStatus, parentStatus)
+		}
+
+		if apiequality.Semantic.DeepEqual(parentsStatus, route.Status.Parents) {
+			continue
+		}
+		if len(parentsStatus) == 0 && len(route.Status.Parents) == 0 {
+			continue
+		}
+		route.Status.Parents = parentsStatus
+		if route.Status.Parents == nil {
+			route.Status.Parents = []gatewayv1.RouteParentStatus{}
+		}
+		if err := r.Status().Update(ctx, route.Object); err != nil {
+			logger.Error(err, fmt.Sprintf("update %s %s status failed", route.Kind, route.Object.GetName()))
+			return err
+		}
+		logger.Info(fmt.Sprintf(
+			"updated %s %s/%s status", route.Kind, route.Object.GetNamespace(), route.Object.GetName(),
+		))
+	}
+	return nil
+}
+
+// describeParentRef describes the parent reference for comparing.
+func describeParentRef(parentRef gatewayv1.ParentReference) string {
+	description := string(parentRef.Name)
+	if parentRef.SectionName != nil {
+		description += "/" + string(*parentRef.SectionName)
+	}
+	if parentRef.Port != nil {
+		description += fmt.Sprintf(":%d", *parentRef.Port)
+	}
+	return description
+}
+
+// setRouteParentConditions sets the Accepted, ResolvedRefs and ProxiesRegistered conditions of the route parent.
+func setRouteParentConditions(
+	parentStatus *gatewayv1.RouteParentStatus,
+	generation int64,
+	parent *gatewayRouteParent,
+	proxies map[string]frpv1.ProxyStatus,
+	endpointConnected bool,
+) {
+	setRouteCondition := func(conditionType string, status metav1.ConditionStatus, reason string, message string) {
+		meta.SetStatusCondition(&parentStatus.Conditions, metav1.Condition{
+			Type:               conditionType,
+			Status:             status,
+			ObservedGeneration: generation,
+			Reason:             reason,
+			Message:            message,
+		})
+	}
+
+	if parent.Accepted {
+		setRouteCondition(
+			string(gatewayv1.RouteConditionAccepted), metav1.ConditionTrue,
+			string(parent.AcceptedReason), parent.AcceptedMessage,
+		)
+	} else {
+		setRouteCondition(
+			string(gatewayv1.RouteConditionAccepted), metav1.ConditionFalse,
+			string(parent.AcceptedReason), parent.AcceptedMessage,
+		)
+	}
+	if parent.RefsResolved {
+		setRouteCondition(
+			string(gatewayv1.RouteConditionResolvedRefs), metav1.ConditionTrue,
+			string(parent.RefsReason), parent.RefsMessage,
+		)
+	} else {
+		setRouteCondition(
+			string(gatewayv1.RouteConditionResolvedRefs), metav1.ConditionFalse,
+			string(parent.RefsReason), parent.RefsMessage,
+		)
+	}
+
+	var names []string
+	for _, proxy := range parent.Proxies {
+		names = append(names, proxy.Name)
+	}
+	pending, failed := describeGatewayProxies(names, proxies)
+	switch {
+	case len(names) == 0:
+		meta.RemoveStatusCondition(&parentStatus.Conditions, string(frpv1.ConditionProxiesRegistered))
+	case !endpointConnected:
+		setRouteCondition(
+			string(frpv1.ConditionProxiesRegistered), metav1.ConditionFalse,
+			reasonNotLoggedIn, "endpoint is not connected",
+		)
+	case len(failed) > 0:
+		setRouteCondition(
+			string(frpv1.ConditionProxiesRegistered), metav1.ConditionFalse,
+			reasonProxiesFailed, strings.Join(failed, "; "),
+		)
+	case len(pending) > 0:
+		setRouteCondition(
+			string(frpv1.ConditionProxiesRegistered), metav1.ConditionUnknown,
+			reasonProxiesPending, fmt.Sprintf("proxies starting: %s", strings.Join(pending, ", ")),
+		)
+	default:
+		setRouteCondition(
+			string(frpv1.ConditionProxiesRegistered), metav1.ConditionTrue,
+			reasonProxiesRunning, fmt.Sprintf("%d proxies running", len(names)),
+		)
+	}
+}
+
+func (r *GatewayReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&gatewayv1.Gateway{}).
+		Watches(
+			&gatewayv1.GatewayClass{},
+			handler.EnqueueRequestsFromMapFunc(r.mapGatewayClassToGateways),
+		).
+		Watches(
+			&frpv1.Endpoint{},
+			handler.EnqueueRequestsFromMapFunc(r.mapEndpointToGateways),
+		).
+		Watches(
+			&gatewayv1.HTTPRoute{},
+			handler.EnqueueRequestsFromMapFunc(mapRouteToGateways),
+		).
+		Watches(
+			&gatewayv1alpha2.TCPRoute{},
+			handler.EnqueueRequestsFromMapFunc(mapRouteToGateways),
+		).
+		Watches(
+			&gatewayv1alpha2.UDPRoute{},
+			handler.EnqueueRequestsFromMapFunc(mapRouteToGateways),
+		).
+		Watches(
+			&corev1.Service{},
+			handler.EnqueueRequestsFromMapFunc(r.mapServiceToGateways),
+		).
+		Complete(r)
+}
+
+// mapGatewayClassToGateways maps a gateway class to the gateways of it.
+func (r *GatewayReconciler) mapGatewayClassToGateways(ctx context.Context, obj client.Object) []reconcile.Request {
+	var gatewayList gatewayv1.GatewayList
+	if err := r.List(ctx, &gatewayList); err != nil {
+		r.Log.Error(err, "list gateways failed", "gatewayclass", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, gateway := range gatewayList.Items {
+		if string(gateway.Spec.GatewayClassName) != obj.GetName() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{Namespace: gateway.Namespace, Name: gateway.Name},
+		})
+	}
+	return requests
+}
+
+// mapEndpointToGateways maps an endpoint to the gateways exposed by it.
+func (r *GatewayReconciler) mapEndpointToGateways(ctx context.Context, obj client.Object) []reconcile.Request {
+	var gatewayList gatewayv1.GatewayList
+	if err := r.List(ctx, &gatewayList, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "list gateways failed", "endpoint", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, gateway := range gatewayList.Items {
+		if gatewayEndpointName(&gateway) != obj.GetName() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{Namespace: gateway.Namespace, Name: gateway.Name},
+		})
+	}
+	return requests
+}
+
+// mapRouteToGateways maps a route to the gateways it attaches to, and the gateways reported
+// in its status, which might be detached.
+func mapRouteToGateways(ctx context.Context, obj client.Object) []reconcile.Request {
+	var (
+		parentRefs []gatewayv1.ParentReference
+		status     *gatewayv1.RouteStatus
+	)
+	switch route := obj.(type) {
+	case *gatewayv1.HTTPRoute:
+		parentRefs, status = route.Spec.ParentRefs, &route.Status.RouteStatus
+	case *gatewayv1alpha2.TCPRoute:
+		parentRefs, status = route.Spec.ParentRefs, &route.Status.RouteStatus
+	case *gatewayv1alpha2.UDPRoute:
+		parentRefs, status = route.Spec.ParentRefs, &route.Status.RouteStatus
+	default:
+		return nil
+	}
+	for _, parentStatus := range status.Parents {
+		if parentStatus.ControllerName == GatewayControllerName {
+			parentRefs = append(parentRefs, parentStatus.ParentRef)
+		}
+	}
+
+	gateways := map[client.ObjectKey]bool{}
+	var requests []reconcile.Request
+	for _, parentRef := range parentRefs {
+		if parentRef.Group != nil && *parentRef.Group != gatewayv1.GroupName {
+			continue
+		}
+		if parentRef.Kind != nil && *parentRef.Kind != kindGateway {
+			continue
+		}
+		key := client.ObjectKey{Namespace: obj.GetNamespace(), Name: string(parentRef.Name)}
+		if parentRef.Namespace != nil {
+			key.Namespace = string(*parentRef.Namespace)
+		}
+		if gateways[key] {
+			continue
+		}
+		gateways[key] = true
+		requests = append(requests, reconcile.Request{NamespacedName: key})
+	}
+	return requests
+}
+
+// mapServiceToGateways maps a core service to the gateways of the routes using it as the backend.
+func (r *GatewayReconciler) mapServiceToGateways(ctx context.Context, obj client.Object) []reconcile.Request {
+	routes, err := listGatewayRoutes(ctx, r.Client)
+	if err != nil {
+		r.Log.Error(err, "list routes failed", "service", obj.GetName())
+		return nil
+	}
+
+	gateways := map[client.ObjectKey]bool{}
+	var requests []reconcile.Request
+	for _, route := range routes {
+		if route.Object.GetNamespace() != obj.GetNamespace() || !gatewayRouteUsesService(route, obj.GetName()) {
+			continue
+		}
+		for _, request := range mapRouteToGateways(ctx, route.Object) {
+			if gateways[request.NamespacedName] {
+				continue
+			}
+			gateways[request.NamespacedName] = true
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// gatewayRouteUsesService tells if the route uses the service in its namespace as a backend.
+func gatewayRouteUsesService(route *gatewayRoute, serviceName string) bool {
+	for _, rule := range route.Rules {
+		for _, backendRef := range rule.BackendRefs {
+			if string(backendRef.Name) == serviceName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mapGatewayToEndpoint maps a gateway to the endpoint exposing it.
+func (r *EndpointReconciler) mapGatewayToEndpoint(ctx context.Context, obj client.Object) []reconcile.Request {
+	gateway, ok := obj.(*gatewayv1.Gateway)
+	if !ok {
+		return nil
+	}
+
+	return []reconcile.Request{
+		{
+			NamespacedName: client.ObjectKey{
+				Namespace: gateway.Namespace,
+				Name:      gatewayEndpointName(gateway),
+			},
+		},
+	}
+}
+
+// mapRouteToEndpoints maps a route to the endpoints exposing the gateways it attaches to.
+func (r *EndpointReconciler) mapRouteToEndpoints(ctx context.Context, obj client.Object) []reconcile.Request {
+	var requests []reconcile.Request
+	for _, request := range mapRouteToGateways(ctx, obj) {
+		var gateway gatewayv1.Gateway
+		if err := r.Get(ctx, request.NamespacedName, &gateway); err != nil {
+			if !apierrors.IsNotFound(err) {
+				r.Log.Error(err, "get gateway failed", "gateway", request.NamespacedName)
+			}
+			continue
+		}
+		requests = append(requests, r.mapGatewayToEndpoint(ctx, &gateway)...)
+	}
+	return requests
+}
+
+// mapGatewayClassToEndpoints maps a gateway class to the endpoints exposing the gateways of it,
+// as the class controller might change.
+func (r *EndpointReconciler) mapGatewayClassToEndpoints(ctx context.Context, obj client.Object) []reconcile.Request {
+	var gatewayList gatewayv1.GatewayList
+	if err := r.List(ctx, &gatewayList); err != nil {
+		r.Log.Error(err, "list gateways failed", "gatewayclass", obj.GetName())
+		return nil
+	}
+
+	endpoints := map[client.ObjectKey]bool{}
+	var requests []reconcile.Request
+	for _, gateway := range gatewayList.Items {
+		if string(gateway.Spec.GatewayClassName) != obj.GetName() {
+			continue
+		}
+		key := client.ObjectKey{Namespace: gateway.Namespace, Name: gatewayEndpointName(&gateway)}
+		if endpoints[key] {
+			continue
+		}
+		endpoints[key] = true
+		requests = append(requests, reconcile.Request{NamespacedName: key})
+	}
+	return requests
+}
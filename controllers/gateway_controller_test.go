@@ -0,0 +1,694 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	m "github.com/onsi/gomega"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/b4fun/frpcontroller/pkg/frpcadmin"
+	"github.com/b4fun/frpcontroller/pkg/frpconfig"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+func newGatewayTestScheme(t *testing.T) *runtime.Scheme {
+	scheme := newIngressTestScheme(t)
+	if err := gatewayv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add to scheme: %v", err)
+	}
+	if err := gatewayv1alpha2.AddToScheme(scheme); err != nil {
+		t.Fatalf("add to scheme: %v", err)
+	}
+	return scheme
+}
+
+func newGatewayTestClient(scheme *runtime.Scheme, objs ...client.Object) client.Client {
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		WithStatusSubresource(
+			&gatewayv1.GatewayClass{}, &gatewayv1.Gateway{}, &gatewayv1.HTTPRoute{},
+			&gatewayv1alpha2.TCPRoute{}, &gatewayv1alpha2.UDPRoute{},
+		).
+		Build()
+}
+
+func newGatewayTestGatewayClass(name string, controllerName gatewayv1.GatewayController) *gatewayv1.GatewayClass {
+	return &gatewayv1.GatewayClass{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       gatewayv1.GatewayClassSpec{ControllerName: controllerName},
+	}
+}
+
+func newGatewayTestGateway(name string, className string, listeners ...gatewayv1.Listener) *gatewayv1.Gateway {
+	return &gatewayv1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        name,
+			Annotations: map[string]string{annotationKeyCoreServiceEndpoint: "endpoint"},
+		},
+		Spec: gatewayv1.GatewaySpec{
+			GatewayClassName: gatewayv1.ObjectName(className),
+			Listeners:        listeners,
+		},
+	}
+}
+
+func newGatewayTestListener(
+	name string,
+	protocol gatewayv1.ProtocolType,
+	port gatewayv1.PortNumber,
+	hostname string,
+) gatewayv1.Listener {
+	listener := gatewayv1.Listener{
+		Name:     gatewayv1.SectionName(name),
+		Protocol: protocol,
+		Port:     port,
+	}
+	if hostname != "" {
+		listenerHostname := gatewayv1.Hostname(hostname)
+		listener.Hostname = &listenerHostname
+	}
+	return listener
+}
+
+func newGatewayTestParentRef(gatewayName string) gatewayv1.ParentReference {
+	return gatewayv1.ParentReference{Name: gatewayv1.ObjectName(gatewayName)}
+}
+
+func newGatewayTestBackendRef(serviceName string, port gatewayv1.PortNumber) gatewayv1.BackendRef {
+	return gatewayv1.BackendRef{
+		BackendObjectReference: gatewayv1.BackendObjectReference{
+			Name: gatewayv1.ObjectName(serviceName),
+			Port: &port,
+		},
+	}
+}
+
+func newGatewayTestHTTPRoute(
+	name string,
+	created time.Time,
+	hostnames []gatewayv1.Hostname,
+	rules ...gatewayv1.HTTPRouteRule,
+) *gatewayv1.HTTPRoute {
+	return &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: gatewayv1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{
+				ParentRefs: []gatewayv1.ParentReference{newGatewayTestParentRef("gateway")},
+			},
+			Hostnames: hostnames,
+			Rules:     rules,
+		},
+	}
+}
+
+func newGatewayTestHTTPRule(backendRef gatewayv1.BackendRef, paths ...string) gatewayv1.HTTPRouteRule {
+	rule := gatewayv1.HTTPRouteRule{
+		BackendRefs: []gatewayv1.HTTPBackendRef{{BackendRef: backendRef}},
+	}
+	for _, path := range paths {
+		path := path
+		pathType := gatewayv1.PathMatchPathPrefix
+		rule.Matches = append(rule.Matches, gatewayv1.HTTPRouteMatch{
+			Path: &gatewayv1.HTTPPathMatch{Type: &pathType, Value: &path},
+		})
+	}
+	return rule
+}
+
+func newGatewayTestTCPRoute(name string, created time.Time, backendRef gatewayv1.BackendRef) *gatewayv1alpha2.TCPRoute {
+	return &gatewayv1alpha2.TCPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: gatewayv1alpha2.TCPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{
+				ParentRefs: []gatewayv1.ParentReference{newGatewayTestParentRef("gateway")},
+			},
+			Rules: []gatewayv1alpha2.TCPRouteRule{{BackendRefs: []gatewayv1.BackendRef{backendRef}}},
+		},
+	}
+}
+
+func newGatewayTestUDPRoute(name string, created time.Time, backendRef gatewayv1.BackendRef) *gatewayv1alpha2.UDPRoute {
+	return &gatewayv1alpha2.UDPRoute{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: gatewayv1alpha2.UDPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{
+				ParentRefs: []gatewayv1.ParentReference{newGatewayTestParentRef("gateway")},
+			},
+			Rules: []gatewayv1alpha2.UDPRouteRule{{BackendRefs: []gatewayv1.BackendRef{backendRef}}},
+		},
+	}
+}
+
+func TestIntersectGatewayHostnames(t *testing.T) {
+	cases := []struct {
+		name              string
+		listenerHostname  string
+		routeHostnames    []gatewayv1.Hostname
+		expectedHostnames []string
+		expectedMatched   bool
+	}{
+		{
+			name:              "listener without hostname",
+			routeHostnames:    []gatewayv1.Hostname{"app.example.com"},
+			expectedHostnames: []string{"app.example.com"},
+			expectedMatched:   true,
+		},
+		{
+			name:              "route without hostname",
+			listenerHostname:  "app.example.com",
+			expectedHostnames: []string{"app.example.com"},
+			expectedMatched:   true,
+		},
+		{
+			name:              "wildcard listener",
+			listenerHostname:  "*.example.com",
+			routeHostnames:    []gatewayv1.Hostname{"app.example.com", "app.example.org", "example.com"},
+			expectedHostnames: []string{"app.example.com"},
+			expectedMatched:   true,
+		},
+		{
+			name:              "wildcard route",
+			listenerHostname:  "app.example.com",
+			routeHostnames:    []gatewayv1.Hostname{"*.example.com"},
+			expectedHostnames: []string{"app.example.com"},
+			expectedMatched:   true,
+		},
+		{
+			name:             "no match",
+			listenerHostname: "app.example.com",
+			routeHostnames:   []gatewayv1.Hostname{"www.example.com"},
+			expectedMatched:  false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var listenerHostname *gatewayv1.Hostname
+			if c.listenerHostname != "" {
+				hostname := gatewayv1.Hostname(c.listenerHostname)
+				listenerHostname = &hostname
+			}
+			hostnames, matched := intersectGatewayHostnames(listenerHostname, c.routeHostnames)
+			if matched != c.expectedMatched {
+				t.Errorf("unexpected matched: %t", matched)
+			}
+			if !reflect.DeepEqual(hostnames, c.expectedHostnames) {
+				t.Errorf("unexpected hostnames: %v", hostnames)
+			}
+		})
+	}
+}
+
+func TestEndpointReconciler_GenerateGatewayApps(t *testing.T) {
+	scheme := newGatewayTestScheme(t)
+	created := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	regexPath := func(rule gatewayv1.HTTPRouteRule) gatewayv1.HTTPRouteRule {
+		pathType := gatewayv1.PathMatchRegularExpression
+		rule.Matches[0].Path.Type = &pathType
+		return rule
+	}
+
+	cases := []struct {
+		name         string
+		className    string
+		listeners    []gatewayv1.Listener
+		routes       []client.Object
+		expectedApps map[string]*frpconfig.ConfigApp
+	}{
+		{
+			name:      "http route",
+			className: "frp",
+			listeners: []gatewayv1.Listener{newGatewayTestListener("http", gatewayv1.HTTPProtocolType, 80, "*.example.com")},
+			routes: []client.Object{
+				newGatewayTestHTTPRoute(
+					"web", created, []gatewayv1.Hostname{"app.example.com"},
+					newGatewayTestHTTPRule(newGatewayTestBackendRef("api", 8080), "/api", "/v1"),
+					newGatewayTestHTTPRule(newGatewayTestBackendRef("web", 80)),
+				),
+			},
+			expectedApps: map[string]*frpconfig.ConfigApp{
+				"gateway_gateway_http_default_web_0-0": {
+					Type: "http", LocalAddr: "10.0.0.1", LocalPort: 8080,
+					CustomDomains: []string{"app.example.com"}, Locations: []string{"/api"},
+				},
+				"gateway_gateway_http_default_web_0-1": {
+					Type: "http", LocalAddr: "10.0.0.1", LocalPort: 8080,
+					CustomDomains: []string{"app.example.com"}, Locations: []string{"/v1"},
+				},
+				"gateway_gateway_http_default_web_1-0": {
+					Type: "http", LocalAddr: "10.0.0.2", LocalPort: 80,
+					CustomDomains: []string{"app.example.com"},
+				},
+			},
+		},
+		{
+			name:      "tcp and udp routes",
+			className: "frp",
+			listeners: []gatewayv1.Listener{
+				newGatewayTestListener("tcp", gatewayv1.TCPProtocolType, 6000, ""),
+				newGatewayTestListener("udp", gatewayv1.UDPProtocolType, 6001, ""),
+			},
+			routes: []client.Object{
+				newGatewayTestTCPRoute("later", created.Add(time.Minute), newGatewayTestBackendRef("web", 80)),
+				newGatewayTestTCPRoute("db", created, newGatewayTestBackendRef("api", 5432)),
+				newGatewayTestUDPRoute("dns", created, newGatewayTestBackendRef("web", 53)),
+			},
+			expectedApps: map[string]*frpconfig.ConfigApp{
+				"gateway_gateway_tcp_default_db": {
+					Type: "tcp", LocalAddr: "10.0.0.1", LocalPort: 5432, RemotePort: 6000,
+				},
+				"gateway_gateway_udp_default_dns": {
+					Type: "udp", LocalAddr: "10.0.0.2", LocalPort: 53, RemotePort: 6001,
+				},
+			},
+		},
+		{
+			name:      "unsupported rules are skipped",
+			className: "frp",
+			listeners: []gatewayv1.Listener{newGatewayTestListener("http", gatewayv1.HTTPProtocolType, 80, "")},
+			routes: []client.Object{
+				newGatewayTestHTTPRoute(
+					"no-hostname", created, nil,
+					newGatewayTestHTTPRule(newGatewayTestBackendRef("web", 80)),
+				),
+				newGatewayTestHTTPRoute(
+					"regex", created, []gatewayv1.Hostname{"app.example.com"},
+					regexPath(newGatewayTestHTTPRule(newGatewayTestBackendRef("web", 80), "/.*")),
+				),
+				newGatewayTestHTTPRoute(
+					"missing", created, []gatewayv1.Hostname{"app.example.com"},
+					newGatewayTestHTTPRule(newGatewayTestBackendRef("missing", 80)),
+				),
+			},
+			expectedApps: map[string]*frpconfig.ConfigApp{},
+		},
+		{
+			name:      "other class",
+			className: "nginx",
+			listeners: []gatewayv1.Listener{newGatewayTestListener("tcp", gatewayv1.TCPProtocolType, 6000, "")},
+			routes: []client.Object{
+				newGatewayTestTCPRoute("db", created, newGatewayTestBackendRef("api", 5432)),
+			},
+			expectedApps: map[string]*frpconfig.ConfigApp{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			objs := []client.Object{
+				newGatewayTestGatewayClass("frp", GatewayControllerName),
+				newGatewayTestGatewayClass("nginx", "example.com/nginx"),
+				newGatewayTestGateway("gateway", c.className, c.listeners...),
+				newIngressTestBackendService("api", "10.0.0.1"),
+				newIngressTestBackendService("web", "10.0.0.2"),
+			}
+			objs = append(objs, c.routes...)
+			r := &EndpointReconciler{
+				Client:  newGatewayTestClient(scheme, objs...),
+				Log:     log.Log,
+				Gateway: GatewayOptions{Enabled: true},
+			}
+			endpoint := newEndpointView(&frpv1.Endpoint{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "endpoint"},
+			})
+			config := &frpconfig.FrpcConfig{Apps: map[string]*frpconfig.ConfigApp{}}
+
+			err := r.generateGatewayApps(context.Background(), r.Log, endpoint, config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(config.Apps, c.expectedApps) {
+				t.Errorf("unexpected apps:\n%+v\nexpected:\n%+v", config.Apps, c.expectedApps)
+			}
+		})
+	}
+}
+
+func TestGatewayReconciler_Reconcile(t *testing.T) {
+	scheme := newGatewayTestScheme(t)
+	created := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+	endpoint := &frpv1.Endpoint{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "endpoint"},
+		Spec:       frpv1.EndpointSpec{Addr: "frp.example.com", Port: 7000},
+		Status: frpv1.EndpointStatus{
+			State: frpv1.EndpointConnected,
+			Proxies: []frpv1.ProxyStatus{
+				{Name: "gateway_gateway_tcp_default_db", Status: frpcadmin.ProxyStatusRunning},
+				{Name: "gateway_gateway_udp_default_dns", Status: "start error", Error: "port unavailable"},
+			},
+		},
+	}
+	otherParent := gatewayv1.RouteParentStatus{
+		ParentRef:      newGatewayTestParentRef("gateway"),
+		ControllerName: "example.com/nginx",
+		Conditions: []metav1.Condition{{
+			Type: string(gatewayv1.RouteConditionAccepted), Status: metav1.ConditionTrue,
+			Reason: string(gatewayv1.RouteReasonAccepted), LastTransitionTime: metav1.NewTime(created),
+		}},
+	}
+
+	newClient := func(className string) client.Client {
+		db := newGatewayTestTCPRoute("db", created, newGatewayTestBackendRef("api", 5432))
+		db.Status.Parents = []gatewayv1.RouteParentStatus{otherParent}
+		return newGatewayTestClient(
+			scheme,
+			newGatewayTestGatewayClass("frp", GatewayControllerName),
+			newGatewayTestGateway(
+				"gateway", className,
+				newGatewayTestListener("tcp", gatewayv1.TCPProtocolType, 6000, ""),
+				newGatewayTestListener("udp", gatewayv1.UDPProtocolType, 6001, ""),
+				newGatewayTestListener("tls", gatewayv1.TLSProtocolType, 443, ""),
+			),
+			endpoint,
+			newIngressTestBackendService("api", "10.0.0.1"),
+			newIngressTestBackendService("web", "10.0.0.2"),
+			db,
+			newGatewayTestTCPRoute("later", created.Add(time.Minute), newGatewayTestBackendRef("web", 80)),
+			newGatewayTestUDPRoute("dns", created, newGatewayTestBackendRef("web", 53)),
+		)
+	}
+	key := client.ObjectKey{Namespace: "default", Name: "gateway"}
+	reconcile := func(t *testing.T, r *GatewayReconciler) {
+		if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("reconcile: %v", err)
+		}
+	}
+	getRouteParents := func(t *testing.T, c client.Client, route client.Object) []gatewayv1.RouteParentStatus {
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(route), route); err != nil {
+			t.Fatalf("get route: %v", err)
+		}
+		switch route := route.(type) {
+		case *gatewayv1alpha2.TCPRoute:
+			return route.Status.Parents
+		case *gatewayv1alpha2.UDPRoute:
+			return route.Status.Parents
+		}
+		return nil
+	}
+	expectCondition := func(
+		t *testing.T,
+		conditions []metav1.Condition,
+		conditionType string,
+		status metav1.ConditionStatus,
+		reason string,
+	) {
+		t.Helper()
+		condition := meta.FindStatusCondition(conditions, conditionType)
+		if condition == nil {
+			t.Errorf("condition %s not found", conditionType)
+			return
+		}
+		if condition.Status != status || condition.Reason != reason {
+			t.Errorf("unexpected condition %s: %s %s %s", conditionType, condition.Status, condition.Reason, condition.Message)
+		}
+	}
+
+	t.Run("implemented", func(t *testing.T) {
+		r := &GatewayReconciler{Client: newClient("frp"), Log: log.Log, Scheme: scheme}
+		reconcile(t, r)
+
+		var gateway gatewayv1.Gateway
+		if err := r.Get(context.Background(), key, &gateway); err != nil {
+			t.Fatalf("get gateway: %v", err)
+		}
+		expectCondition(t, gateway.Status.Conditions,
+			string(gatewayv1.GatewayConditionAccepted), metav1.ConditionTrue, string(gatewayv1.GatewayReasonAccepted))
+		expectCondition(t, gateway.Status.Conditions,
+			string(gatewayv1.GatewayConditionProgrammed), metav1.ConditionTrue, string(gatewayv1.GatewayReasonProgrammed))
+		if len(gateway.Status.Addresses) != 1 || gateway.Status.Addresses[0].Value != "frp.example.com" ||
+			*gateway.Status.Addresses[0].Type != gatewayv1.HostnameAddressType {
+			t.Errorf("unexpected addresses: %+v", gateway.Status.Addresses)
+		}
+		if len(gateway.Status.Listeners) != 3 {
+			t.Fatalf("unexpected listeners: %+v", gateway.Status.Listeners)
+		}
+		tcpListener, udpListener, tlsListener := gateway.Status.Listeners[0], gateway.Status.Listeners[1], gateway.Status.Listeners[2]
+		if tcpListener.AttachedRoutes != 2 || udpListener.AttachedRoutes != 1 {
+			t.Errorf("unexpected attached routes: %d, %d", tcpListener.AttachedRoutes, udpListener.AttachedRoutes)
+		}
+		expectCondition(t, tcpListener.Conditions,
+			string(gatewayv1.ListenerConditionProgrammed), metav1.ConditionTrue, string(gatewayv1.ListenerReasonProgrammed))
+		expectCondition(t, udpListener.Conditions,
+			string(gatewayv1.ListenerConditionProgrammed), metav1.ConditionFalse, string(gatewayv1.ListenerReasonInvalid))
+		expectCondition(t, tlsListener.Conditions,
+			string(gatewayv1.ListenerConditionAccepted), metav1.ConditionFalse, string(gatewayv1.ListenerReasonUnsupportedProtocol))
+
+		dbParents := getRouteParents(t, r.Client, &gatewayv1alpha2.TCPRoute{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"},
+		})
+		if len(dbParents) != 2 || !apiequality.Semantic.DeepEqual(dbParents[0], otherParent) {
+			t.Fatalf("unexpected db parents: %+v", dbParents)
+		}
+		if dbParents[1].ControllerName != GatewayControllerName {
+			t.Errorf("unexpected controller name: %s", dbParents[1].ControllerName)
+		}
+		expectCondition(t, dbParents[1].Conditions,
+			string(gatewayv1.RouteConditionAccepted), metav1.ConditionTrue, string(gatewayv1.RouteReasonAccepted))
+		expectCondition(t, dbParents[1].Conditions,
+			string(gatewayv1.RouteConditionResolvedRefs), metav1.ConditionTrue, string(gatewayv1.RouteReasonResolvedRefs))
+		expectCondition(t, dbParents[1].Conditions,
+			string(frpv1.ConditionProxiesRegistered), metav1.ConditionTrue, reasonProxiesRunning)
+
+		laterParents := getRouteParents(t, r.Client, &gatewayv1alpha2.TCPRoute{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "later"},
+		})
+		if len(laterParents) != 1 {
+			t.Fatalf("unexpected later parents: %+v", laterParents)
+		}
+		expectCondition(t, laterParents[0].Conditions,
+			string(gatewayv1.RouteConditionAccepted), metav1.ConditionFalse, string(gatewayv1.RouteReasonUnsupportedValue))
+		if message := meta.FindStatusCondition(
+			laterParents[0].Conditions, string(gatewayv1.RouteConditionAccepted),
+		).Message; !strings.Contains(message, "TCPRoute default/db") {
+			t.Errorf("unexpected message: %s", message)
+		}
+
+		dnsParents := getRouteParents(t, r.Client, &gatewayv1alpha2.UDPRoute{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "dns"},
+		})
+		if len(dnsParents) != 1 {
+			t.Fatalf("unexpected dns parents: %+v", dnsParents)
+		}
+		expectCondition(t, dnsParents[0].Conditions,
+			string(frpv1.ConditionProxiesRegistered), metav1.ConditionFalse, reasonProxiesFailed)
+	})
+
+	t.Run("class changed", func(t *testing.T) {
+		c := newClient("frp")
+		r := &GatewayReconciler{Client: c, Log: log.Log, Scheme: scheme}
+		reconcile(t, r)
+
+		var gateway gatewayv1.Gateway
+		if err := c.Get(context.Background(), key, &gateway); err != nil {
+			t.Fatalf("get gateway: %v", err)
+		}
+		gateway.Spec.GatewayClassName = "nginx"
+		if err := c.Update(context.Background(), &gateway); err != nil {
+			t.Fatalf("update gateway: %v", err)
+		}
+		reconcile(t, r)
+
+		dbParents := getRouteParents(t, c, &gatewayv1alpha2.TCPRoute{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"},
+		})
+		if !apiequality.Semantic.DeepEqual(dbParents, []gatewayv1.RouteParentStatus{otherParent}) {
+			t.Errorf("unexpected db parents: %+v", dbParents)
+		}
+		dnsParents := getRouteParents(t, c, &gatewayv1alpha2.UDPRoute{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "dns"},
+		})
+		if len(dnsParents) != 0 {
+			t.Errorf("unexpected dns parents: %+v", dnsParents)
+		}
+	})
+}
+
+func TestGatewayClassReconciler_Reconcile(t *testing.T) {
+	scheme := newGatewayTestScheme(t)
+	r := &GatewayClassReconciler{
+		Client: newGatewayTestClient(
+			scheme,
+			newGatewayTestGatewayClass("frp", GatewayControllerName),
+			newGatewayTestGatewayClass("nginx", "example.com/nginx"),
+		),
+		Log:    log.Log,
+		Scheme: scheme,
+	}
+
+	for name, expectedAccepted := range map[string]bool{"frp": true, "nginx": false} {
+		key := client.ObjectKey{Name: name}
+		if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("reconcile %s: %v", name, err)
+		}
+		var gatewayClass gatewayv1.GatewayClass
+		if err := r.Get(context.Background(), key, &gatewayClass); err != nil {
+			t.Fatalf("get gateway class %s: %v", name, err)
+		}
+		accepted := meta.IsStatusConditionTrue(
+			gatewayClass.Status.Conditions, string(gatewayv1.GatewayClassConditionStatusAccepted),
+		)
+		if accepted != expectedAccepted {
+			t.Errorf("gateway class %s: unexpected accepted: %t", name, accepted)
+		}
+	}
+}
+
+var _ = g.Describe("GatewayController", func() {
+	const (
+		resourcePollingTimeout  = "1m"
+		resourcePollingInterval = "2s"
+	)
+
+	var testNamespace string
+
+	g.BeforeEach(func(done g.Done) {
+		var err error
+		testNamespace, err = createNamespace(context.Background(), k8sClient, "frp-test-")
+		m.Expect(err).NotTo(m.HaveOccurred(), "create namespace")
+		log.Log.Info(fmt.Sprintf("created namespace: %s", testNamespace))
+
+		close(done)
+	}, 60)
+
+	g.AfterEach(func(done g.Done) {
+		err := deleteNamespace(context.Background(), k8sClient, testNamespace)
+		m.Expect(err).NotTo(m.HaveOccurred(), "delete namespace")
+
+		close(done)
+	}, 60)
+
+	g.It("reports the gateway and route status", func(done g.Done) {
+		ctx := context.Background()
+		className := fmt.Sprintf("frp-%s", testNamespace)
+
+		g.By("creating the gateway class")
+		gatewayClass := newGatewayTestGatewayClass(className, GatewayControllerName)
+		m.Expect(k8sClient.Create(ctx, gatewayClass)).To(m.Succeed())
+		defer func() {
+			m.Expect(k8sClient.Delete(ctx, gatewayClass)).To(m.Succeed())
+		}()
+		m.Eventually(func() bool {
+			var gatewayClassLatest gatewayv1.GatewayClass
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(gatewayClass), &gatewayClassLatest); err != nil {
+				return false
+			}
+			return meta.IsStatusConditionTrue(
+				gatewayClassLatest.Status.Conditions, string(gatewayv1.GatewayClassConditionStatusAccepted),
+			)
+		}, resourcePollingTimeout, resourcePollingInterval).Should(m.BeTrue())
+
+		g.By("creating the endpoint, backend and routes")
+		endpoint := &frpv1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "endpoint"},
+			Spec:       frpv1.EndpointSpec{Addr: "frp.example.com", Port: 7000},
+		}
+		m.Expect(k8sClient.Create(ctx, endpoint)).To(m.Succeed())
+		backend := newIngressTestBackendService("web", "")
+		backend.Namespace = testNamespace
+		backend.Spec.Ports[0].Port = 80
+		m.Expect(k8sClient.Create(ctx, backend)).To(m.Succeed())
+
+		gateway := newGatewayTestGateway(
+			"gateway", className,
+			newGatewayTestListener("http", gatewayv1.HTTPProtocolType, 80, "*.example.com"),
+			newGatewayTestListener("tcp", gatewayv1.TCPProtocolType, 6000, ""),
+		)
+		gateway.Namespace = testNamespace
+		m.Expect(k8sClient.Create(ctx, gateway)).To(m.Succeed())
+		httpRoute := newGatewayTestHTTPRoute(
+			"web", time.Now(), []gatewayv1.Hostname{"app.example.com"},
+			newGatewayTestHTTPRule(newGatewayTestBackendRef("web", 80), "/"),
+		)
+		httpRoute.Namespace = testNamespace
+		m.Expect(k8sClient.Create(ctx, httpRoute)).To(m.Succeed())
+		tcpRoute := newGatewayTestTCPRoute("missing", time.Now(), newGatewayTestBackendRef("missing", 5432))
+		tcpRoute.Namespace = testNamespace
+		m.Expect(k8sClient.Create(ctx, tcpRoute)).To(m.Succeed())
+
+		g.By("waiting for the gateway status")
+		m.Eventually(func() error {
+			var gatewayLatest gatewayv1.Gateway
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(gateway), &gatewayLatest); err != nil {
+				return err
+			}
+			if !meta.IsStatusConditionTrue(gatewayLatest.Status.Conditions, string(gatewayv1.GatewayConditionAccepted)) {
+				return fmt.Errorf("gateway is not accepted: %+v", gatewayLatest.Status.Conditions)
+			}
+			programmed := meta.FindStatusCondition(
+				gatewayLatest.Status.Conditions, string(gatewayv1.GatewayConditionProgrammed),
+			)
+			if programmed == nil || programmed.Reason != string(gatewayv1.GatewayReasonPending) {
+				return fmt.Errorf("gateway is not pending: %+v", programmed)
+			}
+			if len(gatewayLatest.Status.Listeners) != 2 || gatewayLatest.Status.Listeners[0].AttachedRoutes != 1 {
+				return fmt.Errorf("unexpected listeners: %+v", gatewayLatest.Status.Listeners)
+			}
+			return nil
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+
+		g.By("waiting for the route status")
+		m.Eventually(func() error {
+			var httpRouteLatest gatewayv1.HTTPRoute
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(httpRoute), &httpRouteLatest); err != nil {
+				return err
+			}
+			if len(httpRouteLatest.Status.Parents) != 1 {
+				return fmt.Errorf("unexpected parents: %+v", httpRouteLatest.Status.Parents)
+			}
+			conditions := httpRouteLatest.Status.Parents[0].Conditions
+			if !meta.IsStatusConditionTrue(conditions, string(gatewayv1.RouteConditionAccepted)) ||
+				!meta.IsStatusConditionFalse(conditions, string(frpv1.ConditionProxiesRegistered)) {
+				return fmt.Errorf("unexpected conditions: %+v", conditions)
+			}
+			return nil
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+		m.Eventually(func() error {
+			var tcpRouteLatest gatewayv1alpha2.TCPRoute
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(tcpRoute), &tcpRouteLatest); err != nil {
+				return err
+			}
+			if len(tcpRouteLatest.Status.Parents) != 1 {
+				return fmt.Errorf("unexpected parents: %+v", tcpRouteLatest.Status.Parents)
+			}
+			resolvedRefs := meta.FindStatusCondition(
+				tcpRouteLatest.Status.Parents[0].Conditions, string(gatewayv1.RouteConditionResolvedRefs),
+			)
+			if resolvedRefs == nil || resolvedRefs.Reason != string(gatewayv1.RouteReasonBackendNotFound) {
+				return fmt.Errorf("unexpected resolved refs: %+v", resolvedRefs)
+			}
+			return nil
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+
+		close(done)
+	}, 120)
+})
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+// GatewayClassReconciler accepts the gateway classes implemented by frp.
+type GatewayClassReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gatewayclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gatewayclasses/status,verbs=get;update;patch
+
+func (r *GatewayClassReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Log.WithValues("gatewayclass", req.Name)
+
+	var gatewayClass gatewayv1.GatewayClass
+	err := r.Get(ctx, req.NamespacedName, &gatewayClass)
+	switch {
+	case err == nil && gatewayClass.DeletionTimestamp != nil:
+		return ctrl.Result{}, nil
+	case err == nil:
+		return r.handleCreateOrUpdate(ctx, logger, &gatewayClass)
+	case apierrors.IsNotFound(err):
+		return ctrl.Result{}, nil
+	default:
+		logger.Error(err, "get gateway class failed")
+		return ctrl.Result{}, err
+	}
+}
+
+func (r *GatewayClassReconciler) handleCreateOrUpdate(
+	ctx context.Context,
+	logger logr.Logger,
+	gatewayClass *gatewayv1.GatewayClass,
+) (ctrl.Result, error) {
+	if gatewayClass.Spec.ControllerName != GatewayControllerName {
+		return ctrl.Result{}, nil
+	}
+
+	previousStatus := gatewayClass.Status.DeepCopy()
+	meta.SetStatusCondition(&gatewayClass.Status.Conditions, metav1.Condition{
+		Type:               string(gatewayv1.GatewayClassConditionStatusAccepted),
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: gatewayClass.Generation,
+		Reason:             string(gatewayv1.GatewayClassReasonAccepted),
+		Message:            "gateway class is implemented by frp",
+	})
+	if apiequality.Semantic.DeepEqual(previousStatus, &gatewayClass.Status) {
+		return ctrl.Result{}, nil
+	}
+	if err := r.Status().Update(ctx, gatewayClass); err != nil {
+		logger.Error(err, "update gateway class status failed")
+		return ctrl.Result{}, err
+	}
+	logger.Info(fmt.Sprintf("accepted gateway class: %s", gatewayClass.Name))
+
+	return ctrl.Result{}, nil
+}
+
+func (r *GatewayClassReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&gatewayv1.GatewayClass{}).
+		Complete(r)
+}
@@ -0,0 +1,422 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/b4fun/frpcontroller/pkg/frpconfig"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+const (
+	// ingressBackendProtocolHTTPS exposes the ingress backends with https proxies (tls passthrough).
+	ingressBackendProtocolHTTPS = "HTTPS"
+
+	// IngressControllerName is the controller name of the ingress classes implemented by frp.
+	IngressControllerName = "frp.go.build4.fun/ingress-controller"
+)
+
+// IngressOptions configures the ingresses implemented by frp.
+type IngressOptions struct {
+	// Class specifies the name of the ingress class to implement, disabled if empty.
+	// The ingress class should be created with IngressControllerName as the controller.
+	Class string
+	// Endpoint specifies the name of the endpoint in the ingress namespace to expose the ingresses,
+	// can be overridden with the `frp.go.build4.fun/endpoint` annotation of the ingress.
+	Endpoint string
+}
+
+// Matches tells if the ingress is implemented by frp. The ingress is matched when it
+// refers to the ingress class by `spec.ingressClassName`, or it doesn't specify a class
+// while the ingress class is the default one. The deprecated `kubernetes.io/ingress.class`
+// annotation is matched against the class name as is.
+func (o IngressOptions) Matches(ctx context.Context, reader client.Reader, ingress *networkingv1.Ingress) (bool, error) {
+	if o.Class == "" {
+		return false, nil
+	}
+
+	var className string
+	switch {
+	case ingress.Spec.IngressClassName != nil:
+		className = *ingress.Spec.IngressClassName
+	case ingress.Annotations[annotationKeyIngressClass] != "":
+		return ingress.Annotations[annotationKeyIngressClass] == o.Class, nil
+	}
+	if className != "" && className != o.Class {
+		return false, nil
+	}
+
+	var ingressClass networkingv1.IngressClass
+	err := reader.Get(ctx, client.ObjectKey{Name: o.Class}, &ingressClass)
+	switch {
+	case err == nil:
+	case apierrors.IsNotFound(err):
+		return false, nil
+	default:
+		return false, err
+	}
+	if ingressClass.Spec.Controller != IngressControllerName {
+		return false, nil
+	}
+	if className == "" {
+		return ingressClass.Annotations[networkingv1.AnnotationIsDefaultIngressClass] == "true", nil
+	}
+	return true, nil
+}
+
+// EndpointName returns the name of the endpoint exposing the ingress.
+func (o IngressOptions) EndpointName(ingress *networkingv1.Ingress) string {
+	if endpointName := ingress.Annotations[annotationKeyCoreServiceEndpoint]; endpointName != "" {
+		return endpointName
+	}
+	return o.Endpoint
+}
+
+// IngressReconciler reports the address of the ingresses implemented by frp.
+type IngressReconciler struct {
+	client.Client
+	Log     logr.Logger
+	Scheme  *runtime.Scheme
+	Ingress IngressOptions
+}
+
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=ingressclasses,verbs=get;list;watch
+
+func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Log.WithValues("ingress", req.NamespacedName)
+
+	var ingress networkingv1.Ingress
+	err := r.Get(ctx, req.NamespacedName, &ingress)
+	switch {
+	case err == nil && ingress.DeletionTimestamp != nil:
+		return ctrl.Result{}, nil
+	case err == nil:
+		return r.handleCreateOrUpdate(ctx, logger, &ingress)
+	case apierrors.IsNotFound(err):
+		return ctrl.Result{}, nil
+	default:
+		logger.Error(err, "get ingress failed")
+		return ctrl.Result{}, err
+	}
+}
+
+func (r *IngressReconciler) handleCreateOrUpdate(
+	ctx context.Context,
+	logger logr.Logger,
+	ingress *networkingv1.Ingress,
+) (ctrl.Result, error) {
+	loadBalancerStatus := ingress.Status.LoadBalancer.DeepCopy()
+
+	matched, err := r.Ingress.Matches(ctx, r.Client, ingress)
+	if err != nil {
+		logger.Error(err, "get ingress class failed")
+		return ctrl.Result{}, err
+	}
+	if matched {
+		endpointName := r.Ingress.EndpointName(ingress)
+		var endpoint frpv1.Endpoint
+		err := r.Get(ctx, client.ObjectKey{Namespace: ingress.Namespace, Name: endpointName}, &endpoint)
+		switch {
+		case err == nil:
+			ingress.Status.LoadBalancer.Ingress = endpointIngressLoadBalancerIngress(&endpoint)
+		case apierrors.IsNotFound(err):
+			logger.Info(fmt.Sprintf("endpoint %s not found", endpointName))
+			ingress.Status.LoadBalancer.Ingress = nil
+		default:
+			logger.Error(err, "get endpoint failed")
+			return ctrl.Result{}, err
+		}
+	} else {
+		// NOTE: the ingress might be exposed by frp before, e.g. the class is changed
+		loadBalancerIngress, err := removeEndpointIngressLoadBalancerIngress(
+			ctx, r.Client, ingress.Namespace, ingress.Status.LoadBalancer.Ingress,
+		)
+		if err != nil {
+			logger.Error(err, "list endpoints failed")
+			return ctrl.Result{}, err
+		}
+		ingress.Status.LoadBalancer.Ingress = loadBalancerIngress
+	}
+
+	if apiequality.Semantic.DeepEqual(loadBalancerStatus, &ingress.Status.LoadBalancer) {
+		return ctrl.Result{}, nil
+	}
+	if err := r.Status().Update(ctx, ingress); err != nil {
+		logger.Error(err, "update ingress status failed")
+		return ctrl.Result{}, err
+	}
+	logger.Info(fmt.Sprintf("updated ingress load balancer ingress to: %v", ingress.Status.LoadBalancer.Ingress))
+
+	return ctrl.Result{}, nil
+}
+
+// endpointLoadBalancerIngress returns the load balancer ingress of the endpoint address,
+// which is empty until the endpoint is connected.
+func endpointLoadBalancerIngress(endpoint *frpv1.Endpoint) []corev1.LoadBalancerIngress {
+	if endpoint.Status.State != frpv1.EndpointConnected {
+		return nil
+	}
+	if net.ParseIP(endpoint.Spec.Addr) != nil {
+		return []corev1.LoadBalancerIngress{{IP: endpoint.Spec.Addr}}
+	}
+	return []corev1.LoadBalancerIngress{{Hostname: endpoint.Spec.Addr}}
+}
+
+// endpointIngressLoadBalancerIngress returns the ingress load balancer ingress of the endpoint address,
+// which is empty until the endpoint is connected.
+func endpointIngressLoadBalancerIngress(endpoint *frpv1.Endpoint) []networkingv1.IngressLoadBalancerIngress {
+	var ingress []networkingv1.IngressLoadBalancerIngress
+	for _, item := range endpointLoadBalancerIngress(endpoint) {
+		ingress = append(ingress, networkingv1.IngressLoadBalancerIngress{IP: item.IP, Hostname: item.Hostname})
+	}
+	return ingress
+}
+
+// removeEndpointIngressLoadBalancerIngress removes the endpoint addresses in the namespace
+// from the ingress load balancer ingress.
+func removeEndpointIngressLoadBalancerIngress(
+	ctx context.Context,
+	reader client.Reader,
+	namespace string,
+	ingress []networkingv1.IngressLoadBalancerIngress,
+) ([]networkingv1.IngressLoadBalancerIngress, error) {
+	if len(ingress) < 1 {
+		return ingress, nil
+	}
+
+	endpointAddrs, err := listEndpointAddrs(ctx, reader, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var ingressKept []networkingv1.IngressLoadBalancerIngress
+	for _, item := range ingress {
+		if (item.IP != "" && endpointAddrs[item.IP]) || (item.Hostname != "" && endpointAddrs[item.Hostname]) {
+			continue
+		}
+		ingressKept = append(ingressKept, item)
+	}
+	return ingressKept, nil
+}
+
+func (r *IngressReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&networkingv1.Ingress{}).
+		Watches(
+			&frpv1.Endpoint{},
+			handler.EnqueueRequestsFromMapFunc(r.mapEndpointToIngresses),
+		).
+		Watches(
+			&networkingv1.IngressClass{},
+			handler.EnqueueRequestsFromMapFunc(r.mapIngressClassToIngresses),
+		).
+		Complete(r)
+}
+
+// mapEndpointToIngresses maps an endpoint to the ingresses exposed by it.
+func (r *IngressReconciler) mapEndpointToIngresses(ctx context.Context, obj client.Object) []reconcile.Request {
+	ingresses, err := listEndpointIngresses(
+		ctx, r.Client, r.Ingress, obj.GetNamespace(), obj.GetName(),
+	)
+	if err != nil {
+		r.Log.Error(err, "list ingresses failed", "endpoint", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, ingress := range ingresses {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{
+				Namespace: ingress.Namespace,
+				Name:      ingress.Name,
+			},
+		})
+	}
+	return requests
+}
+
+// mapIngressClassToIngresses maps the implemented ingress class to all ingresses,
+// as the class controller or the default class annotation might change the matched ingresses.
+func (r *IngressReconciler) mapIngressClassToIngresses(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetName() != r.Ingress.Class {
+		return nil
+	}
+
+	var ingressList networkingv1.IngressList
+	if err := r.List(ctx, &ingressList); err != nil {
+		r.Log.Error(err, "list ingresses failed", "ingressclass", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, ingress := range ingressList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{
+				Namespace: ingress.Namespace,
+				Name:      ingress.Name,
+			},
+		})
+	}
+	return requests
+}
+
+// listEndpointIngresses lists the ingresses exposed by the endpoint.
+func listEndpointIngresses(
+	ctx context.Context,
+	reader client.Reader,
+	ingressOptions IngressOptions,
+	namespace string,
+	endpointName string,
+) ([]networkingv1.Ingress, error) {
+	if ingressOptions.Class == "" {
+		return nil, nil
+	}
+
+	var ingressList networkingv1.IngressList
+	if err := reader.List(ctx, &ingressList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	var ingresses []networkingv1.Ingress
+	for _, ingress := range ingressList.Items {
+		if ingressOptions.EndpointName(&ingress) != endpointName {
+			continue
+		}
+		matched, err := ingressOptions.Matches(ctx, reader, &ingress)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			ingresses = append(ingresses, ingress)
+		}
+	}
+	return ingresses, nil
+}
+
+// generateIngressApps generates the http/https proxies for the ingress rules exposed by the endpoint.
+// Rules without host, or with missing backend services are logged and skipped.
+func (r *EndpointReconciler) generateIngressApps(
+	ctx context.Context,
+	logger logr.Logger,
+	endpoint *endpointView,
+	config *frpconfig.FrpcConfig,
+) error {
+	if endpoint.Kind != KindEndpoint {
+		// NOTE: ingresses can only bind to the endpoint in the same namespace
+		return nil
+	}
+
+	ingresses, err := listEndpointIngresses(ctx, r.Client, r.Ingress, endpoint.Namespace, endpoint.Name)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: https proxies are routed by sni, frps accepts only one proxy per domain,
+	//       the earlier created ingress wins
+	sort.SliceStable(ingresses, func(i, j int) bool {
+		ti, tj := ingresses[i].CreationTimestamp, ingresses[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return ingresses[i].Name < ingresses[j].Name
+	})
+	httpsHosts := map[string]bool{}
+	for _, ingress := range ingresses {
+		if ingress.DeletionTimestamp != nil {
+			continue
+		}
+		appType := "http"
+		if ingress.Annotations[annotationKeyIngressBackendProtocol] == ingressBackendProtocolHTTPS {
+			appType = "https"
+		}
+
+		for i, rule := range ingress.Spec.Rules {
+			if rule.Host == "" {
+				logger.Info(fmt.Sprintf("ingress %s rule %d: rules without host are not supported", ingress.Name, i))
+				continue
+			}
+			if rule.HTTP == nil {
+				continue
+			}
+			for j, path := range rule.HTTP.Paths {
+				localAddr, localPort, err := r.resolveIngressBackend(ctx, ingress.Namespace, path.Backend)
+				if err != nil {
+					logger.Info(fmt.Sprintf("ingress %s rule %d path %d: %s", ingress.Name, i, j, err))
+					continue
+				}
+
+				app := &frpconfig.ConfigApp{
+					Type:          appType,
+					LocalAddr:     localAddr,
+					LocalPort:     int(localPort),
+					CustomDomains: []string{rule.Host},
+				}
+				// NOTE: the parts are joined with `_`, which resource and port names cannot contain,
+				// so the names never conflict with the services named as `<service>_<port>`
+				appName := fmt.Sprintf("ingress_%s_%d-%d", ingress.Name, i, j)
+				if appType == "https" {
+					if httpsHosts[rule.Host] {
+						logger.Info(fmt.Sprintf(
+							"ingress %s rule %d path %d: host %s is exposed already, https paths are ignored",
+							ingress.Name, i, j, rule.Host,
+						))
+						continue
+					}
+					httpsHosts[rule.Host] = true
+					appName = fmt.Sprintf("ingress_%s_%d", ingress.Name, i)
+				} else if path.Path != "" {
+					app.Locations = []string{path.Path}
+				}
+				config.Apps[appName] = app
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveIngressBackend resolves the cluster ip and the port of the ingress backend service.
+func (r *EndpointReconciler) resolveIngressBackend(
+	ctx context.Context,
+	namespace string,
+	backend networkingv1.IngressBackend,
+) (string, int32, error) {
+	if backend.Service == nil {
+		return "", 0, fmt.Errorf("only service backends are supported")
+	}
+	serviceName := backend.Service.Name
+	var kservice corev1.Service
+	err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: serviceName}, &kservice)
+	if err != nil {
+		return "", 0, fmt.Errorf("get backend service %s failed: %w", serviceName, err)
+	}
+	if kservice.Spec.ClusterIP == "" || kservice.Spec.ClusterIP == corev1.ClusterIPNone {
+		return "", 0, fmt.Errorf("backend service %s has no cluster ip", serviceName)
+	}
+
+	if backend.Service.Port.Name == "" {
+		return kservice.Spec.ClusterIP, backend.Service.Port.Number, nil
+	}
+	for _, port := range kservice.Spec.Ports {
+		if port.Name == backend.Service.Port.Name {
+			return kservice.Spec.ClusterIP, port.Port, nil
+		}
+	}
+	return "", 0, fmt.Errorf("port %s not found in backend service %s", backend.Service.Port.Name, serviceName)
+}
@@ -0,0 +1,419 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/b4fun/frpcontroller/pkg/frpconfig"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+func newIngressTestScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("add to scheme: %v", err)
+	}
+	if err := frpv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add to scheme: %v", err)
+	}
+	return scheme
+}
+
+func newIngressTestBackendService(name string, clusterIP string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: clusterIP,
+			Ports: []corev1.ServicePort{
+				{Name: "http", Protocol: corev1.ProtocolTCP, Port: 8080},
+			},
+		},
+	}
+}
+
+func newIngressTestIngressClass(name string, controller string, isDefault bool) *networkingv1.IngressClass {
+	ingressClass := &networkingv1.IngressClass{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       networkingv1.IngressClassSpec{Controller: controller},
+	}
+	if isDefault {
+		ingressClass.Annotations = map[string]string{networkingv1.AnnotationIsDefaultIngressClass: "true"}
+	}
+	return ingressClass
+}
+
+func newIngressTestIngress(
+	name string,
+	className string,
+	annotations map[string]string,
+	rules ...networkingv1.IngressRule,
+) *networkingv1.Ingress {
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        name,
+			Annotations: annotations,
+		},
+		Spec: networkingv1.IngressSpec{Rules: rules},
+	}
+	if className != "" {
+		ingress.Spec.IngressClassName = &className
+	}
+	return ingress
+}
+
+func newIngressTestRule(host string, paths ...networkingv1.HTTPIngressPath) networkingv1.IngressRule {
+	return networkingv1.IngressRule{
+		Host: host,
+		IngressRuleValue: networkingv1.IngressRuleValue{
+			HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths},
+		},
+	}
+}
+
+func newIngressTestPath(path string, serviceName string, servicePort intstr.IntOrString) networkingv1.HTTPIngressPath {
+	pathType := networkingv1.PathTypePrefix
+	return networkingv1.HTTPIngressPath{
+		Path:     path,
+		PathType: &pathType,
+		Backend:  newIngressTestBackend(serviceName, servicePort),
+	}
+}
+
+func newIngressTestBackend(serviceName string, servicePort intstr.IntOrString) networkingv1.IngressBackend {
+	port := networkingv1.ServiceBackendPort{Number: servicePort.IntVal}
+	if servicePort.Type == intstr.String {
+		port = networkingv1.ServiceBackendPort{Name: servicePort.StrVal}
+	}
+	return networkingv1.IngressBackend{
+		Service: &networkingv1.IngressServiceBackend{Name: serviceName, Port: port},
+	}
+}
+
+func TestIngressOptions_Matches(t *testing.T) {
+	scheme := newIngressTestScheme(t)
+	ingressOptions := IngressOptions{Class: "frp"}
+
+	cases := []struct {
+		name         string
+		ingressClass *networkingv1.IngressClass
+		ingress      *networkingv1.Ingress
+		expected     bool
+	}{
+		{
+			name:         "class name",
+			ingressClass: newIngressTestIngressClass("frp", IngressControllerName, false),
+			ingress:      newIngressTestIngress("web", "frp", nil),
+			expected:     true,
+		},
+		{
+			name:         "other class name",
+			ingressClass: newIngressTestIngressClass("frp", IngressControllerName, false),
+			ingress:      newIngressTestIngress("web", "nginx", nil),
+		},
+		{
+			name:    "class not found",
+			ingress: newIngressTestIngress("web", "frp", nil),
+		},
+		{
+			name:         "class of other controller",
+			ingressClass: newIngressTestIngressClass("frp", "k8s.io/ingress-nginx", false),
+			ingress:      newIngressTestIngress("web", "frp", nil),
+		},
+		{
+			name:         "default class",
+			ingressClass: newIngressTestIngressClass("frp", IngressControllerName, true),
+			ingress:      newIngressTestIngress("web", "", nil),
+			expected:     true,
+		},
+		{
+			name:         "not default class",
+			ingressClass: newIngressTestIngressClass("frp", IngressControllerName, false),
+			ingress:      newIngressTestIngress("web", "", nil),
+		},
+		{
+			name:     "class annotation",
+			ingress:  newIngressTestIngress("web", "", map[string]string{annotationKeyIngressClass: "frp"}),
+			expected: true,
+		},
+		{
+			name:         "other class annotation",
+			ingressClass: newIngressTestIngressClass("frp", IngressControllerName, true),
+			ingress:      newIngressTestIngress("web", "", map[string]string{annotationKeyIngressClass: "nginx"}),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			clientBuilder := fake.NewClientBuilder().WithScheme(scheme)
+			if c.ingressClass != nil {
+				clientBuilder = clientBuilder.WithObjects(c.ingressClass)
+			}
+			matched, err := ingressOptions.Matches(context.Background(), clientBuilder.Build(), c.ingress)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if matched != c.expected {
+				t.Errorf("expected matched %v, got %v", c.expected, matched)
+			}
+		})
+	}
+}
+
+func TestEndpointReconciler_ResolveIngressBackend(t *testing.T) {
+	scheme := newIngressTestScheme(t)
+	r := &EndpointReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			newIngressTestBackendService("api", "10.0.0.1"),
+			newIngressTestBackendService("headless", corev1.ClusterIPNone),
+		).Build(),
+	}
+
+	cases := []struct {
+		name              string
+		backend           networkingv1.IngressBackend
+		expectedLocalAddr string
+		expectedLocalPort int32
+		expectedError     string
+	}{
+		{
+			name:              "port number",
+			backend:           newIngressTestBackend("api", intstr.FromInt(9090)),
+			expectedLocalAddr: "10.0.0.1",
+			expectedLocalPort: 9090,
+		},
+		{
+			name:              "port name",
+			backend:           newIngressTestBackend("api", intstr.FromString("http")),
+			expectedLocalAddr: "10.0.0.1",
+			expectedLocalPort: 8080,
+		},
+		{
+			name:          "unknown port name",
+			backend:       newIngressTestBackend("api", intstr.FromString("grpc")),
+			expectedError: "port grpc not found in backend service api",
+		},
+		{
+			name:          "headless",
+			backend:       newIngressTestBackend("headless", intstr.FromInt(8080)),
+			expectedError: "backend service headless has no cluster ip",
+		},
+		{
+			name:          "missing service",
+			backend:       newIngressTestBackend("missing", intstr.FromInt(8080)),
+			expectedError: "get backend service missing failed",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			localAddr, localPort, err := r.resolveIngressBackend(context.Background(), "default", c.backend)
+			if c.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), c.expectedError) {
+					t.Errorf("expected error with %q, got %v", c.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if localAddr != c.expectedLocalAddr || localPort != c.expectedLocalPort {
+				t.Errorf("unexpected backend: %s:%d", localAddr, localPort)
+			}
+		})
+	}
+}
+
+func TestEndpointReconciler_GenerateIngressApps(t *testing.T) {
+	scheme := newIngressTestScheme(t)
+	ingressOptions := IngressOptions{Class: "frp", Endpoint: "endpoint"}
+	httpsBackend := map[string]string{annotationKeyIngressBackendProtocol: ingressBackendProtocolHTTPS}
+
+	cases := []struct {
+		name         string
+		ingresses    []*networkingv1.Ingress
+		expectedApps map[string]*frpconfig.ConfigApp
+	}{
+		{
+			name: "http paths",
+			ingresses: []*networkingv1.Ingress{
+				newIngressTestIngress("web", "frp", nil, newIngressTestRule(
+					"app.example.com",
+					newIngressTestPath("/api", "api", intstr.FromString("http")),
+					newIngressTestPath("", "web", intstr.FromInt(80)),
+				)),
+			},
+			expectedApps: map[string]*frpconfig.ConfigApp{
+				"ingress_web_0-0": {
+					Type: "http", LocalAddr: "10.0.0.1", LocalPort: 8080,
+					CustomDomains: []string{"app.example.com"}, Locations: []string{"/api"},
+				},
+				"ingress_web_0-1": {
+					Type: "http", LocalAddr: "10.0.0.2", LocalPort: 80,
+					CustomDomains: []string{"app.example.com"},
+				},
+			},
+		},
+		{
+			name: "https proxy per host",
+			ingresses: []*networkingv1.Ingress{
+				newIngressTestIngress(
+					"web", "frp", httpsBackend,
+					newIngressTestRule(
+						"app.example.com",
+						newIngressTestPath("/api", "api", intstr.FromString("http")),
+						newIngressTestPath("/", "web", intstr.FromInt(443)),
+					),
+					newIngressTestRule(
+						"www.example.com",
+						newIngressTestPath("/", "web", intstr.FromInt(443)),
+					),
+				),
+				newIngressTestIngress("other", "frp", httpsBackend, newIngressTestRule(
+					"app.example.com",
+					newIngressTestPath("/", "web", intstr.FromInt(443)),
+				)),
+			},
+			expectedApps: map[string]*frpconfig.ConfigApp{
+				"ingress_other_0": {
+					Type: "https", LocalAddr: "10.0.0.2", LocalPort: 443,
+					CustomDomains: []string{"app.example.com"},
+				},
+				"ingress_web_1": {
+					Type: "https", LocalAddr: "10.0.0.2", LocalPort: 443,
+					CustomDomains: []string{"www.example.com"},
+				},
+			},
+		},
+		{
+			name: "unsupported rules are skipped",
+			ingresses: []*networkingv1.Ingress{
+				newIngressTestIngress(
+					"web", "frp", nil,
+					newIngressTestRule("", newIngressTestPath("/", "web", intstr.FromInt(80))),
+					networkingv1.IngressRule{Host: "empty.example.com"},
+					newIngressTestRule("app.example.com", newIngressTestPath("/", "missing", intstr.FromInt(80))),
+				),
+			},
+			expectedApps: map[string]*frpconfig.ConfigApp{},
+		},
+		{
+			name: "other class",
+			ingresses: []*networkingv1.Ingress{
+				newIngressTestIngress(
+					"web", "nginx", nil,
+					newIngressTestRule("app.example.com", newIngressTestPath("/", "web", intstr.FromInt(80))),
+				),
+			},
+			expectedApps: map[string]*frpconfig.ConfigApp{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			objs := []client.Object{
+				newIngressTestIngressClass("frp", IngressControllerName, false),
+				newIngressTestBackendService("api", "10.0.0.1"),
+				newIngressTestBackendService("web", "10.0.0.2"),
+			}
+			for _, ingress := range c.ingresses {
+				objs = append(objs, ingress)
+			}
+			r := &EndpointReconciler{
+				Client:  fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+				Log:     log.Log,
+				Ingress: ingressOptions,
+			}
+			endpoint := newEndpointView(&frpv1.Endpoint{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "endpoint"},
+			})
+			config := &frpconfig.FrpcConfig{Apps: map[string]*frpconfig.ConfigApp{}}
+
+			err := r.generateIngressApps(context.Background(), r.Log, endpoint, config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(config.Apps, c.expectedApps) {
+				t.Errorf("unexpected apps:\n%+v\nexpected:\n%+v", config.Apps, c.expectedApps)
+			}
+			// NOTE: service ingress.web port 0-0 took the ingress proxy name with the `.` separator
+			service := &frpv1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ingress.web"}}
+			if _, exists := config.Apps[serviceProxyName(service, "0-0")]; exists {
+				t.Errorf("ingress proxy name collides with service %s", service.Name)
+			}
+		})
+	}
+}
+
+func TestIngressReconciler_Reconcile(t *testing.T) {
+	scheme := newIngressTestScheme(t)
+	endpoint := &frpv1.Endpoint{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "endpoint"},
+		Spec:       frpv1.EndpointSpec{Addr: "frp.example.com", Port: 7000},
+		Status:     frpv1.EndpointStatus{State: frpv1.EndpointConnected},
+	}
+
+	cases := []struct {
+		name            string
+		className       string
+		ingress         []networkingv1.IngressLoadBalancerIngress
+		expectedIngress []networkingv1.IngressLoadBalancerIngress
+	}{
+		{
+			name:            "matched",
+			className:       "frp",
+			expectedIngress: []networkingv1.IngressLoadBalancerIngress{{Hostname: "frp.example.com"}},
+		},
+		{
+			name:      "class changed",
+			className: "nginx",
+			ingress: []networkingv1.IngressLoadBalancerIngress{
+				{Hostname: "frp.example.com"},
+				{IP: "1.2.3.4"},
+			},
+			expectedIngress: []networkingv1.IngressLoadBalancerIngress{{IP: "1.2.3.4"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ingress := newIngressTestIngress("web", c.className, nil)
+			ingress.Status.LoadBalancer.Ingress = c.ingress
+			r := &IngressReconciler{
+				Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+					ingress, endpoint, newIngressTestIngressClass("frp", IngressControllerName, false),
+				).Build(),
+				Log:     log.Log,
+				Scheme:  scheme,
+				Ingress: IngressOptions{Class: "frp", Endpoint: "endpoint"},
+			}
+			key := client.ObjectKey{Namespace: ingress.Namespace, Name: ingress.Name}
+			if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatalf("reconcile: %v", err)
+			}
+
+			var ingressLatest networkingv1.Ingress
+			if err := r.Get(context.Background(), key, &ingressLatest); err != nil {
+				t.Fatalf("get ingress: %v", err)
+			}
+			if !apiequality.Semantic.DeepEqual(ingressLatest.Status.LoadBalancer.Ingress, c.expectedIngress) {
+				t.Errorf("unexpected ingress: %+v", ingressLatest.Status.LoadBalancer.Ingress)
+			}
+		})
+	}
+}
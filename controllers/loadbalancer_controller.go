@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+// LoadBalancerOptions configures the LoadBalancer services implemented by frp.
+type LoadBalancerOptions struct {
+	// Class specifies the load balancer class to implement, disabled if empty.
+	// The class is set with the `frp.go.build4.fun/load-balancer-class` annotation of the service.
+	Class string
+	// Endpoint specifies the name of the endpoint in the service namespace to expose the services,
+	// can be overridden with the `frp.go.build4.fun/endpoint` annotation of the service.
+	Endpoint string
+}
+
+// Matches tells if the core service is a LoadBalancer service implemented by frp.
+func (o LoadBalancerOptions) Matches(kservice *corev1.Service) bool {
+	if o.Class == "" || kservice.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return false
+	}
+	return kservice.Annotations[annotationKeyLoadBalancerClass] == o.Class
+}
+
+// LoadBalancerReconciler reports the ingress of the LoadBalancer services implemented by frp.
+type LoadBalancerReconciler struct {
+	client.Client
+	Log          logr.Logger
+	Scheme       *runtime.Scheme
+	LoadBalancer LoadBalancerOptions
+	// Recorder records the warning events of the services, events are skipped if not set.
+	Recorder record.EventRecorder
+
+	// portMismatchWarnings remembers the port mismatch warned for each service,
+	// so the warning is recorded once per message instead of on every reconcile.
+	portMismatchWarnings sync.Map
+}
+
+// +kubebuilder:rbac:groups=core,resources=services/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+func (r *LoadBalancerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Log.WithValues("service", req.NamespacedName)
+
+	var kservice corev1.Service
+	err := r.Get(ctx, req.NamespacedName, &kservice)
+	switch {
+	case err == nil && kservice.DeletionTimestamp != nil:
+		r.portMismatchWarnings.Delete(req.NamespacedName)
+		return ctrl.Result{}, nil
+	case err == nil:
+		return r.handleCreateOrUpdate(ctx, logger, &kservice)
+	case apierrors.IsNotFound(err):
+		r.portMismatchWarnings.Delete(req.NamespacedName)
+		return ctrl.Result{}, nil
+	default:
+		logger.Error(err, "get service failed")
+		return ctrl.Result{}, err
+	}
+}
+
+func (r *LoadBalancerReconciler) handleCreateOrUpdate(
+	ctx context.Context,
+	logger logr.Logger,
+	kservice *corev1.Service,
+) (ctrl.Result, error) {
+	loadBalancerStatus := kservice.Status.LoadBalancer.DeepCopy()
+
+	var (
+		ingress []corev1.LoadBalancerIngress
+		err     error
+	)
+	if r.LoadBalancer.Matches(kservice) {
+		ingress, err = r.resolveIngress(ctx, logger, kservice)
+	} else {
+		r.portMismatchWarnings.Delete(client.ObjectKeyFromObject(kservice))
+		// NOTE: the service might be exposed by frp before, e.g. the class annotation is removed
+		ingress, err = removeEndpointLoadBalancerIngress(ctx, r.Client, kservice.Namespace, kservice.Status.LoadBalancer.Ingress)
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	kservice.Status.LoadBalancer.Ingress = ingress
+
+	if apiequality.Semantic.DeepEqual(loadBalancerStatus, &kservice.Status.LoadBalancer) {
+		return ctrl.Result{}, nil
+	}
+	if err := r.Status().Update(ctx, kservice); err != nil {
+		logger.Error(err, "update service status failed")
+		return ctrl.Result{}, err
+	}
+	logger.Info(fmt.Sprintf("updated service load balancer ingress to: %v", ingress))
+
+	return ctrl.Result{}, nil
+}
+
+// resolveIngress resolves the load balancer ingress from the endpoint address.
+// The ingress is empty until the endpoint is connected and all ports are allocated.
+// As the clients connect to the service ports at the ingress address, the ingress is
+// not published if any port is not exposed at the same remote port, which is warned.
+func (r *LoadBalancerReconciler) resolveIngress(
+	ctx context.Context,
+	logger logr.Logger,
+	kservice *corev1.Service,
+) ([]corev1.LoadBalancerIngress, error) {
+	service, err := coreServiceToService(kservice, r.LoadBalancer)
+	if err != nil {
+		logger.Info(fmt.Sprintf("service is not exposed: %s", err))
+		return nil, nil
+	}
+	if service.Spec.Endpoint == "" {
+		logger.Info("no endpoint specified for the service")
+		return nil, nil
+	}
+
+	var endpoint frpv1.Endpoint
+	err = r.Get(ctx, client.ObjectKey{Namespace: kservice.Namespace, Name: service.Spec.Endpoint}, &endpoint)
+	switch {
+	case err == nil:
+	case apierrors.IsNotFound(err):
+		logger.Info(fmt.Sprintf("endpoint %s not found", service.Spec.Endpoint))
+		return nil, nil
+	default:
+		logger.Error(err, "get endpoint failed")
+		return nil, err
+	}
+	exposedPorts := map[string]bool{}
+	for _, port := range service.Spec.Ports {
+		exposedPorts[port.Name] = true
+	}
+	var (
+		mismatches []string
+		pending    bool
+	)
+	for _, port := range kservice.Spec.Ports {
+		if !exposedPorts[port.Name] {
+			mismatches = append(mismatches, fmt.Sprintf("port %s is not exposed", port.Name))
+			continue
+		}
+		allocation := findPortAllocation(endpoint.Status.Allocations, service, port.Name)
+		switch {
+		case allocation == nil:
+			pending = true
+		case allocation.Error != "":
+			mismatches = append(mismatches, fmt.Sprintf("port %s: %s", port.Name, allocation.Error))
+		case allocation.RemotePort != port.Port:
+			mismatches = append(mismatches, fmt.Sprintf(
+				"port %s is exposed at remote port %d instead of %d",
+				port.Name, allocation.RemotePort, port.Port,
+			))
+		}
+	}
+	if len(mismatches) > 0 {
+		message := "load balancer ingress is not published: " + strings.Join(mismatches, "; ")
+		logger.Info(message)
+		r.recordPortMismatch(kservice, message)
+		return nil, nil
+	}
+	r.portMismatchWarnings.Delete(client.ObjectKeyFromObject(kservice))
+	if pending {
+		return nil, nil
+	}
+
+	return endpointLoadBalancerIngress(&endpoint), nil
+}
+
+// recordPortMismatch records a warning event on the service with ports not exposed at the service ports,
+// unless the same warning has been recorded.
+func (r *LoadBalancerReconciler) recordPortMismatch(kservice *corev1.Service, message string) {
+	if r.Recorder == nil {
+		return
+	}
+
+	key := client.ObjectKeyFromObject(kservice)
+	if previous, recorded := r.portMismatchWarnings.Load(key); recorded && previous == message {
+		return
+	}
+	r.portMismatchWarnings.Store(key, message)
+	r.Recorder.Event(kservice, corev1.EventTypeWarning, reasonLoadBalancerPortMismatch, message)
+}
+
+// removeEndpointLoadBalancerIngress removes the load balancer ingress pointing to the endpoints in the namespace,
+// the ingress set by other implementations is kept.
+func removeEndpointLoadBalancerIngress(
+	ctx context.Context,
+	reader client.Reader,
+	namespace string,
+	ingress []corev1.LoadBalancerIngress,
+) ([]corev1.LoadBalancerIngress, error) {
+	if len(ingress) < 1 {
+		return ingress, nil
+	}
+
+	endpointAddrs, err := listEndpointAddrs(ctx, reader, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var ingressKept []corev1.LoadBalancerIngress
+	for _, item := range ingress {
+		if (item.IP != "" && endpointAddrs[item.IP]) || (item.Hostname != "" && endpointAddrs[item.Hostname]) {
+			continue
+		}
+		ingressKept = append(ingressKept, item)
+	}
+	return ingressKept, nil
+}
+
+// listEndpointAddrs lists the addresses of the endpoints in the namespace.
+func listEndpointAddrs(ctx context.Context, reader client.Reader, namespace string) (map[string]bool, error) {
+	var endpointList frpv1.EndpointList
+	if err := reader.List(ctx, &endpointList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	endpointAddrs := map[string]bool{}
+	for _, endpoint := range endpointList.Items {
+		endpointAddrs[endpoint.Spec.Addr] = true
+	}
+	return endpointAddrs, nil
+}
+
+func (r *LoadBalancerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Service{}).
+		Watches(
+			&frpv1.Endpoint{},
+			handler.EnqueueRequestsFromMapFunc(r.mapEndpointToServices),
+		).
+		Complete(r)
+}
+
+// mapEndpointToServices maps an endpoint to the LoadBalancer services exposed by it.
+func (r *LoadBalancerReconciler) mapEndpointToServices(ctx context.Context, obj client.Object) []reconcile.Request {
+	var kserviceList corev1.ServiceList
+	err := r.List(
+		context.Background(), &kserviceList,
+		client.InNamespace(obj.GetNamespace()),
+	)
+	if err != nil {
+		r.Log.Error(err, "list services failed", "endpoint", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range kserviceList.Items {
+		kservice := &kserviceList.Items[i]
+		if !r.LoadBalancer.Matches(kservice) {
+			continue
+		}
+		if coreServiceEndpointName(kservice, r.LoadBalancer) != obj.GetName() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{
+				Namespace: kservice.Namespace,
+				Name:      kservice.Name,
+			},
+		})
+	}
+	return requests
+}
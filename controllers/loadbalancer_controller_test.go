@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+func TestLoadBalancerReconciler_Reconcile(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("add to scheme: %v", err)
+	}
+	if err := frpv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add to scheme: %v", err)
+	}
+
+	newEndpoint := func(state frpv1.EndpointState, allocations ...frpv1.PortAllocation) *frpv1.Endpoint {
+		return &frpv1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "lb-endpoint"},
+			Spec:       frpv1.EndpointSpec{Addr: "1.2.3.4", Port: 7000},
+			Status: frpv1.EndpointStatus{
+				State:       state,
+				Allocations: allocations,
+			},
+		}
+	}
+	httpAllocation := frpv1.PortAllocation{
+		Namespace: "default", Service: coreServiceNamePrefix + "web", Port: "http", RemotePort: 80,
+	}
+
+	newLoadBalancerService := func(mutate func(*corev1.Service)) *corev1.Service {
+		kservice := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        "web",
+				Annotations: map[string]string{annotationKeyLoadBalancerClass: "frp"},
+			},
+			Spec: corev1.ServiceSpec{
+				Type:      corev1.ServiceTypeLoadBalancer,
+				ClusterIP: "10.0.0.1",
+				Ports: []corev1.ServicePort{
+					{Name: "http", Protocol: corev1.ProtocolTCP, Port: 80},
+				},
+			},
+		}
+		if mutate != nil {
+			mutate(kservice)
+		}
+		return kservice
+	}
+	withIngress := func(ingress ...corev1.LoadBalancerIngress) func(*corev1.Service) {
+		return func(kservice *corev1.Service) {
+			kservice.Status.LoadBalancer.Ingress = ingress
+		}
+	}
+
+	cases := []struct {
+		name            string
+		kservice        *corev1.Service
+		endpoint        *frpv1.Endpoint
+		expectedIngress []corev1.LoadBalancerIngress
+		expectedEvents  []string
+	}{
+		{
+			name:            "connected",
+			kservice:        newLoadBalancerService(nil),
+			endpoint:        newEndpoint(frpv1.EndpointConnected, httpAllocation),
+			expectedIngress: []corev1.LoadBalancerIngress{{IP: "1.2.3.4"}},
+		},
+		{
+			name:     "disconnected",
+			kservice: newLoadBalancerService(withIngress(corev1.LoadBalancerIngress{IP: "1.2.3.4"})),
+			endpoint: newEndpoint(frpv1.EndpointDisconnected, httpAllocation),
+		},
+		{
+			name:     "port not allocated",
+			kservice: newLoadBalancerService(nil),
+			endpoint: newEndpoint(frpv1.EndpointConnected),
+		},
+		{
+			name: "class removed",
+			kservice: newLoadBalancerService(func(kservice *corev1.Service) {
+				kservice.Annotations = nil
+				withIngress(
+					corev1.LoadBalancerIngress{IP: "1.2.3.4"},
+					corev1.LoadBalancerIngress{Hostname: "lb.example.com"},
+				)(kservice)
+			}),
+			endpoint:        newEndpoint(frpv1.EndpointConnected, httpAllocation),
+			expectedIngress: []corev1.LoadBalancerIngress{{Hostname: "lb.example.com"}},
+		},
+		{
+			name: "type changed",
+			kservice: newLoadBalancerService(func(kservice *corev1.Service) {
+				kservice.Spec.Type = corev1.ServiceTypeClusterIP
+				withIngress(corev1.LoadBalancerIngress{IP: "1.2.3.4"})(kservice)
+			}),
+			endpoint: newEndpoint(frpv1.EndpointConnected, httpAllocation),
+		},
+		{
+			name: "remote port differs from service port",
+			kservice: newLoadBalancerService(func(kservice *corev1.Service) {
+				kservice.Annotations[annotationKeyCoreServiceRemotePorts] = "http"
+				withIngress(corev1.LoadBalancerIngress{IP: "1.2.3.4"})(kservice)
+			}),
+			endpoint: newEndpoint(frpv1.EndpointConnected, frpv1.PortAllocation{
+				Namespace: "default", Service: coreServiceNamePrefix + "web", Port: "http", RemotePort: 30000,
+			}),
+			expectedEvents: []string{
+				"Warning LoadBalancerPortMismatch load balancer ingress is not published: " +
+					"port http is exposed at remote port 30000 instead of 80",
+			},
+		},
+		{
+			name:     "remote port conflict",
+			kservice: newLoadBalancerService(nil),
+			endpoint: newEndpoint(frpv1.EndpointConnected, frpv1.PortAllocation{
+				Namespace: "default", Service: coreServiceNamePrefix + "web", Port: "http",
+				Error: "remote port 80/TCP is already used by service ssh",
+			}),
+			expectedEvents: []string{
+				"Warning LoadBalancerPortMismatch load balancer ingress is not published: " +
+					"port http: remote port 80/TCP is already used by service ssh",
+			},
+		},
+		{
+			name: "port not exposed",
+			kservice: newLoadBalancerService(func(kservice *corev1.Service) {
+				kservice.Annotations[annotationKeyCoreServiceRemotePorts] = "http=80"
+				kservice.Spec.Ports = append(kservice.Spec.Ports, corev1.ServicePort{
+					Name: "https", Protocol: corev1.ProtocolTCP, Port: 443,
+				})
+			}),
+			endpoint: newEndpoint(frpv1.EndpointConnected, httpAllocation),
+			expectedEvents: []string{
+				"Warning LoadBalancerPortMismatch load balancer ingress is not published: port https is not exposed",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &LoadBalancerReconciler{
+				Client:       fake.NewClientBuilder().WithScheme(scheme).WithObjects(c.kservice, c.endpoint).Build(),
+				Log:          log.Log,
+				Scheme:       scheme,
+				LoadBalancer: LoadBalancerOptions{Class: "frp", Endpoint: "lb-endpoint"},
+				Recorder:     recorder,
+			}
+			key := client.ObjectKey{Namespace: c.kservice.Namespace, Name: c.kservice.Name}
+			// NOTE: the warning is recorded once across reconciles
+			for i := 0; i < 2; i++ {
+				if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+					t.Fatalf("reconcile: %v", err)
+				}
+			}
+
+			var kservice corev1.Service
+			if err := r.Get(context.Background(), key, &kservice); err != nil {
+				t.Fatalf("get service: %v", err)
+			}
+			if !apiequality.Semantic.DeepEqual(kservice.Status.LoadBalancer.Ingress, c.expectedIngress) {
+				t.Errorf("unexpected ingress: %+v", kservice.Status.LoadBalancer.Ingress)
+			}
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			if !reflect.DeepEqual(events, c.expectedEvents) {
+				t.Errorf("unexpected events: %v", events)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// getSecretKeyValue reads the value of the secret key selector under the namespace.
+// Missing optional secret or key resolves to empty value.
+func getSecretKeyValue(
+	ctx context.Context,
+	reader client.Reader,
+	namespace string,
+	selector *corev1.SecretKeySelector,
+) (string, error) {
+	optional := selector.Optional != nil && *selector.Optional
+
+	var secret corev1.Secret
+	err := reader.Get(
+		ctx,
+		client.ObjectKey{Namespace: namespace, Name: selector.Name},
+		&secret,
+	)
+	switch {
+	case err == nil:
+	case apierrors.IsNotFound(err) && optional:
+		return "", nil
+	default:
+		return "", err
+	}
+
+	value, exists := secret.Data[selector.Key]
+	if !exists {
+		if optional {
+			return "", nil
+		}
+		return "", fmt.Errorf("key %s not found in secret %s/%s", selector.Key, namespace, selector.Name)
+	}
+	return string(value), nil
+}
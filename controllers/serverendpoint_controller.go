@@ -0,0 +1,855 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/b4fun/frpcontroller/pkg/frpconfig"
+	"github.com/b4fun/frpcontroller/pkg/portalloc"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+const (
+	serverEndpointOwnerKey     = ".metadata.controller.serverEndpoint"
+	serverEndpointSecretRefKey = ".spec.secretRefs"
+
+	// frpsContainerName specifies the name of the frps container.
+	frpsContainerName = "frps"
+)
+
+// ServerEndpointReconciler reconciles a ServerEndpoint object
+type ServerEndpointReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// DefaultImage specifies the frps image for the server endpoints without image, optional.
+	DefaultImage string
+}
+
+// +kubebuilder:rbac:groups=frp.go.build4.fun,resources=serverendpoints,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=frp.go.build4.fun,resources=serverendpoints/status,verbs=get;update;patch
+
+func (r *ServerEndpointReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Log.WithValues("serverendpoint", req.NamespacedName)
+
+	var serverEndpoint frpv1.ServerEndpoint
+	err := r.Get(ctx, req.NamespacedName, &serverEndpoint)
+	switch {
+	case err == nil && serverEndpoint.DeletionTimestamp != nil:
+		// NOTE: owned resources are cleaned up by the garbage collector
+		return ctrl.Result{}, nil
+	case err == nil:
+		return r.handleCreateOrUpdate(ctx, logger, &serverEndpoint)
+	case apierrors.IsNotFound(err):
+		return ctrl.Result{}, nil
+	default:
+		logger.Error(err, "get server endpoint failed")
+		return ctrl.Result{}, err
+	}
+}
+
+func (r *ServerEndpointReconciler) handleCreateOrUpdate(
+	ctx context.Context,
+	logger logr.Logger,
+	serverEndpoint *frpv1.ServerEndpoint,
+) (ctrl.Result, error) {
+	// NOTE: the defaulting webhook might be disabled
+	serverEndpoint.Default()
+
+	serverEndpointStatus := serverEndpoint.Status.DeepCopy()
+
+	// NOTE: the validating webhook might be disabled, invalid specs are not deployed
+	if _, err := serverEndpoint.ValidateCreate(); err != nil {
+		logger.Info(fmt.Sprintf("invalid server endpoint: %s", err))
+		setCondition(
+			&serverEndpoint.Status.Conditions, serverEndpoint.Generation,
+			frpv1.ConditionConfigGenerated, metav1.ConditionFalse,
+			reasonSpecInvalid, err.Error(),
+		)
+		serverEndpoint.Status.State = frpv1.ServerEndpointNotReady
+		if statusErr := r.updateServerEndpointStatus(ctx, logger, serverEndpoint, serverEndpointStatus); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
+		// NOTE: reconciled again on spec changes
+		return ctrl.Result{}, nil
+	}
+
+	frpsConfig, err := r.ensureServerEndpointConfigSecret(ctx, logger, serverEndpoint)
+	if err != nil {
+		setCondition(
+			&serverEndpoint.Status.Conditions, serverEndpoint.Generation,
+			frpv1.ConditionConfigGenerated, metav1.ConditionFalse,
+			reasonConfigGenerateFailed, err.Error(),
+		)
+		if statusErr := r.updateServerEndpointStatus(ctx, logger, serverEndpoint, serverEndpointStatus); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
+		return ctrl.Result{}, err
+	}
+	setCondition(
+		&serverEndpoint.Status.Conditions, serverEndpoint.Generation,
+		frpv1.ConditionConfigGenerated, metav1.ConditionTrue,
+		reasonConfigGenerated, fmt.Sprintf("frps config is stored in secret %s", frpsConfig.Name),
+	)
+
+	deployment, err := r.ensureServerEndpointDeployment(ctx, logger, serverEndpoint, frpsConfig)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	kservice, err := r.ensureServerEndpointService(ctx, logger, serverEndpoint)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var podList corev1.PodList
+	err = r.List(
+		ctx, &podList,
+		client.InNamespace(serverEndpoint.Namespace),
+		client.MatchingLabels{labelKeyServerEndpointName: serverEndpoint.Name},
+	)
+	if err != nil {
+		logger.Error(err, "list server endpoint pods failed")
+		return ctrl.Result{}, err
+	}
+	setServerEndpointPodConditions(serverEndpoint, deployment, podList.Items)
+
+	serverEndpoint.Status.ServiceName = kservice.Name
+	serverEndpoint.Status.Addr = serverEndpointServiceAddr(kservice)
+	if serverEndpoint.Status.Addr != "" {
+		setCondition(
+			&serverEndpoint.Status.Conditions, serverEndpoint.Generation,
+			frpv1.ConditionAddressAssigned, metav1.ConditionTrue,
+			reasonAddressAssigned, fmt.Sprintf("frps is served at %s", serverEndpoint.Status.Addr),
+		)
+	} else {
+		setCondition(
+			&serverEndpoint.Status.Conditions, serverEndpoint.Generation,
+			frpv1.ConditionAddressAssigned, metav1.ConditionFalse,
+			reasonAddressPending, fmt.Sprintf("waiting for the address of service %s", kservice.Name),
+		)
+	}
+
+	endpointName, err := r.ensureServerEndpointClientEndpoint(ctx, logger, serverEndpoint, kservice)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	serverEndpoint.Status.EndpointName = endpointName
+
+	serverEndpoint.Status.State = frpv1.ServerEndpointNotReady
+	if frpv1.IsConditionTrue(serverEndpoint.Status.Conditions, frpv1.ConditionServerPodReady) &&
+		frpv1.IsConditionTrue(serverEndpoint.Status.Conditions, frpv1.ConditionAddressAssigned) {
+		serverEndpoint.Status.State = frpv1.ServerEndpointReady
+	}
+	if err := r.updateServerEndpointStatus(ctx, logger, serverEndpoint, serverEndpointStatus); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// updateServerEndpointStatus updates the server endpoint status if it differs from the previous one.
+func (r *ServerEndpointReconciler) updateServerEndpointStatus(
+	ctx context.Context,
+	logger logr.Logger,
+	serverEndpoint *frpv1.ServerEndpoint,
+	previousStatus *frpv1.ServerEndpointStatus,
+) error {
+	serverEndpoint.Status.ObservedGeneration = serverEndpoint.Generation
+	if apiequality.Semantic.DeepEqual(previousStatus, &serverEndpoint.Status) {
+		return nil
+	}
+
+	if err := r.Status().Update(ctx, serverEndpoint); err != nil {
+		logger.Error(err, "update server endpoint status failed")
+		return err
+	}
+	logger.Info(fmt.Sprintf("updated server endpoint status to: %s", serverEndpoint.Status.State))
+
+	return nil
+}
+
+func (r *ServerEndpointReconciler) ensureServerEndpointConfigSecret(
+	ctx context.Context,
+	logger logr.Logger,
+	serverEndpoint *frpv1.ServerEndpoint,
+) (*corev1.Secret, error) {
+	var (
+		frpsConfigList    corev1.SecretList
+		frpsConfig        *corev1.Secret
+		frpsConfigExisted bool
+	)
+	err := r.List(
+		ctx, &frpsConfigList,
+		client.InNamespace(serverEndpoint.Namespace),
+		client.MatchingFields{serverEndpointOwnerKey: serverEndpoint.Name},
+	)
+	if err != nil {
+		logger.Error(err, "list server endpoint secrets failed")
+		return nil, err
+	}
+	if len(frpsConfigList.Items) == 0 {
+		logger.Info("no server endpoint secret found, will create")
+		frpsConfigExisted = false
+		frpsConfig = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: fmt.Sprintf("%s-frps-", serverEndpoint.Name),
+				Namespace:    serverEndpoint.Namespace,
+			},
+			Type: corev1.SecretTypeOpaque,
+		}
+		err := ctrl.SetControllerReference(serverEndpoint, frpsConfig, r.Scheme)
+		if err != nil {
+			logger.Error(err, "set controller reference failed")
+			return nil, err
+		}
+	} else {
+		frpsConfigExisted = true
+		frpsConfig = &frpsConfigList.Items[0]
+		logger.Info(fmt.Sprintf(
+			"found %d secrets, using %s",
+			len(frpsConfigList.Items),
+			frpsConfig.Name),
+		)
+	}
+
+	config, err := r.generateFrpsConfig(ctx, serverEndpoint)
+	if err != nil {
+		logger.Error(err, "generate frps config failed")
+		return nil, err
+	}
+	frpsConfigContent, err := config.GenerateINI()
+	if err != nil {
+		logger.Error(err, "generate frps config failed")
+		return nil, err
+	}
+
+	frpsConfigHash := frpcConfigHash(frpsConfigContent)
+	if frpsConfigExisted &&
+		string(frpsConfig.Data[frpsFileName]) == frpsConfigContent && len(frpsConfig.Data) == 1 &&
+		frpsConfig.Annotations[annotationKeyEndpointPodConfigHash] == frpsConfigHash {
+		return frpsConfig, nil
+	}
+	frpsConfig.Data = map[string][]byte{
+		frpsFileName: []byte(frpsConfigContent),
+	}
+	if frpsConfig.Annotations == nil {
+		frpsConfig.Annotations = map[string]string{}
+	}
+	// NOTE: frps cannot reload the config, the pods are restarted on changes
+	frpsConfig.Annotations[annotationKeyEndpointPodConfigHash] = frpsConfigHash
+
+	if frpsConfigExisted {
+		if err := r.Update(ctx, frpsConfig); err != nil {
+			logger.Error(err, "update secret failed")
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("updated secret: %s", frpsConfig.Name))
+	} else {
+		if err := r.Create(ctx, frpsConfig); err != nil {
+			logger.Error(err, "create secret failed")
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("created secret: %s", frpsConfig.Name))
+	}
+
+	return frpsConfig, nil
+}
+
+func (r *ServerEndpointReconciler) generateFrpsConfig(
+	ctx context.Context,
+	serverEndpoint *frpv1.ServerEndpoint,
+) (*frpconfig.FrpsConfig, error) {
+	config := &frpconfig.FrpsConfig{
+		Common: &frpconfig.ServerConfigCommon{
+			BindAddr:       "0.0.0.0",
+			BindPort:       int(serverEndpoint.Spec.BindPort),
+			VhostHTTPPort:  int(serverEndpoint.Spec.VhostHTTPPort),
+			VhostHTTPSPort: int(serverEndpoint.Spec.VhostHTTPSPort),
+			SubdomainHost:  serverEndpoint.Spec.SubdomainHost,
+			AllowPorts:     serverEndpoint.Spec.AllowedPorts,
+		},
+	}
+
+	if serverEndpoint.Spec.TokenSecretRef != nil {
+		var err error
+		config.Common.Token, err = getSecretKeyValue(
+			ctx, r.Client, serverEndpoint.Namespace, serverEndpoint.Spec.TokenSecretRef,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if dashboard := serverEndpoint.Spec.Dashboard; dashboard != nil {
+		config.Common.DashboardAddr = "0.0.0.0"
+		config.Common.DashboardPort = int(dashboard.Port)
+		if dashboard.CredentialsSecretRef != nil {
+			var err error
+			config.Common.DashboardUser, err = getSecretKeyValue(ctx, r.Client, serverEndpoint.Namespace, &corev1.SecretKeySelector{
+				LocalObjectReference: *dashboard.CredentialsSecretRef,
+				Key:                  corev1.BasicAuthUsernameKey,
+			})
+			if err != nil {
+				return nil, err
+			}
+			config.Common.DashboardPwd, err = getSecretKeyValue(ctx, r.Client, serverEndpoint.Namespace, &corev1.SecretKeySelector{
+				LocalObjectReference: *dashboard.CredentialsSecretRef,
+				Key:                  corev1.BasicAuthPasswordKey,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return config, nil
+}
+
+func (r *ServerEndpointReconciler) ensureServerEndpointDeployment(
+	ctx context.Context,
+	logger logr.Logger,
+	serverEndpoint *frpv1.ServerEndpoint,
+	frpsConfig *corev1.Secret,
+) (*appsv1.Deployment, error) {
+	var (
+		deploymentList    appsv1.DeploymentList
+		deployment        *appsv1.Deployment
+		deploymentExisted bool
+	)
+	err := r.List(
+		ctx, &deploymentList,
+		client.InNamespace(serverEndpoint.Namespace),
+		client.MatchingFields{serverEndpointOwnerKey: serverEndpoint.Name},
+	)
+	if err != nil {
+		logger.Error(err, "list server endpoint deployments failed")
+		return nil, err
+	}
+	if len(deploymentList.Items) == 0 {
+		logger.Info("no server endpoint deployment found, will create")
+		deploymentExisted = false
+		deployment = &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{
+					labelKeyServerEndpointName: serverEndpoint.Name,
+				},
+				GenerateName: fmt.Sprintf("%s-frps-", serverEndpoint.Name),
+				Namespace:    serverEndpoint.Namespace,
+			},
+			Spec: appsv1.DeploymentSpec{
+				// NOTE: selector is immutable, so we only set it on creation
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						labelKeyServerEndpointName: serverEndpoint.Name,
+					},
+				},
+			},
+		}
+		err := ctrl.SetControllerReference(serverEndpoint, deployment, r.Scheme)
+		if err != nil {
+			logger.Error(err, "set controller reference failed")
+			return nil, err
+		}
+	} else {
+		deploymentExisted = true
+		deployment = &deploymentList.Items[0]
+		logger.Info(fmt.Sprintf(
+			"found %d deployments, using %s",
+			len(deploymentList.Items),
+			deployment.Name),
+		)
+	}
+
+	// NOTE: frps keeps the proxies in memory, only one replica can serve the clients
+	replicas := int32(1)
+	deployment.Spec.Replicas = &replicas
+	deployment.Spec.Strategy = appsv1.DeploymentStrategy{
+		Type: appsv1.RecreateDeploymentStrategyType,
+	}
+	deployment.Spec.Template = buildServerEndpointPodTemplate(serverEndpoint, frpsConfig, r.serverEndpointImage(serverEndpoint))
+
+	// NOTE: the defaults filled by the api server are excluded by hashing the managed fields
+	specHash, err := endpointDeploymentSpecHash(&deployment.Spec)
+	if err != nil {
+		logger.Error(err, "hash deployment spec failed")
+		return nil, err
+	}
+	if deploymentExisted && deployment.Annotations[annotationKeyEndpointDeploymentSpecHash] == specHash {
+		return deployment, nil
+	}
+	if deployment.Annotations == nil {
+		deployment.Annotations = map[string]string{}
+	}
+	deployment.Annotations[annotationKeyEndpointDeploymentSpecHash] = specHash
+
+	if deploymentExisted {
+		if err := r.Update(ctx, deployment); err != nil {
+			logger.Error(err, "update deployment failed")
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("updated deployment: %s", deployment.Name))
+	} else {
+		if err := r.Create(ctx, deployment); err != nil {
+			logger.Error(err, "create deployment failed")
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("created deployment: %s", deployment.Name))
+	}
+
+	return deployment, nil
+}
+
+// serverEndpointImage returns the frps image of the server endpoint.
+func (r *ServerEndpointReconciler) serverEndpointImage(serverEndpoint *frpv1.ServerEndpoint) string {
+	if serverEndpoint.Spec.Image != "" {
+		return serverEndpoint.Spec.Image
+	}
+	if r.DefaultImage != "" {
+		return r.DefaultImage
+	}
+	return frpDockerImage
+}
+
+func buildServerEndpointPodTemplate(
+	serverEndpoint *frpv1.ServerEndpoint,
+	frpsConfig *corev1.Secret,
+	image string,
+) corev1.PodTemplateSpec {
+	const (
+		frpsConfigVolumeName = "frps-config"
+	)
+
+	var containerPorts []corev1.ContainerPort
+	for _, port := range serverEndpointServicePorts(serverEndpoint) {
+		containerPorts = append(containerPorts, corev1.ContainerPort{
+			Name:          port.Name,
+			ContainerPort: port.Port,
+			Protocol:      port.Protocol,
+		})
+	}
+
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				labelKeyServerEndpointName: serverEndpoint.Name,
+			},
+			Annotations: map[string]string{
+				annotationKeyEndpointPodConfigHash: frpsConfig.Annotations[annotationKeyEndpointPodConfigHash],
+			},
+		},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				{
+					Name: frpsConfigVolumeName,
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName: frpsConfig.Name,
+							Items: []corev1.KeyToPath{
+								{
+									Key:  frpsFileName,
+									Path: frpsFileName,
+								},
+							},
+						},
+					},
+				},
+			},
+			Containers: []corev1.Container{
+				{
+					Name:    frpsContainerName,
+					Image:   image,
+					Command: []string{"/opt/frp/frps"},
+					Args:    []string{"-c", "/config/frps.ini"},
+					Ports:   containerPorts,
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{
+							TCPSocket: &corev1.TCPSocketAction{
+								Port: intstr.FromInt(int(serverEndpoint.Spec.BindPort)),
+							},
+						},
+						PeriodSeconds: 5,
+					},
+					VolumeMounts: []corev1.VolumeMount{
+						{
+							Name:      frpsConfigVolumeName,
+							ReadOnly:  true,
+							MountPath: "/config",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// serverEndpointServicePorts lists the ports served by frps.
+func serverEndpointServicePorts(serverEndpoint *frpv1.ServerEndpoint) []corev1.ServicePort {
+	newPort := func(name string, protocol corev1.Protocol, port int32) corev1.ServicePort {
+		return corev1.ServicePort{
+			Name:       name,
+			Protocol:   protocol,
+			Port:       port,
+			TargetPort: intstr.FromInt(int(port)),
+		}
+	}
+
+	ports := []corev1.ServicePort{
+		newPort("bind", corev1.ProtocolTCP, serverEndpoint.Spec.BindPort),
+	}
+	if serverEndpoint.Spec.VhostHTTPPort != 0 {
+		ports = append(ports, newPort("vhost-http", corev1.ProtocolTCP, serverEndpoint.Spec.VhostHTTPPort))
+	}
+	if serverEndpoint.Spec.VhostHTTPSPort != 0 {
+		ports = append(ports, newPort("vhost-https", corev1.ProtocolTCP, serverEndpoint.Spec.VhostHTTPSPort))
+	}
+	if serverEndpoint.Spec.Dashboard != nil {
+		ports = append(ports, newPort("dashboard", corev1.ProtocolTCP, serverEndpoint.Spec.Dashboard.Port))
+	}
+
+	// NOTE: invalid or too many allowed ports are rejected by the validation
+	ranges, _ := portalloc.ParseRanges(serverEndpoint.Spec.AllowedPorts)
+	for _, portRange := range ranges {
+		for port := portRange.From; port <= portRange.To; port++ {
+			// NOTE: the allowed ports are shared by the TCP and UDP proxies
+			ports = append(ports,
+				newPort(fmt.Sprintf("tcp-%d", port), corev1.ProtocolTCP, port),
+				newPort(fmt.Sprintf("udp-%d", port), corev1.ProtocolUDP, port),
+			)
+		}
+	}
+
+	return ports
+}
+
+func (r *ServerEndpointReconciler) ensureServerEndpointService(
+	ctx context.Context,
+	logger logr.Logger,
+	serverEndpoint *frpv1.ServerEndpoint,
+) (*corev1.Service, error) {
+	var kserviceList corev1.ServiceList
+	err := r.List(
+		ctx, &kserviceList,
+		client.InNamespace(serverEndpoint.Namespace),
+		client.MatchingFields{serverEndpointOwnerKey: serverEndpoint.Name},
+	)
+	if err != nil {
+		logger.Error(err, "list services failed")
+		return nil, err
+	}
+
+	var (
+		kservice       *corev1.Service
+		kserviceBefore *corev1.Service
+	)
+	if len(kserviceList.Items) > 0 {
+		kservice = &kserviceList.Items[0]
+		kserviceBefore = kservice.DeepCopy()
+	} else {
+		kservice = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: fmt.Sprintf("%s-frps-", serverEndpoint.Name),
+				Namespace:    serverEndpoint.Namespace,
+			},
+		}
+		err := ctrl.SetControllerReference(serverEndpoint, kservice, r.Scheme)
+		if err != nil {
+			logger.Error(err, "set controller reference failed")
+			return nil, err
+		}
+	}
+
+	if len(serverEndpoint.Spec.ServiceLabels) > 0 {
+		// NOTE: reset all previous labels
+		kservice.Labels = map[string]string{}
+		for k, v := range serverEndpoint.Spec.ServiceLabels {
+			kservice.Labels[k] = v
+		}
+	}
+	if len(serverEndpoint.Spec.ServiceAnnotations) > 0 {
+		if kservice.Annotations == nil {
+			kservice.Annotations = map[string]string{}
+		}
+		for k, v := range serverEndpoint.Spec.ServiceAnnotations {
+			kservice.Annotations[k] = v
+		}
+	}
+	kservice.Spec.Type = serverEndpoint.Spec.ServiceType
+	kservice.Spec.Selector = map[string]string{
+		labelKeyServerEndpointName: serverEndpoint.Name,
+	}
+	// NOTE: keep the allocated node ports
+	nodePorts := map[string]int32{}
+	for _, port := range kservice.Spec.Ports {
+		nodePorts[port.Name] = port.NodePort
+	}
+	kservice.Spec.Ports = nil
+	for _, port := range serverEndpointServicePorts(serverEndpoint) {
+		if serverEndpoint.Spec.ServiceType != corev1.ServiceTypeClusterIP {
+			port.NodePort = nodePorts[port.Name]
+		}
+		kservice.Spec.Ports = append(kservice.Spec.Ports, port)
+	}
+
+	if kserviceBefore != nil && apiequality.Semantic.DeepEqual(kserviceBefore, kservice) {
+		return kservice, nil
+	}
+	if kservice.Name != "" {
+		if err := r.Update(ctx, kservice); err != nil {
+			logger.Error(err, fmt.Sprintf("update corev1.service %s failed", kservice.Name))
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("updated corev1.service: %s", kservice.Name))
+	} else {
+		if err := r.Create(ctx, kservice); err != nil {
+			logger.Error(err, "create corev1.Service failed")
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("created corev1.service: %s", kservice.Name))
+	}
+
+	return kservice, nil
+}
+
+// serverEndpointServiceAddr returns the public address of the frps service.
+func serverEndpointServiceAddr(kservice *corev1.Service) string {
+	if kservice.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return kservice.Spec.ClusterIP
+	}
+	for _, ingress := range kservice.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			return ingress.IP
+		}
+		if ingress.Hostname != "" {
+			return ingress.Hostname
+		}
+	}
+	return ""
+}
+
+// ensureServerEndpointClientEndpoint creates or updates the Endpoint connecting to the frps.
+// Returns the name of the Endpoint, or empty if not specified.
+func (r *ServerEndpointReconciler) ensureServerEndpointClientEndpoint(
+	ctx context.Context,
+	logger logr.Logger,
+	serverEndpoint *frpv1.ServerEndpoint,
+	kservice *corev1.Service,
+) (string, error) {
+	var endpointList frpv1.EndpointList
+	err := r.List(
+		ctx, &endpointList,
+		client.InNamespace(serverEndpoint.Namespace),
+		client.MatchingFields{serverEndpointOwnerKey: serverEndpoint.Name},
+	)
+	if err != nil {
+		logger.Error(err, "list endpoints failed")
+		return "", err
+	}
+
+	clientEndpoint := serverEndpoint.Spec.ClientEndpoint
+	var endpoint *frpv1.Endpoint
+	for i := range endpointList.Items {
+		if clientEndpoint != nil && endpointList.Items[i].Name == clientEndpoint.Name {
+			endpoint = &endpointList.Items[i]
+			continue
+		}
+		// NOTE: the endpoint is removed from spec or renamed
+		if err := r.Delete(ctx, &endpointList.Items[i]); err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, fmt.Sprintf("delete endpoint %s failed", endpointList.Items[i].Name))
+			return "", err
+		}
+		logger.Info(fmt.Sprintf("deleted endpoint %s", endpointList.Items[i].Name))
+	}
+	if clientEndpoint == nil {
+		return "", nil
+	}
+
+	endpointExisted := endpoint != nil
+	if !endpointExisted {
+		endpoint = &frpv1.Endpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      clientEndpoint.Name,
+				Namespace: serverEndpoint.Namespace,
+			},
+		}
+		err := ctrl.SetControllerReference(serverEndpoint, endpoint, r.Scheme)
+		if err != nil {
+			logger.Error(err, "set controller reference failed")
+			return "", err
+		}
+	}
+
+	endpoint.Spec.Addr = clientEndpoint.Addr
+	if endpoint.Spec.Addr == "" {
+		endpoint.Spec.Addr = fmt.Sprintf("%s.%s.svc", kservice.Name, kservice.Namespace)
+	}
+	endpoint.Spec.Port = serverEndpoint.Spec.BindPort
+	endpoint.Spec.TokenSecretRef = serverEndpoint.Spec.TokenSecretRef.DeepCopy()
+	endpoint.Spec.AllowedPorts = serverEndpoint.Spec.AllowedPorts
+
+	if endpointExisted {
+		if err := r.Update(ctx, endpoint); err != nil {
+			logger.Error(err, fmt.Sprintf("update endpoint %s failed", endpoint.Name))
+			return "", err
+		}
+		logger.Info(fmt.Sprintf("updated endpoint: %s", endpoint.Name))
+	} else {
+		// NOTE: creating fails if the endpoint exists but not owned by the server endpoint
+		if err := r.Create(ctx, endpoint); err != nil {
+			logger.Error(err, fmt.Sprintf("create endpoint %s failed", endpoint.Name))
+			return "", err
+		}
+		logger.Info(fmt.Sprintf("created endpoint: %s", endpoint.Name))
+	}
+
+	return endpoint.Name, nil
+}
+
+// setServerEndpointPodConditions sets the ServerPodReady condition from the frps deployment.
+func setServerEndpointPodConditions(
+	serverEndpoint *frpv1.ServerEndpoint,
+	deployment *appsv1.Deployment,
+	pods []corev1.Pod,
+) {
+	if deployment.Status.AvailableReplicas > 0 {
+		setCondition(
+			&serverEndpoint.Status.Conditions, serverEndpoint.Generation,
+			frpv1.ConditionServerPodReady, metav1.ConditionTrue,
+			reasonPodRunning, fmt.Sprintf("%d frps pod(s) available", deployment.Status.AvailableReplicas),
+		)
+		return
+	}
+
+	var podsNotRunning []string
+	for i := range pods {
+		if pods[i].DeletionTimestamp != nil {
+			continue
+		}
+		podsNotRunning = append(podsNotRunning, describePodNotRunning(&pods[i]))
+	}
+	message := "no frps pod found"
+	if len(podsNotRunning) > 0 {
+		message = strings.Join(podsNotRunning, "; ")
+	}
+	setCondition(
+		&serverEndpoint.Status.Conditions, serverEndpoint.Generation,
+		frpv1.ConditionServerPodReady, metav1.ConditionFalse,
+		reasonPodNotRunning, message,
+	)
+}
+
+// serverEndpointReferencedSecrets lists the names of the secrets referenced by the server endpoint.
+func serverEndpointReferencedSecrets(serverEndpoint *frpv1.ServerEndpoint) []string {
+	var secretNames []string
+	if serverEndpoint.Spec.TokenSecretRef != nil {
+		secretNames = append(secretNames, serverEndpoint.Spec.TokenSecretRef.Name)
+	}
+	if dashboard := serverEndpoint.Spec.Dashboard; dashboard != nil && dashboard.CredentialsSecretRef != nil {
+		secretNames = append(secretNames, dashboard.CredentialsSecretRef.Name)
+	}
+	return secretNames
+}
+
+func (r *ServerEndpointReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	indexOwner := func(obj client.Object) []string {
+		owner := metav1.GetControllerOf(obj)
+		if owner == nil {
+			return nil
+		}
+		if owner.APIVersion != apiGVStr || owner.Kind != KindServerEndpoint {
+			return nil
+		}
+		return []string{owner.Name}
+	}
+	for _, obj := range []client.Object{
+		&corev1.Secret{},
+		&corev1.Service{},
+		&appsv1.Deployment{},
+		&frpv1.Endpoint{},
+	} {
+		if err := mgr.GetFieldIndexer().IndexField(context.Background(), obj, serverEndpointOwnerKey, indexOwner); err != nil {
+			return err
+		}
+	}
+	err := mgr.GetFieldIndexer().IndexField(
+		context.Background(), &frpv1.ServerEndpoint{}, serverEndpointSecretRefKey,
+		func(rawObj client.Object) []string {
+			return serverEndpointReferencedSecrets(rawObj.(*frpv1.ServerEndpoint))
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&frpv1.ServerEndpoint{}).
+		Owns(&corev1.Secret{}).
+		Owns(&corev1.Service{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&frpv1.Endpoint{}).
+		Watches(
+			&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.mapSecretToServerEndpoints),
+		).
+		Watches(
+			&corev1.Pod{},
+			handler.EnqueueRequestsFromMapFunc(r.mapToServerEndpoint),
+		).
+		Complete(r)
+}
+
+// mapSecretToServerEndpoints maps a secret to the server endpoints referencing it.
+func (r *ServerEndpointReconciler) mapSecretToServerEndpoints(ctx context.Context, obj client.Object) []reconcile.Request {
+	var serverEndpointList frpv1.ServerEndpointList
+	err := r.List(
+		context.Background(), &serverEndpointList,
+		client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{serverEndpointSecretRefKey: obj.GetName()},
+	)
+	if err != nil {
+		r.Log.Error(err, "list server endpoints failed", "secret", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, serverEndpoint := range serverEndpointList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{
+				Namespace: serverEndpoint.Namespace,
+				Name:      serverEndpoint.Name,
+			},
+		})
+	}
+	return requests
+}
+
+// mapToServerEndpoint maps an object to the server endpoint it bounds to by the server endpoint label.
+func (r *ServerEndpointReconciler) mapToServerEndpoint(ctx context.Context, obj client.Object) []reconcile.Request {
+	serverEndpointName, exists := obj.GetLabels()[labelKeyServerEndpointName]
+	if !exists || serverEndpointName == "" {
+		return nil
+	}
+
+	return []reconcile.Request{
+		{
+			NamespacedName: client.ObjectKey{
+				Namespace: obj.GetNamespace(),
+				Name:      serverEndpointName,
+			},
+		},
+	}
+}
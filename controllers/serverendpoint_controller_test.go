@@ -0,0 +1,384 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	m "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+var _ = g.Describe("ServerEndpointController", func() {
+	const (
+		resourcePollingTimeout  = "1m"
+		resourcePollingInterval = "2s"
+	)
+
+	var (
+		frpsDeploy    *frpsDeployStatus
+		testNamespace string
+	)
+
+	g.BeforeEach(func(done g.Done) {
+		ctx := context.Background()
+		var err error
+
+		g.By("create test namespace")
+		testNamespace, err = createNamespace(ctx, k8sClient, "frp-test-")
+		m.Expect(err).NotTo(m.HaveOccurred(), "create namespace")
+		log.Log.Info(fmt.Sprintf("created namespace: %s", testNamespace))
+
+		g.By("deploying frps server")
+		frps := frpsSettings{
+			Port:  3333,
+			Token: "supersecret",
+		}
+		frpsDeploy, err = frps.DeployToCluster(ctx, k8sClient, testNamespace)
+		m.Expect(err).NotTo(m.HaveOccurred(), "deploy frps")
+		log.Log.Info(fmt.Sprintf("deployed frps: %s", frpsDeploy))
+
+		close(done)
+	}, 300)
+
+	g.AfterEach(func(done g.Done) {
+		err := deleteNamespace(context.Background(), k8sClient, testNamespace)
+		m.Expect(err).NotTo(m.HaveOccurred(), "delete namespace")
+
+		close(done)
+	}, 300)
+
+	isOwnedBy := func(obj metav1.Object, ownerName string) bool {
+		for _, owner := range obj.GetOwnerReferences() {
+			if owner.Kind == KindServerEndpoint && owner.Name == ownerName {
+				return true
+			}
+		}
+		return false
+	}
+
+	getServerEndpointConfigSecret := func(serverEndpointName string) *corev1.Secret {
+		secretRetrieved := &corev1.Secret{}
+		m.Eventually(func() error {
+			var secretList corev1.SecretList
+			err := k8sClient.List(context.Background(), &secretList, client.InNamespace(testNamespace))
+			if err != nil {
+				return err
+			}
+			for _, secret := range secretList.Items {
+				if isOwnedBy(&secret, serverEndpointName) {
+					*secretRetrieved = secret
+					return nil
+				}
+			}
+			return errors.New("server endpoint secret not found")
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+
+		return secretRetrieved
+	}
+
+	getServerEndpointService := func(serverEndpointName string) *corev1.Service {
+		serviceRetrieved := &corev1.Service{}
+		m.Eventually(func() error {
+			var serviceList corev1.ServiceList
+			err := k8sClient.List(context.Background(), &serviceList, client.InNamespace(testNamespace))
+			if err != nil {
+				return err
+			}
+			for _, service := range serviceList.Items {
+				if isOwnedBy(&service, serverEndpointName) {
+					*serviceRetrieved = service
+					return nil
+				}
+			}
+			return errors.New("server endpoint service not found")
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+
+		return serviceRetrieved
+	}
+
+	getServerEndpoint := func(name string) *frpv1.ServerEndpoint {
+		var serverEndpoint frpv1.ServerEndpoint
+		err := k8sClient.Get(
+			context.Background(),
+			client.ObjectKey{Namespace: testNamespace, Name: name},
+			&serverEndpoint,
+		)
+		m.Expect(err).NotTo(m.HaveOccurred(), "get server endpoint")
+		return &serverEndpoint
+	}
+
+	g.It("should deploy frps", func() {
+		serverEndpoint := getServerEndpoint(frpsDeploy.ServerEndpoint)
+		m.Expect(serverEndpoint.Status.State).To(m.Equal(frpv1.ServerEndpointReady))
+		m.Expect(serverEndpoint.Status.Addr).NotTo(m.BeEmpty())
+
+		g.By("inspecting generated config")
+		secret := getServerEndpointConfigSecret(serverEndpoint.Name)
+		m.Expect(secret.Data).To(m.HaveKey(frpsFileName))
+		frpsFileContent := string(secret.Data[frpsFileName])
+		m.Expect(frpsFileContent).To(m.MatchRegexp(`bind_port\s*=\s*3333`))
+		m.Expect(frpsFileContent).To(m.ContainSubstring(frpsDeploy.Token))
+
+		g.By("inspecting generated service")
+		service := getServerEndpointService(serverEndpoint.Name)
+		m.Expect(service.Name).To(m.Equal(serverEndpoint.Status.ServiceName))
+		m.Expect(service.Spec.Type).To(m.Equal(corev1.ServiceTypeClusterIP))
+		m.Expect(service.Spec.ClusterIP).To(m.Equal(serverEndpoint.Status.Addr))
+		m.Expect(service.Spec.Ports).To(m.HaveLen(1))
+		m.Expect(service.Spec.Ports[0].Port).To(m.Equal(frpsDeploy.Port))
+	})
+
+	g.It("should serve frpc with the endpoint", func() {
+		ctx := context.Background()
+		endpointCreated, err := createEndpoint(ctx, k8sClient, testNamespace, frpsDeploy)
+		m.Expect(err).NotTo(m.HaveOccurred())
+		m.Expect(endpointCreated.Status.State).To(m.Equal(frpv1.EndpointConnected))
+	})
+
+	g.It("should create client endpoint", func() {
+		ctx := context.Background()
+
+		serverEndpoint := getServerEndpoint(frpsDeploy.ServerEndpoint)
+		serverEndpoint.Spec.ClientEndpoint = &frpv1.ServerEndpointClientEndpoint{}
+		err := k8sClient.Update(ctx, serverEndpoint)
+		m.Expect(err).NotTo(m.HaveOccurred(), "update server endpoint")
+
+		m.Eventually(func() error {
+			serverEndpoint := getServerEndpoint(frpsDeploy.ServerEndpoint)
+			if serverEndpoint.Status.EndpointName != serverEndpoint.Name {
+				return fmt.Errorf("unexpected endpoint name: %q", serverEndpoint.Status.EndpointName)
+			}
+			return nil
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+
+		endpoint, err := waitEndpointReady(
+			ctx, k8sClient, testNamespace, serverEndpoint.Name,
+			&retryOption{
+				RetryAttempts: 120,
+				RetryPolling:  time.Duration(1) * time.Second,
+			},
+		)
+		m.Expect(err).NotTo(m.HaveOccurred(), "wait client endpoint ready")
+		m.Expect(isOwnedBy(endpoint, serverEndpoint.Name)).To(m.BeTrue(), "endpoint should be owned by the server endpoint")
+		m.Expect(endpoint.Spec.Port).To(m.Equal(frpsDeploy.Port))
+	})
+
+	g.It("should restart frps on config changes", func() {
+		ctx := context.Background()
+
+		serverEndpoint := getServerEndpoint(frpsDeploy.ServerEndpoint)
+		configHash := getServerEndpointConfigSecret(serverEndpoint.Name).
+			Annotations[annotationKeyEndpointPodConfigHash]
+
+		serverEndpoint.Spec.VhostHTTPPort = 8080
+		err := k8sClient.Update(ctx, serverEndpoint)
+		m.Expect(err).NotTo(m.HaveOccurred(), "update server endpoint")
+
+		m.Eventually(func() error {
+			secret := getServerEndpointConfigSecret(serverEndpoint.Name)
+			newConfigHash := secret.Annotations[annotationKeyEndpointPodConfigHash]
+			if newConfigHash == configHash {
+				return errors.New("config is not updated yet")
+			}
+
+			var deploymentList appsv1.DeploymentList
+			err := k8sClient.List(ctx, &deploymentList, client.InNamespace(testNamespace))
+			if err != nil {
+				return err
+			}
+			for _, deployment := range deploymentList.Items {
+				if !isOwnedBy(&deployment, serverEndpoint.Name) {
+					continue
+				}
+				podConfigHash := deployment.Spec.Template.Annotations[annotationKeyEndpointPodConfigHash]
+				if podConfigHash != newConfigHash {
+					return fmt.Errorf("deployment uses config %s, expected %s", podConfigHash, newConfigHash)
+				}
+				return nil
+			}
+			return errors.New("server endpoint deployment not found")
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+
+		service := getServerEndpointService(serverEndpoint.Name)
+		var servicePorts []int32
+		for _, port := range service.Spec.Ports {
+			servicePorts = append(servicePorts, port.Port)
+		}
+		m.Expect(servicePorts).To(m.ConsistOf(frpsDeploy.Port, int32(8080)))
+	})
+
+	g.It("should reject public dashboard without credentials", func() {
+		ctx := context.Background()
+
+		// NOTE: the webhooks are not served in the test environment, the controller validates the spec
+		serverEndpoint := &frpv1.ServerEndpoint{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:    testNamespace,
+				GenerateName: "frps-public-",
+			},
+			Spec: frpv1.ServerEndpointSpec{
+				BindPort:  7000,
+				Dashboard: &frpv1.ServerEndpointDashboard{Port: 7500},
+			},
+		}
+		err := k8sClient.Create(ctx, serverEndpoint)
+		m.Expect(err).NotTo(m.HaveOccurred(), "create server endpoint")
+
+		m.Eventually(func() error {
+			serverEndpoint := getServerEndpoint(serverEndpoint.Name)
+			condition := frpv1.FindCondition(serverEndpoint.Status.Conditions, frpv1.ConditionConfigGenerated)
+			if condition == nil || condition.Reason != reasonSpecInvalid {
+				return fmt.Errorf("server endpoint is not rejected: %+v", serverEndpoint.Status.Conditions)
+			}
+			return nil
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+
+		var serviceList corev1.ServiceList
+		err = k8sClient.List(ctx, &serviceList, client.InNamespace(testNamespace))
+		m.Expect(err).NotTo(m.HaveOccurred())
+		for _, service := range serviceList.Items {
+			m.Expect(isOwnedBy(&service, serverEndpoint.Name)).To(m.BeFalse(), "service should not be created")
+		}
+	})
+})
+
+func TestServerEndpointServicePorts(t *testing.T) {
+	serverEndpoint := &frpv1.ServerEndpoint{
+		Spec: frpv1.ServerEndpointSpec{
+			BindPort:      7000,
+			VhostHTTPPort: 80,
+			AllowedPorts:  "30000-30001",
+		},
+	}
+
+	var ports []string
+	for _, port := range serverEndpointServicePorts(serverEndpoint) {
+		ports = append(ports, fmt.Sprintf("%s/%s/%d", port.Name, port.Protocol, port.Port))
+	}
+	expected := []string{
+		"bind/TCP/7000",
+		"vhost-http/TCP/80",
+		"tcp-30000/TCP/30000",
+		"udp-30000/UDP/30000",
+		"tcp-30001/TCP/30001",
+		"udp-30001/UDP/30001",
+	}
+	if !reflect.DeepEqual(ports, expected) {
+		t.Errorf("expected ports %v, got %v", expected, ports)
+	}
+}
+
+func TestServerEndpointReconciler_Image(t *testing.T) {
+	cases := []struct {
+		specImage     string
+		defaultImage  string
+		expectedImage string
+	}{
+		{expectedImage: frpDockerImage},
+		{defaultImage: "frps:default", expectedImage: "frps:default"},
+		{specImage: "frps:spec", defaultImage: "frps:default", expectedImage: "frps:spec"},
+	}
+
+	for _, c := range cases {
+		r := &ServerEndpointReconciler{DefaultImage: c.defaultImage}
+		serverEndpoint := &frpv1.ServerEndpoint{Spec: frpv1.ServerEndpointSpec{Image: c.specImage}}
+		image := r.serverEndpointImage(serverEndpoint)
+		if image != c.expectedImage {
+			t.Errorf("spec image %q, default image %q: expected %q, got %q",
+				c.specImage, c.defaultImage, c.expectedImage, image)
+		}
+	}
+}
+
+func TestServerEndpointReconciler_UpdateOnDrift(t *testing.T) {
+	ctx := context.Background()
+	serverEndpoint := &frpv1.ServerEndpoint{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "frps", UID: "frps-uid"},
+		Spec: frpv1.ServerEndpointSpec{
+			BindPort:     7000,
+			AllowedPorts: "30000",
+			ServiceType:  corev1.ServiceTypeClusterIP,
+		},
+	}
+	indexOwner := func(obj client.Object) []string {
+		owner := metav1.GetControllerOf(obj)
+		if owner == nil || owner.Kind != KindServerEndpoint {
+			return nil
+		}
+		return []string{owner.Name}
+	}
+	scheme := newIngressTestScheme(t)
+	r := &ServerEndpointReconciler{
+		Log:    log.Log,
+		Scheme: scheme,
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(serverEndpoint).
+			WithIndex(&corev1.Secret{}, serverEndpointOwnerKey, indexOwner).
+			WithIndex(&corev1.Service{}, serverEndpointOwnerKey, indexOwner).
+			WithIndex(&appsv1.Deployment{}, serverEndpointOwnerKey, indexOwner).
+			Build(),
+	}
+
+	ensure := func() (*corev1.Secret, *appsv1.Deployment, *corev1.Service) {
+		frpsConfig, err := r.ensureServerEndpointConfigSecret(ctx, log.Log, serverEndpoint)
+		if err != nil {
+			t.Fatalf("ensure config secret: %v", err)
+		}
+		deployment, err := r.ensureServerEndpointDeployment(ctx, log.Log, serverEndpoint, frpsConfig)
+		if err != nil {
+			t.Fatalf("ensure deployment: %v", err)
+		}
+		kservice, err := r.ensureServerEndpointService(ctx, log.Log, serverEndpoint)
+		if err != nil {
+			t.Fatalf("ensure service: %v", err)
+		}
+		return frpsConfig, deployment, kservice
+	}
+
+	frpsConfig, deployment, kservice := ensure()
+
+	// NOTE: the objects are kept as is without drift
+	frpsConfig2, deployment2, kservice2 := ensure()
+	if frpsConfig2.ResourceVersion != frpsConfig.ResourceVersion {
+		t.Errorf("expected config secret not updated, resource version %s -> %s",
+			frpsConfig.ResourceVersion, frpsConfig2.ResourceVersion)
+	}
+	if deployment2.ResourceVersion != deployment.ResourceVersion {
+		t.Errorf("expected deployment not updated, resource version %s -> %s",
+			deployment.ResourceVersion, deployment2.ResourceVersion)
+	}
+	if kservice2.ResourceVersion != kservice.ResourceVersion {
+		t.Errorf("expected service not updated, resource version %s -> %s",
+			kservice.ResourceVersion, kservice2.ResourceVersion)
+	}
+
+	// NOTE: the image and the allowed ports drift the deployment and the service
+	serverEndpoint.Spec.Image = "frps:custom"
+	serverEndpoint.Spec.AllowedPorts = "30000-30001"
+	_, deployment3, kservice3 := ensure()
+	if deployment3.ResourceVersion == deployment.ResourceVersion {
+		t.Errorf("expected deployment updated")
+	}
+	if image := deployment3.Spec.Template.Spec.Containers[0].Image; image != "frps:custom" {
+		t.Errorf("expected image frps:custom, got %s", image)
+	}
+	if kservice3.ResourceVersion == kservice.ResourceVersion {
+		t.Errorf("expected service updated")
+	}
+	if len(kservice3.Spec.Ports) != 5 {
+		t.Errorf("expected 5 service ports, got %d", len(kservice3.Spec.Ports))
+	}
+}
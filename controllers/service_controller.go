@@ -2,22 +2,37 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/b4fun/frpcontroller/pkg/frpcadmin"
 
 	frpv1 "github.com/b4fun/frpcontroller/api/v1"
 )
 
 const (
-	serviceOwnerKey = ".metadata.controller"
+	serviceOwnerKey     = ".metadata.controller"
+	serviceSecretRefKey = ".spec.ports.secretRefs"
+
+	// serviceUnregisterTimeout specifies the duration to retry unregistering the proxies
+	// of the deleting service, the finalizer is removed after the timeout.
+	serviceUnregisterTimeout = 2 * time.Minute
 )
 
 // ServiceReconciler reconciles a Service object
@@ -25,6 +40,16 @@ type ServiceReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// Recorder records the warning events of the services, events are skipped if not set.
+	Recorder record.EventRecorder
+	// Endpoints regenerates and reloads the frpc config of the endpoints when services are deleted.
+	Endpoints *EndpointReconciler
+	// ClusterEndpoints regenerates and reloads the frpc config of the cluster endpoints when services are deleted.
+	ClusterEndpoints *ClusterEndpointReconciler
+
+	// proxyProtocolWarnings remembers the ports warned for each service without PROXY protocol declared,
+	// so the warning is recorded once per port set instead of on every reconcile.
+	proxyProtocolWarnings sync.Map
 }
 
 // +kubebuilder:rbac:groups=frp.go.build4.fun,resources=services,verbs=get;list;watch;create;update;patch;delete
@@ -33,19 +58,25 @@ type ServiceReconciler struct {
 // Marking rbac settings for corev1 resources
 // +kubebuilder:rbac:groups=core,resources=services,verbs=create;delete;get;list;patch;update;watch
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=create;delete;get;list;patch;update;watch
+// +kubebuilder:rbac:groups=core,resources=pods/log,verbs=get
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=create;delete;get;list;patch;update;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=create;delete;get;list;patch;update;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=create;delete;get;list;patch;update;watch
 
-func (r *ServiceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	ctx := context.Background()
+func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := r.Log.WithValues("service", req.NamespacedName)
 
 	var service frpv1.Service
 	err := r.Get(ctx, req.NamespacedName, &service)
 	switch {
+	case err == nil && service.DeletionTimestamp != nil:
+		return r.handleDeleted(ctx, logger, &service)
 	case err == nil:
 		return r.handleCreateOrUpdate(ctx, logger, &service)
 	case apierrors.IsNotFound(err):
-		return r.handleDeleted(ctx, logger, &service)
+		// NOTE: the service has been cleaned up before removing the finalizer
+		return ctrl.Result{}, nil
 	default:
 		logger.Error(err, "get service failed")
 
@@ -58,18 +89,26 @@ func (r *ServiceReconciler) handleCreateOrUpdate(
 	logger logr.Logger,
 	service *frpv1.Service,
 ) (ctrl.Result, error) {
-	endpointName := client.ObjectKey{
-		Name:      service.Spec.Endpoint,
-		Namespace: service.Namespace,
+	// NOTE: the defaulting webhook might be disabled
+	service.Default()
+
+	endpointRef := service.GetEndpointRef()
+	endpointLabelKey, staleLabelKey := labelKeyEndpointName, labelKeyClusterEndpointName
+	if endpointRef.Kind == frpv1.EndpointKindClusterEndpoint {
+		endpointLabelKey, staleLabelKey = labelKeyClusterEndpointName, labelKeyEndpointName
 	}
 
 	if service.Labels == nil {
 		service.Labels = map[string]string{}
 	}
-	if v, exists := service.Labels[labelKeyEndpointName]; !exists || v != endpointName.Name {
-		service.Labels[labelKeyEndpointName] = endpointName.Name
+	_, staleLabelExists := service.Labels[staleLabelKey]
+	if v, exists := service.Labels[endpointLabelKey]; !exists || v != endpointRef.Name || staleLabelExists ||
+		!hasFinalizer(service, finalizerService) {
+		service.Labels[endpointLabelKey] = endpointRef.Name
+		delete(service.Labels, staleLabelKey)
+		controllerutil.AddFinalizer(service, finalizerService)
 		if err := r.Update(ctx, service); err != nil {
-			logger.Error(err, "update labels failed")
+			logger.Error(err, "update labels and finalizers failed")
 			return ctrl.Result{}, err
 		}
 	}
@@ -87,12 +126,15 @@ func (r *ServiceReconciler) handleCreateOrUpdate(
 		logger.Error(err, "list services failed")
 		return ctrl.Result{}, err
 	}
+	kservicePorts := serviceCorev1Ports(service)
 	for _, kservice := range kserviceList.Items {
-		kservice.Spec.Selector = service.Spec.Selector
-		kservice.Spec.Ports = nil
-		for _, port := range service.Spec.Ports {
-			kservice.Spec.Ports = append(kservice.Spec.Ports, port.ToCorev1ServicePort())
+		if len(kservicePorts) == 0 {
+			// NOTE: a service requires at least one port, wait for the allocation
+			kserviceBound = &kservice
+			break
 		}
+		kservice.Spec.Selector = service.Spec.Selector
+		kservice.Spec.Ports = kservicePorts
 		if len(service.Spec.ServiceLabels) > 0 {
 			// NOTE: reset all previous labels
 			kservice.Labels = map[string]string{}
@@ -100,6 +142,7 @@ func (r *ServiceReconciler) handleCreateOrUpdate(
 				kservice.Labels[k] = v
 			}
 		}
+		setServiceProxyProtocolAnnotation(&kservice, service)
 		err = r.Update(ctx, &kservice)
 		if err != nil {
 			logger.Error(err, fmt.Sprintf("update corev1.service %s failed", service.Name))
@@ -109,11 +152,7 @@ func (r *ServiceReconciler) handleCreateOrUpdate(
 		kserviceBound = &kservice
 	}
 
-	if kserviceBound == nil {
-		var kservicePorts []corev1.ServicePort
-		for _, port := range service.Spec.Ports {
-			kservicePorts = append(kservicePorts, port.ToCorev1ServicePort())
-		}
+	if kserviceBound == nil && len(kservicePorts) > 0 {
 		kserviceBound = &corev1.Service{
 			ObjectMeta: metav1.ObjectMeta{
 				GenerateName: fmt.Sprintf("%s-frpc-", service.Name),
@@ -125,6 +164,7 @@ func (r *ServiceReconciler) handleCreateOrUpdate(
 				Ports:    kservicePorts,
 			},
 		}
+		setServiceProxyProtocolAnnotation(kserviceBound, service)
 		err = ctrl.SetControllerReference(service, kserviceBound, r.Scheme)
 		if err != nil {
 			logger.Error(err, "set controller reference failed")
@@ -137,11 +177,14 @@ func (r *ServiceReconciler) handleCreateOrUpdate(
 		}
 		logger.Info(fmt.Sprintf("created service %s", kserviceBound.Name))
 	}
-	if kserviceBound.Spec.ClusterIP != "" {
+	if kserviceBound == nil {
+		logger.Info("no remote port allocated yet, skipped creating corev1.Service")
+	} else if clusterIP := kserviceBound.Spec.ClusterIP; clusterIP != "" &&
+		service.Annotations[annotationKeyServiceClusterIP] != clusterIP {
 		if service.Annotations == nil {
 			service.Annotations = map[string]string{}
 		}
-		service.Annotations[annotationKeyServiceClusterIP] = kserviceBound.Spec.ClusterIP
+		service.Annotations[annotationKeyServiceClusterIP] = clusterIP
 		err = r.Update(ctx, service)
 		if err != nil {
 			logger.Error(err, "update service failed")
@@ -153,29 +196,64 @@ func (r *ServiceReconciler) handleCreateOrUpdate(
 		))
 	}
 
-	var (
-		endpoint        frpv1.Endpoint
-		serviceNewState frpv1.ServiceState
-	)
-	err = r.Get(ctx, endpointName, &endpoint)
+	r.recordProxyProtocolNotDeclared(service)
+
+	serviceStatus := service.Status.DeepCopy()
+
+	endpoint, err := r.getServiceEndpoint(ctx, service)
 	switch {
 	case err == nil:
 		logger.Info(fmt.Sprintf("found endpoint %s (%s)", endpoint.Name, endpoint.Status.State))
-		serviceNewState = frpv1.ServiceStateInactive
-		if endpoint.Status.State == frpv1.EndpointConnected {
-			serviceNewState = frpv1.ServiceStateActive
+		// NOTE: the service is served by the endpoint frpc
+		for _, conditionType := range endpointConditionTypes {
+			if conditionType == frpv1.ConditionProxiesRegistered {
+				// NOTE: proxies of the service are reported separately
+				continue
+			}
+			condition := frpv1.FindCondition(endpoint.Status.Conditions, conditionType)
+			if condition == nil {
+				continue
+			}
+			setCondition(
+				&service.Status.Conditions, service.Generation,
+				conditionType, condition.Status,
+				condition.Reason, condition.Message,
+			)
 		}
-	case apierrors.IsNotFound(err):
-		logger.Info(fmt.Sprintf("endpoint %s does not exist, try later", endpointName.Name))
+		service.Status.State = frpv1.ServiceStateInactive
+		if setServicePortsStatus(service, endpoint) {
+			service.Status.State = frpv1.ServiceStateActive
+		}
+	case apierrors.IsNotFound(err) || err == errNamespaceNotAllowed:
+		reason := reasonEndpointNotFound
+		message := fmt.Sprintf("%s %s not found, the service is orphaned", endpointRef.Kind, endpointRef.Name)
+		if err == errNamespaceNotAllowed {
+			reason = reasonNamespaceNotAllowed
+			message = fmt.Sprintf(
+				"namespace %s is not allowed by %s %s",
+				service.Namespace, endpointRef.Kind, endpointRef.Name,
+			)
+		}
+		logger.Info(message)
 
-		serviceNewState = frpv1.ServiceStateInactive
+		service.Status.State = frpv1.ServiceStateInactive
+		for _, conditionType := range append(endpointConditionTypes, frpv1.ConditionRemotePortsAllocated) {
+			setCondition(
+				&service.Status.Conditions, service.Generation,
+				conditionType, metav1.ConditionFalse,
+				reason, message,
+			)
+		}
+		for i := range service.Status.Ports {
+			service.Status.Ports[i].State = frpv1.ServicePortStateUnknown
+		}
 	default:
 		logger.Error(err, "get endpoint failed")
 		return ctrl.Result{}, err
 	}
 
-	if serviceNewState != service.Status.State {
-		service.Status.State = serviceNewState
+	service.Status.ObservedGeneration = service.Generation
+	if !apiequality.Semantic.DeepEqual(serviceStatus, &service.Status) {
 		if err := r.Status().Update(ctx, service); err != nil {
 			logger.Error(err, "update service status failed")
 			return ctrl.Result{}, err
@@ -183,17 +261,8 @@ func (r *ServiceReconciler) handleCreateOrUpdate(
 		logger.Info(fmt.Sprintf("updated service status to: %s", service.Status.State))
 	}
 
-	switch service.Status.State {
-	case frpv1.ServiceStateActive:
-		return ctrl.Result{
-			// NOTE: already active, requeue slower
-			RequeueAfter: time.Duration(30) * time.Second,
-		}, nil
-	default:
-		return ctrl.Result{
-			RequeueAfter: time.Duration(10) * time.Second,
-		}, nil
-	}
+	// NOTE: no requeue here, endpoint status changes will trigger the reconcile.
+	return ctrl.Result{}, nil
 }
 
 func (r *ServiceReconciler) handleDeleted(
@@ -201,13 +270,354 @@ func (r *ServiceReconciler) handleDeleted(
 	logger logr.Logger,
 	service *frpv1.Service,
 ) (ctrl.Result, error) {
+	if !hasFinalizer(service, finalizerService) {
+		return ctrl.Result{}, nil
+	}
+
+	endpoint, endpointReconciler, err := r.getServiceEndpointView(ctx, service)
+	switch {
+	case err == nil && endpoint.DeletionTimestamp == nil && endpointReconciler != nil:
+		// NOTE: regenerate and reload the frpc config without the deleting service,
+		//       so the proxies are unregistered before the service is gone.
+		err := endpointReconciler.syncEndpointConfig(ctx, logger, endpoint)
+		switch {
+		case err == nil:
+			logger.Info(fmt.Sprintf("unregistered proxies from endpoint %s", endpoint.Name))
+		case time.Since(service.DeletionTimestamp.Time) < serviceUnregisterTimeout:
+			logger.Error(err, fmt.Sprintf("unregister proxies from endpoint %s failed, will retry", endpoint.Name))
+			return ctrl.Result{}, err
+		default:
+			logger.Error(err, fmt.Sprintf(
+				"unregister proxies from endpoint %s failed in %s, removing finalizer",
+				endpoint.Name, serviceUnregisterTimeout,
+			))
+		}
+	case err == nil || apierrors.IsNotFound(err) || err == errNamespaceNotAllowed:
+		// NOTE: nothing to unregister from a deleted endpoint
+	default:
+		logger.Error(err, "get endpoint failed")
+		return ctrl.Result{}, err
+	}
+
+	controllerutil.RemoveFinalizer(service, finalizerService)
+	if err := r.Update(ctx, service); err != nil {
+		logger.Error(err, "remove finalizer failed")
+		return ctrl.Result{}, err
+	}
+	logger.Info("removed service finalizer")
+	r.proxyProtocolWarnings.Delete(service.UID)
+
 	return ctrl.Result{}, nil
 }
 
+// recordProxyProtocolNotDeclared records a warning event on the service sending PROXY protocol headers
+// without the support declared, unless the same ports have been warned.
+func (r *ServiceReconciler) recordProxyProtocolNotDeclared(service *frpv1.Service) {
+	if r.Recorder == nil {
+		return
+	}
+
+	proxyProtocolPorts := serviceProxyProtocolPorts(service)
+	if proxyProtocolPorts == "" || service.Annotations[annotationKeyServiceProxyProtocolSupported] == "true" {
+		r.proxyProtocolWarnings.Delete(service.UID)
+		return
+	}
+	if previous, recorded := r.proxyProtocolWarnings.Load(service.UID); recorded && previous == proxyProtocolPorts {
+		return
+	}
+	r.proxyProtocolWarnings.Store(service.UID, proxyProtocolPorts)
+	r.Recorder.Eventf(
+		service, corev1.EventTypeWarning, reasonProxyProtocolNotDeclared,
+		"ports %s send PROXY protocol headers, but the workload hasn't declared PROXY protocol support "+
+			"with annotation %s: \"true\"",
+		proxyProtocolPorts, annotationKeyServiceProxyProtocolSupported,
+	)
+}
+
+// errNamespaceNotAllowed tells the service namespace is not allowed by the bound cluster endpoint.
+var errNamespaceNotAllowed = errors.New("namespace is not allowed by the cluster endpoint")
+
+// getServiceEndpoint gets the endpoint bound by the service,
+// cluster endpoints are returned as the endpoint with the same spec & status.
+func (r *ServiceReconciler) getServiceEndpoint(
+	ctx context.Context,
+	service *frpv1.Service,
+) (*frpv1.Endpoint, error) {
+	endpointRef := service.GetEndpointRef()
+	if endpointRef.Kind != frpv1.EndpointKindClusterEndpoint {
+		var endpoint frpv1.Endpoint
+		err := r.Get(ctx, client.ObjectKey{Namespace: service.Namespace, Name: endpointRef.Name}, &endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return &endpoint, nil
+	}
+
+	var clusterEndpoint frpv1.ClusterEndpoint
+	if err := r.Get(ctx, client.ObjectKey{Name: endpointRef.Name}, &clusterEndpoint); err != nil {
+		return nil, err
+	}
+	allowed, err := clusterEndpointAllowsNamespace(ctx, r.Client, &clusterEndpoint, service.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, errNamespaceNotAllowed
+	}
+	return &frpv1.Endpoint{
+		ObjectMeta: clusterEndpoint.ObjectMeta,
+		Spec:       clusterEndpoint.Spec.EndpointSpec,
+		Status:     clusterEndpoint.Status,
+	}, nil
+}
+
+// getServiceEndpointView gets the view of the endpoint bound by the service,
+// along with the reconciler managing the frpc of the endpoint.
+func (r *ServiceReconciler) getServiceEndpointView(
+	ctx context.Context,
+	service *frpv1.Service,
+) (*endpointView, *EndpointReconciler, error) {
+	endpointRef := service.GetEndpointRef()
+	if endpointRef.Kind != frpv1.EndpointKindClusterEndpoint {
+		var endpoint frpv1.Endpoint
+		err := r.Get(ctx, client.ObjectKey{Namespace: service.Namespace, Name: endpointRef.Name}, &endpoint)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newEndpointView(&endpoint), r.Endpoints, nil
+	}
+
+	var clusterEndpoint frpv1.ClusterEndpoint
+	if err := r.Get(ctx, client.ObjectKey{Name: endpointRef.Name}, &clusterEndpoint); err != nil {
+		return nil, nil, err
+	}
+	allowed, err := clusterEndpointAllowsNamespace(ctx, r.Client, &clusterEndpoint, service.Namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !allowed {
+		return nil, nil, errNamespaceNotAllowed
+	}
+	if r.ClusterEndpoints == nil {
+		return newClusterEndpointView(&clusterEndpoint, ""), nil, nil
+	}
+	return newClusterEndpointView(&clusterEndpoint, r.ClusterEndpoints.Namespace),
+		&r.ClusterEndpoints.EndpointReconciler, nil
+}
+
+// setServicePortsStatus sets the ports status and the ProxiesRegistered condition
+// from the proxies reported by the endpoint. Returns true if all proxies of the service are running.
+func setServicePortsStatus(service *frpv1.Service, endpoint *frpv1.Endpoint) bool {
+	endpointConnected := endpoint.Status.State == frpv1.EndpointConnected
+
+	proxies := map[string]frpv1.ProxyStatus{}
+	for _, proxy := range endpoint.Status.Proxies {
+		proxies[proxy.Name] = proxy
+	}
+	previousPorts := map[string]frpv1.ServicePortStatus{}
+	for _, portStatus := range service.Status.Ports {
+		previousPorts[portStatus.Name] = portStatus
+	}
+
+	var (
+		ports           []frpv1.ServicePortStatus
+		proxiesPending  []string
+		proxiesFailed   []string
+		allocationFails []string
+	)
+	for _, port := range service.Spec.Ports {
+		portStatus := frpv1.ServicePortStatus{
+			Name:       port.Name,
+			ProxyName:  serviceProxyName(service, port.Name),
+			RemotePort: port.RemotePort,
+			LastError:  previousPorts[port.Name].LastError,
+		}
+
+		var allocationError string
+		if port.Protocol.HasRemotePort() {
+			allocation := findPortAllocation(endpoint.Status.Allocations, service, port.Name)
+			switch {
+			case allocation == nil:
+				// NOTE: not allocated by the endpoint yet, keep the previous allocation
+				if portStatus.RemotePort == 0 {
+					portStatus.RemotePort = previousPorts[port.Name].RemotePort
+				}
+			case allocation.Error != "":
+				allocationError = allocation.Error
+				allocationFails = append(allocationFails, fmt.Sprintf("%s: %s", port.Name, allocationError))
+			default:
+				portStatus.RemotePort = allocation.RemotePort
+			}
+		}
+
+		proxy, exists := proxies[portStatus.ProxyName]
+		switch {
+		case allocationError != "":
+			portStatus.State = frpv1.ServicePortStateFailed
+			portStatus.LastError = allocationError
+		case !endpointConnected:
+			portStatus.State = frpv1.ServicePortStateUnknown
+		case !exists:
+			portStatus.State = frpv1.ServicePortStatePending
+		case proxy.Status == frpcadmin.ProxyStatusRunning:
+			portStatus.State = frpv1.ServicePortStateRunning
+		case frpcadmin.IsProxyStatusPending(proxy.Status):
+			portStatus.State = frpv1.ServicePortStatePending
+		default:
+			portStatus.State = frpv1.ServicePortStateFailed
+			portStatus.LastError = proxy.Status
+		}
+		if exists && proxy.Error != "" && allocationError == "" {
+			portStatus.LastError = proxy.Error
+		}
+
+		portStatus.RemoteAddr = proxy.RemoteAddr
+		if portStatus.RemoteAddr == "" && port.Protocol.HasRemotePort() && portStatus.RemotePort > 0 {
+			portStatus.RemoteAddr = fmt.Sprintf("%s:%d", endpoint.Spec.Addr, portStatus.RemotePort)
+		}
+
+		switch portStatus.State {
+		case frpv1.ServicePortStatePending:
+			proxiesPending = append(proxiesPending, portStatus.ProxyName)
+		case frpv1.ServicePortStateFailed:
+			proxiesFailed = append(proxiesFailed, fmt.Sprintf(
+				"%s: %s", portStatus.ProxyName, portStatus.LastError,
+			))
+		}
+		ports = append(ports, portStatus)
+	}
+	service.Status.Ports = ports
+
+	if len(allocationFails) > 0 {
+		setCondition(
+			&service.Status.Conditions, service.Generation,
+			frpv1.ConditionRemotePortsAllocated, metav1.ConditionFalse,
+			reasonRemotePortConflict, strings.Join(allocationFails, "; "),
+		)
+	} else {
+		setCondition(
+			&service.Status.Conditions, service.Generation,
+			frpv1.ConditionRemotePortsAllocated, metav1.ConditionTrue,
+			reasonRemotePortsAllocated, "remote ports allocated",
+		)
+	}
+
+	switch {
+	case !endpointConnected:
+		setCondition(
+			&service.Status.Conditions, service.Generation,
+			frpv1.ConditionProxiesRegistered, metav1.ConditionFalse,
+			reasonNotLoggedIn, fmt.Sprintf("endpoint %s is not connected", endpoint.Name),
+		)
+		return false
+	case len(proxiesFailed) > 0:
+		setCondition(
+			&service.Status.Conditions, service.Generation,
+			frpv1.ConditionProxiesRegistered, metav1.ConditionFalse,
+			reasonProxiesFailed, strings.Join(proxiesFailed, "; "),
+		)
+		return false
+	case len(proxiesPending) > 0:
+		setCondition(
+			&service.Status.Conditions, service.Generation,
+			frpv1.ConditionProxiesRegistered, metav1.ConditionUnknown,
+			reasonProxiesPending, fmt.Sprintf("proxies starting: %s", strings.Join(proxiesPending, ", ")),
+		)
+		return false
+	default:
+		setCondition(
+			&service.Status.Conditions, service.Generation,
+			frpv1.ConditionProxiesRegistered, metav1.ConditionTrue,
+			reasonProxiesRunning, fmt.Sprintf("%d proxies running", len(service.Spec.Ports)),
+		)
+		return true
+	}
+}
+
+// serviceCorev1Ports generates the corev1.Service ports of the service.
+// Ports without remote port allocated are skipped.
+func serviceCorev1Ports(service *frpv1.Service) []corev1.ServicePort {
+	allocatedPorts := map[string]int32{}
+	for _, portStatus := range service.Status.Ports {
+		allocatedPorts[portStatus.Name] = portStatus.RemotePort
+	}
+
+	var ports []corev1.ServicePort
+	for _, port := range service.Spec.Ports {
+		if port.RemotePort == 0 {
+			port.RemotePort = allocatedPorts[port.Name]
+		}
+		if port.RemotePort == 0 {
+			continue
+		}
+		ports = append(ports, port.ToCorev1ServicePort())
+	}
+	return ports
+}
+
+// serviceProxyProtocolPorts lists the ports sending PROXY protocol headers, e.g. `web=v2,ssh=v1`.
+func serviceProxyProtocolPorts(service *frpv1.Service) string {
+	var ports []string
+	for _, port := range service.Spec.Ports {
+		if port.ProxyProtocolVersion == "" || !port.Protocol.SupportsProxyProtocol() {
+			continue
+		}
+		ports = append(ports, fmt.Sprintf("%s=%s", port.Name, port.ProxyProtocolVersion))
+	}
+	return strings.Join(ports, ",")
+}
+
+// setServiceProxyProtocolAnnotation annotates the corev1.Service with the ports sending PROXY protocol headers.
+func setServiceProxyProtocolAnnotation(kservice *corev1.Service, service *frpv1.Service) {
+	proxyProtocolPorts := serviceProxyProtocolPorts(service)
+	if proxyProtocolPorts == "" {
+		delete(kservice.Annotations, annotationKeyServiceProxyProtocol)
+		return
+	}
+	if kservice.Annotations == nil {
+		kservice.Annotations = map[string]string{}
+	}
+	kservice.Annotations[annotationKeyServiceProxyProtocol] = proxyProtocolPorts
+}
+
+// serviceProxyName returns the frp proxy name of the service port.
+// Services bound to a cluster endpoint are prefixed with the namespace.
+// NOTE: the parts are joined with `_`, which resource names cannot contain,
+// while the service names might contain `.`.
+func serviceProxyName(service *frpv1.Service, portName string) string {
+	if service.GetEndpointRef().Kind == frpv1.EndpointKindClusterEndpoint {
+		return fmt.Sprintf("%s_%s_%s", service.Namespace, service.Name, portName)
+	}
+	return fmt.Sprintf("%s_%s", service.Name, portName)
+}
+
+// serviceDisplayName returns the name of the service for messages,
+// services bound to a cluster endpoint are prefixed with the namespace.
+func serviceDisplayName(service *frpv1.Service) string {
+	if service.GetEndpointRef().Kind == frpv1.EndpointKindClusterEndpoint {
+		return fmt.Sprintf("%s/%s", service.Namespace, service.Name)
+	}
+	return service.Name
+}
+
+// serviceReferencedSecrets lists the names of the secrets referenced by the service.
+func serviceReferencedSecrets(service *frpv1.Service) []string {
+	var secretNames []string
+	for _, port := range service.Spec.Ports {
+		if port.HTTPAuthSecretRef != nil {
+			secretNames = append(secretNames, port.HTTPAuthSecretRef.Name)
+		}
+		if port.SecretKeyRef != nil {
+			secretNames = append(secretNames, port.SecretKeyRef.Name)
+		}
+	}
+	return secretNames
+}
+
 func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	err := mgr.GetFieldIndexer().IndexField(
-		&corev1.Service{}, serviceOwnerKey,
-		func(rawObj runtime.Object) []string {
+		context.Background(), &corev1.Service{}, serviceOwnerKey,
+		func(rawObj client.Object) []string {
 			kservice := rawObj.(*corev1.Service)
 			owner := metav1.GetControllerOf(kservice)
 			if owner == nil {
@@ -225,5 +635,97 @@ func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&frpv1.Service{}).
+		Owns(&corev1.Service{}).
+		Watches(
+			&frpv1.Endpoint{},
+			handler.EnqueueRequestsFromMapFunc(r.mapEndpointToServices),
+		).
+		Watches(
+			&frpv1.ClusterEndpoint{},
+			handler.EnqueueRequestsFromMapFunc(r.mapClusterEndpointToServices),
+		).
+		Watches(
+			&corev1.Namespace{},
+			handler.EnqueueRequestsFromMapFunc(r.mapNamespaceToServices),
+		).
 		Complete(r)
 }
+
+// mapEndpointToServices maps an endpoint to the services referencing it.
+func (r *ServiceReconciler) mapEndpointToServices(ctx context.Context, obj client.Object) []reconcile.Request {
+	var serviceList frpv1.ServiceList
+	err := r.List(
+		context.Background(), &serviceList,
+		client.InNamespace(obj.GetNamespace()),
+		client.MatchingLabels{
+			labelKeyEndpointName: obj.GetName(),
+		},
+	)
+	if err != nil {
+		r.Log.Error(err, "list services failed", "endpoint", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, service := range serviceList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{
+				Namespace: service.Namespace,
+				Name:      service.Name,
+			},
+		})
+	}
+	return requests
+}
+
+// mapClusterEndpointToServices maps a cluster endpoint to the services referencing it.
+func (r *ServiceReconciler) mapClusterEndpointToServices(ctx context.Context, obj client.Object) []reconcile.Request {
+	var serviceList frpv1.ServiceList
+	err := r.List(
+		context.Background(), &serviceList,
+		client.MatchingLabels{
+			labelKeyClusterEndpointName: obj.GetName(),
+		},
+	)
+	if err != nil {
+		r.Log.Error(err, "list services failed", "clusterendpoint", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, service := range serviceList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{
+				Namespace: service.Namespace,
+				Name:      service.Name,
+			},
+		})
+	}
+	return requests
+}
+
+// mapNamespaceToServices maps a namespace to the services referencing cluster endpoints in it,
+// as the namespace labels might change the namespaces allowed by the cluster endpoints.
+func (r *ServiceReconciler) mapNamespaceToServices(ctx context.Context, obj client.Object) []reconcile.Request {
+	var serviceList frpv1.ServiceList
+	err := r.List(
+		context.Background(), &serviceList,
+		client.InNamespace(obj.GetName()),
+		client.HasLabels{labelKeyClusterEndpointName},
+	)
+	if err != nil {
+		r.Log.Error(err, "list services failed", "namespace", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, service := range serviceList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{
+				Namespace: service.Namespace,
+				Name:      service.Name,
+			},
+		})
+	}
+	return requests
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"testing"
 
 	g "github.com/onsi/ginkgo"
 	m "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
@@ -234,3 +237,49 @@ var _ = g.Describe("ServiceController", func() {
 	})
 
 })
+
+func TestServiceReconciler_RecordProxyProtocolNotDeclared(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &ServiceReconciler{Recorder: recorder}
+	service := &frpv1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", UID: "web-uid"},
+		Spec: frpv1.ServiceSpec{
+			Ports: []frpv1.ServicePort{
+				{Name: "http", Protocol: frpv1.ServicePortTCP, LocalPort: 80, ProxyProtocolVersion: "v2"},
+				{Name: "ssh", Protocol: frpv1.ServicePortTCP, LocalPort: 22},
+			},
+		},
+	}
+	expectEvents := func(expectedPorts ...string) {
+		t.Helper()
+		var events []string
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		if len(events) != len(expectedPorts) {
+			t.Fatalf("unexpected events: %v", events)
+		}
+		for i, ports := range expectedPorts {
+			if !strings.HasPrefix(events[i], "Warning "+reasonProxyProtocolNotDeclared+" ports "+ports+" ") {
+				t.Errorf("unexpected event: %s", events[i])
+			}
+		}
+	}
+
+	r.recordProxyProtocolNotDeclared(service)
+	r.recordProxyProtocolNotDeclared(service)
+	expectEvents("http=v2")
+
+	service.Spec.Ports[1].ProxyProtocolVersion = "v1"
+	r.recordProxyProtocolNotDeclared(service)
+	r.recordProxyProtocolNotDeclared(service)
+	expectEvents("http=v2,ssh=v1")
+
+	service.Annotations = map[string]string{annotationKeyServiceProxyProtocolSupported: "true"}
+	r.recordProxyProtocolNotDeclared(service)
+	expectEvents()
+
+	service.Annotations = nil
+	r.recordProxyProtocolNotDeclared(service)
+	expectEvents("http=v2,ssh=v1")
+}
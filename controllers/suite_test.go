@@ -1,15 +1,21 @@
 package controllers
 
 import (
+	"context"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/envtest/printer"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
 	frpv1 "github.com/b4fun/frpcontroller/api/v1"
 
@@ -28,13 +34,19 @@ import (
 var cfg *rest.Config
 var k8sClient client.Client
 var testEnv *envtest.Environment
+var cancelManager context.CancelFunc
+
+// gatewayAPICRDDirectory returns the directory of the Gateway API CRDs, including the experimental routes.
+func gatewayAPICRDDirectory() string {
+	output, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", "sigs.k8s.io/gateway-api").Output()
+	Expect(err).NotTo(HaveOccurred(), "locate gateway-api module")
+	return filepath.Join(strings.TrimSpace(string(output)), "config", "crd", "experimental")
+}
 
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
 
-	RunSpecsWithDefaultAndCustomReporters(t,
-		"Controller Suite",
-		[]Reporter{printer.NewlineReporter{}})
+	RunSpecs(t, "Controller Suite")
 }
 
 var _ = BeforeSuite(func(done Done) {
@@ -42,7 +54,10 @@ var _ = BeforeSuite(func(done Done) {
 
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
-		CRDDirectoryPaths:        []string{filepath.Join("..", "config", "crd", "bases")},
+		CRDDirectoryPaths: []string{
+			filepath.Join("..", "config", "crd", "bases"),
+			gatewayAPICRDDirectory(),
+		},
 		AttachControlPlaneOutput: true,
 	}
 
@@ -60,6 +75,12 @@ var _ = BeforeSuite(func(done Done) {
 	err = frpv1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = gatewayv1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = gatewayv1alpha2.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	// +kubebuilder:scaffold:scheme
 
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
@@ -67,26 +88,76 @@ var _ = BeforeSuite(func(done Done) {
 	Expect(k8sClient).ToNot(BeNil())
 
 	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
-		Scheme: scheme.Scheme,
-		Port:   9443,
+		Scheme:  scheme.Scheme,
+		Metrics: metricsserver.Options{BindAddress: "0"},
 	})
 	Expect(err).NotTo(HaveOccurred())
 
+	endpointReconciler := &EndpointReconciler{
+		Client:    mgr.GetClient(),
+		Log:       ctrl.Log.WithName("controllers").WithName("Endpoint"),
+		Scheme:    mgr.GetScheme(),
+		Clientset: kubernetes.NewForConfigOrDie(cfg),
+		Recorder:  mgr.GetEventRecorderFor("frpcontroller"),
+		Gateway:   GatewayOptions{Enabled: true},
+	}
+	err = endpointReconciler.SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	clusterEndpointReconciler := &ClusterEndpointReconciler{
+		EndpointReconciler: EndpointReconciler{
+			Client:    mgr.GetClient(),
+			Log:       ctrl.Log.WithName("controllers").WithName("ClusterEndpoint"),
+			Scheme:    mgr.GetScheme(),
+			Clientset: kubernetes.NewForConfigOrDie(cfg),
+		},
+		Namespace: "default",
+	}
+	err = clusterEndpointReconciler.SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
 	err = (&ServiceReconciler{
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("Service"),
+		Scheme:           mgr.GetScheme(),
+		Recorder:         mgr.GetEventRecorderFor("frpcontroller"),
+		Endpoints:        endpointReconciler,
+		ClusterEndpoints: clusterEndpointReconciler,
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&ServerEndpointReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("ServerEndpoint"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&VisitorReconciler{
 		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Service"),
+		Log:    ctrl.Log.WithName("controllers").WithName("Visitor"),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr)
 	Expect(err).NotTo(HaveOccurred())
-	err = (&EndpointReconciler{
+
+	err = (&GatewayClassReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("GatewayClass"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&GatewayReconciler{
 		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Endpoint"),
+		Log:    ctrl.Log.WithName("controllers").WithName("Gateway"),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr)
 	Expect(err).NotTo(HaveOccurred())
 
+	var ctx context.Context
+	ctx, cancelManager = context.WithCancel(ctrl.SetupSignalHandler())
 	go func() {
-		err := mgr.Start(ctrl.SetupSignalHandler())
+		err := mgr.Start(ctx)
 		Expect(err).NotTo(HaveOccurred())
 	}()
 
@@ -95,6 +166,8 @@ var _ = BeforeSuite(func(done Done) {
 
 var _ = AfterSuite(func() {
 	By("tearing down the test environment")
+	// NOTE: stop the manager first, the api server waits for the open watches before stopping
+	cancelManager()
 
 	err := testEnv.Stop()
 	Expect(err).ToNot(HaveOccurred())
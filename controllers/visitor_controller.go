@@ -0,0 +1,303 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+const (
+	visitorOwnerKey     = ".metadata.controller.visitor"
+	visitorSecretRefKey = ".spec.secretKeyRef.name"
+)
+
+// VisitorReconciler reconciles a Visitor object
+type VisitorReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=frp.go.build4.fun,resources=visitors,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=frp.go.build4.fun,resources=visitors/status,verbs=get;update;patch
+
+func (r *VisitorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Log.WithValues("visitor", req.NamespacedName)
+
+	var visitor frpv1.Visitor
+	err := r.Get(ctx, req.NamespacedName, &visitor)
+	switch {
+	case err == nil:
+		return r.handleCreateOrUpdate(ctx, logger, &visitor)
+	case apierrors.IsNotFound(err):
+		return r.handleDeleted(ctx, logger, &visitor)
+	default:
+		logger.Error(err, "get visitor failed")
+
+		return ctrl.Result{}, err
+	}
+}
+
+func (r *VisitorReconciler) handleCreateOrUpdate(
+	ctx context.Context,
+	logger logr.Logger,
+	visitor *frpv1.Visitor,
+) (ctrl.Result, error) {
+	if visitor.Labels == nil {
+		visitor.Labels = map[string]string{}
+	}
+	if v, exists := visitor.Labels[labelKeyEndpointName]; !exists || v != visitor.Spec.Endpoint {
+		visitor.Labels[labelKeyEndpointName] = visitor.Spec.Endpoint
+		if err := r.Update(ctx, visitor); err != nil {
+			logger.Error(err, "update labels failed")
+			return ctrl.Result{}, err
+		}
+	}
+
+	var visitorList frpv1.VisitorList
+	if err := r.List(ctx, &visitorList, client.InNamespace(visitor.Namespace)); err != nil {
+		logger.Error(err, "list visitors failed")
+		return ctrl.Result{}, err
+	}
+	if conflict := visitorPortConflict(visitor, visitorList.Items); conflict != "" {
+		logger.Info(fmt.Sprintf("visitor port conflicts: %s", conflict))
+		return r.handlePortConflict(ctx, logger, visitor, conflict)
+	}
+	statusBefore := visitor.Status.DeepCopy()
+	setCondition(
+		&visitor.Status.Conditions, visitor.Generation,
+		frpv1.ConditionPortAvailable, metav1.ConditionTrue,
+		reasonPortAvailable, fmt.Sprintf("port %d is bound by the endpoint frpc", visitor.Spec.Port),
+	)
+
+	// visitors are served by the endpoint frpc pods
+	kserviceSelector := map[string]string{
+		labelKeyEndpointName: visitor.Spec.Endpoint,
+	}
+	kservicePorts := []corev1.ServicePort{
+		{
+			Name:       "visitor",
+			Protocol:   visitor.Spec.Protocol.ToCorev1Protocol(),
+			Port:       visitor.Spec.Port,
+			TargetPort: intstr.FromInt(int(visitor.Spec.Port)),
+		},
+	}
+
+	var (
+		kserviceList  corev1.ServiceList
+		kserviceBound *corev1.Service
+	)
+	err := r.List(
+		ctx, &kserviceList,
+		client.InNamespace(visitor.Namespace),
+		client.MatchingFields{visitorOwnerKey: visitor.Name},
+	)
+	if err != nil {
+		logger.Error(err, "list services failed")
+		return ctrl.Result{}, err
+	}
+	for _, kservice := range kserviceList.Items {
+		kservice.Spec.Selector = kserviceSelector
+		kservice.Spec.Ports = kservicePorts
+		if len(visitor.Spec.ServiceLabels) > 0 {
+			// NOTE: reset all previous labels
+			kservice.Labels = map[string]string{}
+			for k, v := range visitor.Spec.ServiceLabels {
+				kservice.Labels[k] = v
+			}
+		}
+		err = r.Update(ctx, &kservice)
+		if err != nil {
+			logger.Error(err, fmt.Sprintf("update corev1.service %s failed", kservice.Name))
+			return ctrl.Result{}, err
+		}
+		logger.Info(fmt.Sprintf("updated corev1.service: %s", kservice.Name))
+		kserviceBound = &kservice
+	}
+
+	if kserviceBound == nil {
+		kserviceBound = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: fmt.Sprintf("%s-visitor-", visitor.Name),
+				Namespace:    visitor.Namespace,
+				Labels:       visitor.Spec.ServiceLabels,
+			},
+			Spec: corev1.ServiceSpec{
+				Type:     corev1.ServiceTypeClusterIP,
+				Selector: kserviceSelector,
+				Ports:    kservicePorts,
+			},
+		}
+		err = ctrl.SetControllerReference(visitor, kserviceBound, r.Scheme)
+		if err != nil {
+			logger.Error(err, "set controller reference failed")
+			return ctrl.Result{}, err
+		}
+		err = r.Create(ctx, kserviceBound)
+		if err != nil {
+			logger.Error(err, "create corev1.Service failed")
+			return ctrl.Result{}, err
+		}
+		logger.Info(fmt.Sprintf("created service %s", kserviceBound.Name))
+	}
+
+	visitor.Status.ServiceName = kserviceBound.Name
+	if !apiequality.Semantic.DeepEqual(statusBefore, &visitor.Status) {
+		if err := r.Status().Update(ctx, visitor); err != nil {
+			logger.Error(err, "update visitor status failed")
+			return ctrl.Result{}, err
+		}
+		logger.Info(fmt.Sprintf("updated visitor service to: %s", visitor.Status.ServiceName))
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// handlePortConflict removes the generated services of the visitor, which is not bound by the frpc,
+// and reports the conflict in the PortAvailable condition.
+func (r *VisitorReconciler) handlePortConflict(
+	ctx context.Context,
+	logger logr.Logger,
+	visitor *frpv1.Visitor,
+	conflict string,
+) (ctrl.Result, error) {
+	var kserviceList corev1.ServiceList
+	err := r.List(
+		ctx, &kserviceList,
+		client.InNamespace(visitor.Namespace),
+		client.MatchingFields{visitorOwnerKey: visitor.Name},
+	)
+	if err != nil {
+		logger.Error(err, "list services failed")
+		return ctrl.Result{}, err
+	}
+	for _, kservice := range kserviceList.Items {
+		if err := r.Delete(ctx, &kservice); err != nil && !apierrors.IsNotFound(err) {
+			logger.Error(err, fmt.Sprintf("delete corev1.service %s failed", kservice.Name))
+			return ctrl.Result{}, err
+		}
+		logger.Info(fmt.Sprintf("deleted corev1.service: %s", kservice.Name))
+	}
+
+	statusBefore := visitor.Status.DeepCopy()
+	visitor.Status.ServiceName = ""
+	setCondition(
+		&visitor.Status.Conditions, visitor.Generation,
+		frpv1.ConditionPortAvailable, metav1.ConditionFalse,
+		reasonRemotePortConflict, conflict,
+	)
+	if !apiequality.Semantic.DeepEqual(statusBefore, &visitor.Status) {
+		if err := r.Status().Update(ctx, visitor); err != nil {
+			logger.Error(err, "update visitor status failed")
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *VisitorReconciler) handleDeleted(
+	ctx context.Context,
+	logger logr.Logger,
+	visitor *frpv1.Visitor,
+) (ctrl.Result, error) {
+	return ctrl.Result{}, nil
+}
+
+func (r *VisitorReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	err := mgr.GetFieldIndexer().IndexField(
+		context.Background(), &corev1.Service{}, visitorOwnerKey,
+		func(rawObj client.Object) []string {
+			kservice := rawObj.(*corev1.Service)
+			owner := metav1.GetControllerOf(kservice)
+			if owner == nil {
+				return nil
+			}
+			if owner.APIVersion != apiGVStr || owner.Kind != KindVisitor {
+				return nil
+			}
+			return []string{owner.Name}
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&frpv1.Visitor{}).
+		Owns(&corev1.Service{}).
+		Watches(
+			// NOTE: the port released by a visitor can be taken by the conflicting ones
+			&frpv1.Visitor{},
+			handler.EnqueueRequestsFromMapFunc(r.mapToEndpointVisitors),
+		).
+		Complete(r)
+}
+
+// mapToEndpointVisitors maps a visitor to the other visitors of the same endpoint.
+func (r *VisitorReconciler) mapToEndpointVisitors(ctx context.Context, obj client.Object) []reconcile.Request {
+	visitor, ok := obj.(*frpv1.Visitor)
+	if !ok {
+		return nil
+	}
+
+	var visitorList frpv1.VisitorList
+	if err := r.List(ctx, &visitorList, client.InNamespace(visitor.Namespace)); err != nil {
+		r.Log.Error(err, "list visitors failed", "visitor", visitor.Name)
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, other := range visitorList.Items {
+		if other.Name == visitor.Name || other.Spec.Endpoint != visitor.Spec.Endpoint {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: client.ObjectKey{Namespace: other.Namespace, Name: other.Name},
+		})
+	}
+	return requests
+}
+
+// visitorPortConflict tells why the port of the visitor cannot be bound by the endpoint frpc,
+// returns empty if the port is available. When visitors of the same endpoint declare the same port,
+// the earliest created visitor takes the port.
+func visitorPortConflict(visitor *frpv1.Visitor, visitors []frpv1.Visitor) string {
+	if visitor.Spec.Port == frpcAdminPort {
+		return fmt.Sprintf("port %d is used by the frpc admin api", visitor.Spec.Port)
+	}
+
+	// NOTE: the listed visitors might be stale, use the latest spec of the visitor
+	sameVisitors := []frpv1.Visitor{*visitor}
+	for _, other := range visitors {
+		if other.Name == visitor.Name || other.DeletionTimestamp != nil ||
+			other.Spec.Endpoint != visitor.Spec.Endpoint || other.Spec.Port != visitor.Spec.Port {
+			continue
+		}
+		sameVisitors = append(sameVisitors, other)
+	}
+	sort.SliceStable(sameVisitors, func(i, j int) bool {
+		ti, tj := sameVisitors[i].CreationTimestamp, sameVisitors[j].CreationTimestamp
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return sameVisitors[i].Name < sameVisitors[j].Name
+	})
+	if sameVisitors[0].Name != visitor.Name {
+		return fmt.Sprintf("port %d is used by visitor %s", visitor.Spec.Port, sameVisitors[0].Name)
+	}
+	return ""
+}
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	g "github.com/onsi/ginkgo"
+	m "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	frpv1 "github.com/b4fun/frpcontroller/api/v1"
+)
+
+var _ = g.Describe("VisitorController", func() {
+	const (
+		resourcePollingTimeout  = "30s"
+		resourcePollingInterval = "1s"
+	)
+
+	var testNamespace string
+
+	g.BeforeEach(func(done g.Done) {
+		var err error
+		testNamespace, err = createNamespace(context.Background(), k8sClient, "frp-test-")
+		m.Expect(err).NotTo(m.HaveOccurred(), "create namespace")
+
+		close(done)
+	}, 60)
+
+	g.AfterEach(func(done g.Done) {
+		err := deleteNamespace(context.Background(), k8sClient, testNamespace)
+		m.Expect(err).NotTo(m.HaveOccurred(), "delete namespace")
+
+		close(done)
+	}, 60)
+
+	// NOTE: the visitors are reconciled without the endpoint
+	createVisitor := func(ctx context.Context, name string, port int32) *frpv1.Visitor {
+		visitor := &frpv1.Visitor{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: name},
+			Spec: frpv1.VisitorSpec{
+				Endpoint:   "endpoint",
+				Protocol:   frpv1.VisitorSTCP,
+				ServerName: "db_postgres",
+				SecretKeyRef: corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "sk"},
+					Key:                  "sk",
+				},
+				Port: port,
+			},
+		}
+		m.Expect(k8sClient.Create(ctx, visitor)).To(m.Succeed())
+		return visitor
+	}
+
+	// waitVisitorPortAvailable waits the PortAvailable condition of the visitor to be the given status.
+	waitVisitorPortAvailable := func(name string, status metav1.ConditionStatus) *frpv1.Visitor {
+		var visitor frpv1.Visitor
+		m.Eventually(func() error {
+			err := k8sClient.Get(context.Background(), client.ObjectKey{
+				Namespace: testNamespace,
+				Name:      name,
+			}, &visitor)
+			if err != nil {
+				return err
+			}
+			condition := frpv1.FindCondition(visitor.Status.Conditions, frpv1.ConditionPortAvailable)
+			if condition == nil || condition.Status != status || condition.ObservedGeneration != visitor.Generation {
+				return fmt.Errorf("visitor %s port available condition is not %s yet", name, status)
+			}
+			return nil
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+		return &visitor
+	}
+
+	// waitVisitorServicePort waits the generated service of the visitor to expose the given port.
+	waitVisitorServicePort := func(name string, port int32) {
+		m.Eventually(func() error {
+			visitor := waitVisitorPortAvailable(name, metav1.ConditionTrue)
+			var kservice corev1.Service
+			err := k8sClient.Get(context.Background(), client.ObjectKey{
+				Namespace: testNamespace,
+				Name:      visitor.Status.ServiceName,
+			}, &kservice)
+			if err != nil {
+				return err
+			}
+			if len(kservice.Spec.Ports) != 1 || kservice.Spec.Ports[0].Port != port {
+				return fmt.Errorf("visitor %s service does not expose port %d yet", name, port)
+			}
+			return nil
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+	}
+
+	// listVisitorServices lists the generated services of the visitor.
+	listVisitorServices := func(name string) []corev1.Service {
+		var kserviceList corev1.ServiceList
+		err := k8sClient.List(context.Background(), &kserviceList, client.InNamespace(testNamespace))
+		m.Expect(err).NotTo(m.HaveOccurred())
+		var kservices []corev1.Service
+		for _, kservice := range kserviceList.Items {
+			owner := metav1.GetControllerOf(&kservice)
+			if owner != nil && owner.Kind == KindVisitor && owner.Name == name {
+				kservices = append(kservices, kservice)
+			}
+		}
+		return kservices
+	}
+
+	g.It("should create and update the visitor service", func() {
+		ctx := context.Background()
+
+		visitor := createVisitor(ctx, "db", 5432)
+		waitVisitorServicePort("db", 5432)
+
+		g.By("changing the port")
+		m.Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: testNamespace, Name: "db"}, visitor)).To(m.Succeed())
+		visitor.Spec.Port = 5433
+		m.Expect(k8sClient.Update(ctx, visitor)).To(m.Succeed())
+		waitVisitorServicePort("db", 5433)
+	})
+
+	g.It("should report the port used by the frpc admin api", func() {
+		ctx := context.Background()
+
+		createVisitor(ctx, "admin", frpcAdminPort)
+		visitor := waitVisitorPortAvailable("admin", metav1.ConditionFalse)
+		condition := frpv1.FindCondition(visitor.Status.Conditions, frpv1.ConditionPortAvailable)
+		m.Expect(condition.Reason).To(m.Equal(reasonRemotePortConflict))
+		m.Expect(condition.Message).To(m.ContainSubstring("frpc admin api"))
+		m.Expect(visitor.Status.ServiceName).To(m.BeEmpty())
+		m.Expect(listVisitorServices("admin")).To(m.BeEmpty())
+	})
+
+	g.It("should report the port used by another visitor until it's deleted", func() {
+		ctx := context.Background()
+
+		first := createVisitor(ctx, "db-1", 5432)
+		waitVisitorServicePort("db-1", 5432)
+		// NOTE: creation timestamps are in seconds
+		time.Sleep(time.Second)
+		createVisitor(ctx, "db-2", 5432)
+
+		g.By("reporting the conflict of the later visitor")
+		visitor := waitVisitorPortAvailable("db-2", metav1.ConditionFalse)
+		condition := frpv1.FindCondition(visitor.Status.Conditions, frpv1.ConditionPortAvailable)
+		m.Expect(condition.Reason).To(m.Equal(reasonRemotePortConflict))
+		m.Expect(condition.Message).To(m.ContainSubstring("visitor db-1"))
+		m.Expect(listVisitorServices("db-2")).To(m.BeEmpty())
+		waitVisitorServicePort("db-1", 5432)
+
+		g.By("moving the later visitor into the port")
+		m.Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: testNamespace, Name: "db-2"}, visitor)).To(m.Succeed())
+		visitor.Spec.Port = 5433
+		m.Expect(k8sClient.Update(ctx, visitor)).To(m.Succeed())
+		waitVisitorServicePort("db-2", 5433)
+		m.Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: testNamespace, Name: "db-2"}, visitor)).To(m.Succeed())
+		visitor.Spec.Port = 5432
+		m.Expect(k8sClient.Update(ctx, visitor)).To(m.Succeed())
+		waitVisitorPortAvailable("db-2", metav1.ConditionFalse)
+		m.Eventually(func() []corev1.Service {
+			return listVisitorServices("db-2")
+		}, resourcePollingTimeout, resourcePollingInterval).Should(m.BeEmpty())
+
+		g.By("deleting the earlier visitor")
+		m.Expect(k8sClient.Delete(ctx, first)).To(m.Succeed())
+		m.Eventually(func() error {
+			var visitor frpv1.Visitor
+			err := k8sClient.Get(ctx, client.ObjectKey{Namespace: testNamespace, Name: "db-1"}, &visitor)
+			if err == nil {
+				return errors.New("visitor is not deleted yet")
+			}
+			return client.IgnoreNotFound(err)
+		}, resourcePollingTimeout, resourcePollingInterval).ShouldNot(m.HaveOccurred())
+		waitVisitorServicePort("db-2", 5432)
+	})
+})
+
+func TestVisitorPortConflict(t *testing.T) {
+	newVisitor := func(name string, endpoint string, port int32, createdAt time.Time) frpv1.Visitor {
+		return frpv1.Visitor{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(createdAt),
+			},
+			Spec: frpv1.VisitorSpec{Endpoint: endpoint, Port: port},
+		}
+	}
+	now := time.Now()
+	deleting := newVisitor("deleting", "endpoint", 5432, now.Add(-2*time.Hour))
+	deleting.DeletionTimestamp = &metav1.Time{Time: now}
+	visitors := []frpv1.Visitor{
+		deleting,
+		newVisitor("db-1", "endpoint", 5432, now.Add(-time.Hour)),
+		newVisitor("db-2", "endpoint", 5432, now),
+		newVisitor("db-3", "endpoint", 5432, now),
+		newVisitor("other", "other-endpoint", 5433, now.Add(-time.Hour)),
+		newVisitor("admin", "endpoint", frpcAdminPort, now.Add(-time.Hour)),
+	}
+
+	cases := []struct {
+		visitor          frpv1.Visitor
+		expectedConflict string
+	}{
+		{
+			visitor: visitors[1],
+		},
+		{
+			visitor:          visitors[2],
+			expectedConflict: "port 5432 is used by visitor db-1",
+		},
+		{
+			visitor:          visitors[3],
+			expectedConflict: "port 5432 is used by visitor db-1",
+		},
+		{
+			visitor: visitors[4],
+		},
+		{
+			// NOTE: the port in the list is stale
+			visitor: newVisitor("db-1", "endpoint", 5433, now.Add(-time.Hour)),
+		},
+		{
+			visitor: newVisitor("other-2", "other-endpoint", 5432, now),
+		},
+		{
+			visitor:          visitors[5],
+			expectedConflict: "port 7400 is used by the frpc admin api",
+		},
+	}
+
+	for _, c := range cases {
+		conflict := visitorPortConflict(&c.visitor, visitors)
+		if conflict != c.expectedConflict {
+			t.Errorf("visitor %s: expected conflict %q, got %q", c.visitor.Name, c.expectedConflict, conflict)
+		}
+	}
+}
@@ -7,10 +7,15 @@ import (
 	frpv1 "github.com/b4fun/frpcontroller/api/v1"
 	"github.com/b4fun/frpcontroller/controllers"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -21,6 +26,8 @@ var (
 
 func init() {
 	_ = clientgoscheme.AddToScheme(scheme)
+	_ = gatewayv1.AddToScheme(scheme)
+	_ = gatewayv1alpha2.AddToScheme(scheme)
 
 	_ = frpv1.AddToScheme(scheme)
 	// +kubebuilder:scaffold:scheme
@@ -29,9 +36,41 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var enableWebhooks bool
+	var clusterResourceNamespace string
+	var loadBalancerClass string
+	var loadBalancerEndpoint string
+	var ingressClass string
+	var ingressEndpoint string
+	var enableGatewayAPI bool
+	var defaultFrpcImage string
+	var defaultFrpsImage string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Enable the admission webhooks. The webhook server requires the serving certificates.")
+	flag.StringVar(&clusterResourceNamespace, "cluster-resource-namespace", "frpcontroller-system",
+		"The namespace to run the frpc of the cluster endpoints, and to resolve the token secrets of them.")
+	flag.StringVar(&loadBalancerClass, "load-balancer-class", "",
+		"The class of the LoadBalancer services to implement with frp, set by the frp.go.build4.fun/load-balancer-class annotation. "+
+			"Disabled if empty.")
+	flag.StringVar(&loadBalancerEndpoint, "load-balancer-endpoint", "",
+		"The name of the endpoint in the service namespace to expose the LoadBalancer services, "+
+			"can be overridden by the frp.go.build4.fun/endpoint annotation.")
+	flag.StringVar(&ingressClass, "ingress-class", "",
+		"The name of the IngressClass to implement with frp, its controller should be "+controllers.IngressControllerName+". "+
+			"Disabled if empty.")
+	flag.StringVar(&ingressEndpoint, "ingress-endpoint", "",
+		"The name of the endpoint in the ingress namespace to expose the ingresses, "+
+			"can be overridden by the frp.go.build4.fun/endpoint annotation.")
+	flag.BoolVar(&enableGatewayAPI, "enable-gateway-api", false,
+		"Implement the gateway classes with "+controllers.GatewayControllerName+" as the controller. "+
+			"Requires the Gateway API CRDs, including the experimental TCPRoute and UDPRoute.")
+	flag.StringVar(&defaultFrpcImage, "default-frpc-image", controllers.DefaultFrpcImage,
+		"The frpc image for the endpoints without image specified.")
+	flag.StringVar(&defaultFrpsImage, "default-frps-image", controllers.DefaultFrpsImage,
+		"The frps image for the server endpoints without image specified.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(func(o *zap.Options) {
@@ -39,32 +78,149 @@ func main() {
 	}))
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: metricsAddr,
-		LeaderElection:     enableLeaderElection,
-		Port:               9443,
+		Scheme:           scheme,
+		Metrics:          metricsserver.Options{BindAddress: metricsAddr},
+		LeaderElection:   enableLeaderElection,
+		LeaderElectionID: "frpcontroller.frp.go.build4.fun",
+		WebhookServer:    webhook.NewServer(webhook.Options{Port: 9443}),
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	loadBalancer := controllers.LoadBalancerOptions{
+		Class:    loadBalancerClass,
+		Endpoint: loadBalancerEndpoint,
+	}
+	ingress := controllers.IngressOptions{
+		Class:    ingressClass,
+		Endpoint: ingressEndpoint,
+	}
+	gateway := controllers.GatewayOptions{
+		Enabled: enableGatewayAPI,
+	}
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		setupLog.Error(err, "unable to create clientset")
+		os.Exit(1)
+	}
+	endpointReconciler := &controllers.EndpointReconciler{
+		Client:       mgr.GetClient(),
+		Log:          ctrl.Log.WithName("controllers").WithName("Endpoint"),
+		Scheme:       mgr.GetScheme(),
+		Clientset:    clientset,
+		LoadBalancer: loadBalancer,
+		Ingress:      ingress,
+		Gateway:      gateway,
+		DefaultImage: defaultFrpcImage,
+		Recorder:     mgr.GetEventRecorderFor("frpcontroller"),
+	}
+	if err = endpointReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Endpoint")
+		os.Exit(1)
+	}
+	if loadBalancer.Class != "" {
+		if err = (&controllers.LoadBalancerReconciler{
+			Client:       mgr.GetClient(),
+			Log:          ctrl.Log.WithName("controllers").WithName("LoadBalancer"),
+			Scheme:       mgr.GetScheme(),
+			LoadBalancer: loadBalancer,
+			Recorder:     mgr.GetEventRecorderFor("frpcontroller"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "LoadBalancer")
+			os.Exit(1)
+		}
+	}
+	if ingress.Class != "" {
+		if err = (&controllers.IngressReconciler{
+			Client:  mgr.GetClient(),
+			Log:     ctrl.Log.WithName("controllers").WithName("Ingress"),
+			Scheme:  mgr.GetScheme(),
+			Ingress: ingress,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Ingress")
+			os.Exit(1)
+		}
+	}
+	if gateway.Enabled {
+		if err = (&controllers.GatewayClassReconciler{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("controllers").WithName("GatewayClass"),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "GatewayClass")
+			os.Exit(1)
+		}
+		if err = (&controllers.GatewayReconciler{
+			Client: mgr.GetClient(),
+			Log:    ctrl.Log.WithName("controllers").WithName("Gateway"),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "Gateway")
+			os.Exit(1)
+		}
+	}
+	clusterEndpointReconciler := &controllers.ClusterEndpointReconciler{
+		EndpointReconciler: controllers.EndpointReconciler{
+			Client:       mgr.GetClient(),
+			Log:          ctrl.Log.WithName("controllers").WithName("ClusterEndpoint"),
+			Scheme:       mgr.GetScheme(),
+			Clientset:    clientset,
+			DefaultImage: defaultFrpcImage,
+		},
+		Namespace: clusterResourceNamespace,
+	}
+	if err = clusterEndpointReconciler.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterEndpoint")
+		os.Exit(1)
+	}
 	if err = (&controllers.ServiceReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Service"),
-		Scheme: mgr.GetScheme(),
+		Client:           mgr.GetClient(),
+		Log:              ctrl.Log.WithName("controllers").WithName("Service"),
+		Scheme:           mgr.GetScheme(),
+		Recorder:         mgr.GetEventRecorderFor("frpcontroller"),
+		Endpoints:        endpointReconciler,
+		ClusterEndpoints: clusterEndpointReconciler,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Service")
 		os.Exit(1)
 	}
-	if err = (&controllers.EndpointReconciler{
+	if err = (&controllers.ServerEndpointReconciler{
+		Client:       mgr.GetClient(),
+		Log:          ctrl.Log.WithName("controllers").WithName("ServerEndpoint"),
+		Scheme:       mgr.GetScheme(),
+		DefaultImage: defaultFrpsImage,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ServerEndpoint")
+		os.Exit(1)
+	}
+	if err = (&controllers.VisitorReconciler{
 		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("Endpoint"),
+		Log:    ctrl.Log.WithName("controllers").WithName("Visitor"),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Endpoint")
+		setupLog.Error(err, "unable to create controller", "controller", "Visitor")
 		os.Exit(1)
 	}
+	if enableWebhooks {
+		if err = (&frpv1.Endpoint{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Endpoint")
+			os.Exit(1)
+		}
+		if err = (&frpv1.ClusterEndpoint{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterEndpoint")
+			os.Exit(1)
+		}
+		if err = (&frpv1.ServerEndpoint{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ServerEndpoint")
+			os.Exit(1)
+		}
+		if err = (&frpv1.Service{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Service")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
@@ -0,0 +1,77 @@
+// Package frpcadmin implements a client for the frpc admin api.
+package frpcadmin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Client talks to a running frpc with admin api enabled.
+type Client struct {
+	// Addr specifies the admin api address (admin_addr:admin_port).
+	Addr string
+	// User specifies the admin api user (admin_user).
+	User string
+	// Password specifies the admin api password (admin_pwd).
+	Password string
+	// HTTPClient specifies the http client to use, defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// PutConfig replaces the config file of the frpc with given content.
+func (c *Client) PutConfig(ctx context.Context, content string) error {
+	_, err := c.do(ctx, http.MethodPut, "/api/config", strings.NewReader(content))
+	return err
+}
+
+// Reload asks the frpc to reload proxies from its config file.
+func (c *Client) Reload(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodGet, "/api/reload", nil)
+	return err
+}
+
+func (c *Client) do(
+	ctx context.Context,
+	method string,
+	path string,
+	body io.Reader,
+) ([]byte, error) {
+	req, err := http.NewRequestWithContext(
+		ctx, method,
+		fmt.Sprintf("http://%s%s", c.Addr, path),
+		body,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if c.User != "" || c.Password != "" {
+		req.SetBasicAuth(c.User, c.Password)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"%s %s: unexpected status %d: %s",
+			method, path, resp.StatusCode, strings.TrimSpace(string(respBody)),
+		)
+	}
+
+	return respBody, nil
+}
@@ -0,0 +1,120 @@
+package frpcadmin
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestClient(handler http.HandlerFunc) (*Client, func()) {
+	server := httptest.NewServer(handler)
+
+	return &Client{
+		Addr:     strings.TrimPrefix(server.URL, "http://"),
+		User:     "admin",
+		Password: "secret",
+	}, server.Close
+}
+
+func TestClient_PutConfigAndReload(t *testing.T) {
+	var (
+		configReceived string
+		reloaded       bool
+	)
+	c, closeServer := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/api/config":
+			b, _ := ioutil.ReadAll(r.Body)
+			configReceived = string(b)
+		case r.Method == http.MethodGet && r.URL.Path == "/api/reload":
+			reloaded = true
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	defer closeServer()
+
+	ctx := context.Background()
+	if err := c.PutConfig(ctx, "[common]\n"); err != nil {
+		t.Fatalf("put config: %v", err)
+	}
+	if configReceived != "[common]\n" {
+		t.Errorf("unexpected config received: %q", configReceived)
+	}
+	if err := c.Reload(ctx); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !reloaded {
+		t.Errorf("reload api not called")
+	}
+}
+
+func TestClient_Error(t *testing.T) {
+	c, closeServer := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("reload frpc config error"))
+	})
+	defer closeServer()
+
+	err := c.Reload(context.Background())
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "reload frpc config error") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestClient_Status(t *testing.T) {
+	c, closeServer := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/api/status" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{
+			"tcp": [
+				{"name": "ssh_tcp", "type": "tcp", "status": "start error", "err": "port already used", "local_addr": "10.0.0.2:22", "remote_addr": ":2222"}
+			],
+			"http": [
+				{"name": "web_http", "type": "http", "status": "running", "local_addr": "10.0.0.1:80", "remote_addr": "a.example.com:8080"}
+			],
+			"udp": []
+		}`))
+	})
+	defer closeServer()
+
+	proxies, err := c.Status(context.Background())
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	expected := []ProxyStatus{
+		{
+			Name:       "ssh_tcp",
+			Type:       "tcp",
+			Status:     ProxyStatusStartError,
+			Err:        "port already used",
+			LocalAddr:  "10.0.0.2:22",
+			RemoteAddr: ":2222",
+		},
+		{
+			Name:       "web_http",
+			Type:       "http",
+			Status:     ProxyStatusRunning,
+			LocalAddr:  "10.0.0.1:80",
+			RemoteAddr: "a.example.com:8080",
+		},
+	}
+	if !reflect.DeepEqual(proxies, expected) {
+		t.Errorf("unexpected proxies: %+v", proxies)
+	}
+}
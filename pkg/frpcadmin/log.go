@@ -0,0 +1,79 @@
+package frpcadmin
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const logLoginStatusUnknown = "no login attempt found in frpc logs"
+
+var (
+	logLoginSuccess      = regexp.MustCompile(`login to server success`)
+	logLoginFailed       = regexp.MustCompile(`login to server failed: (.*)$`)
+	logProxyStartSuccess = regexp.MustCompile(`\[([^\[\]]+)\] start proxy success`)
+	logProxyStartError   = regexp.MustCompile(`\[([^\[\]]+)\] start error: (.*)$`)
+)
+
+// LogStatus describes the frpc status parsed from its logs.
+// It's used when the admin api is not available, e.g. the frpc is not logged in.
+type LogStatus struct {
+	// LoggedIn tells if the last login attempt succeeded.
+	LoggedIn bool
+	// LoginError tells the error of the last failed login attempt.
+	LoginError string
+	// Proxies lists the proxy status from the last login, sorted by name.
+	Proxies []ProxyStatus
+}
+
+// ParseLog parses the frpc status from its logs.
+func ParseLog(r io.Reader) (*LogStatus, error) {
+	status := &LogStatus{
+		LoginError: logLoginStatusUnknown,
+	}
+	proxies := map[string]ProxyStatus{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if logLoginSuccess.MatchString(line) {
+			status.LoggedIn = true
+			status.LoginError = ""
+			// NOTE: proxies are registered again after logged in
+			proxies = map[string]ProxyStatus{}
+			continue
+		}
+		if m := logLoginFailed.FindStringSubmatch(line); m != nil {
+			status.LoggedIn = false
+			status.LoginError = m[1]
+			continue
+		}
+		if m := logProxyStartSuccess.FindStringSubmatch(line); m != nil {
+			proxies[m[1]] = ProxyStatus{
+				Name:   m[1],
+				Status: ProxyStatusRunning,
+			}
+			continue
+		}
+		if m := logProxyStartError.FindStringSubmatch(line); m != nil {
+			proxies[m[1]] = ProxyStatus{
+				Name:   m[1],
+				Status: ProxyStatusStartError,
+				Err:    m[2],
+			}
+			continue
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, proxy := range proxies {
+		status.Proxies = append(status.Proxies, proxy)
+	}
+	sortProxies(status.Proxies)
+
+	return status, nil
+}
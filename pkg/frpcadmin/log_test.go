@@ -0,0 +1,69 @@
+package frpcadmin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLog(t *testing.T) {
+	cases := []struct {
+		name     string
+		logs     string
+		expected *LogStatus
+	}{
+		{
+			name: "no login",
+			logs: `2020/03/08 10:00:00 [I] [service.go:96] starting frpc`,
+			expected: &LogStatus{
+				LoginError: logLoginStatusUnknown,
+			},
+		},
+		{
+			name: "login failed",
+			logs: `
+2020/03/08 10:00:00 [I] [service.go:249] [abc] login to server success, get run id [abc], server udp port [0]
+2020/03/08 10:01:00 [W] [service.go:101] login to server failed: authorization failed
+`,
+			expected: &LogStatus{
+				LoginError: "authorization failed",
+			},
+		},
+		{
+			name: "proxies",
+			logs: `
+2020/03/08 10:00:00 [W] [service.go:101] login to server failed: dial tcp 10.0.0.1:7000: connect: connection refused
+2020/03/08 10:01:00 [I] [service.go:249] [abc] login to server success, get run id [abc], server udp port [0]
+2020/03/08 10:01:00 [I] [proxy_manager.go:144] [abc] proxy added: [web_http ssh_tcp]
+2020/03/08 10:01:00 [I] [control.go:164] [abc] [web_http] start proxy success
+2020/03/08 10:01:00 [W] [control.go:162] [abc] [ssh_tcp] start error: port already used
+`,
+			expected: &LogStatus{
+				LoggedIn: true,
+				Proxies: []ProxyStatus{
+					{
+						Name:   "ssh_tcp",
+						Status: ProxyStatusStartError,
+						Err:    "port already used",
+					},
+					{
+						Name:   "web_http",
+						Status: ProxyStatusRunning,
+					},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status, err := ParseLog(strings.NewReader(c.logs))
+			if err != nil {
+				t.Fatalf("parse log: %v", err)
+			}
+			if !reflect.DeepEqual(status, c.expected) {
+				t.Errorf("unexpected status: %+v, expected: %+v", status, c.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package frpcadmin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// Proxy status values reported by frpc.
+const (
+	ProxyStatusNew         = "new"
+	ProxyStatusWaitStart   = "wait start"
+	ProxyStatusStartError  = "start error"
+	ProxyStatusRunning     = "running"
+	ProxyStatusCheckFailed = "check failed"
+	ProxyStatusClosed      = "closed"
+)
+
+// ProxyStatus describes the status of a proxy reported by frpc.
+type ProxyStatus struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Status     string `json:"status"`
+	Err        string `json:"err"`
+	LocalAddr  string `json:"local_addr"`
+	RemoteAddr string `json:"remote_addr"`
+}
+
+// IsPending tells if the proxy is still starting.
+func (s ProxyStatus) IsPending() bool {
+	return IsProxyStatusPending(s.Status)
+}
+
+// IsProxyStatusPending tells if the proxy status is a starting one.
+func IsProxyStatusPending(status string) bool {
+	return status == ProxyStatusNew || status == ProxyStatusWaitStart
+}
+
+// Status lists the status of the proxies, sorted by name.
+func (c *Client) Status(ctx context.Context) ([]ProxyStatus, error) {
+	body, err := c.do(ctx, http.MethodGet, "/api/status", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: proxies are grouped by the proxy type
+	var resp map[string][]ProxyStatus
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+
+	var proxies []ProxyStatus
+	for _, proxiesByType := range resp {
+		proxies = append(proxies, proxiesByType...)
+	}
+	sortProxies(proxies)
+
+	return proxies, nil
+}
+
+func sortProxies(proxies []ProxyStatus) {
+	sort.Slice(proxies, func(i, j int) bool {
+		return proxies[i].Name < proxies[j].Name
+	})
+}
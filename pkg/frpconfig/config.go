@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"gopkg.in/ini.v1"
 	"sort"
+	"strconv"
 )
 
 // ConfigCommon describes the common section config.
@@ -11,24 +12,104 @@ type ConfigCommon struct {
 	ServerAddr string `ini:"server_addr"`
 	ServerPort int    `ini:"server_port"`
 	Token      string `ini:"token,omitempty"`
+
+	// authentication settings
+	AuthenticationMethod     string `ini:"authentication_method,omitempty"`
+	AuthenticateHeartbeats   bool   `ini:"authenticate_heartbeats,omitempty"`
+	AuthenticateNewWorkConns bool   `ini:"authenticate_new_work_conns,omitempty"`
+	OIDCClientID             string `ini:"oidc_client_id,omitempty"`
+	OIDCClientSecret         string `ini:"oidc_client_secret,omitempty"`
+	OIDCAudience             string `ini:"oidc_audience,omitempty"`
+	OIDCScope                string `ini:"oidc_scope,omitempty"`
+	OIDCTokenEndpointURL     string `ini:"oidc_token_endpoint_url,omitempty"`
+
+	// admin api settings
+	AdminAddr string `ini:"admin_addr,omitempty"`
+	AdminPort int    `ini:"admin_port,omitempty"`
+	AdminUser string `ini:"admin_user,omitempty"`
+	AdminPwd  string `ini:"admin_pwd,omitempty"`
+
+	// tls settings
+	// TLSEnable is rendered only if specified, as the default value varies by frp versions.
+	TLSEnable        *bool  `ini:"-"`
+	TLSCertFile      string `ini:"tls_cert_file,omitempty"`
+	TLSKeyFile       string `ini:"tls_key_file,omitempty"`
+	TLSTrustedCaFile string `ini:"tls_trusted_ca_file,omitempty"`
+	TLSServerName    string `ini:"tls_server_name,omitempty"`
+
+	// transport settings
+	Protocol          string `ini:"protocol,omitempty"`
+	PoolCount         int    `ini:"pool_count,omitempty"`
+	HeartbeatInterval int    `ini:"heartbeat_interval,omitempty"`
+	HeartbeatTimeout  int    `ini:"heartbeat_timeout,omitempty"`
+	DialServerTimeout int    `ini:"dial_server_timeout,omitempty"`
+	HTTPProxy         string `ini:"http_proxy,omitempty"`
+	// TCPMux is rendered only if specified, as false is a meaningful value.
+	TCPMux *bool `ini:"-"`
 }
 
+// Authentication methods of frp.
+const (
+	AuthenticationMethodToken = "token"
+	AuthenticationMethodOIDC  = "oidc"
+)
+
 // ConfigApp describes an app config.
 type ConfigApp struct {
 	Type       string `ini:"type"`
-	RemotePort int    `ini:"remote_port"`
+	RemotePort int    `ini:"remote_port,omitempty"`
 	LocalPort  int    `ini:"local_port"`
 	LocalAddr  string `ini:"local_ip"`
+
+	// http / https settings
+	CustomDomains     []string `ini:"custom_domains,omitempty"`
+	SubDomain         string   `ini:"subdomain,omitempty"`
+	Locations         []string `ini:"locations,omitempty"`
+	HostHeaderRewrite string   `ini:"host_header_rewrite,omitempty"`
+	HTTPUser          string   `ini:"http_user,omitempty"`
+	HTTPPwd           string   `ini:"http_pwd,omitempty"`
+	// Headers are rendered as `header_<name>` keys.
+	Headers map[string]string `ini:"-"`
+
+	// stcp / sudp / xtcp settings
+	SK string `ini:"sk,omitempty"`
+
+	// transport settings
+	UseEncryption      bool   `ini:"use_encryption,omitempty"`
+	UseCompression     bool   `ini:"use_compression,omitempty"`
+	BandwidthLimit     string `ini:"bandwidth_limit,omitempty"`
+	BandwidthLimitMode string `ini:"bandwidth_limit_mode,omitempty"`
+
+	// ProxyProtocolVersion sends the client address to the local port with PROXY protocol.
+	ProxyProtocolVersion string `ini:"proxy_protocol_version,omitempty"`
+
+	// load balancing settings, tcp / http proxies in the same group share the remote port / domains
+	Group    string `ini:"group,omitempty"`
+	GroupKey string `ini:"group_key,omitempty"`
+}
+
+// RoleVisitor is the role of visitor configs.
+const RoleVisitor = "visitor"
+
+// ConfigVisitor describes a visitor config.
+type ConfigVisitor struct {
+	Type       string `ini:"type"`
+	Role       string `ini:"role"`
+	ServerName string `ini:"server_name"`
+	SK         string `ini:"sk,omitempty"`
+	BindAddr   string `ini:"bind_addr"`
+	BindPort   int    `ini:"bind_port"`
 }
 
 // FrpcConfig describes a frpc configuration.
 type FrpcConfig struct {
-	Common *ConfigCommon
-	Apps   map[string]*ConfigApp
+	Common   *ConfigCommon
+	Apps     map[string]*ConfigApp
+	Visitors map[string]*ConfigVisitor
 }
 
-// GenerateIni generates frpc ini config.
-func (c *FrpcConfig) GenerateIni() (string, error) {
+// GenerateINI generates frpc ini config.
+func (c *FrpcConfig) GenerateINI() (string, error) {
 	cfg := ini.Empty()
 
 	secCommon, err := cfg.NewSection("common")
@@ -39,6 +120,21 @@ func (c *FrpcConfig) GenerateIni() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	for _, key := range []struct {
+		name  string
+		value *bool
+	}{
+		{name: "tls_enable", value: c.Common.TLSEnable},
+		{name: "tcp_mux", value: c.Common.TCPMux},
+	} {
+		if key.value == nil {
+			continue
+		}
+		_, err = secCommon.NewKey(key.name, strconv.FormatBool(*key.value))
+		if err != nil {
+			return "", err
+		}
+	}
 
 	// ensure app sections are sorted
 	var appNames []string
@@ -52,10 +148,91 @@ func (c *FrpcConfig) GenerateIni() (string, error) {
 		if err != nil {
 			return "", err
 		}
-		err = secApp.ReflectFrom(c.Apps[appName])
+		app := c.Apps[appName]
+		err = secApp.ReflectFrom(app)
 		if err != nil {
 			return "", err
 		}
+
+		var headerNames []string
+		for headerName := range app.Headers {
+			headerNames = append(headerNames, headerName)
+		}
+		sort.Strings(headerNames)
+		for _, headerName := range headerNames {
+			_, err = secApp.NewKey("header_"+headerName, app.Headers[headerName])
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// ensure visitor sections are sorted
+	var visitorNames []string
+	for visitorName := range c.Visitors {
+		visitorNames = append(visitorNames, visitorName)
+	}
+	sort.Strings(visitorNames)
+
+	for _, visitorName := range visitorNames {
+		secVisitor, err := cfg.NewSection(visitorName)
+		if err != nil {
+			return "", err
+		}
+		err = secVisitor.ReflectFrom(c.Visitors[visitorName])
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var b bytes.Buffer
+	_, err = cfg.WriteTo(&b)
+	if err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// ServerConfigCommon describes the common section of frps config.
+type ServerConfigCommon struct {
+	BindAddr string `ini:"bind_addr,omitempty"`
+	BindPort int    `ini:"bind_port"`
+	Token    string `ini:"token,omitempty"`
+
+	// vhost settings
+	VhostHTTPPort  int    `ini:"vhost_http_port,omitempty"`
+	VhostHTTPSPort int    `ini:"vhost_https_port,omitempty"`
+	SubdomainHost  string `ini:"subdomain_host,omitempty"`
+
+	// AllowPorts limits the remote ports, e.g. `2000-3000,3001`.
+	AllowPorts string `ini:"allow_ports,omitempty"`
+
+	// dashboard settings
+	DashboardAddr string `ini:"dashboard_addr,omitempty"`
+	DashboardPort int    `ini:"dashboard_port,omitempty"`
+	DashboardUser string `ini:"dashboard_user,omitempty"`
+	DashboardPwd  string `ini:"dashboard_pwd,omitempty"`
+
+	LogLevel string `ini:"log_level,omitempty"`
+}
+
+// FrpsConfig describes a frps configuration.
+type FrpsConfig struct {
+	Common *ServerConfigCommon
+}
+
+// GenerateINI generates frps ini config.
+func (c *FrpsConfig) GenerateINI() (string, error) {
+	cfg := ini.Empty()
+
+	secCommon, err := cfg.NewSection("common")
+	if err != nil {
+		return "", err
+	}
+	err = secCommon.ReflectFrom(c.Common)
+	if err != nil {
+		return "", err
 	}
 
 	var b bytes.Buffer
@@ -0,0 +1,356 @@
+package frpconfig
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFrpcConfig_GenerateINI(t *testing.T) {
+	c := &FrpcConfig{
+		Common: &ConfigCommon{
+			ServerAddr: "127.0.0.1",
+			ServerPort: 7000,
+			Token:      "foobar",
+		},
+		Apps: map[string]*ConfigApp{
+			"web_http": {
+				Type:              "http",
+				LocalPort:         80,
+				LocalAddr:         "10.0.0.1",
+				CustomDomains:     []string{"a.example.com", "b.example.com"},
+				Locations:         []string{"/", "/api"},
+				HostHeaderRewrite: "internal.example.com",
+				HTTPUser:          "user",
+				HTTPPwd:           "password",
+				Headers: map[string]string{
+					"X-From-Where": "frp",
+				},
+			},
+			"ssh_tcp": {
+				Type:       "tcp",
+				RemotePort: 2222,
+				LocalPort:  22,
+				LocalAddr:  "10.0.0.2",
+			},
+			"db_stcp": {
+				Type:      "stcp",
+				LocalPort: 5432,
+				LocalAddr: "10.0.0.3",
+				SK:        "secret",
+			},
+		},
+		Visitors: map[string]*ConfigVisitor{
+			"db.visitor": {
+				Type:       "stcp",
+				Role:       RoleVisitor,
+				ServerName: "db_stcp",
+				SK:         "secret",
+				BindAddr:   "0.0.0.0",
+				BindPort:   5432,
+			},
+		},
+	}
+
+	content, err := c.GenerateINI()
+	if err != nil {
+		t.Fatalf("generate ini: %v", err)
+	}
+
+	expected := `[common]
+server_addr = 127.0.0.1
+server_port = 7000
+token       = foobar
+
+[db_stcp]
+type       = stcp
+local_port = 5432
+local_ip   = 10.0.0.3
+sk         = secret
+
+[ssh_tcp]
+type        = tcp
+remote_port = 2222
+local_port  = 22
+local_ip    = 10.0.0.2
+
+[web_http]
+type                = http
+local_port          = 80
+local_ip            = 10.0.0.1
+custom_domains      = a.example.com,b.example.com
+locations           = /,/api
+host_header_rewrite = internal.example.com
+http_user           = user
+http_pwd            = password
+header_X-From-Where = frp
+
+[db.visitor]
+type        = stcp
+role        = visitor
+server_name = db_stcp
+sk          = secret
+bind_addr   = 0.0.0.0
+bind_port   = 5432
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestFrpsConfig_GenerateINI(t *testing.T) {
+	c := &FrpsConfig{
+		Common: &ServerConfigCommon{
+			BindPort:      7000,
+			Token:         "foobar",
+			VhostHTTPPort: 80,
+			AllowPorts:    "30000-30100",
+			DashboardAddr: "0.0.0.0",
+			DashboardPort: 7500,
+			DashboardUser: "admin",
+			DashboardPwd:  "password",
+		},
+	}
+
+	content, err := c.GenerateINI()
+	if err != nil {
+		t.Fatalf("generate ini: %v", err)
+	}
+
+	expected := `[common]
+bind_port       = 7000
+token           = foobar
+vhost_http_port = 80
+allow_ports     = 30000-30100
+dashboard_addr  = 0.0.0.0
+dashboard_port  = 7500
+dashboard_user  = admin
+dashboard_pwd   = password
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestFrpcConfig_GenerateINI_TLS(t *testing.T) {
+	tlsEnable := true
+	c := &FrpcConfig{
+		Common: &ConfigCommon{
+			ServerAddr:       "frps.example.com",
+			ServerPort:       7000,
+			TLSEnable:        &tlsEnable,
+			TLSCertFile:      "/tls/client/tls.crt",
+			TLSKeyFile:       "/tls/client/tls.key",
+			TLSTrustedCaFile: "/tls/ca/ca.crt",
+			TLSServerName:    "frps.internal",
+		},
+	}
+
+	content, err := c.GenerateINI()
+	if err != nil {
+		t.Fatalf("generate ini: %v", err)
+	}
+
+	expected := `[common]
+server_addr         = frps.example.com
+server_port         = 7000
+tls_cert_file       = /tls/client/tls.crt
+tls_key_file        = /tls/client/tls.key
+tls_trusted_ca_file = /tls/ca/ca.crt
+tls_server_name     = frps.internal
+tls_enable          = true
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestFrpcConfig_GenerateINI_Transport(t *testing.T) {
+	tcpMux := false
+	c := &FrpcConfig{
+		Common: &ConfigCommon{
+			ServerAddr:        "frps.example.com",
+			ServerPort:        7000,
+			Protocol:          "websocket",
+			PoolCount:         5,
+			HeartbeatInterval: -1,
+			DialServerTimeout: 10,
+			TCPMux:            &tcpMux,
+		},
+	}
+
+	content, err := c.GenerateINI()
+	if err != nil {
+		t.Fatalf("generate ini: %v", err)
+	}
+
+	expected := `[common]
+server_addr         = frps.example.com
+server_port         = 7000
+protocol            = websocket
+pool_count          = 5
+heartbeat_interval  = -1
+dial_server_timeout = 10
+tcp_mux             = false
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestFrpcConfig_GenerateINI_OIDC(t *testing.T) {
+	c := &FrpcConfig{
+		Common: &ConfigCommon{
+			ServerAddr:               "frps.example.com",
+			ServerPort:               7000,
+			AuthenticationMethod:     AuthenticationMethodOIDC,
+			AuthenticateHeartbeats:   true,
+			AuthenticateNewWorkConns: true,
+			OIDCClientID:             "frpc",
+			OIDCClientSecret:         "secret",
+			OIDCAudience:             "frps",
+			OIDCTokenEndpointURL:     "https://idp.example.com/oauth2/token",
+		},
+	}
+
+	content, err := c.GenerateINI()
+	if err != nil {
+		t.Fatalf("generate ini: %v", err)
+	}
+
+	expected := `[common]
+server_addr                 = frps.example.com
+server_port                 = 7000
+authentication_method       = oidc
+authenticate_heartbeats     = true
+authenticate_new_work_conns = true
+oidc_client_id              = frpc
+oidc_client_secret          = secret
+oidc_audience               = frps
+oidc_token_endpoint_url     = https://idp.example.com/oauth2/token
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestFrpcConfig_GenerateINI_AppTransport(t *testing.T) {
+	c := &FrpcConfig{
+		Common: &ConfigCommon{
+			ServerAddr: "127.0.0.1",
+			ServerPort: 7000,
+		},
+		Apps: map[string]*ConfigApp{
+			"db_tcp": {
+				Type:               "tcp",
+				RemotePort:         5432,
+				LocalPort:          5432,
+				LocalAddr:          "10.0.0.3",
+				UseEncryption:      true,
+				UseCompression:     true,
+				BandwidthLimit:     "10MB",
+				BandwidthLimitMode: "server",
+			},
+		},
+	}
+
+	content, err := c.GenerateINI()
+	if err != nil {
+		t.Fatalf("generate ini: %v", err)
+	}
+
+	expected := `[common]
+server_addr = 127.0.0.1
+server_port = 7000
+
+[db_tcp]
+type                 = tcp
+remote_port          = 5432
+local_port           = 5432
+local_ip             = 10.0.0.3
+use_encryption       = true
+use_compression      = true
+bandwidth_limit      = 10MB
+bandwidth_limit_mode = server
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestFrpcConfig_GenerateINI_ProxyProtocol(t *testing.T) {
+	c := &FrpcConfig{
+		Common: &ConfigCommon{
+			ServerAddr: "127.0.0.1",
+			ServerPort: 7000,
+		},
+		Apps: map[string]*ConfigApp{
+			"web_https": {
+				Type:                 "https",
+				LocalPort:            443,
+				LocalAddr:            "10.0.0.1",
+				CustomDomains:        []string{"a.example.com"},
+				ProxyProtocolVersion: "v2",
+			},
+		},
+	}
+
+	content, err := c.GenerateINI()
+	if err != nil {
+		t.Fatalf("generate ini: %v", err)
+	}
+
+	expected := `[common]
+server_addr = 127.0.0.1
+server_port = 7000
+
+[web_https]
+type                   = https
+local_port             = 443
+local_ip               = 10.0.0.1
+custom_domains         = a.example.com
+proxy_protocol_version = v2
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestFrpcConfig_GenerateINI_Group(t *testing.T) {
+	c := &FrpcConfig{
+		Common: &ConfigCommon{
+			ServerAddr: "127.0.0.1",
+			ServerPort: 7000,
+		},
+		Apps: map[string]*ConfigApp{
+			"ssh_22@{{ .Envs.FRPC_POD_NAME }}": {
+				Type:       "tcp",
+				RemotePort: 2222,
+				LocalPort:  22,
+				LocalAddr:  "10.0.0.1",
+				Group:      "ssh_22",
+				GroupKey:   "secret",
+			},
+		},
+	}
+
+	content, err := c.GenerateINI()
+	if err != nil {
+		t.Fatalf("generate ini: %v", err)
+	}
+
+	expected := `[common]
+server_addr = 127.0.0.1
+server_port = 7000
+
+[ssh_22@{{ .Envs.FRPC_POD_NAME }}]
+type        = tcp
+remote_port = 2222
+local_port  = 22
+local_ip    = 10.0.0.1
+group       = ssh_22
+group_key   = secret
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
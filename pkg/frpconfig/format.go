@@ -0,0 +1,321 @@
+package frpconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"sigs.k8s.io/yaml"
+)
+
+// Format describes the frp configuration file format.
+type Format string
+
+const (
+	// FormatINI is the legacy format, deprecated since frp v0.52.0.
+	FormatINI Format = "ini"
+	// FormatTOML is the recommended format since frp v0.52.0.
+	FormatTOML Format = "toml"
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// FileName returns the config file name with the format extension, e.g. `frpc.toml`.
+func (f Format) FileName(baseName string) string {
+	return fmt.Sprintf("%s.%s", baseName, f)
+}
+
+// Generate generates frpc config in the given format.
+func (c *FrpcConfig) Generate(format Format) (string, error) {
+	switch format {
+	case FormatINI, "":
+		return c.GenerateINI()
+	case FormatTOML:
+		return c.GenerateTOML()
+	case FormatYAML:
+		return c.GenerateYAML()
+	case FormatJSON:
+		return c.GenerateJSON()
+	default:
+		return "", fmt.Errorf("unsupported config format: %s", format)
+	}
+}
+
+// GenerateTOML generates frpc config in the TOML format (frp v0.52.0+ schema).
+func (c *FrpcConfig) GenerateTOML() (string, error) {
+	var b bytes.Buffer
+	encoder := toml.NewEncoder(&b)
+	encoder.Indent = ""
+	if err := encoder.Encode(c.toClientConfigV1()); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// GenerateYAML generates frpc config in the YAML format (frp v0.52.0+ schema).
+func (c *FrpcConfig) GenerateYAML() (string, error) {
+	b, err := yaml.Marshal(c.toClientConfigV1())
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// GenerateJSON generates frpc config in the JSON format (frp v0.52.0+ schema).
+func (c *FrpcConfig) GenerateJSON() (string, error) {
+	b, err := json.MarshalIndent(c.toClientConfigV1(), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// authConfigV1 describes the `auth` settings of the v1 schema.
+type authConfigV1 struct {
+	Method           string              `json:"method,omitempty" toml:"method,omitempty"`
+	AdditionalScopes []string            `json:"additionalScopes,omitempty" toml:"additionalScopes,omitempty"`
+	Token            string              `json:"token,omitempty" toml:"token,omitempty"`
+	OIDC             *oidcClientConfigV1 `json:"oidc,omitempty" toml:"oidc,omitempty"`
+}
+
+// oidcClientConfigV1 describes the `auth.oidc` settings of the v1 schema.
+type oidcClientConfigV1 struct {
+	ClientID         string `json:"clientID,omitempty" toml:"clientID,omitempty"`
+	ClientSecret     string `json:"clientSecret,omitempty" toml:"clientSecret,omitempty"`
+	Audience         string `json:"audience,omitempty" toml:"audience,omitempty"`
+	Scope            string `json:"scope,omitempty" toml:"scope,omitempty"`
+	TokenEndpointURL string `json:"tokenEndpointURL,omitempty" toml:"tokenEndpointURL,omitempty"`
+}
+
+// Additional authentication scopes of the v1 schema.
+const (
+	authScopeHeartBeatsV1   = "HeartBeats"
+	authScopeNewWorkConnsV1 = "NewWorkConns"
+)
+
+// webServerConfigV1 describes the `webServer` (admin api / dashboard) settings of the v1 schema.
+type webServerConfigV1 struct {
+	Addr     string `json:"addr,omitempty" toml:"addr,omitempty"`
+	Port     int    `json:"port,omitempty" toml:"port,omitzero"`
+	User     string `json:"user,omitempty" toml:"user,omitempty"`
+	Password string `json:"password,omitempty" toml:"password,omitempty"`
+}
+
+// tlsConfigV1 describes the `transport.tls` settings of the v1 schema.
+type tlsConfigV1 struct {
+	Enable        *bool  `json:"enable,omitempty" toml:"enable,omitempty"`
+	CertFile      string `json:"certFile,omitempty" toml:"certFile,omitempty"`
+	KeyFile       string `json:"keyFile,omitempty" toml:"keyFile,omitempty"`
+	TrustedCaFile string `json:"trustedCaFile,omitempty" toml:"trustedCaFile,omitempty"`
+	ServerName    string `json:"serverName,omitempty" toml:"serverName,omitempty"`
+}
+
+// transportConfigV1 describes the `transport` settings of the v1 schema.
+type transportConfigV1 struct {
+	DialServerTimeout int          `json:"dialServerTimeout,omitempty" toml:"dialServerTimeout,omitzero"`
+	ProxyURL          string       `json:"proxyURL,omitempty" toml:"proxyURL,omitempty"`
+	PoolCount         int          `json:"poolCount,omitempty" toml:"poolCount,omitzero"`
+	TCPMux            *bool        `json:"tcpMux,omitempty" toml:"tcpMux,omitempty"`
+	Protocol          string       `json:"protocol,omitempty" toml:"protocol,omitempty"`
+	HeartbeatInterval int          `json:"heartbeatInterval,omitempty" toml:"heartbeatInterval,omitzero"`
+	HeartbeatTimeout  int          `json:"heartbeatTimeout,omitempty" toml:"heartbeatTimeout,omitzero"`
+	TLS               *tlsConfigV1 `json:"tls,omitempty" toml:"tls,omitempty"`
+}
+
+// headerOperationsV1 describes the `requestHeaders` settings of the v1 schema.
+type headerOperationsV1 struct {
+	Set map[string]string `json:"set,omitempty" toml:"set,omitempty"`
+}
+
+// proxyTransportConfigV1 describes the `proxies.transport` settings of the v1 schema.
+type proxyTransportConfigV1 struct {
+	UseEncryption      bool   `json:"useEncryption,omitempty" toml:"useEncryption,omitempty"`
+	UseCompression     bool   `json:"useCompression,omitempty" toml:"useCompression,omitempty"`
+	BandwidthLimit     string `json:"bandwidthLimit,omitempty" toml:"bandwidthLimit,omitempty"`
+	BandwidthLimitMode string `json:"bandwidthLimitMode,omitempty" toml:"bandwidthLimitMode,omitempty"`
+
+	ProxyProtocolVersion string `json:"proxyProtocolVersion,omitempty" toml:"proxyProtocolVersion,omitempty"`
+}
+
+// loadBalancerConfigV1 describes the `proxies.loadBalancer` settings of the v1 schema.
+type loadBalancerConfigV1 struct {
+	Group    string `json:"group" toml:"group"`
+	GroupKey string `json:"groupKey,omitempty" toml:"groupKey,omitempty"`
+}
+
+// proxyConfigV1 describes a `proxies` entry of the v1 schema.
+type proxyConfigV1 struct {
+	Name       string `json:"name" toml:"name"`
+	Type       string `json:"type" toml:"type"`
+	LocalIP    string `json:"localIP,omitempty" toml:"localIP,omitempty"`
+	LocalPort  int    `json:"localPort,omitempty" toml:"localPort,omitzero"`
+	RemotePort int    `json:"remotePort,omitempty" toml:"remotePort,omitzero"`
+
+	CustomDomains     []string            `json:"customDomains,omitempty" toml:"customDomains,omitempty"`
+	SubDomain         string              `json:"subdomain,omitempty" toml:"subdomain,omitempty"`
+	Locations         []string            `json:"locations,omitempty" toml:"locations,omitempty"`
+	HostHeaderRewrite string              `json:"hostHeaderRewrite,omitempty" toml:"hostHeaderRewrite,omitempty"`
+	HTTPUser          string              `json:"httpUser,omitempty" toml:"httpUser,omitempty"`
+	HTTPPassword      string              `json:"httpPassword,omitempty" toml:"httpPassword,omitempty"`
+	RequestHeaders    *headerOperationsV1 `json:"requestHeaders,omitempty" toml:"requestHeaders,omitempty"`
+
+	SecretKey string `json:"secretKey,omitempty" toml:"secretKey,omitempty"`
+
+	Transport    *proxyTransportConfigV1 `json:"transport,omitempty" toml:"transport,omitempty"`
+	LoadBalancer *loadBalancerConfigV1   `json:"loadBalancer,omitempty" toml:"loadBalancer,omitempty"`
+}
+
+// visitorConfigV1 describes a `visitors` entry of the v1 schema.
+type visitorConfigV1 struct {
+	Name       string `json:"name" toml:"name"`
+	Type       string `json:"type" toml:"type"`
+	ServerName string `json:"serverName" toml:"serverName"`
+	SecretKey  string `json:"secretKey,omitempty" toml:"secretKey,omitempty"`
+	BindAddr   string `json:"bindAddr,omitempty" toml:"bindAddr,omitempty"`
+	BindPort   int    `json:"bindPort" toml:"bindPort"`
+}
+
+// clientConfigV1 describes the frpc config of the v1 schema (frp v0.52.0+).
+type clientConfigV1 struct {
+	ServerAddr string             `json:"serverAddr" toml:"serverAddr"`
+	ServerPort int                `json:"serverPort" toml:"serverPort"`
+	Auth       *authConfigV1      `json:"auth,omitempty" toml:"auth,omitempty"`
+	WebServer  *webServerConfigV1 `json:"webServer,omitempty" toml:"webServer,omitempty"`
+	Transport  *transportConfigV1 `json:"transport,omitempty" toml:"transport,omitempty"`
+	Proxies    []proxyConfigV1    `json:"proxies,omitempty" toml:"proxies,omitempty"`
+	Visitors   []visitorConfigV1  `json:"visitors,omitempty" toml:"visitors,omitempty"`
+}
+
+func (c *FrpcConfig) toClientConfigV1() *clientConfigV1 {
+	config := &clientConfigV1{}
+
+	if common := c.Common; common != nil {
+		config.ServerAddr = common.ServerAddr
+		config.ServerPort = common.ServerPort
+		if common.Token != "" || common.AuthenticationMethod != "" ||
+			common.AuthenticateHeartbeats || common.AuthenticateNewWorkConns {
+			config.Auth = &authConfigV1{Method: common.AuthenticationMethod, Token: common.Token}
+			if config.Auth.Method == "" && common.Token != "" {
+				config.Auth.Method = AuthenticationMethodToken
+			}
+			if common.AuthenticateHeartbeats {
+				config.Auth.AdditionalScopes = append(config.Auth.AdditionalScopes, authScopeHeartBeatsV1)
+			}
+			if common.AuthenticateNewWorkConns {
+				config.Auth.AdditionalScopes = append(config.Auth.AdditionalScopes, authScopeNewWorkConnsV1)
+			}
+			if config.Auth.Method == AuthenticationMethodOIDC {
+				config.Auth.OIDC = &oidcClientConfigV1{
+					ClientID:         common.OIDCClientID,
+					ClientSecret:     common.OIDCClientSecret,
+					Audience:         common.OIDCAudience,
+					Scope:            common.OIDCScope,
+					TokenEndpointURL: common.OIDCTokenEndpointURL,
+				}
+			}
+		}
+		if common.AdminPort != 0 {
+			config.WebServer = &webServerConfigV1{
+				Addr:     common.AdminAddr,
+				Port:     common.AdminPort,
+				User:     common.AdminUser,
+				Password: common.AdminPwd,
+			}
+		}
+		if common.TLSEnable != nil || common.TLSCertFile != "" || common.TLSKeyFile != "" ||
+			common.TLSTrustedCaFile != "" || common.TLSServerName != "" {
+			config.transport().TLS = &tlsConfigV1{
+				Enable:        common.TLSEnable,
+				CertFile:      common.TLSCertFile,
+				KeyFile:       common.TLSKeyFile,
+				TrustedCaFile: common.TLSTrustedCaFile,
+				ServerName:    common.TLSServerName,
+			}
+		}
+		if common.Protocol != "" || common.TCPMux != nil || common.PoolCount != 0 ||
+			common.HeartbeatInterval != 0 || common.HeartbeatTimeout != 0 ||
+			common.DialServerTimeout != 0 || common.HTTPProxy != "" {
+			transport := config.transport()
+			transport.Protocol = common.Protocol
+			transport.TCPMux = common.TCPMux
+			transport.PoolCount = common.PoolCount
+			transport.HeartbeatInterval = common.HeartbeatInterval
+			transport.HeartbeatTimeout = common.HeartbeatTimeout
+			transport.DialServerTimeout = common.DialServerTimeout
+			transport.ProxyURL = common.HTTPProxy
+		}
+	}
+
+	// ensure proxies are sorted
+	var appNames []string
+	for appName := range c.Apps {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+
+	for _, appName := range appNames {
+		app := c.Apps[appName]
+		proxy := proxyConfigV1{
+			Name:              appName,
+			Type:              app.Type,
+			LocalIP:           app.LocalAddr,
+			LocalPort:         app.LocalPort,
+			RemotePort:        app.RemotePort,
+			CustomDomains:     app.CustomDomains,
+			SubDomain:         app.SubDomain,
+			Locations:         app.Locations,
+			HostHeaderRewrite: app.HostHeaderRewrite,
+			HTTPUser:          app.HTTPUser,
+			HTTPPassword:      app.HTTPPwd,
+			SecretKey:         app.SK,
+		}
+		if len(app.Headers) > 0 {
+			proxy.RequestHeaders = &headerOperationsV1{Set: app.Headers}
+		}
+		if app.UseEncryption || app.UseCompression || app.BandwidthLimit != "" || app.BandwidthLimitMode != "" ||
+			app.ProxyProtocolVersion != "" {
+			proxy.Transport = &proxyTransportConfigV1{
+				UseEncryption:        app.UseEncryption,
+				UseCompression:       app.UseCompression,
+				BandwidthLimit:       app.BandwidthLimit,
+				BandwidthLimitMode:   app.BandwidthLimitMode,
+				ProxyProtocolVersion: app.ProxyProtocolVersion,
+			}
+		}
+		if app.Group != "" {
+			proxy.LoadBalancer = &loadBalancerConfigV1{Group: app.Group, GroupKey: app.GroupKey}
+		}
+		config.Proxies = append(config.Proxies, proxy)
+	}
+
+	// ensure visitors are sorted
+	var visitorNames []string
+	for visitorName := range c.Visitors {
+		visitorNames = append(visitorNames, visitorName)
+	}
+	sort.Strings(visitorNames)
+
+	for _, visitorName := range visitorNames {
+		visitor := c.Visitors[visitorName]
+		config.Visitors = append(config.Visitors, visitorConfigV1{
+			Name:       visitorName,
+			Type:       visitor.Type,
+			ServerName: visitor.ServerName,
+			SecretKey:  visitor.SK,
+			BindAddr:   visitor.BindAddr,
+			BindPort:   visitor.BindPort,
+		})
+	}
+
+	return config
+}
+
+// transport returns the transport settings, which are created on demand.
+func (c *clientConfigV1) transport() *transportConfigV1 {
+	if c.Transport == nil {
+		c.Transport = &transportConfigV1{}
+	}
+	return c.Transport
+}
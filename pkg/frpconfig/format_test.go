@@ -0,0 +1,350 @@
+package frpconfig
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestFrpcConfig() *FrpcConfig {
+	return &FrpcConfig{
+		Common: &ConfigCommon{
+			ServerAddr: "127.0.0.1",
+			ServerPort: 7000,
+			Token:      "foobar",
+			AdminAddr:  "0.0.0.0",
+			AdminPort:  7400,
+			AdminUser:  "admin",
+			AdminPwd:   "password",
+		},
+		Apps: map[string]*ConfigApp{
+			"web_http": {
+				Type:          "http",
+				LocalPort:     80,
+				LocalAddr:     "10.0.0.1",
+				CustomDomains: []string{"a.example.com"},
+				Locations:     []string{"/api"},
+				Headers: map[string]string{
+					"X-From-Where": "frp",
+				},
+			},
+			"ssh_tcp": {
+				Type:       "tcp",
+				RemotePort: 2222,
+				LocalPort:  22,
+				LocalAddr:  "10.0.0.2",
+			},
+		},
+		Visitors: map[string]*ConfigVisitor{
+			"db.visitor": {
+				Type:       "stcp",
+				Role:       RoleVisitor,
+				ServerName: "db_stcp",
+				SK:         "secret",
+				BindAddr:   "0.0.0.0",
+				BindPort:   5432,
+			},
+		},
+	}
+}
+
+func TestFrpcConfig_GenerateTOML(t *testing.T) {
+	content, err := newTestFrpcConfig().Generate(FormatTOML)
+	if err != nil {
+		t.Fatalf("generate toml: %v", err)
+	}
+
+	expected := `serverAddr = "127.0.0.1"
+serverPort = 7000
+
+[auth]
+method = "token"
+token = "foobar"
+
+[webServer]
+addr = "0.0.0.0"
+port = 7400
+user = "admin"
+password = "password"
+
+[[proxies]]
+name = "ssh_tcp"
+type = "tcp"
+localIP = "10.0.0.2"
+localPort = 22
+remotePort = 2222
+
+[[proxies]]
+name = "web_http"
+type = "http"
+localIP = "10.0.0.1"
+localPort = 80
+customDomains = ["a.example.com"]
+locations = ["/api"]
+[proxies.requestHeaders]
+[proxies.requestHeaders.set]
+X-From-Where = "frp"
+
+[[visitors]]
+name = "db.visitor"
+type = "stcp"
+serverName = "db_stcp"
+secretKey = "secret"
+bindAddr = "0.0.0.0"
+bindPort = 5432
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestFrpcConfig_GenerateYAML(t *testing.T) {
+	c := newTestFrpcConfig()
+	c.Apps = map[string]*ConfigApp{
+		"ssh_tcp": c.Apps["ssh_tcp"],
+	}
+	c.Visitors = nil
+
+	content, err := c.Generate(FormatYAML)
+	if err != nil {
+		t.Fatalf("generate yaml: %v", err)
+	}
+
+	expected := `auth:
+  method: token
+  token: foobar
+proxies:
+- localIP: 10.0.0.2
+  localPort: 22
+  name: ssh_tcp
+  remotePort: 2222
+  type: tcp
+serverAddr: 127.0.0.1
+serverPort: 7000
+webServer:
+  addr: 0.0.0.0
+  password: password
+  port: 7400
+  user: admin
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestFrpcConfig_GenerateJSON(t *testing.T) {
+	c := newTestFrpcConfig()
+	c.Common.Token = ""
+	c.Common.AdminPort = 0
+	c.Apps = map[string]*ConfigApp{
+		"ssh_tcp": c.Apps["ssh_tcp"],
+	}
+	c.Visitors = nil
+
+	content, err := c.Generate(FormatJSON)
+	if err != nil {
+		t.Fatalf("generate json: %v", err)
+	}
+
+	expected := `{
+  "serverAddr": "127.0.0.1",
+  "serverPort": 7000,
+  "proxies": [
+    {
+      "name": "ssh_tcp",
+      "type": "tcp",
+      "localIP": "10.0.0.2",
+      "localPort": 22,
+      "remotePort": 2222
+    }
+  ]
+}
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestFrpcConfig_Generate_UnsupportedFormat(t *testing.T) {
+	if _, err := newTestFrpcConfig().Generate(Format("xml")); err == nil {
+		t.Errorf("expected error for unsupported format")
+	}
+}
+
+func TestFrpcConfig_GenerateTOML_TLS(t *testing.T) {
+	tlsEnable := false
+	c := &FrpcConfig{
+		Common: &ConfigCommon{
+			ServerAddr: "127.0.0.1",
+			ServerPort: 7000,
+			TLSEnable:  &tlsEnable,
+		},
+	}
+
+	content, err := c.Generate(FormatTOML)
+	if err != nil {
+		t.Fatalf("generate toml: %v", err)
+	}
+
+	expected := `serverAddr = "127.0.0.1"
+serverPort = 7000
+
+[transport]
+[transport.tls]
+enable = false
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestFrpcConfig_GenerateTOML_Transport(t *testing.T) {
+	tcpMux := true
+	c := &FrpcConfig{
+		Common: &ConfigCommon{
+			ServerAddr:        "127.0.0.1",
+			ServerPort:        7000,
+			Protocol:          "tcp",
+			TCPMux:            &tcpMux,
+			HeartbeatInterval: 10,
+			HeartbeatTimeout:  30,
+			HTTPProxy:         "http://192.168.1.128:8080",
+		},
+	}
+
+	content, err := c.Generate(FormatTOML)
+	if err != nil {
+		t.Fatalf("generate toml: %v", err)
+	}
+
+	expected := `serverAddr = "127.0.0.1"
+serverPort = 7000
+
+[transport]
+proxyURL = "http://192.168.1.128:8080"
+tcpMux = true
+protocol = "tcp"
+heartbeatInterval = 10
+heartbeatTimeout = 30
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestFrpcConfig_GenerateTOML_OIDC(t *testing.T) {
+	c := &FrpcConfig{
+		Common: &ConfigCommon{
+			ServerAddr:             "127.0.0.1",
+			ServerPort:             7000,
+			AuthenticationMethod:   AuthenticationMethodOIDC,
+			AuthenticateHeartbeats: true,
+			OIDCClientID:           "frpc",
+			OIDCClientSecret:       "secret",
+			OIDCScope:              "frp",
+			OIDCTokenEndpointURL:   "https://idp.example.com/oauth2/token",
+		},
+	}
+
+	content, err := c.Generate(FormatTOML)
+	if err != nil {
+		t.Fatalf("generate toml: %v", err)
+	}
+
+	expected := `serverAddr = "127.0.0.1"
+serverPort = 7000
+
+[auth]
+method = "oidc"
+additionalScopes = ["HeartBeats"]
+[auth.oidc]
+clientID = "frpc"
+clientSecret = "secret"
+scope = "frp"
+tokenEndpointURL = "https://idp.example.com/oauth2/token"
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestFrpcConfig_GenerateTOML_AppTransport(t *testing.T) {
+	c := &FrpcConfig{
+		Common: &ConfigCommon{
+			ServerAddr: "127.0.0.1",
+			ServerPort: 7000,
+		},
+		Apps: map[string]*ConfigApp{
+			"db_tcp": {
+				Type:           "tcp",
+				RemotePort:     5432,
+				LocalPort:      5432,
+				LocalAddr:      "10.0.0.3",
+				UseEncryption:  true,
+				BandwidthLimit: "512KB",
+			},
+		},
+	}
+
+	content, err := c.Generate(FormatTOML)
+	if err != nil {
+		t.Fatalf("generate toml: %v", err)
+	}
+
+	expected := `serverAddr = "127.0.0.1"
+serverPort = 7000
+
+[[proxies]]
+name = "db_tcp"
+type = "tcp"
+localIP = "10.0.0.3"
+localPort = 5432
+remotePort = 5432
+[proxies.transport]
+useEncryption = true
+bandwidthLimit = "512KB"
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+func TestFrpcConfig_GenerateTOML_Group(t *testing.T) {
+	c := &FrpcConfig{
+		Common: &ConfigCommon{
+			ServerAddr: "127.0.0.1",
+			ServerPort: 7000,
+		},
+		Apps: map[string]*ConfigApp{
+			"ssh_22@{{ .Envs.FRPC_POD_NAME }}": {
+				Type:       "tcp",
+				RemotePort: 2222,
+				LocalPort:  22,
+				LocalAddr:  "10.0.0.1",
+				Group:      "ssh_22",
+				GroupKey:   "secret",
+			},
+		},
+	}
+
+	content, err := c.Generate(FormatTOML)
+	if err != nil {
+		t.Fatalf("generate toml: %v", err)
+	}
+
+	expected := `serverAddr = "127.0.0.1"
+serverPort = 7000
+
+[[proxies]]
+name = "ssh_22@{{ .Envs.FRPC_POD_NAME }}"
+type = "tcp"
+localIP = "10.0.0.1"
+localPort = 22
+remotePort = 2222
+[proxies.loadBalancer]
+group = "ssh_22"
+groupKey = "secret"
+`
+	if strings.TrimSpace(content) != strings.TrimSpace(expected) {
+		t.Errorf("unexpected content:\n%s\nexpected:\n%s", content, expected)
+	}
+}
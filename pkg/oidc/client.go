@@ -0,0 +1,96 @@
+// Package oidc implements the OIDC client credentials grant used by frpc,
+// for verifying the OIDC settings of the endpoints.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client requests tokens from an OIDC token endpoint with client credentials,
+// the same way frpc does (`authentication_method = oidc`).
+type Client struct {
+	// TokenEndpointURL specifies the token endpoint (oidc_token_endpoint_url).
+	TokenEndpointURL string
+	// ClientID specifies the client id (oidc_client_id).
+	ClientID string
+	// ClientSecret specifies the client secret (oidc_client_secret).
+	ClientSecret string
+	// Audience specifies the audience of the token (oidc_audience).
+	Audience string
+	// Scope specifies the scope of the token (oidc_scope).
+	Scope string
+	// HTTPClient specifies the http client to use, defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// tokenResponse is the token endpoint response defined by RFC 6749.
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Token requests an access token with the client credentials.
+func (c *Client) Token(ctx context.Context) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if c.Audience != "" {
+		form.Set("audience", c.Audience)
+	}
+	if c.Scope != "" {
+		form.Set("scope", c.Scope)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, c.TokenEndpointURL,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(respBody, &token); err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("parse token response: %w", err)
+	}
+	switch {
+	case token.Error != "" && token.ErrorDescription != "":
+		return "", fmt.Errorf("token endpoint error %s: %s", token.Error, token.ErrorDescription)
+	case token.Error != "":
+		return "", fmt.Errorf("token endpoint error %s", token.Error)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf(
+			"token endpoint: unexpected status %d: %s",
+			resp.StatusCode, strings.TrimSpace(string(respBody)),
+		)
+	case token.AccessToken == "":
+		return "", fmt.Errorf("token endpoint returned no access token")
+	}
+
+	return token.AccessToken, nil
+}
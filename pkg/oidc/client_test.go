@@ -0,0 +1,105 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestTokenEndpoint starts a token endpoint stand-in accepting the given client credentials.
+func newTestTokenEndpoint(clientID string, clientSecret string) (*httptest.Server, *[]string) {
+	var audiences []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost || r.URL.Path != "/oauth2/token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "unsupported_grant_type"})
+			return
+		}
+		user, password, ok := r.BasicAuth()
+		if !ok || user != clientID || password != clientSecret {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"error":             "invalid_client",
+				"error_description": "client authentication failed",
+			})
+			return
+		}
+		audiences = append(audiences, r.PostForm.Get("audience"))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	return server, &audiences
+}
+
+func TestClient_Token(t *testing.T) {
+	server, audiences := newTestTokenEndpoint("frpc", "secret")
+	defer server.Close()
+
+	c := &Client{
+		TokenEndpointURL: server.URL + "/oauth2/token",
+		ClientID:         "frpc",
+		ClientSecret:     "secret",
+		Audience:         "frps",
+	}
+	token, err := c.Token(context.Background())
+	if err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	if token != "access-token" {
+		t.Errorf("unexpected token: %s", token)
+	}
+	if len(*audiences) != 1 || (*audiences)[0] != "frps" {
+		t.Errorf("unexpected audiences received: %v", *audiences)
+	}
+}
+
+func TestClient_Token_InvalidClient(t *testing.T) {
+	server, _ := newTestTokenEndpoint("frpc", "secret")
+	defer server.Close()
+
+	c := &Client{
+		TokenEndpointURL: server.URL + "/oauth2/token",
+		ClientID:         "frpc",
+		ClientSecret:     "wrong",
+	}
+	_, err := c.Token(context.Background())
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "invalid_client") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestClient_Token_NotFound(t *testing.T) {
+	server, _ := newTestTokenEndpoint("frpc", "secret")
+	defer server.Close()
+
+	c := &Client{
+		TokenEndpointURL: server.URL + "/token",
+		ClientID:         "frpc",
+		ClientSecret:     "secret",
+	}
+	_, err := c.Token(context.Background())
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !strings.Contains(err.Error(), "unexpected status 404") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+// Package portalloc allocates ports from port ranges.
+package portalloc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PortRange describes a range of ports, both ends included.
+type PortRange struct {
+	From int32
+	To   int32
+}
+
+// ParseRanges parses port ranges in `30000-30100,31000` format.
+func ParseRanges(s string) ([]PortRange, error) {
+	var ranges []PortRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		var (
+			portRange PortRange
+			err       error
+		)
+		bounds := strings.SplitN(part, "-", 2)
+		portRange.From, err = parsePort(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		portRange.To = portRange.From
+		if len(bounds) == 2 {
+			portRange.To, err = parsePort(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		if portRange.From > portRange.To {
+			return nil, fmt.Errorf("invalid port range: %s", part)
+		}
+
+		ranges = append(ranges, portRange)
+	}
+
+	return ranges, nil
+}
+
+func parsePort(s string) (int32, error) {
+	port, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid port: %s", s)
+	}
+	if port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("port should be in range 1-65535: %d", port)
+	}
+	return int32(port), nil
+}
+
+// Allocator allocates ports from the port ranges.
+type Allocator struct {
+	ranges []PortRange
+	used   map[int32]bool
+}
+
+// NewAllocator creates an allocator with the port ranges.
+func NewAllocator(ranges []PortRange) *Allocator {
+	return &Allocator{
+		ranges: ranges,
+		used:   map[int32]bool{},
+	}
+}
+
+// Contains tells if the port is in the port ranges.
+func (a *Allocator) Contains(port int32) bool {
+	for _, portRange := range a.ranges {
+		if portRange.From <= port && port <= portRange.To {
+			return true
+		}
+	}
+	return false
+}
+
+// Use marks the port as used, the port can be out of the port ranges.
+// Returns false if the port has been used.
+func (a *Allocator) Use(port int32) bool {
+	if a.used[port] {
+		return false
+	}
+	a.used[port] = true
+	return true
+}
+
+// Allocate allocates the lowest unused port in the port ranges.
+// Returns false if all ports have been used.
+func (a *Allocator) Allocate() (int32, bool) {
+	for _, portRange := range a.ranges {
+		for port := portRange.From; port <= portRange.To; port++ {
+			if a.Use(port) {
+				return port, true
+			}
+		}
+	}
+	return 0, false
+}
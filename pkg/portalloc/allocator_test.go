@@ -0,0 +1,56 @@
+package portalloc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRanges(t *testing.T) {
+	ranges, err := ParseRanges("30000-30002, 31000")
+	if err != nil {
+		t.Fatalf("parse ranges: %v", err)
+	}
+	expected := []PortRange{
+		{From: 30000, To: 30002},
+		{From: 31000, To: 31000},
+	}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Errorf("unexpected ranges: %+v", ranges)
+	}
+
+	for _, s := range []string{"foo", "30002-30000", "0-10", "1-70000"} {
+		if _, err := ParseRanges(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestAllocator(t *testing.T) {
+	a := NewAllocator([]PortRange{
+		{From: 30000, To: 30001},
+		{From: 31000, To: 31000},
+	})
+
+	if !a.Contains(30001) || a.Contains(30002) {
+		t.Errorf("unexpected contains result")
+	}
+	if !a.Use(30000) {
+		t.Errorf("30000 should be unused")
+	}
+	if a.Use(30000) {
+		t.Errorf("30000 should be used")
+	}
+	if !a.Use(2222) {
+		t.Errorf("out of range port should be usable")
+	}
+
+	for _, expected := range []int32{30001, 31000} {
+		port, ok := a.Allocate()
+		if !ok || port != expected {
+			t.Errorf("expected %d, got %d (%v)", expected, port, ok)
+		}
+	}
+	if _, ok := a.Allocate(); ok {
+		t.Errorf("ports should be exhausted")
+	}
+}